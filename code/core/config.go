@@ -1,6 +1,9 @@
 package core
 
-import "gorm.io/gorm/schema"
+import (
+	"github.com/eyebluecn/tank/code/tool/storage"
+	"gorm.io/gorm/schema"
+)
 
 const (
 	//authentication key of cookie
@@ -28,6 +31,8 @@ type Config interface {
 	SqliteFolder() string
 	//files storage location.
 	MatterPath() string
+	//storage backends configured in tank.json. key is the backend's name.
+	StorageBackends() map[string]*storage.BackendConfig
 	//table name strategy
 	NamingStrategy() schema.NamingStrategy
 	//when installed by user. Write configs to tank.json
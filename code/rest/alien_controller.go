@@ -12,16 +12,18 @@ import (
 
 type AlienController struct {
 	BaseController
-	uploadTokenDao     *UploadTokenDao
-	downloadTokenDao   *DownloadTokenDao
-	matterDao          *MatterDao
-	spaceDao           *SpaceDao
-	matterService      *MatterService
-	imageCacheDao      *ImageCacheDao
-	imageCacheService  *ImageCacheService
-	alienService       *AlienService
-	shareService       *ShareService
-	spaceMemberService *SpaceMemberService
+	uploadTokenDao       *UploadTokenDao
+	downloadTokenDao     *DownloadTokenDao
+	matterDao            *MatterDao
+	spaceDao             *SpaceDao
+	matterService        *MatterService
+	imageCacheDao        *ImageCacheDao
+	imageCacheService    *ImageCacheService
+	alienService         *AlienService
+	shareService         *ShareService
+	spaceMemberService   *SpaceMemberService
+	uploadSessionDao     *UploadSessionDao
+	uploadSessionService *UploadSessionService
 }
 
 func (this *AlienController) Init() {
@@ -76,6 +78,16 @@ func (this *AlienController) Init() {
 	if b, ok := b.(*SpaceMemberService); ok {
 		this.spaceMemberService = b
 	}
+
+	b = core.CONTEXT.GetBean(this.uploadSessionDao)
+	if b, ok := b.(*UploadSessionDao); ok {
+		this.uploadSessionDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.uploadSessionService)
+	if b, ok := b.(*UploadSessionService); ok {
+		this.uploadSessionService = b
+	}
 }
 
 func (this *AlienController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
@@ -86,6 +98,10 @@ func (this *AlienController) RegisterRoutes() map[string]func(writer http.Respon
 	routeMap["/api/alien/fetch/download/token"] = this.Wrap(this.FetchDownloadToken, USER_ROLE_USER)
 	routeMap["/api/alien/confirm"] = this.Wrap(this.Confirm, USER_ROLE_USER)
 	routeMap["/api/alien/upload"] = this.Wrap(this.Upload, USER_ROLE_GUEST)
+	routeMap["/api/alien/upload/init"] = this.Wrap(this.UploadInit, USER_ROLE_GUEST)
+	routeMap["/api/alien/upload/append"] = this.Wrap(this.UploadAppend, USER_ROLE_GUEST)
+	routeMap["/api/alien/upload/finish"] = this.Wrap(this.UploadFinish, USER_ROLE_GUEST)
+	routeMap["/api/alien/upload/detail"] = this.Wrap(this.UploadDetail, USER_ROLE_GUEST)
 	routeMap["/api/alien/crawl/token"] = this.Wrap(this.CrawlToken, USER_ROLE_GUEST)
 	routeMap["/api/alien/crawl/direct"] = this.Wrap(this.CrawlDirect, USER_ROLE_USER)
 
@@ -244,7 +260,7 @@ func (this *AlienController) Upload(writer http.ResponseWriter, request *http.Re
 
 	dirMatter := this.matterDao.CheckWithRootByUuid(uploadToken.FolderUuid, space)
 
-	matter := this.matterService.Upload(request, file, handler, user, space, dirMatter, uploadToken.Filename, uploadToken.Privacy)
+	matter := this.matterService.AtomicUpload(request, file, handler, user, space, dirMatter, uploadToken.Filename, uploadToken.Privacy)
 
 	//expire the upload token.
 	uploadToken.ExpireTime = time.Now()
@@ -253,6 +269,104 @@ func (this *AlienController) Upload(writer http.ResponseWriter, request *http.Re
 	return this.Success(matter)
 }
 
+// a guest init a resumable upload with a upload token.
+func (this *AlienController) UploadInit(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+	//allow cors.
+	this.allowCORS(writer)
+	if request.Method == "OPTIONS" {
+		//nil means empty response body.
+		return nil
+	}
+
+	uploadTokenUuid := util.ExtractRequestString(request, "uploadTokenUuid")
+	size := util.ExtractRequestInt64(request, "size")
+
+	uploadToken := this.uploadTokenDao.CheckByUuid(uploadTokenUuid)
+	if uploadToken.ExpireTime.Before(time.Now()) {
+		panic(result.BadRequest("uploadToken has expired"))
+	}
+
+	if size != uploadToken.Size {
+		panic(result.BadRequest("file size doesn't the one in uploadToken"))
+	}
+
+	user := this.userDao.CheckByUuid(uploadToken.UserUuid)
+	space := this.spaceDao.CheckByUuid(user.SpaceUuid)
+	dirMatter := this.matterDao.CheckWithRootByUuid(uploadToken.FolderUuid, space)
+
+	session := this.uploadSessionService.Create(request, user, space, dirMatter, uploadToken.Filename, uploadToken.Size, uploadToken.Privacy, uploadToken)
+
+	return this.Success(session)
+}
+
+// check the upload session is created by the upload token.
+func (this *AlienController) checkUploadSession(request *http.Request) *UploadSession {
+
+	uploadTokenUuid := util.ExtractRequestString(request, "uploadTokenUuid")
+	uuid := util.ExtractRequestString(request, "uuid")
+
+	session := this.uploadSessionDao.CheckByUuid(uuid)
+	if session.UploadTokenUuid != uploadTokenUuid {
+		panic(result.UNAUTHORIZED)
+	}
+
+	uploadToken := this.uploadTokenDao.CheckByUuid(uploadTokenUuid)
+	if uploadToken.ExpireTime.Before(time.Now()) {
+		panic(result.BadRequest("uploadToken has expired"))
+	}
+	return session
+}
+
+// a guest append a chunk to the resumable upload.
+func (this *AlienController) UploadAppend(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+	//allow cors.
+	this.allowCORS(writer)
+	if request.Method == "OPTIONS" {
+		//nil means empty response body.
+		return nil
+	}
+
+	session := this.checkUploadSession(request)
+	offset := util.ExtractRequestInt64(request, "offset")
+
+	reader, closeReader := ExtractChunkReader(request)
+	defer closeReader()
+
+	session = this.uploadSessionService.Append(request, session, offset, reader)
+
+	return this.Success(session)
+}
+
+// a guest finish the resumable upload. the upload token will be expired.
+func (this *AlienController) UploadFinish(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+	//allow cors.
+	this.allowCORS(writer)
+	if request.Method == "OPTIONS" {
+		//nil means empty response body.
+		return nil
+	}
+
+	session := this.checkUploadSession(request)
+
+	matter := this.uploadSessionService.Finish(request, session)
+
+	return this.Success(matter)
+}
+
+// a guest get the offset of the resumable upload.
+func (this *AlienController) UploadDetail(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+	//allow cors.
+	this.allowCORS(writer)
+	if request.Method == "OPTIONS" {
+		//nil means empty response body.
+		return nil
+	}
+
+	session := this.checkUploadSession(request)
+
+	return this.Success(session)
+}
+
 // crawl a url with uploadToken. guest can visit this method.
 func (this *AlienController) CrawlToken(writer http.ResponseWriter, request *http.Request) *result.WebResult {
 
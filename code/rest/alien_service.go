@@ -20,6 +20,7 @@ type AlienService struct {
 	imageCacheDao     *ImageCacheDao
 	imageCacheService *ImageCacheService
 	spaceService      *SpaceService
+	recentService     *RecentService
 }
 
 func (this *AlienService) Init() {
@@ -68,6 +69,11 @@ func (this *AlienService) Init() {
 	if c, ok := b.(*SpaceService); ok {
 		this.spaceService = c
 	}
+
+	b = core.CONTEXT.GetBean(this.recentService)
+	if c, ok := b.(*RecentService); ok {
+		this.recentService = c
+	}
 }
 
 // check whether the request params ok.
@@ -155,7 +161,7 @@ func (this *AlienService) PreviewOrDownload(
 			this.matterService.DownloadFile(writer, request, GetSpaceCacheRootDir(imageCache.Username)+imageCache.Path, imageCache.Name, withContentDisposition)
 
 		} else {
-			this.matterService.DownloadFile(writer, request, matter.AbsolutePath(), matter.Name, withContentDisposition)
+			this.matterService.DownloadMatter(writer, request, matter, withContentDisposition)
 		}
 
 	}
@@ -164,4 +170,10 @@ func (this *AlienService) PreviewOrDownload(
 	go core.RunWithRecovery(func() {
 		this.matterDao.TimesIncrement(matter.Uuid)
 	})
+
+	if withContentDisposition {
+		this.recentService.Record(this.findUser(request), matter, RECENT_MODE_DOWNLOAD)
+	} else {
+		this.recentService.Record(this.findUser(request), matter, RECENT_MODE_VIEW)
+	}
 }
@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type BlobDao struct {
+	BaseDao
+}
+
+// find by uuid. if not found return nil.
+func (this *BlobDao) FindByUuid(uuid string) *Blob {
+	var entity = &Blob{}
+	db := core.CONTEXT.GetDB().Where("uuid = ?", uuid).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+// find by backend and sha256. if not found return nil.
+func (this *BlobDao) FindBySha256(backend string, sha256 string) *Blob {
+	var entity = &Blob{}
+	db := core.CONTEXT.GetDB().Where("backend = ? AND sha256 = ?", backend, sha256).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+func (this *BlobDao) Create(blob *Blob) *Blob {
+
+	timeUUID, _ := uuid.NewV4()
+	blob.Uuid = string(timeUUID.String())
+	blob.CreateTime = time.Now()
+	blob.UpdateTime = time.Now()
+	blob.Sort = time.Now().UnixNano() / 1e6
+	db := core.CONTEXT.GetDB().Create(blob)
+	this.PanicError(db.Error)
+
+	return blob
+}
+
+func (this *BlobDao) Save(blob *Blob) *Blob {
+
+	blob.UpdateTime = time.Now()
+	db := core.CONTEXT.GetDB().Save(blob)
+	this.PanicError(db.Error)
+
+	return blob
+}
+
+// change the reference count by delta.
+func (this *BlobDao) UpdateRefCount(uuid string, delta int64) {
+	db := core.CONTEXT.GetDB().Model(&Blob{}).Where("uuid = ?", uuid).Updates(map[string]interface{}{
+		"ref_count":   gorm.Expr("ref_count + ?", delta),
+		"update_time": time.Now(),
+	})
+	this.PanicError(db.Error)
+}
+
+// release the references in refTable matching the condition on alias r, in one statement whatever the number of references.
+func (this *BlobDao) ReleaseByRefs(refTable string, refWp *builder.WherePair) {
+
+	blobTable := fmt.Sprintf("`%sblob`", core.TABLE_PREFIX)
+	refs := fmt.Sprintf("FROM %s AS r WHERE %s AND r.backend = %s.backend AND r.sha256 = %s.sha256", refTable, refWp.Query, blobTable, blobTable)
+
+	db := core.CONTEXT.GetDB().Model(&Blob{}).
+		Where("EXISTS (SELECT 1 "+refs+")", refWp.Args...).
+		Updates(map[string]interface{}{
+			"ref_count":   gorm.Expr("ref_count - (SELECT COUNT(*) "+refs+")", refWp.Args...),
+			"update_time": time.Now(),
+		})
+	this.PanicError(db.Error)
+}
+
+// the blobs without any reference.
+func (this *BlobDao) FindUnreferenced() []*Blob {
+	var blobs []*Blob
+	db := core.CONTEXT.GetDB().Where("ref_count <= ?", 0).Find(&blobs)
+	this.PanicError(db.Error)
+	return blobs
+}
+
+func (this *BlobDao) Delete(blob *Blob) {
+
+	db := core.CONTEXT.GetDB().Delete(&blob)
+	this.PanicError(db.Error)
+}
+
+// System cleanup.
+func (this *BlobDao) Cleanup() {
+	this.logger.Info("[BlobDao] clean up. Delete all Blob")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(Blob{})
+	this.PanicError(db.Error)
+}
@@ -0,0 +1,50 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"time"
+)
+
+const (
+	//content addressed blob store directory. see USERNAME_PATTERN for the reserved directories.
+	BLOB_STORE = "blob-store"
+	//temp directory for the blob being written.
+	BLOB_TMP = "tmp"
+)
+
+/**
+ * content addressed blob. identical content across spaces is stored only once in each storage backend.
+ * a non dir matter with Sha256 is stored in the blob store, otherwise in the space's root dir.
+ */
+type Blob struct {
+	Uuid       string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort       int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	Backend    string    `json:"backend" gorm:"type:varchar(45) not null;default:'';uniqueIndex:idx_blob_sha256"`
+	Sha256     string    `json:"sha256" gorm:"type:char(64) not null;uniqueIndex:idx_blob_sha256"`
+	Md5        string    `json:"md5" gorm:"type:varchar(45) not null;index:idx_blob_md5"`
+	Size       int64     `json:"size" gorm:"type:bigint(20) not null;default:0"`
+	RefCount   int64     `json:"refCount" gorm:"type:bigint(20) not null;default:0"`
+}
+
+// get blob's key in the storage backend.
+func (this *Blob) Key() string {
+	return GetBlobKey(this.Sha256)
+}
+
+// get the blob store's absolute path
+func GetBlobRootDir() string {
+	return fmt.Sprintf("%s/%s", core.CONFIG.MatterPath(), BLOB_STORE)
+}
+
+// get the blob store's temp absolute path
+func GetBlobTmpDir() string {
+	return fmt.Sprintf("%s/%s", GetBlobRootDir(), BLOB_TMP)
+}
+
+// blobs are spread into sub directories by the prefix of sha256. eg. blob-store/ab/cd/abcd....
+func GetBlobKey(sha256 string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", BLOB_STORE, sha256[0:2], sha256[2:4], sha256)
+}
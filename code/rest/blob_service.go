@@ -0,0 +1,302 @@
+package rest
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/storage"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// compute md5 and sha256 at the same time.
+type BlobHasher struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+}
+
+func NewBlobHasher() *BlobHasher {
+	return &BlobHasher{
+		md5:    md5.New(),
+		sha256: sha256.New(),
+	}
+}
+
+// restore a hasher from the state. state comes from MarshalState()
+func RestoreBlobHasher(state string) *BlobHasher {
+	hasher := NewBlobHasher()
+	if state == "" {
+		return hasher
+	}
+
+	parts := strings.Split(state, ".")
+	if len(parts) != 2 {
+		panic(result.BadRequest("hash state error"))
+	}
+
+	for i, h := range []hash.Hash{hasher.md5, hasher.sha256} {
+		bytes, err := base64.StdEncoding.DecodeString(parts[i])
+		core.PanicError(err)
+		err = h.(encoding.BinaryUnmarshaler).UnmarshalBinary(bytes)
+		core.PanicError(err)
+	}
+
+	return hasher
+}
+
+func (this *BlobHasher) Write(p []byte) (int, error) {
+	this.md5.Write(p)
+	this.sha256.Write(p)
+	return len(p), nil
+}
+
+func (this *BlobHasher) Md5() string {
+	return hex.EncodeToString(this.md5.Sum(nil))
+}
+
+func (this *BlobHasher) Sha256() string {
+	return hex.EncodeToString(this.sha256.Sum(nil))
+}
+
+// marshal the intermediate state. so that hashing can be continued later.
+func (this *BlobHasher) MarshalState() string {
+	var parts []string
+	for _, h := range []hash.Hash{this.md5, this.sha256} {
+		bytes, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+		core.PanicError(err)
+		parts = append(parts, base64.StdEncoding.EncodeToString(bytes))
+	}
+	return strings.Join(parts, ".")
+}
+
+// hash the bytes which are really written.
+type HashedWriter struct {
+	Writer io.Writer
+	Hasher *BlobHasher
+}
+
+func (this *HashedWriter) Write(p []byte) (int, error) {
+	n, err := this.Writer.Write(p)
+	this.Hasher.Write(p[:n])
+	return n, err
+}
+
+// content addressed blob store.
+// @Service
+type BlobService struct {
+	BaseBean
+	blobDao        *BlobDao
+	storageService *StorageService
+
+	//protect the reference count.
+	mutex sync.Mutex
+}
+
+func (this *BlobService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.blobDao)
+	if b, ok := b.(*BlobDao); ok {
+		this.blobDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.storageService)
+	if b, ok := b.(*StorageService); ok {
+		this.storageService = b
+	}
+}
+
+// write the reader to a temp file and compute the hashes.
+func (this *BlobService) WriteTmp(reader io.Reader) (tmpPath string, size int64, md5 string, sha256 string) {
+
+	util.MakeDirAll(GetBlobTmpDir())
+	tmpFile, err := ioutil.TempFile(GetBlobTmpDir(), "blob-")
+	this.PanicError(err)
+	tmpPath = tmpFile.Name()
+
+	hasher := NewBlobHasher()
+	size, err = io.Copy(&HashedWriter{Writer: tmpFile, Hasher: hasher}, reader)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		this.removeFile(tmpPath)
+		panic(err)
+	}
+
+	return tmpPath, size, hasher.Md5(), hasher.Sha256()
+}
+
+// compute the hashes of a file.
+func (this *BlobService) HashFile(filePath string) (md5 string, sha256 string) {
+
+	file, err := os.Open(filePath)
+	this.PanicError(err)
+	defer func() {
+		err := file.Close()
+		this.PanicError(err)
+	}()
+
+	hasher := NewBlobHasher()
+	_, err = io.Copy(hasher, file)
+	this.PanicError(err)
+
+	return hasher.Md5(), hasher.Sha256()
+}
+
+// move a file into blob store of the backend with one reference. if the content exists, the file is removed.
+func (this *BlobService) Commit(backendName string, filePath string, md5 string, sha256 string, size int64) *Blob {
+
+	blob := this.Reference(backendName, sha256)
+	if blob != nil {
+		this.removeFile(filePath)
+		return blob
+	}
+
+	//upload out of the mutex, so that a large file doesn't hold up the others. the same content may be uploaded twice, which is harmless.
+	blob = &Blob{
+		Backend:  backendName,
+		Sha256:   sha256,
+		Md5:      md5,
+		Size:     size,
+		RefCount: 1,
+	}
+	backend := this.storageService.Backend(backendName)
+	err := storage.PutFile(backend, blob.Key(), filePath)
+	this.PanicError(err)
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	//the last reference of the same content may be released during the upload, which removes the file uploaded.
+	exists, err := storage.Exists(backend, blob.Key())
+	this.PanicError(err)
+	if !exists {
+		panic(result.BadRequest("blob %s is removed during the upload, please retry.", sha256))
+	}
+
+	dbBlob := this.blobDao.FindBySha256(backendName, sha256)
+	if dbBlob != nil {
+		//committed by another upload just now, or the blob was lost and healed by this upload.
+		this.blobDao.UpdateRefCount(dbBlob.Uuid, 1)
+		dbBlob.RefCount = dbBlob.RefCount + 1
+		return dbBlob
+	}
+
+	return this.blobDao.Create(blob)
+}
+
+// import a content into blob store of the backend. if the content exists, nothing is copied.
+func (this *BlobService) Import(backendName string, reader io.Reader) *Blob {
+
+	tmpPath, size, md5, sha256 := this.WriteTmp(reader)
+	defer this.Discard(tmpPath)
+
+	blob := this.Reference(backendName, sha256)
+	if blob != nil {
+		return blob
+	}
+
+	return this.Commit(backendName, tmpPath, md5, sha256, size)
+}
+
+// add one reference to an existing blob. return nil if not exist.
+func (this *BlobService) Reference(backendName string, sha256 string) *Blob {
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	blob := this.blobDao.FindBySha256(backendName, sha256)
+	if blob == nil {
+		return nil
+	}
+	exists, err := storage.Exists(this.storageService.Backend(backendName), blob.Key())
+	this.PanicError(err)
+	if !exists {
+		return nil
+	}
+
+	this.blobDao.UpdateRefCount(blob.Uuid, 1)
+	blob.RefCount = blob.RefCount + 1
+
+	return blob
+}
+
+// add one reference to the blob matching the size and sha256. md5 is only a hint, checked if not empty. return nil if not exist.
+func (this *BlobService) ReferenceMatch(backendName string, size int64, sha256 string, md5 string) *Blob {
+
+	blob := this.blobDao.FindBySha256(backendName, strings.ToLower(sha256))
+	if blob == nil || blob.Size != size {
+		return nil
+	}
+	if md5 != "" && !strings.EqualFold(md5, blob.Md5) {
+		return nil
+	}
+
+	//the blob may be released just now, so reference it by sha256 again.
+	return this.Reference(backendName, blob.Sha256)
+}
+
+// release one reference. the blob is removed when its last reference goes away.
+func (this *BlobService) Release(backendName string, sha256 string) {
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	blob := this.blobDao.FindBySha256(backendName, sha256)
+	if blob == nil {
+		this.logger.Error("release a not exist blob %s in backend %s", sha256, backendName)
+		return
+	}
+
+	if blob.RefCount > 1 {
+		this.blobDao.UpdateRefCount(blob.Uuid, -1)
+		return
+	}
+
+	this.remove(blob)
+}
+
+// release all the references in refTable matching the condition on alias r. see BlobDao.ReleaseByRefs
+func (this *BlobService) ReleaseByRefs(refTable string, refWp *builder.WherePair) {
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.blobDao.ReleaseByRefs(refTable, refWp)
+	for _, blob := range this.blobDao.FindUnreferenced() {
+		this.remove(blob)
+	}
+}
+
+func (this *BlobService) remove(blob *Blob) {
+	this.logger.Info("blob %s has no reference, delete it.", blob.Sha256)
+	this.blobDao.Delete(blob)
+	err := this.storageService.Backend(blob.Backend).Remove(blob.Key())
+	if err != nil && !os.IsNotExist(err) {
+		this.logger.Error("occur error when deleting blob %s. %v", blob.Sha256, err)
+	}
+}
+
+// delete a temp file if it still exists.
+func (this *BlobService) Discard(tmpPath string) {
+	this.removeFile(tmpPath)
+}
+
+func (this *BlobService) removeFile(filePath string) {
+	err := os.Remove(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		this.logger.Error("occur error when deleting file %s. %v", filePath, err)
+	}
+}
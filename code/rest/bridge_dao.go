@@ -127,6 +127,12 @@ func (this *BridgeDao) DeleteByMatterUuid(matterUuid string) {
 	this.PanicError(db.Error)
 }
 
+func (this *BridgeDao) DeleteByMatterUuidQuery(matterUuidQuery *gorm.DB) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid IN (?)", matterUuidQuery).Delete(Bridge{})
+	this.PanicError(db.Error)
+}
+
 func (this *BridgeDao) DeleteByShareUuid(shareUuid string) {
 
 	var wp = &builder.WherePair{}
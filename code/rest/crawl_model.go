@@ -0,0 +1,41 @@
+package rest
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+)
+
+const (
+	CRAWL_DEFAULT_CONCURRENCY = 3
+	CRAWL_MAX_CONCURRENCY     = JOB_CRAWL_WORKER_NUM
+	CRAWL_DEFAULT_RETRIES     = 3
+	CRAWL_MAX_RETRIES         = 10
+	CRAWL_MAX_REDIRECTS       = 10
+	//wait before the first retry, doubled for each next one.
+	CRAWL_BACKOFF     = 2 * time.Second
+	CRAWL_MAX_BACKOFF = time.Minute
+	//timeout of connecting and waiting for the response header.
+	CRAWL_CONNECT_TIMEOUT = 30 * time.Second
+	//a crawl is broken when no byte is received in this duration.
+	CRAWL_IDLE_TIMEOUT = time.Minute
+)
+
+// the filename of a url's last path segment. empty if none.
+func CrawlFilename(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// the received bytes of a crawl job. it is kept after a failure, so that the retry continues from it.
+func GetCrawlTmpPath(jobUuid string) string {
+	return fmt.Sprintf("%s/crawl-%s", GetBlobTmpDir(), jobUuid)
+}
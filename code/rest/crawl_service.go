@@ -0,0 +1,127 @@
+package rest
+
+import (
+	"context"
+	"errors"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/crawl"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"net"
+	"net/http"
+	"sync"
+)
+
+/**
+ * download the remote files with limited concurrency and bandwidth. a broken download is resumed by Range.
+ */
+//@Service
+type CrawlService struct {
+	BaseBean
+	preferenceService *PreferenceService
+
+	client *http.Client
+	//shared by all the crawls.
+	limiter *crawl.Limiter
+
+	mutex   sync.Mutex
+	running int
+	//closed when a crawl finishes, to wake up the waiting ones.
+	released chan struct{}
+}
+
+func (this *CrawlService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.preferenceService)
+	if b, ok := b.(*PreferenceService); ok {
+		this.preferenceService = b
+	}
+
+	//no proxy, otherwise the addresses dialed are the proxy's rather than the crawled ones.
+	dialer := &net.Dialer{Timeout: CRAWL_CONNECT_TIMEOUT}
+	this.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+				return this.policy().DialContext(dialer)(ctx, network, address)
+			},
+			TLSHandshakeTimeout:   CRAWL_CONNECT_TIMEOUT,
+			ResponseHeaderTimeout: CRAWL_CONNECT_TIMEOUT,
+		},
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= CRAWL_MAX_REDIRECTS {
+				return errors.New("too many redirects")
+			}
+			return this.policy().CheckUrl(request.URL.String())
+		},
+	}
+	this.limiter = crawl.NewLimiter(-1)
+	this.released = make(chan struct{})
+}
+
+// the outbound policy from the crawl config.
+func (this *CrawlService) policy() *crawl.Policy {
+	return crawl.NewPolicy(this.preferenceService.Fetch().FetchCrawlConfig().AllowHosts)
+}
+
+// fail fast if the url is not allowed. the addresses resolved are checked again when downloading.
+func (this *CrawlService) CheckUrl(url string) {
+	err := this.policy().CheckUrl(url)
+	if err != nil {
+		panic(result.BadRequest("url not allowed. %s", err.Error()))
+	}
+}
+
+// download url to path within maxSize(-1 means no limit). a partial file at path is continued.
+// it waits in queue when the crawls running reach the concurrency.
+func (this *CrawlService) Download(request *http.Request, url string, path string, maxSize int64) (int64, error) {
+
+	crawlConfig := this.preferenceService.Fetch().FetchCrawlConfig()
+	if crawlConfig.SizeLimit >= 0 && (maxSize < 0 || crawlConfig.SizeLimit < maxSize) {
+		maxSize = crawlConfig.SizeLimit
+	}
+	this.limiter.SetRate(crawlConfig.Bandwidth)
+
+	ctx := request.Context()
+	runner := JobOf(request)
+
+	//wait for a free slot.
+	for {
+		this.mutex.Lock()
+		if this.running < crawlConfig.Concurrency {
+			this.running++
+			this.mutex.Unlock()
+			break
+		}
+		released := this.released
+		this.mutex.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+	defer func() {
+		this.mutex.Lock()
+		this.running--
+		close(this.released)
+		this.released = make(chan struct{})
+		this.mutex.Unlock()
+	}()
+
+	downloader := &crawl.Downloader{
+		Client:      this.client,
+		MaxSize:     maxSize,
+		Retries:     crawlConfig.Retries,
+		Backoff:     CRAWL_BACKOFF,
+		MaxBackoff:  CRAWL_MAX_BACKOFF,
+		IdleTimeout: CRAWL_IDLE_TIMEOUT,
+		Limiter:     this.limiter,
+		Progress:    runner.Progress,
+		OnRetry: func(attempt int, err error) {
+			this.logger.Info("crawl %s broken, retry %d. %s", url, attempt, err.Error())
+			runner.Log("broken, retry %d. %s", attempt, err.Error())
+		},
+	}
+	return downloader.Download(ctx, url, path)
+}
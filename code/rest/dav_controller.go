@@ -23,14 +23,16 @@ import (
 
 type DavController struct {
 	BaseController
-	uploadTokenDao    *UploadTokenDao
-	downloadTokenDao  *DownloadTokenDao
-	spaceDao          *SpaceDao
-	matterDao         *MatterDao
-	matterService     *MatterService
-	imageCacheDao     *ImageCacheDao
-	imageCacheService *ImageCacheService
-	davService        *DavService
+	uploadTokenDao     *UploadTokenDao
+	downloadTokenDao   *DownloadTokenDao
+	spaceDao           *SpaceDao
+	matterDao          *MatterDao
+	matterService      *MatterService
+	imageCacheDao      *ImageCacheDao
+	imageCacheService  *ImageCacheService
+	davService         *DavService
+	spaceMemberDao     *SpaceMemberDao
+	spaceMemberService *SpaceMemberService
 }
 
 func (this *DavController) Init() {
@@ -75,6 +77,16 @@ func (this *DavController) Init() {
 	if c, ok := b.(*DavService); ok {
 		this.davService = c
 	}
+
+	b = core.CONTEXT.GetBean(this.spaceMemberDao)
+	if c, ok := b.(*SpaceMemberDao); ok {
+		this.spaceMemberDao = c
+	}
+
+	b = core.CONTEXT.GetBean(this.spaceMemberService)
+	if c, ok := b.(*SpaceMemberService); ok {
+		this.spaceMemberService = c
+	}
 }
 
 // Auth user by BasicAuth
@@ -178,8 +190,47 @@ func (this *DavController) Index(writer http.ResponseWriter, request *http.Reque
 	//this.debug(writer, request, subPath)
 
 	user := this.CheckCurrentUser(writer, request)
-	space := this.spaceDao.CheckByUuid(user.SpaceUuid)
+	privateSpace := this.spaceDao.CheckByUuid(user.SpaceUuid)
+
+	//the root lists the private space and the spaces the user is a member of.
+	if subPath == "" {
+		this.davService.HandleSpaces(writer, request, user, privateSpace, this.spaceDao.FindByUserUuidOrMember(user.Uuid))
+		return
+	}
+
+	space, spacePath := this.resolveSpace(user, subPath)
+	if space == nil {
+		//the paths not starting with a space name are in the private space, as the old versions did.
+		space, spacePath = privateSpace, subPath
+	}
 
-	this.davService.HandleDav(writer, request, user, space, subPath)
+	if !this.spaceMemberService.canRead(user, space.Uuid) {
+		panic(result.StatusCodeWebResult(http.StatusForbidden, "you cannot read this space."))
+	}
+	if this.davService.IsWriteMethod(request.Method) && !this.spaceMemberService.canWrite(user, space.Uuid) {
+		panic(result.StatusCodeWebResult(http.StatusForbidden, "you cannot change this space."))
+	}
+
+	this.davService.HandleDav(writer, request, user, space, spacePath)
+}
+
+// the space named by the first segment of the path and the rest path in it.
+// only the private space of the user and the spaces the user is a member of are matched, otherwise return nil.
+func (this *DavController) resolveSpace(user *User, subPath string) (*Space, string) {
+
+	segments := strings.SplitN(strings.TrimPrefix(subPath, "/"), "/", 2)
+
+	space := this.spaceDao.FindByName(segments[0])
+	if space == nil {
+		return nil, ""
+	}
+	if space.Uuid != user.SpaceUuid && this.spaceMemberDao.FindBySpaceUuidAndUserUuid(space.Uuid, user.Uuid) == nil {
+		return nil, ""
+	}
+
+	if len(segments) == 2 {
+		return space, "/" + segments[1]
+	}
+	return space, ""
 
 }
@@ -0,0 +1,101 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
+	"time"
+	"unicode/utf8"
+)
+
+type DavLockDao struct {
+	BaseDao
+}
+
+// find an active lock by token. if not found return nil.
+func (this *DavLockDao) FindActiveByToken(token string, now time.Time) *DavLock {
+	var entity = &DavLock{}
+	db := core.CONTEXT.GetDB().Where("token = ? AND expire_time > ?", token, now).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+// the active locks on the paths, in the transaction.
+func (this *DavLockDao) ListActiveBySpaceUuidAndPathsTx(tx *gorm.DB, spaceUuid string, paths []string, now time.Time) []*DavLock {
+	var locks []*DavLock
+	db := tx.Where("space_uuid = ? AND path IN (?) AND expire_time > ?", spaceUuid, paths, now).Find(&locks)
+	this.PanicError(db.Error)
+	return locks
+}
+
+// the active locks under the path, not including the path itself, in the transaction.
+func (this *DavLockDao) ListActiveUnderPathTx(tx *gorm.DB, spaceUuid string, path string, now time.Time) []*DavLock {
+	var locks []*DavLock
+	var db *gorm.DB
+	if path == "/" {
+		db = tx.Where("space_uuid = ? AND path <> ? AND expire_time > ?", spaceUuid, path, now).Find(&locks)
+	} else {
+		//see MatterDao.descendantCondition
+		prefix := path + "/"
+		db = tx.Where("space_uuid = ? AND path > ? AND path < ? AND SUBSTR(path, 1, ?) = ? AND expire_time > ?",
+			spaceUuid, prefix, path+"0", utf8.RuneCountInString(prefix), prefix, now).Find(&locks)
+	}
+	this.PanicError(db.Error)
+	return locks
+}
+
+func (this *DavLockDao) CreateTx(tx *gorm.DB, davLock *DavLock) *DavLock {
+
+	timeUUID, _ := uuid.NewV4()
+	davLock.Uuid = string(timeUUID.String())
+	davLock.CreateTime = time.Now()
+	davLock.UpdateTime = time.Now()
+	davLock.Sort = time.Now().UnixNano() / 1e6
+	db := tx.Create(davLock)
+	this.PanicError(db.Error)
+
+	return davLock
+}
+
+func (this *DavLockDao) Save(davLock *DavLock) *DavLock {
+
+	davLock.UpdateTime = time.Now()
+	db := core.CONTEXT.GetDB().Save(davLock)
+	this.PanicError(db.Error)
+
+	return davLock
+}
+
+func (this *DavLockDao) Delete(davLock *DavLock) {
+
+	db := core.CONTEXT.GetDB().Delete(davLock)
+	this.PanicError(db.Error)
+}
+
+// delete the expired locks. return the number deleted.
+func (this *DavLockDao) DeleteExpired(now time.Time) int64 {
+
+	db := core.CONTEXT.GetDB().Where("expire_time <= ?", now).Delete(DavLock{})
+	this.PanicError(db.Error)
+	return db.RowsAffected
+}
+
+func (this *DavLockDao) DeleteByUserUuid(userUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("user_uuid = ?", userUuid).Delete(DavLock{})
+	this.PanicError(db.Error)
+}
+
+// System cleanup.
+func (this *DavLockDao) Cleanup() {
+	this.logger.Info("[DavLockDao] clean up. Delete all DavLock")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(DavLock{})
+	this.PanicError(db.Error)
+}
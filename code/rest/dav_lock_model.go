@@ -0,0 +1,42 @@
+package rest
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	//longer or infinite timeouts asked by the clients are cut to this, so that a forgotten lock expires at last.
+	DAV_LOCK_MAX_TIMEOUT = 24 * time.Hour
+	//the prefix of the lock tokens. see http://www.webdav.org/specs/rfc4918.html#opaquelocktoken.uri.scheme
+	DAV_LOCK_TOKEN_PREFIX = "opaquelocktoken:"
+)
+
+/**
+ * a webdav lock. it's kept in db, so it survives restarts and is shared by all the instances.
+ */
+type DavLock struct {
+	Uuid       string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort       int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	Token      string    `json:"-" gorm:"type:varchar(128) not null;unique"`
+	UserUuid   string    `json:"userUuid" gorm:"type:char(36) not null"`
+	SpaceUuid  string    `json:"spaceUuid" gorm:"type:char(36) not null;index:idx_dav_lock_sp,priority:1"`
+	Path       string    `json:"path" gorm:"type:varchar(1024) not null;index:idx_dav_lock_sp,priority:2,length:255"` //the locked path in the space. "/" is the root.
+	ZeroDepth  bool      `json:"zeroDepth" gorm:"type:tinyint(1) not null;default:0"`                                 //only the path itself is locked, not its descendants.
+	OwnerXml   string    `json:"ownerXml" gorm:"type:text"`
+	Duration   int64     `json:"duration" gorm:"type:bigint(20) not null;default:0"` //seconds.
+	ExpireTime time.Time `json:"expireTime" gorm:"type:timestamp not null;index:idx_dav_lock_et;default:'2018-01-01 00:00:00'"`
+}
+
+// whether the lock covers the path, a zero depth lock only covers itself.
+func (this *DavLock) Covers(path string) bool {
+	if this.Path == path {
+		return true
+	}
+	if this.ZeroDepth {
+		return false
+	}
+	return this.Path == "/" || strings.HasPrefix(path, this.Path+"/")
+}
@@ -0,0 +1,282 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"github.com/eyebluecn/tank/code/tool/webdav"
+	"gorm.io/gorm"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+)
+
+/**
+ * webdav locks kept in db. the rest operations respect them too,
+ * so that a file locked by a webdav client(eg. Office) cannot be changed from the web page.
+ */
+//@Service
+type DavLockService struct {
+	BaseBean
+	davLockDao *DavLockDao
+	spaceDao   *SpaceDao
+
+	mutex sync.Mutex
+	//tokens confirmed by the requests being handled in this instance. see webdav.LockSystem.Confirm
+	held map[string]bool
+}
+
+func (this *DavLockService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.davLockDao)
+	if b, ok := b.(*DavLockDao); ok {
+		this.davLockDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.spaceDao)
+	if b, ok := b.(*SpaceDao); ok {
+		this.spaceDao = b
+	}
+
+	this.held = make(map[string]bool)
+}
+
+// the lock system of a space for the webdav handlers.
+func (this *DavLockService) LockSystem(user *User, space *Space) webdav.LockSystem {
+	return &davLockSystem{davLockService: this, user: user, space: space}
+}
+
+// the active locks forbidding to change the path. with subtree the locks under the path count too.
+func (this *DavLockService) conflicts(space *Space, name string, subtree bool, now time.Time) []*DavLock {
+	return this.conflictsTx(core.CONTEXT.GetDB(), space, name, subtree, now)
+}
+
+func (this *DavLockService) conflictsTx(tx *gorm.DB, space *Space, name string, subtree bool, now time.Time) []*DavLock {
+
+	name = davLockPath(name)
+
+	//the path itself and its ancestors.
+	var paths []string
+	for p := name; ; p = path.Dir(p) {
+		paths = append(paths, p)
+		if p == "/" {
+			break
+		}
+	}
+
+	var locks []*DavLock
+	for _, davLock := range this.davLockDao.ListActiveBySpaceUuidAndPathsTx(tx, space.Uuid, paths, now) {
+		if davLock.Covers(name) {
+			locks = append(locks, davLock)
+		}
+	}
+	if subtree {
+		locks = append(locks, this.davLockDao.ListActiveUnderPathTx(tx, space.Uuid, name, now)...)
+	}
+	return locks
+}
+
+// whether the path is locked.
+func (this *DavLockService) Locked(space *Space, name string) bool {
+	return len(this.conflicts(space, name, false, time.Now())) > 0
+}
+
+// check the path not locked by webdav, unless the request submits the lock tokens in the If header.
+// with subtree the locks under the path are checked too, for the operations on a directory.
+func (this *DavLockService) CheckUnlocked(request *http.Request, space *Space, name string, subtree bool) {
+
+	locks := this.conflicts(space, name, subtree, time.Now())
+	if len(locks) == 0 {
+		return
+	}
+
+	tokens := make(map[string]bool)
+	if request != nil {
+		if ih, ok := webdav.ParseIfHeader(request.Header.Get("If")); ok {
+			for _, list := range ih.Lists {
+				for _, condition := range list.Conditions {
+					if !condition.Not && condition.Token != "" {
+						tokens[condition.Token] = true
+					}
+				}
+			}
+		}
+	}
+
+	for _, davLock := range locks {
+		if !tokens[davLock.Token] {
+			panic(result.CustomWebResult(result.LOCKED, fmt.Sprintf("%s is locked by webdav until %s", davLock.Path, davLock.ExpireTime.Format("2006-01-02 15:04:05"))))
+		}
+	}
+}
+
+// delete the expired locks.
+func (this *DavLockService) CleanExpiredLocks() {
+
+	count := this.davLockDao.DeleteExpired(time.Now())
+	if count > 0 {
+		this.logger.Info("delete %d expired webdav locks.", count)
+	}
+}
+
+// the lock's duration, cut to DAV_LOCK_MAX_TIMEOUT.
+func davLockDuration(duration time.Duration) time.Duration {
+	if duration < 0 || duration > DAV_LOCK_MAX_TIMEOUT {
+		return DAV_LOCK_MAX_TIMEOUT
+	}
+	return duration
+}
+
+// the cleaned path with a leading "/".
+func davLockPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+/**
+ * webdav.LockSystem of a space. see webdav.memLS for the same semantics in memory.
+ */
+type davLockSystem struct {
+	davLockService *DavLockService
+	user           *User
+	space          *Space
+}
+
+// the active lock in the space matching one of the conditions and covering the path, nil if none.
+// a held lock is not available for another request.
+func (this *davLockSystem) lookup(name string, now time.Time, conditions ...webdav.Condition) *DavLock {
+	for _, condition := range conditions {
+		davLock := this.davLockService.davLockDao.FindActiveByToken(condition.Token, now)
+		if davLock == nil || davLock.SpaceUuid != this.space.Uuid || this.davLockService.held[davLock.Token] {
+			continue
+		}
+		if davLock.Covers(name) {
+			return davLock
+		}
+	}
+	return nil
+}
+
+// find the active lock of the space by token.
+func (this *davLockSystem) find(token string, now time.Time) *DavLock {
+	davLock := this.davLockService.davLockDao.FindActiveByToken(token, now)
+	if davLock == nil || davLock.SpaceUuid != this.space.Uuid {
+		return nil
+	}
+	return davLock
+}
+
+func (this *davLockSystem) details(davLock *DavLock) webdav.LockDetails {
+	return webdav.LockDetails{
+		Root:      davLock.Path,
+		Duration:  time.Duration(davLock.Duration) * time.Second,
+		OwnerXML:  davLock.OwnerXml,
+		ZeroDepth: davLock.ZeroDepth,
+	}
+}
+
+func (this *davLockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+
+	this.davLockService.mutex.Lock()
+	defer this.davLockService.mutex.Unlock()
+
+	var tokens []string
+	for _, name := range []string{name0, name1} {
+		if name == "" {
+			continue
+		}
+		davLock := this.lookup(davLockPath(name), now, conditions...)
+		if davLock == nil {
+			return nil, webdav.ErrConfirmationFailed
+		}
+		if len(tokens) == 0 || tokens[0] != davLock.Token {
+			tokens = append(tokens, davLock.Token)
+		}
+	}
+
+	for _, token := range tokens {
+		this.davLockService.held[token] = true
+	}
+	return func() {
+		this.davLockService.mutex.Lock()
+		defer this.davLockService.mutex.Unlock()
+		for _, token := range tokens {
+			delete(this.davLockService.held, token)
+		}
+	}, nil
+}
+
+func (this *davLockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+
+	this.davLockService.mutex.Lock()
+	defer this.davLockService.mutex.Unlock()
+
+	name := davLockPath(details.Root)
+	duration := davLockDuration(details.Duration)
+	timeUUID, _ := uuid.NewV4()
+	davLock := &DavLock{
+		Token:      DAV_LOCK_TOKEN_PREFIX + timeUUID.String(),
+		UserUuid:   this.user.Uuid,
+		SpaceUuid:  this.space.Uuid,
+		Path:       name,
+		ZeroDepth:  details.ZeroDepth,
+		OwnerXml:   details.OwnerXML,
+		Duration:   int64(duration / time.Second),
+		ExpireTime: now.Add(duration),
+	}
+
+	//the row of the space is locked, so that the instances check and create the locks of a space one by one.
+	err := core.CONTEXT.GetDB().Transaction(func(tx *gorm.DB) error {
+		this.davLockService.spaceDao.CheckByUuidForUpdateTx(tx, this.space.Uuid)
+		//an infinite depth lock cannot cover the locks under it.
+		if len(this.davLockService.conflictsTx(tx, this.space, name, !details.ZeroDepth, now)) > 0 {
+			return webdav.ErrLocked
+		}
+		davLock = this.davLockService.davLockDao.CreateTx(tx, davLock)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return davLock.Token, nil
+}
+
+func (this *davLockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+
+	this.davLockService.mutex.Lock()
+	defer this.davLockService.mutex.Unlock()
+
+	davLock := this.find(token, now)
+	if davLock == nil {
+		return webdav.LockDetails{}, webdav.ErrNoSuchLock
+	}
+	if this.davLockService.held[token] {
+		return webdav.LockDetails{}, webdav.ErrLocked
+	}
+
+	duration = davLockDuration(duration)
+	davLock.Duration = int64(duration / time.Second)
+	davLock.ExpireTime = now.Add(duration)
+	davLock = this.davLockService.davLockDao.Save(davLock)
+
+	return this.details(davLock), nil
+}
+
+func (this *davLockSystem) Unlock(now time.Time, token string) error {
+
+	this.davLockService.mutex.Lock()
+	defer this.davLockService.mutex.Unlock()
+
+	davLock := this.find(token, now)
+	if davLock == nil {
+		return webdav.ErrNoSuchLock
+	}
+	if this.davLockService.held[token] {
+		return webdav.ErrLocked
+	}
+
+	this.davLockService.davLockDao.Delete(davLock)
+	return nil
+}
@@ -7,11 +7,42 @@ import (
 	"net/http"
 	"path"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // webdav url prefix.
 var WEBDAV_PREFIX = "/api/dav"
 
+const (
+	//max matters listed by a PROPFIND with Depth infinity, unless configured.
+	DAV_DEFAULT_DEPTH_INFINITY_LIMIT = 10000
+	DAV_MAX_DEPTH_INFINITY_LIMIT     = 1000000
+	//dead properties of the matters are read in batches of this size.
+	DAV_PROP_BATCH_SIZE = 500
+)
+
+// client types told by the User-Agent. the webdav config chooses their behaviors.
+const (
+	DAV_CLIENT_WINDOWS = "WINDOWS"
+	DAV_CLIENT_FINDER  = "FINDER"
+	DAV_CLIENT_RCLONE  = "RCLONE"
+	DAV_CLIENT_OTHER   = "OTHER"
+)
+
+// how the OS metadata files(eg. ._* and .DS_Store written by Finder) are treated.
+const (
+	//keep them as the other files.
+	DAV_METADATA_ALLOW = "ALLOW"
+	//answer success without keeping them, and hide them in the listings.
+	DAV_METADATA_IGNORE = "IGNORE"
+	//answer 403, and hide them in the listings.
+	DAV_METADATA_DENY = "DENY"
+)
+
+// namespace of the properties which Windows' webdav client(MiniRedir) reads and writes.
+const DAV_WIN32_NAMESPACE = "urn:schemas-microsoft-com:"
+
 // live prop.
 type LiveProp struct {
 	findFn func(space *Space, matter *Matter) string
@@ -60,8 +91,10 @@ var LivePropMap = map[xml.Name]LiveProp{
 		dir: true,
 	},
 	{Space: "DAV:", Local: "creationdate"}: {
-		findFn: nil,
-		dir:    false,
+		findFn: func(space *Space, matter *Matter) string {
+			return matter.CreateTime.UTC().Format(time.RFC3339)
+		},
+		dir: true,
 	},
 	{Space: "DAV:", Local: "getcontentlanguage"}: {
 		findFn: nil,
@@ -79,12 +112,10 @@ var LivePropMap = map[xml.Name]LiveProp{
 	},
 	{Space: "DAV:", Local: "getetag"}: {
 		findFn: func(space *Space, matter *Matter) string {
-			return fmt.Sprintf(`"%x%x"`, matter.UpdateTime.UnixNano(), matter.Size)
+			return davETag(matter)
 		},
-		// findETag implements ETag as the concatenated hex values of a file's
-		// modification time and size. This is not a reliable synchronization
-		// mechanism for directories, so we do not advertise getetag for DAV
-		// collections.
+		// This is not a reliable synchronization mechanism for directories,
+		// so we do not advertise getetag for DAV collections.
 		dir: false,
 	},
 	// TODO: The lockdiscovery property requires LockSystem to list the
@@ -124,3 +155,75 @@ var LivePropMap = map[xml.Name]LiveProp{
 		dir: true,
 	},
 }
+
+// Win32 properties. they default to the matter's, and are kept as dead properties when Windows changes them.
+var Win32PropMap = map[xml.Name]LiveProp{
+	{Space: DAV_WIN32_NAMESPACE, Local: "Win32CreationTime"}: {
+		findFn: func(space *Space, matter *Matter) string {
+			return matter.CreateTime.UTC().Format(http.TimeFormat)
+		},
+		dir: true,
+	},
+	{Space: DAV_WIN32_NAMESPACE, Local: "Win32LastModifiedTime"}: {
+		findFn: func(space *Space, matter *Matter) string {
+			return matter.UpdateTime.UTC().Format(http.TimeFormat)
+		},
+		dir: true,
+	},
+	{Space: DAV_WIN32_NAMESPACE, Local: "Win32LastAccessTime"}: {
+		findFn: func(space *Space, matter *Matter) string {
+			return matter.VisitTime.UTC().Format(http.TimeFormat)
+		},
+		dir: true,
+	},
+	{Space: DAV_WIN32_NAMESPACE, Local: "Win32FileAttributes"}: {
+		findFn: func(space *Space, matter *Matter) string {
+			//FILE_ATTRIBUTE_DIRECTORY or FILE_ATTRIBUTE_ARCHIVE
+			if matter.Dir {
+				return "00000010"
+			} else {
+				return "00000020"
+			}
+		},
+		dir: true,
+	},
+}
+
+// the client type told by the User-Agent.
+func davClientType(userAgent string) string {
+	if strings.HasPrefix(userAgent, "Microsoft-WebDAV-MiniRedir") || strings.HasPrefix(userAgent, "Microsoft Office") || strings.HasPrefix(userAgent, "DavClnt") {
+		return DAV_CLIENT_WINDOWS
+	} else if strings.HasPrefix(userAgent, "WebDAVFS") || strings.HasPrefix(userAgent, "WebDAVLib") {
+		return DAV_CLIENT_FINDER
+	} else if strings.HasPrefix(userAgent, "rclone/") {
+		return DAV_CLIENT_RCLONE
+	}
+	return DAV_CLIENT_OTHER
+}
+
+// strong ETag of a file. the content's sha256 if it lives in the blob store,
+// otherwise the hex values of its size and modification time in seconds, which the db keeps exactly.
+func davETag(matter *Matter) string {
+	if matter.Sha256 != "" {
+		return fmt.Sprintf(`"%s"`, matter.Sha256)
+	}
+	return fmt.Sprintf(`"%x-%x"`, matter.Size, matter.UpdateTime.Unix())
+}
+
+// whether an If-Match or If-None-Match header matches the ETag. (RFC7232:2.3.2)
+// If-None-Match uses the weak comparison, which ignores the W/ prefix.
+func davETagMatch(header string, etag string, weak bool) bool {
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimSpace(value)
+		if value == "*" {
+			return true
+		}
+		if weak {
+			value = strings.TrimPrefix(value, "W/")
+		}
+		if etag != "" && value == etag {
+			return true
+		}
+	}
+	return false
+}
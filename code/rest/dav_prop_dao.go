@@ -0,0 +1,107 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type DavPropDao struct {
+	BaseDao
+}
+
+// the dead properties of the matters, ordered by matter and name.
+func (this *DavPropDao) ListBySpaceUuidAndMatterUuids(spaceUuid string, matterUuids []string) []*DavProp {
+	var davProps []*DavProp
+	db := core.CONTEXT.GetDB().Where("space_uuid = ? AND matter_uuid IN (?)", spaceUuid, matterUuids).Order("matter_uuid, namespace, name").Find(&davProps)
+	this.PanicError(db.Error)
+	return davProps
+}
+
+// find a dead property in a transaction. if not found return nil.
+func (this *DavPropDao) FindTx(tx *gorm.DB, spaceUuid string, matterUuid string, namespace string, name string) *DavProp {
+	var entity = &DavProp{}
+	db := tx.Where("space_uuid = ? AND matter_uuid = ? AND namespace = ? AND name = ?", spaceUuid, matterUuid, namespace, name).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+func (this *DavPropDao) CreateTx(tx *gorm.DB, davProp *DavProp) *DavProp {
+
+	timeUUID, _ := uuid.NewV4()
+	davProp.Uuid = string(timeUUID.String())
+	davProp.CreateTime = time.Now()
+	davProp.UpdateTime = time.Now()
+	davProp.Sort = time.Now().UnixNano() / 1e6
+	db := tx.Create(davProp)
+	this.PanicError(db.Error)
+
+	return davProp
+}
+
+func (this *DavPropDao) SaveTx(tx *gorm.DB, davProp *DavProp) *DavProp {
+
+	davProp.UpdateTime = time.Now()
+	db := tx.Save(davProp)
+	this.PanicError(db.Error)
+
+	return davProp
+}
+
+func (this *DavPropDao) DeleteTx(tx *gorm.DB, davProp *DavProp) {
+
+	db := tx.Delete(davProp)
+	this.PanicError(db.Error)
+}
+
+// copy the dead properties of srcMatter to destMatter in a transaction.
+func (this *DavPropDao) CopyTx(tx *gorm.DB, srcMatter *Matter, destMatter *Matter) {
+
+	var davProps []*DavProp
+	db := tx.Where("space_uuid = ? AND matter_uuid = ?", srcMatter.SpaceUuid, srcMatter.Uuid).Find(&davProps)
+	this.PanicError(db.Error)
+
+	for _, davProp := range davProps {
+		this.CreateTx(tx, &DavProp{
+			SpaceUuid:  destMatter.SpaceUuid,
+			MatterUuid: destMatter.Uuid,
+			Namespace:  davProp.Namespace,
+			Name:       davProp.Name,
+			Lang:       davProp.Lang,
+			Value:      davProp.Value,
+		})
+	}
+}
+
+func (this *DavPropDao) DeleteByMatterUuid(matterUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid = ?", matterUuid).Delete(DavProp{})
+	this.PanicError(db.Error)
+}
+
+func (this *DavPropDao) DeleteByMatterUuidQuery(matterUuidQuery *gorm.DB) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid IN (?)", matterUuidQuery).Delete(DavProp{})
+	this.PanicError(db.Error)
+}
+
+func (this *DavPropDao) DeleteBySpaceUuid(spaceUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("space_uuid = ?", spaceUuid).Delete(DavProp{})
+	this.PanicError(db.Error)
+}
+
+// System cleanup.
+func (this *DavPropDao) Cleanup() {
+	this.logger.Info("[DavPropDao] clean up. Delete all DavProp")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(DavProp{})
+	this.PanicError(db.Error)
+}
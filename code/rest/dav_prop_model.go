@@ -0,0 +1,20 @@
+package rest
+
+import "time"
+
+/**
+ * a dead property of a matter set by PROPPATCH. the root directory of a space uses MATTER_ROOT as its matterUuid.
+ * see http://www.webdav.org/specs/rfc4918.html#dead.properties
+ */
+type DavProp struct {
+	Uuid       string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort       int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	SpaceUuid  string    `json:"spaceUuid" gorm:"type:char(36) not null;uniqueIndex:idx_dav_prop_smn,priority:1"`
+	MatterUuid string    `json:"matterUuid" gorm:"type:char(36) not null;uniqueIndex:idx_dav_prop_smn,priority:2"`
+	Namespace  string    `json:"namespace" gorm:"type:varchar(255) not null;uniqueIndex:idx_dav_prop_smn,priority:3"`
+	Name       string    `json:"name" gorm:"type:varchar(255) not null;uniqueIndex:idx_dav_prop_smn,priority:4"`
+	Lang       string    `json:"lang" gorm:"type:varchar(45)"`
+	Value      string    `json:"value" gorm:"type:text"` //inner xml of the property.
+}
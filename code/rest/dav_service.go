@@ -8,11 +8,11 @@ import (
 	"github.com/eyebluecn/tank/code/tool/result"
 	"github.com/eyebluecn/tank/code/tool/util"
 	"github.com/eyebluecn/tank/code/tool/webdav"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"path"
-	"regexp"
 	"strings"
 	"time"
 )
@@ -27,9 +27,14 @@ import (
 //@Service
 type DavService struct {
 	BaseBean
-	matterDao     *MatterDao
-	matterService *MatterService
-	lockSystem    webdav.LockSystem
+	matterDao         *MatterDao
+	matterService     *MatterService
+	storageService    *StorageService
+	recentService     *RecentService
+	davLockService    *DavLockService
+	davPropDao        *DavPropDao
+	preferenceService *PreferenceService
+	unitOfWorkService *UnitOfWorkService
 }
 
 func (this *DavService) Init() {
@@ -45,27 +50,49 @@ func (this *DavService) Init() {
 		this.matterService = b
 	}
 
-	// init the webdav lock system.
-	this.lockSystem = webdav.NewMemLS()
+	b = core.CONTEXT.GetBean(this.storageService)
+	if b, ok := b.(*StorageService); ok {
+		this.storageService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.recentService)
+	if b, ok := b.(*RecentService); ok {
+		this.recentService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.davLockService)
+	if b, ok := b.(*DavLockService); ok {
+		this.davLockService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.davPropDao)
+	if b, ok := b.(*DavPropDao); ok {
+		this.davPropDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.preferenceService)
+	if b, ok := b.(*PreferenceService); ok {
+		this.preferenceService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.unitOfWorkService)
+	if b, ok := b.(*UnitOfWorkService); ok {
+		this.unitOfWorkService = b
+	}
 }
 
-// get the depth in header. Not support infinity yet.
+// get the depth in header. a PROPFIND without Depth acts as Depth infinity. (RFC4918:9.1)
 func (this *DavService) ParseDepth(request *http.Request) int {
 
-	depth := 1
-	if hdr := request.Header.Get("Depth"); hdr != "" {
-		switch hdr {
-		case "0":
-			return 0
-		case "1":
-			return 1
-		case "infinity":
-			return 1
-		}
-	} else {
-		panic(result.BadRequest("Header Depth cannot be null"))
+	switch request.Header.Get("Depth") {
+	case "0":
+		return 0
+	case "1":
+		return 1
+	case "", "infinity":
+		return webdav.InfiniteDepth
 	}
-	return depth
+	panic(result.BadRequest("Header Depth must be 0, 1 or infinity"))
 }
 
 func (this *DavService) makePropstatResponse(href string, pstats []dav.Propstat) *dav.Response {
@@ -88,8 +115,28 @@ func (this *DavService) makePropstatResponse(href string, pstats []dav.Propstat)
 	return &resp
 }
 
+// the dead properties of the matters. matterUuid -> props.
+func (this *DavService) deadPropMap(space *Space, matters []*Matter) map[string][]*DavProp {
+
+	deadPropMap := make(map[string][]*DavProp)
+	for i := 0; i < len(matters); i += DAV_PROP_BATCH_SIZE {
+		end := i + DAV_PROP_BATCH_SIZE
+		if end > len(matters) {
+			end = len(matters)
+		}
+		var matterUuids []string
+		for _, matter := range matters[i:end] {
+			matterUuids = append(matterUuids, matter.Uuid)
+		}
+		for _, davProp := range this.davPropDao.ListBySpaceUuidAndMatterUuids(space.Uuid, matterUuids) {
+			deadPropMap[davProp.MatterUuid] = append(deadPropMap[davProp.MatterUuid], davProp)
+		}
+	}
+	return deadPropMap
+}
+
 // fetch a matter's []dav.Propstat
-func (this *DavService) PropstatsFromXmlNames(user *User, space *Space, matter *Matter, xmlNames []xml.Name) []dav.Propstat {
+func (this *DavService) PropstatsFromXmlNames(user *User, space *Space, matter *Matter, xmlNames []xml.Name, deadProps []*DavProp) []dav.Propstat {
 
 	propstats := make([]dav.Propstat, 0)
 
@@ -97,9 +144,8 @@ func (this *DavService) PropstatsFromXmlNames(user *User, space *Space, matter *
 	var notFoundProperties []dav.Property
 
 	for _, xmlName := range xmlNames {
-		//TODO: deadprops not implement yet.
 
-		// Otherwise, it must either be a live property or we don't know it.
+		// it must either be a live property, a dead property or we don't know it.
 		if liveProp := LivePropMap[xmlName]; liveProp.findFn != nil && (liveProp.dir || !matter.Dir) {
 			innerXML := liveProp.findFn(space, matter)
 
@@ -107,9 +153,21 @@ func (this *DavService) PropstatsFromXmlNames(user *User, space *Space, matter *
 				XMLName:  xmlName,
 				InnerXML: []byte(innerXML),
 			})
+		} else if davProp := findDavProp(deadProps, xmlName); davProp != nil {
+			okProperties = append(okProperties, dav.Property{
+				XMLName:  xmlName,
+				Lang:     davProp.Lang,
+				InnerXML: []byte(davProp.Value),
+			})
+		} else if win32Prop, isWin32 := Win32PropMap[xmlName]; isWin32 {
+			okProperties = append(okProperties, dav.Property{
+				XMLName:  xmlName,
+				InnerXML: []byte(win32Prop.findFn(space, matter)),
+			})
 		} else {
 			this.logger.Info("handle props %s %s.", matter.Path, xmlName.Local)
 
+			//the props set by the old versions are kept in matter.Prop without namespace.
 			propMap := matter.FetchPropMap()
 			if value, isPresent := propMap[xmlName.Local]; isPresent {
 				okProperties = append(okProperties, dav.Property{
@@ -150,7 +208,8 @@ func (this *DavService) PropstatsFromXmlNames(user *User, space *Space, matter *
 
 }
 
-func (this *DavService) AllPropXmlNames(matter *Matter) []xml.Name {
+// names of the live properties and the dead properties of a matter. Windows gets the Win32 properties too.
+func (this *DavService) AllPropXmlNames(matter *Matter, deadProps []*DavProp, clientType string) []xml.Name {
 
 	pnames := make([]xml.Name, 0)
 	for pn, prop := range LivePropMap {
@@ -158,24 +217,54 @@ func (this *DavService) AllPropXmlNames(matter *Matter) []xml.Name {
 			pnames = append(pnames, pn)
 		}
 	}
+	for _, davProp := range deadProps {
+		pnames = append(pnames, xml.Name{Space: davProp.Namespace, Local: davProp.Name})
+	}
+	if clientType == DAV_CLIENT_WINDOWS {
+		for pn := range Win32PropMap {
+			if findDavProp(deadProps, pn) == nil {
+				pnames = append(pnames, pn)
+			}
+		}
+	}
 
 	return pnames
 }
 
-func (this *DavService) Propstats(user *User, space *Space, matter *Matter, propfind *dav.Propfind) []dav.Propstat {
+func (this *DavService) Propstats(user *User, space *Space, matter *Matter, propfind *dav.Propfind, deadProps []*DavProp, clientType string) []dav.Propstat {
 
 	propstats := make([]dav.Propstat, 0)
 	if propfind.Propname != nil {
-		panic(result.BadRequest("TODO: propfind.Propname != nil "))
+
+		//only the names. (RFC4918:9.1.4)
+		var properties []dav.Property
+		for _, xmlName := range this.AllPropXmlNames(matter, deadProps, clientType) {
+			properties = append(properties, dav.Property{XMLName: xmlName})
+		}
+		propstats = append(propstats, dav.Propstat{Status: http.StatusOK, Props: properties})
+
 	} else if propfind.Allprop != nil {
 
-		//TODO: if include other things. add to it.
-		xmlNames := this.AllPropXmlNames(matter)
+		xmlNames := this.AllPropXmlNames(matter, deadProps, clientType)
+
+		//the properties asked by include besides allprop. (RFC4918:9.1.2)
+		for _, include := range propfind.Include {
+			found := false
+			for _, xmlName := range xmlNames {
+				if xmlName == include {
+					found = true
+					break
+				}
+			}
+			if !found {
+				xmlNames = append(xmlNames, include)
+			}
+		}
 
-		propstats = this.PropstatsFromXmlNames(user, space, matter, xmlNames)
+		propstats = this.PropstatsFromXmlNames(user, space, matter, xmlNames, deadProps)
 
 	} else {
-		propstats = this.PropstatsFromXmlNames(user, space, matter, propfind.Prop)
+		propstats = this.PropstatsFromXmlNames(user, space, matter, propfind.Prop, deadProps)
 	}
 
 	return propstats
@@ -196,25 +285,41 @@ func (this *DavService) HandlePropfind(writer http.ResponseWriter, request *http
 	matter := this.matterDao.CheckWithRootByPath(subPath, user, space)
 
 	var matters []*Matter
-	if depth == 0 {
+	if depth == 0 || !matter.Dir {
 		matters = []*Matter{matter}
+	} else if depth == webdav.InfiniteDepth {
+
+		//refuse the directories too large to list at once. (RFC4918:9.1)
+		limit := this.preferenceService.Fetch().FetchDavConfig().DepthInfinityLimit
+		if limit > 0 {
+			matters = this.matterDao.FindAliveDescendants(matter, int(limit)+1)
+		}
+		if limit == 0 || int64(len(matters)) > limit {
+			this.writeFiniteDepthError(writer)
+			return
+		}
+
+		//add this matter to head.
+		matters = append([]*Matter{matter}, this.hideMetadata(request, matters)...)
 	} else {
 		// len(matters) == 0 means empty directory
-		matters = this.matterDao.FindByPuuidAndUserUuidAndDeleted(matter.Uuid, user.Uuid, FALSE, nil)
+		matters = this.matterDao.FindBySpaceUuidAndPuuidAndDeleted(space.Uuid, matter.Uuid, FALSE, nil)
 
 		//add this matter to head.
-		matters = append([]*Matter{matter}, matters...)
+		matters = append([]*Matter{matter}, this.hideMetadata(request, matters)...)
 	}
 
+	clientType := davClientType(request.UserAgent())
+	deadPropMap := this.deadPropMap(space, matters)
+	prefix := this.spacePrefix(request, space)
+
 	//prepare a multiStatusWriter.
 	multiStatusWriter := &dav.MultiStatusWriter{Writer: writer}
 
 	for _, matter := range matters {
 
-		fmt.Printf("handle Matter %s\n", matter.Path)
-
-		propstats := this.Propstats(user, space, matter, propfind)
-		visitPath := fmt.Sprintf("%s%s", WEBDAV_PREFIX, matter.Path)
+		propstats := this.Propstats(user, space, matter, propfind, deadPropMap[matter.Uuid], clientType)
+		visitPath := fmt.Sprintf("%s%s", prefix, matter.Path)
 		response := this.makePropstatResponse(visitPath, propstats)
 
 		err := multiStatusWriter.Write(response)
@@ -224,21 +329,83 @@ func (this *DavService) HandlePropfind(writer http.ResponseWriter, request *http
 	err := multiStatusWriter.Close()
 	this.PanicError(err)
 
-	fmt.Printf("%v %v \n", subPath, propfind.Prop)
+}
 
+// refuse a PROPFIND with Depth infinity. (RFC4918:9.1)
+func (this *DavService) writeFiniteDepthError(writer http.ResponseWriter) {
+	writer.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	writer.WriteHeader(http.StatusForbidden)
+	_, err := fmt.Fprintf(writer, `%s<D:error xmlns:D="DAV:"><D:propfind-finite-depth/></D:error>`, xml.Header)
+	this.PanicError(err)
 }
 
-// change the file's property
-func (this *DavService) HandleProppatch(writer http.ResponseWriter, request *http.Request, user *User, subPath string) {
+// the root lists the spaces as directories. it's read only, and its quota is the private space's.
+func (this *DavService) HandleSpaces(writer http.ResponseWriter, request *http.Request, user *User, privateSpace *Space, spaces []*Space) {
+
+	method := request.Method
+	if method == "OPTIONS" {
+
+		writer.Header().Set("Allow", "OPTIONS, PROPFIND")
+		writer.Header().Set("DAV", "1, 2")
+		writer.Header().Set("MS-Author-Via", "DAV")
+
+	} else if method == "PROPFIND" || method == "GET" || method == "HEAD" || method == "POST" {
+
+		depth := this.ParseDepth(request)
+		if depth == webdav.InfiniteDepth {
+			this.writeFiniteDepthError(writer)
+			return
+		}
+
+		propfind := dav.ReadPropfind(request.Body)
+
+		multiStatusWriter := &dav.MultiStatusWriter{Writer: writer}
+
+		root := NewRootMatter(privateSpace)
+		response := this.makePropstatResponse(WEBDAV_PREFIX, this.Propstats(user, privateSpace, root, propfind, nil, davClientType(request.UserAgent())))
+		err := multiStatusWriter.Write(response)
+		this.PanicError(err)
+
+		if depth != 0 {
+			for _, space := range spaces {
+				matter := NewRootMatter(space)
+				matter.Name = space.Name
+				response = this.makePropstatResponse(WEBDAV_PREFIX+"/"+space.Name, this.Propstats(user, space, matter, propfind, nil, davClientType(request.UserAgent())))
+				err = multiStatusWriter.Write(response)
+				this.PanicError(err)
+			}
+		}
+
+		err = multiStatusWriter.Close()
+		this.PanicError(err)
+
+	} else {
+
+		panic(result.StatusCodeWebResult(http.StatusForbidden, "the root only lists the spaces. operate in a space instead."))
+
+	}
+}
+
+// whether the method changes the space.
+func (this *DavService) IsWriteMethod(method string) bool {
+	switch method {
+	case "PUT", "PATCH", "DELETE", "MKCOL", "COPY", "MOVE", "PROPPATCH", "LOCK", "UNLOCK":
+		return true
+	}
+	return false
+}
+
+// change the file's property. the dead properties are all set or none. (RFC4918:9.2)
+func (this *DavService) HandleProppatch(writer http.ResponseWriter, request *http.Request, user *User, space *Space, subPath string) {
 
 	fmt.Printf("PROPPATCH %s\n", subPath)
 
 	// handle the lock feature.
-	reqPath, status, err := this.stripPrefix(request.URL.Path)
+	reqPath, status, err := this.stripPrefix(this.spacePrefix(request, space), request.URL.Path)
 	if err != nil {
 		panic(result.StatusCodeWebResult(status, err.Error()))
 	}
-	release, status, err := this.confirmLocks(request, reqPath, "")
+	release, status, err := this.confirmLocks(request, user, space, reqPath, "")
 	if err != nil {
 		panic(result.StatusCodeWebResult(status, err.Error()))
 	}
@@ -246,46 +413,87 @@ func (this *DavService) HandleProppatch(writer http.ResponseWriter, request *htt
 		defer release()
 	}
 
-	matter := this.matterDao.checkByUserUuidAndPath(user.Uuid, subPath)
+	matter := this.matterDao.CheckWithRootByPath(subPath, user, space)
 
 	patches, status, err := webdav.ReadProppatch(request.Body)
-	this.PanicError(err)
-
-	fmt.Printf("status:%v\n", status)
-
-	//prepare a multiStatusWriter.
-	multiStatusWriter := &dav.MultiStatusWriter{Writer: writer}
+	if err != nil {
+		panic(result.StatusCodeWebResult(status, err.Error()))
+	}
 
-	propstats := make([]dav.Propstat, 0)
-	propMap := matter.FetchPropMap()
+	//the live properties are protected. if any is changed, nothing is changed.
+	var forbidden, dependent []dav.Property
 	for _, patch := range patches {
-		propStat := dav.Propstat{Status: http.StatusOK}
-		if patch.Remove {
-
-			if len(patch.Props) > 0 {
-				property := patch.Props[0]
-				if _, isPresent := propMap[property.XMLName.Local]; isPresent {
-					//delete the prop.
-					delete(propMap, property.XMLName.Local)
-				}
+		for _, prop := range patch.Props {
+			property := dav.Property{XMLName: xml.Name{Space: prop.XMLName.Space, Local: prop.XMLName.Local}}
+			if _, isLive := LivePropMap[property.XMLName]; isLive {
+				forbidden = append(forbidden, property)
+			} else if !containsDavProperty(dependent, property.XMLName) {
+				dependent = append(dependent, property)
 			}
-		} else {
-			for _, prop := range patch.Props {
-				propMap[prop.XMLName.Local] = string(prop.InnerXML)
+		}
+	}
+
+	var propstats []dav.Propstat
+	if len(forbidden) > 0 {
+		propstats = append(propstats, dav.Propstat{
+			Status:   http.StatusForbidden,
+			Props:    forbidden,
+			XMLError: `<D:cannot-modify-protected-property xmlns:D="DAV:"/>`,
+		})
+		if len(dependent) > 0 {
+			propstats = append(propstats, dav.Propstat{Status: dav.StatusFailedDependency, Props: dependent})
+		}
+	} else {
 
-				propStat.Props = append(propStat.Props, dav.Property{XMLName: xml.Name{Space: prop.XMLName.Space, Local: prop.XMLName.Local}})
+		this.unitOfWorkService.Run(func(work *UnitOfWork) {
 
+			propMap := matter.FetchPropMap()
+			legacy := false
+			for _, patch := range patches {
+				for _, prop := range patch.Props {
+
+					davProp := this.davPropDao.FindTx(work.DB, space.Uuid, matter.Uuid, prop.XMLName.Space, prop.XMLName.Local)
+					if patch.Remove {
+						//removing a property not exist is not an error. (RFC4918:14.23)
+						if davProp != nil {
+							this.davPropDao.DeleteTx(work.DB, davProp)
+						}
+					} else if davProp != nil {
+						davProp.Lang = prop.Lang
+						davProp.Value = string(prop.InnerXML)
+						this.davPropDao.SaveTx(work.DB, davProp)
+					} else {
+						this.davPropDao.CreateTx(work.DB, &DavProp{
+							SpaceUuid:  space.Uuid,
+							MatterUuid: matter.Uuid,
+							Namespace:  prop.XMLName.Space,
+							Name:       prop.XMLName.Local,
+							Lang:       prop.Lang,
+							Value:      string(prop.InnerXML),
+						})
+					}
+
+					//the same prop set by the old versions is replaced.
+					if _, isPresent := propMap[prop.XMLName.Local]; isPresent {
+						delete(propMap, prop.XMLName.Local)
+						legacy = true
+					}
+				}
 			}
-		}
 
-		propstats = append(propstats, propStat)
+			if legacy && matter.Uuid != MATTER_ROOT {
+				matter.SetPropMap(propMap)
+				this.matterDao.SaveTx(work.DB, matter)
+			}
+		})
 
+		propstats = append(propstats, dav.Propstat{Status: http.StatusOK, Props: dependent})
 	}
-	matter.SetPropMap(propMap)
-	// update the matter
-	this.matterDao.Save(matter)
 
-	visitPath := fmt.Sprintf("%s%s", WEBDAV_PREFIX, matter.Path)
+	//prepare a multiStatusWriter.
+	multiStatusWriter := &dav.MultiStatusWriter{Writer: writer}
+
+	visitPath := fmt.Sprintf("%s%s", this.spacePrefix(request, space), matter.Path)
 	response := this.makePropstatResponse(visitPath, propstats)
 
 	err1 := multiStatusWriter.Write(response)
@@ -296,6 +504,26 @@ func (this *DavService) HandleProppatch(writer http.ResponseWriter, request *htt
 
 }
 
+// whether the property is in the list.
+func containsDavProperty(properties []dav.Property, xmlName xml.Name) bool {
+	for _, property := range properties {
+		if property.XMLName == xmlName {
+			return true
+		}
+	}
+	return false
+}
+
+// find the dead property by name. if not found return nil.
+func findDavProp(davProps []*DavProp, xmlName xml.Name) *DavProp {
+	for _, davProp := range davProps {
+		if davProp.Namespace == xmlName.Space && davProp.Name == xmlName.Local {
+			return davProp
+		}
+	}
+	return nil
+}
+
 // handle download
 func (this *DavService) HandleGetHeadPost(writer http.ResponseWriter, request *http.Request, user *User, space *Space, subPath string) {
 
@@ -309,22 +537,38 @@ func (this *DavService) HandleGetHeadPost(writer http.ResponseWriter, request *h
 		return
 	}
 
-	//download a file.
-	this.matterService.DownloadFile(writer, request, matter.AbsolutePath(), matter.Name, false)
+	//download a file. the ETag serves If-None-Match and If-Range.
+	writer.Header().Set("ETag", davETag(matter))
+	this.matterService.DownloadMatter(writer, request, matter, false)
+
+	if request.Method == http.MethodGet {
+		this.recentService.Record(user, matter, RECENT_MODE_DOWNLOAD)
+	}
 
 }
 
-// upload a file
+// upload a file, or update it partially.
 func (this *DavService) HandlePut(writer http.ResponseWriter, request *http.Request, user *User, space *Space, subPath string) {
 
-	fmt.Printf("PUT %s\n", subPath)
+	fmt.Printf("%s %s\n", request.Method, subPath)
+
+	filename := util.GetFilenameOfPath(subPath)
+	dirPath := util.GetDirOfPath(subPath)
+
+	//the OS metadata files may be ignored or denied.
+	if this.ignoreMetadata(request, filename) {
+		_, err := io.Copy(ioutil.Discard, request.Body)
+		this.PanicError(err)
+		writer.WriteHeader(http.StatusCreated)
+		return
+	}
 
 	// handle the lock feature.
-	reqPath, status, err := this.stripPrefix(request.URL.Path)
+	reqPath, status, err := this.stripPrefix(this.spacePrefix(request, space), request.URL.Path)
 	if err != nil {
 		panic(result.StatusCodeWebResult(status, err.Error()))
 	}
-	release, status, err := this.confirmLocks(request, reqPath, "")
+	release, status, err := this.confirmLocks(request, user, space, reqPath, "")
 	if err != nil {
 
 		//if status == http.StatusLocked {
@@ -336,20 +580,51 @@ func (this *DavService) HandlePut(writer http.ResponseWriter, request *http.Requ
 		defer release()
 	}
 
-	filename := util.GetFilenameOfPath(subPath)
-	dirPath := util.GetDirOfPath(subPath)
-
 	dirMatter := this.matterDao.CheckWithRootByPath(dirPath, user, space)
 
+	//if exist replace its content, so that the previous content can be kept as a version.
+	srcMatter := this.matterDao.findBySpaceUuidAndPath(space.Uuid, subPath)
+	this.checkPreconditions(request, srcMatter)
+
+	//PATCH only updates a file partially.
+	var size int64 = 0
+	if srcMatter != nil && !srcMatter.Dir {
+		size = srcMatter.Size
+	} else if request.Method == "PATCH" {
+		panic(result.NotFound("%s not exist", subPath))
+	}
+	start, partial := this.ParseUpdateRange(request, size)
+
+	if srcMatter != nil && !srcMatter.Dir {
+		var matter *Matter
+		if partial {
+			//the offset is parsed again with the latest file under the lock.
+			matter = this.matterService.AtomicUpdateRange(request, request.Body, request.ContentLength, user, space, srcMatter, func(matter *Matter) int64 {
+				this.checkPreconditions(request, matter)
+				start, _ = this.ParseUpdateRange(request, matter.Size)
+				return start
+			})
+		} else {
+			matter = this.matterService.AtomicReplaceUpload(request, request.Body, user, space, srcMatter, func(matter *Matter) {
+				this.checkPreconditions(request, matter)
+			})
+		}
+
+		//replaced. (RFC4918:9.7.1)
+		writer.Header().Set("ETag", davETag(matter))
+		writer.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	//if exist delete it.
-	srcMatter := this.matterDao.findByUserUuidAndPath(user.Uuid, subPath)
 	if srcMatter != nil {
 		this.matterService.AtomicDelete(request, srcMatter, user, space)
 	}
 
-	this.matterService.Upload(request, request.Body, nil, user, space, dirMatter, filename, true)
+	matter := this.matterService.AtomicUpload(request, request.Body, nil, user, space, dirMatter, filename, true)
 
 	//set the status code 201
+	writer.Header().Set("ETag", davETag(matter))
 	writer.WriteHeader(http.StatusCreated)
 
 }
@@ -359,11 +634,11 @@ func (this *DavService) HandleDelete(w http.ResponseWriter, r *http.Request, use
 
 	fmt.Printf("DELETE %s\n", subPath)
 
-	reqPath, status, err := this.stripPrefix(r.URL.Path)
+	reqPath, status, err := this.stripPrefix(this.spacePrefix(r, space), r.URL.Path)
 	if err != nil {
 		panic(result.StatusCodeWebResult(status, err.Error()))
 	}
-	release, status, err := this.confirmLocks(r, reqPath, "")
+	release, status, err := this.confirmLocks(r, user, space, reqPath, "")
 	if err != nil {
 		panic(result.StatusCodeWebResult(status, err.Error()))
 	}
@@ -372,10 +647,120 @@ func (this *DavService) HandleDelete(w http.ResponseWriter, r *http.Request, use
 	}
 
 	matter := this.matterDao.CheckWithRootByPath(subPath, user, space)
+	this.checkPreconditions(r, matter)
 
 	this.matterService.AtomicDelete(r, matter, user, space)
 }
 
+// check If-Match and If-None-Match against the matter's ETag, so that a sync client won't overwrite the changes it hasn't seen.
+// matter is nil if not exist. (RFC7232:3.1, 3.2)
+func (this *DavService) checkPreconditions(request *http.Request, matter *Matter) {
+
+	etag := ""
+	if matter != nil && !matter.Dir {
+		etag = davETag(matter)
+	}
+
+	if ifMatch := request.Header.Get("If-Match"); ifMatch != "" {
+		if matter == nil || !davETagMatch(ifMatch, etag, false) {
+			panic(result.CustomWebResult(result.PRECONDITION_FAILED, fmt.Sprintf("If-Match %s not satisfied", ifMatch)))
+		}
+	}
+
+	if ifNoneMatch := request.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if matter != nil && davETagMatch(ifNoneMatch, etag, true) {
+			panic(result.CustomWebResult(result.PRECONDITION_FAILED, fmt.Sprintf("If-None-Match %s not satisfied", ifNoneMatch)))
+		}
+	}
+}
+
+// get the offset of a partial update, by Content-Range of PUT or X-Update-Range of SabreDAV's PATCH.
+// the body replaces Content-Length bytes from the offset. size is the file's current size.
+// partial is false for an ordinary PUT.
+func (this *DavService) ParseUpdateRange(request *http.Request, size int64) (start int64, partial bool) {
+
+	contentRange := request.Header.Get("Content-Range")
+	updateRange := request.Header.Get("X-Update-Range")
+	if contentRange == "" && updateRange == "" {
+		if request.Method == "PATCH" {
+			panic(result.BadRequest("Header X-Update-Range cannot be null"))
+		}
+		return 0, false
+	}
+
+	length := request.ContentLength
+	if length < 0 {
+		panic(result.StatusCodeWebResult(http.StatusLengthRequired, "Content-Length is required by a partial update"))
+	}
+
+	var end int64 = -1
+	var err error
+	if contentRange != "" {
+		//bytes <start>-<end>/<total or *>
+		var total string
+		_, err = fmt.Sscanf(contentRange, "bytes %d-%d/%s", &start, &end, &total)
+	} else if updateRange == "append" {
+		start = size
+	} else if strings.HasPrefix(updateRange, "bytes=-") {
+		//the offset counts from the end.
+		var fromEnd int64
+		_, err = fmt.Sscanf(updateRange, "bytes=-%d", &fromEnd)
+		start = size - fromEnd
+	} else if strings.HasSuffix(updateRange, "-") {
+		_, err = fmt.Sscanf(updateRange, "bytes=%d-", &start)
+	} else {
+		_, err = fmt.Sscanf(updateRange, "bytes=%d-%d", &start, &end)
+	}
+	if err != nil {
+		panic(result.BadRequest("cannot parse the range %s%s", contentRange, updateRange))
+	}
+
+	if end >= 0 && end-start+1 != length {
+		panic(result.BadRequest("the range %s%s doesn't match Content-Length %d", contentRange, updateRange, length))
+	}
+	//a gap cannot be left in the file.
+	if start < 0 || start > size {
+		panic(result.CustomWebResult(result.RANGE_NOT_SATISFIABLE, fmt.Sprintf("the range %s%s is out of the size %d", contentRange, updateRange, size)))
+	}
+
+	return start, true
+}
+
+// whether the file is an OS metadata file ignored for the client. panic 403 if denied.
+func (this *DavService) ignoreMetadata(request *http.Request, name string) bool {
+
+	davConfig := this.preferenceService.Fetch().FetchDavConfig()
+	if !davConfig.IsMetadata(name) {
+		return false
+	}
+
+	switch davConfig.MetadataPolicy(davClientType(request.UserAgent())) {
+	case DAV_METADATA_IGNORE:
+		this.logger.Info("ignore the metadata file %s", name)
+		return true
+	case DAV_METADATA_DENY:
+		panic(result.StatusCodeWebResult(http.StatusForbidden, fmt.Sprintf("%s is an OS metadata file", name)))
+	}
+	return false
+}
+
+// hide the OS metadata files from the client which doesn't allow them.
+func (this *DavService) hideMetadata(request *http.Request, matters []*Matter) []*Matter {
+
+	davConfig := this.preferenceService.Fetch().FetchDavConfig()
+	if davConfig.MetadataPolicy(davClientType(request.UserAgent())) == DAV_METADATA_ALLOW {
+		return matters
+	}
+
+	var visibleMatters []*Matter
+	for _, matter := range matters {
+		if !davConfig.IsMetadata(matter.Name) {
+			visibleMatters = append(visibleMatters, matter)
+		}
+	}
+	return visibleMatters
+}
+
 // crate a directory
 func (this *DavService) HandleMkcol(writer http.ResponseWriter, request *http.Request, user *User, space *Space, subPath string) {
 
@@ -395,6 +780,12 @@ func (this *DavService) HandleMkcol(writer http.ResponseWriter, request *http.Re
 	thisDirName := util.GetFilenameOfPath(subPath)
 	dirPath := util.GetDirOfPath(subPath)
 
+	//the OS metadata directories may be ignored or denied.
+	if this.ignoreMetadata(request, thisDirName) {
+		writer.WriteHeader(http.StatusCreated)
+		return
+	}
+
 	dirMatter := this.matterDao.FindWithRootByPath(dirPath, user, space)
 	if dirMatter == nil {
 		//throw conflict error
@@ -428,7 +819,9 @@ func (this *DavService) HandleOptions(w http.ResponseWriter, r *http.Request, us
 	if matter.Dir {
 		allow = "OPTIONS, LOCK, DELETE, PROPPATCH, COPY, MOVE, UNLOCK, PROPFIND"
 	} else {
-		allow = "OPTIONS, LOCK, GET, HEAD, POST, DELETE, PROPPATCH, COPY, MOVE, UNLOCK, PROPFIND, PUT"
+		allow = "OPTIONS, LOCK, GET, HEAD, POST, DELETE, PROPPATCH, COPY, MOVE, UNLOCK, PROPFIND, PUT, PATCH"
+		//partial update. see ParseUpdateRange
+		w.Header().Set("Accept-Patch", "application/x-sabredav-partialupdate")
 	}
 
 	w.Header().Set("Allow", allow)
@@ -481,14 +874,12 @@ func (this *DavService) prepareMoveCopy(
 	//clean the relative path. eg. /a/b/../ => /a/
 	fullDestinationPath = path.Clean(fullDestinationPath)
 
-	//clean the prefix
-	pattern := fmt.Sprintf(`^%s(.*)$`, WEBDAV_PREFIX)
-	reg := regexp.MustCompile(pattern)
-	strs := reg.FindStringSubmatch(fullDestinationPath)
-	if len(strs) == 2 {
-		destinationPath = strs[1]
+	//clean the prefix. the destination must be in the same space.
+	prefix := this.spacePrefix(request, space)
+	if fullDestinationPath == prefix || strings.HasPrefix(fullDestinationPath, prefix+"/") {
+		destinationPath = strings.TrimPrefix(fullDestinationPath, prefix)
 	} else {
-		panic(result.BadRequest("destination prefix must be %s", WEBDAV_PREFIX))
+		panic(result.BadRequest("destination prefix must be %s", prefix))
 	}
 
 	destinationName = util.GetFilenameOfPath(destinationPath)
@@ -513,6 +904,8 @@ func (this *DavService) prepareMoveCopy(
 		panic(result.BadRequest("you cannot move the root directory"))
 	}
 
+	this.checkPreconditions(request, srcMatter)
+
 	destDirMatter = this.matterDao.FindWithRootByPath(destinationDirPath, user, space)
 	if destDirMatter == nil {
 		//throw conflict error
@@ -529,11 +922,11 @@ func (this *DavService) HandleMove(writer http.ResponseWriter, request *http.Req
 	fmt.Printf("MOVE %s\n", subPath)
 
 	// handle the lock feature.
-	reqPath, status, err := this.stripPrefix(request.URL.Path)
+	reqPath, status, err := this.stripPrefix(this.spacePrefix(request, space), request.URL.Path)
 	if err != nil {
 		panic(result.StatusCodeWebResult(status, err.Error()))
 	}
-	release, status, err := this.confirmLocks(request, reqPath, "")
+	release, status, err := this.confirmLocks(request, user, space, reqPath, "")
 	if err != nil {
 		panic(result.StatusCodeWebResult(status, err.Error()))
 	}
@@ -570,7 +963,7 @@ func (this *DavService) HandleCopy(writer http.ResponseWriter, request *http.Req
 	srcMatter, destDirMatter, _, _, destinationName, overwrite := this.prepareMoveCopy(writer, request, user, space, subPath)
 
 	// handle the lock feature.
-	release, status, err := this.confirmLocks(request, destDirMatter.Path+"/"+destinationName, "")
+	release, status, err := this.confirmLocks(request, user, space, destDirMatter.Path+"/"+destinationName, "")
 	if err != nil {
 		panic(result.StatusCodeWebResult(status, err.Error()))
 	}
@@ -593,61 +986,36 @@ func (this *DavService) HandleCopy(writer http.ResponseWriter, request *http.Req
 
 }
 
-func (h *DavService) stripPrefix(p string) (string, int, error) {
-	if r := strings.TrimPrefix(p, WEBDAV_PREFIX); len(r) < len(p) {
-		return r, http.StatusOK, nil
+// the url prefix of the space's root in the request. a path not starting with a space name is in the private space.
+// see DavController.Index
+func (this *DavService) spacePrefix(request *http.Request, space *Space) string {
+	prefix := WEBDAV_PREFIX + "/" + space.Name
+	if request.URL.Path == prefix || strings.HasPrefix(request.URL.Path, prefix+"/") {
+		return prefix
 	}
-	return p, http.StatusNotFound, webdav.ErrPrefixMismatch
+	return WEBDAV_PREFIX
 }
 
-func (h *DavService) lock(now time.Time, root string) (token string, status int, err error) {
-	token, err = h.lockSystem.Create(now, webdav.LockDetails{
-		Root:      root,
-		Duration:  webdav.InfiniteTimeout,
-		ZeroDepth: true,
-	})
-	if err != nil {
-		if err == webdav.ErrLocked {
-			return "", webdav.StatusLocked, err
-		}
-		return "", http.StatusInternalServerError, err
+func (h *DavService) stripPrefix(prefix string, p string) (string, int, error) {
+	if r := strings.TrimPrefix(p, prefix); len(r) < len(p) {
+		return r, http.StatusOK, nil
 	}
-	return token, 0, nil
+	return p, http.StatusNotFound, webdav.ErrPrefixMismatch
 }
 
-func (h *DavService) confirmLocks(r *http.Request, src, dst string) (release func(), status int, err error) {
+func (h *DavService) confirmLocks(r *http.Request, user *User, space *Space, src, dst string) (release func(), status int, err error) {
 	hdr := r.Header.Get("If")
 	if hdr == "" {
 		// An empty If header means that the client hasn't previously created locks.
 		// Even if this client doesn't care about locks, we still need to check that
-		// the resources aren't locked by another client, so we create temporary
-		// locks that would conflict with another client's locks. These temporary
-		// locks are unlocked at the end of the HTTP request.
-		now, srcToken, dstToken := time.Now(), "", ""
-		if src != "" {
-			srcToken, status, err = h.lock(now, src)
-			if err != nil {
-				return nil, status, err
-			}
-		}
-		if dst != "" {
-			dstToken, status, err = h.lock(now, dst)
-			if err != nil {
-				if srcToken != "" {
-					h.lockSystem.Unlock(now, srcToken)
-				}
-				return nil, status, err
+		// the resources aren't locked by another client. The operations check the
+		// locks again in MatterService, together with the locks under a directory.
+		for _, name := range []string{src, dst} {
+			if name != "" && h.davLockService.Locked(space, name) {
+				return nil, webdav.StatusLocked, webdav.ErrLocked
 			}
 		}
-
-		return func() {
-			if dstToken != "" {
-				h.lockSystem.Unlock(now, dstToken)
-			}
-			if srcToken != "" {
-				h.lockSystem.Unlock(now, srcToken)
-			}
-		}, 0, nil
+		return nil, 0, nil
 	}
 
 	ih, ok := webdav.ParseIfHeader(hdr)
@@ -667,12 +1035,12 @@ func (h *DavService) confirmLocks(r *http.Request, src, dst string) (release fun
 			if u.Host != r.Host {
 				continue
 			}
-			lsrc, status, err = h.stripPrefix(u.Path)
+			lsrc, status, err = h.stripPrefix(h.spacePrefix(r, space), u.Path)
 			if err != nil {
 				return nil, status, err
 			}
 		}
-		release, err = h.lockSystem.Confirm(time.Now(), lsrc, dst, l.Conditions...)
+		release, err = h.davLockService.LockSystem(user, space).Confirm(time.Now(), lsrc, dst, l.Conditions...)
 		if err == webdav.ErrConfirmationFailed {
 			continue
 		}
@@ -689,7 +1057,7 @@ func (h *DavService) confirmLocks(r *http.Request, src, dst string) (release fun
 }
 
 // lock.
-func (this *DavService) HandleLock(w http.ResponseWriter, r *http.Request, user *User, subPath string) {
+func (this *DavService) HandleLock(w http.ResponseWriter, r *http.Request, user *User, space *Space, subPath string) {
 
 	duration, err := webdav.ParseTimeout(r.Header.Get("Timeout"))
 	if err != nil {
@@ -713,7 +1081,7 @@ func (this *DavService) HandleLock(w http.ResponseWriter, r *http.Request, user
 		if token == "" {
 			panic(result.BadRequest(webdav.ErrInvalidLockToken.Error()))
 		}
-		ld, err = this.lockSystem.Refresh(now, token, duration)
+		ld, err = this.davLockService.LockSystem(user, space).Refresh(now, token, duration)
 		if err != nil {
 			if err == webdav.ErrNoSuchLock {
 				panic(result.StatusCodeWebResult(http.StatusPreconditionFailed, err.Error()))
@@ -734,7 +1102,7 @@ func (this *DavService) HandleLock(w http.ResponseWriter, r *http.Request, user
 			}
 		}
 
-		reqPath, status, err := this.stripPrefix(r.URL.Path)
+		reqPath, status, err := this.stripPrefix(this.spacePrefix(r, space), r.URL.Path)
 		if err != nil {
 			panic(result.StatusCodeWebResult(status, err.Error()))
 		}
@@ -745,7 +1113,7 @@ func (this *DavService) HandleLock(w http.ResponseWriter, r *http.Request, user
 			OwnerXML:  li.Owner.InnerXML,
 			ZeroDepth: depth == 0,
 		}
-		token, err = this.lockSystem.Create(now, ld)
+		token, err = this.davLockService.LockSystem(user, space).Create(now, ld)
 		if err != nil {
 			if err == webdav.ErrLocked {
 				panic(result.StatusCodeWebResult(http.StatusLocked, err.Error()))
@@ -786,7 +1154,7 @@ func (this *DavService) HandleLock(w http.ResponseWriter, r *http.Request, user
 }
 
 // unlock
-func (this *DavService) HandleUnlock(w http.ResponseWriter, r *http.Request, user *User, subPath string) {
+func (this *DavService) HandleUnlock(w http.ResponseWriter, r *http.Request, user *User, space *Space, subPath string) {
 
 	// http://www.webdav.org/specs/rfc4918.html#HEADER_Lock-Token says that the
 	// Lock-Token value is a Coded-URL. We strip its angle brackets.
@@ -796,7 +1164,7 @@ func (this *DavService) HandleUnlock(w http.ResponseWriter, r *http.Request, use
 	}
 	t = t[1 : len(t)-1]
 
-	switch err := this.lockSystem.Unlock(time.Now(), t); err {
+	switch err := this.davLockService.LockSystem(user, space).Unlock(time.Now(), t); err {
 	case nil:
 		panic(result.StatusCodeWebResult(http.StatusNoContent, ""))
 	case webdav.ErrForbidden:
@@ -829,9 +1197,9 @@ func (this *DavService) HandleDav(writer http.ResponseWriter, request *http.Requ
 		//delete file
 		this.HandleDelete(writer, request, user, space, subPath)
 
-	} else if method == "PUT" {
+	} else if method == "PUT" || method == "PATCH" {
 
-		//upload file
+		//upload file, or update it partially.
 		this.HandlePut(writer, request, user, space, subPath)
 
 	} else if method == "MKCOL" {
@@ -852,12 +1220,12 @@ func (this *DavService) HandleDav(writer http.ResponseWriter, request *http.Requ
 	} else if method == "LOCK" {
 
 		//lock
-		this.HandleLock(writer, request, user, subPath)
+		this.HandleLock(writer, request, user, space, subPath)
 
 	} else if method == "UNLOCK" {
 
 		//unlock
-		this.HandleUnlock(writer, request, user, subPath)
+		this.HandleUnlock(writer, request, user, space, subPath)
 
 	} else if method == "PROPFIND" {
 
@@ -867,7 +1235,7 @@ func (this *DavService) HandleDav(writer http.ResponseWriter, request *http.Requ
 	} else if method == "PROPPATCH" {
 
 		//change file's property.
-		this.HandleProppatch(writer, request, user, subPath)
+		this.HandleProppatch(writer, request, user, space, subPath)
 
 	} else {
 
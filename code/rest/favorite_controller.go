@@ -0,0 +1,116 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"net/http"
+)
+
+type FavoriteController struct {
+	BaseController
+	favoriteDao *FavoriteDao
+	matterDao   *MatterDao
+}
+
+func (this *FavoriteController) Init() {
+	this.BaseController.Init()
+
+	b := core.CONTEXT.GetBean(this.favoriteDao)
+	if b, ok := b.(*FavoriteDao); ok {
+		this.favoriteDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+}
+
+func (this *FavoriteController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
+
+	routeMap := make(map[string]func(writer http.ResponseWriter, request *http.Request))
+
+	routeMap["/api/favorite/add"] = this.Wrap(this.Add, USER_ROLE_USER)
+	routeMap["/api/favorite/remove"] = this.Wrap(this.Remove, USER_ROLE_USER)
+	routeMap["/api/favorite/page"] = this.Wrap(this.Page, USER_ROLE_USER)
+
+	return routeMap
+}
+
+// mark a matter as favorite. nothing happens if marked already.
+func (this *FavoriteController) Add(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	matterUuid := util.ExtractRequestString(request, "matterUuid")
+
+	user := this.checkUser(request)
+	matter := this.matterDao.CheckByUuid(matterUuid)
+	this.spaceService.CheckReadableByUuid(request, user, matter.SpaceUuid)
+	if matter.Deleted {
+		panic(result.BadRequest("matter has been deleted"))
+	}
+
+	favorite := this.favoriteDao.FindByUserUuidAndMatterUuid(user.Uuid, matter.Uuid)
+	if favorite == nil {
+		favorite = this.favoriteDao.Create(&Favorite{
+			UserUuid:   user.Uuid,
+			SpaceUuid:  matter.SpaceUuid,
+			MatterUuid: matter.Uuid,
+		})
+	}
+
+	return this.Success(favorite)
+}
+
+func (this *FavoriteController) Remove(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	matterUuid := util.ExtractRequestString(request, "matterUuid")
+
+	user := this.checkUser(request)
+	favorite := this.favoriteDao.FindByUserUuidAndMatterUuid(user.Uuid, matterUuid)
+	if favorite != nil {
+		this.favoriteDao.Delete(favorite)
+	}
+
+	return this.Success(nil)
+}
+
+// my favorites in a space.
+func (this *FavoriteController) Page(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	page := util.ExtractRequestOptionalInt(request, "page", 0)
+	pageSize := util.ExtractRequestOptionalInt(request, "pageSize", 200)
+	orderCreateTime := util.ExtractRequestOptionalString(request, "orderCreateTime", DIRECTION_DESC)
+
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	this.spaceService.CheckReadableByUuid(request, user, spaceUuid)
+
+	sortArray := []builder.OrderPair{
+		{
+			Key:   "create_time",
+			Value: orderCreateTime,
+		},
+	}
+
+	pager := this.favoriteDao.Page(page, pageSize, user.Uuid, spaceUuid, sortArray)
+
+	//fill the matters.
+	favorites := pager.Data.([]*Favorite)
+	var matterUuids []string
+	for _, favorite := range favorites {
+		matterUuids = append(matterUuids, favorite.MatterUuid)
+	}
+	if len(matterUuids) > 0 {
+		matterMap := make(map[string]*Matter)
+		for _, matter := range this.matterDao.FindByUuids(matterUuids, nil) {
+			matterMap[matter.Uuid] = matter
+		}
+		for _, favorite := range favorites {
+			favorite.Matter = matterMap[favorite.MatterUuid]
+		}
+	}
+
+	return this.Success(pager)
+}
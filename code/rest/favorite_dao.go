@@ -0,0 +1,109 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type FavoriteDao struct {
+	BaseDao
+	matterDao *MatterDao
+}
+
+func (this *FavoriteDao) Init() {
+	this.BaseDao.Init()
+
+	b := core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+}
+
+// find by userUuid and matterUuid. if not found return nil.
+func (this *FavoriteDao) FindByUserUuidAndMatterUuid(userUuid string, matterUuid string) *Favorite {
+	var entity = &Favorite{}
+	db := core.CONTEXT.GetDB().Where("user_uuid = ? AND matter_uuid = ?", userUuid, matterUuid).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+// matters in the trash are skipped.
+func (this *FavoriteDao) Page(page int, pageSize int, userUuid string, spaceUuid string, sortArray []builder.OrderPair) *Pager {
+
+	var wp = &builder.WherePair{Query: "matter_uuid IN (?)", Args: []interface{}{this.matterDao.AliveUuidQuery()}}
+
+	if userUuid != "" {
+		wp = wp.And(&builder.WherePair{Query: "user_uuid = ?", Args: []interface{}{userUuid}})
+	}
+
+	if spaceUuid != "" {
+		wp = wp.And(&builder.WherePair{Query: "space_uuid = ?", Args: []interface{}{spaceUuid}})
+	}
+
+	var conditionDB *gorm.DB
+	conditionDB = core.CONTEXT.GetDB().Model(&Favorite{}).Where(wp.Query, wp.Args...)
+
+	var count int64 = 0
+	db := conditionDB.Count(&count)
+	this.PanicError(db.Error)
+
+	var favorites []*Favorite
+	db = conditionDB.Order(this.GetSortString(sortArray)).Offset(page * pageSize).Limit(pageSize).Find(&favorites)
+	this.PanicError(db.Error)
+	pager := NewPager(page, pageSize, int(count), favorites)
+
+	return pager
+}
+
+func (this *FavoriteDao) Create(favorite *Favorite) *Favorite {
+
+	timeUUID, _ := uuid.NewV4()
+	favorite.Uuid = string(timeUUID.String())
+	favorite.CreateTime = time.Now()
+	favorite.UpdateTime = time.Now()
+	favorite.Sort = time.Now().UnixNano() / 1e6
+	db := core.CONTEXT.GetDB().Create(favorite)
+	this.PanicError(db.Error)
+
+	return favorite
+}
+
+func (this *FavoriteDao) Delete(favorite *Favorite) {
+
+	db := core.CONTEXT.GetDB().Delete(&favorite)
+	this.PanicError(db.Error)
+}
+
+func (this *FavoriteDao) DeleteByMatterUuid(matterUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid = ?", matterUuid).Delete(Favorite{})
+	this.PanicError(db.Error)
+}
+
+func (this *FavoriteDao) DeleteByMatterUuidQuery(matterUuidQuery *gorm.DB) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid IN (?)", matterUuidQuery).Delete(Favorite{})
+	this.PanicError(db.Error)
+}
+
+func (this *FavoriteDao) DeleteByUserUuid(userUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("user_uuid = ?", userUuid).Delete(Favorite{})
+	this.PanicError(db.Error)
+}
+
+func (this *FavoriteDao) Cleanup() {
+	this.logger.Info("[FavoriteDao] clean up. Delete all Favorite")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(Favorite{})
+	this.PanicError(db.Error)
+}
@@ -184,6 +184,18 @@ func (this *ImageCacheDao) DeleteByMatterUuid(matterUuid string) {
 
 }
 
+// delete all the caches of the matters in the sub query of uuids.
+func (this *ImageCacheDao) DeleteByMatterUuidQuery(matterUuidQuery *gorm.DB) {
+
+	var imageCaches []*ImageCache
+	db := core.CONTEXT.GetDB().Where("matter_uuid IN (?)", matterUuidQuery).Find(&imageCaches)
+	this.PanicError(db.Error)
+
+	for _, imageCache := range imageCaches {
+		this.Delete(imageCache)
+	}
+}
+
 func (this *ImageCacheDao) DeleteByUserUuid(userUuid string) {
 	db := core.CONTEXT.GetDB().Where("user_uuid = ?", userUuid).Delete(ImageCache{})
 	this.PanicError(db.Error)
@@ -7,6 +7,7 @@ import (
 	"github.com/eyebluecn/tank/code/tool/result"
 	"github.com/eyebluecn/tank/code/tool/util"
 	"image"
+	"io"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -17,9 +18,10 @@ import (
 // @Service
 type ImageCacheService struct {
 	BaseBean
-	imageCacheDao *ImageCacheDao
-	userDao       *UserDao
-	matterDao     *MatterDao
+	imageCacheDao  *ImageCacheDao
+	userDao        *UserDao
+	matterDao      *MatterDao
+	storageService *StorageService
 }
 
 func (this *ImageCacheService) Init() {
@@ -40,6 +42,11 @@ func (this *ImageCacheService) Init() {
 		this.matterDao = b
 	}
 
+	b = core.CONTEXT.GetBean(this.storageService)
+	if b, ok := b.(*StorageService); ok {
+		this.storageService = b
+	}
+
 }
 
 func (this *ImageCacheService) Detail(uuid string) *ImageCache {
@@ -93,14 +100,7 @@ func (this *ImageCacheService) ResizeParams(request *http.Request) (needProcess
 }
 
 // resize image.
-func (this *ImageCacheService) ResizeImage(request *http.Request, filePath string) *image.NRGBA {
-
-	diskFile, err := os.Open(filePath)
-	this.PanicError(err)
-	defer func() {
-		e := diskFile.Close()
-		this.PanicError(e)
-	}()
+func (this *ImageCacheService) ResizeImage(request *http.Request, diskFile io.Reader) *image.NRGBA {
 
 	_, imageResizeM, imageResizeW, imageResizeH := this.ResizeParams(request)
 
@@ -173,7 +173,12 @@ func (this *ImageCacheService) cacheImage(writer http.ResponseWriter, request *h
 
 	user := this.userDao.FindByUuid(matter.UserUuid)
 
-	dstImage := this.ResizeImage(request, matter.AbsolutePath())
+	reader := this.storageService.OpenMatter(matter)
+	defer func() {
+		e := reader.Close()
+		this.PanicError(e)
+	}()
+	dstImage := this.ResizeImage(request, reader)
 
 	cacheImageName := util.GetSimpleFileName(matter.Name) + "_" + mode + extension
 	cacheImageRelativePath := util.GetSimpleFileName(matter.Path) + "_" + mode + extension
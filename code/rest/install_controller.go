@@ -70,18 +70,30 @@ func (this *InstallController) Init() {
 
 	this.tableNames = []interface{}{
 		&Dashboard{},
+		&DavLock{},
+		&DavProp{},
 		&Bridge{},
+		&Blob{},
 		&DownloadToken{},
+		&Favorite{},
 		&Footprint{},
 		&ImageCache{},
+		&Job{},
 		&Matter{},
+		&MatterTag{},
+		&MatterVersion{},
 		&Preference{},
+		&Recent{},
+		&SearchTerm{},
 		&Session{},
 		&Share{},
 		&Space{},
 		&SpaceMember{},
+		&Tag{},
+		&UploadSession{},
 		&UploadToken{},
 		&User{},
+		&WorkCommit{},
 	}
 
 }
@@ -326,6 +338,30 @@ func (this *InstallController) CreateTable(writer http.ResponseWriter, request *
 
 }
 
+// create the tables and columns added since the installed version. invoked before any bean's Bootstrap.
+// existing columns and indexes are left untouched, the path index is created by MatterService after repairing the paths.
+func (this *InstallController) Migrate() {
+
+	db := core.CONTEXT.GetDB()
+
+	for _, iBase := range this.tableNames {
+		tableName, exist, _, missingFields := this.getTableMeta(db, iBase)
+
+		if !exist {
+			this.logger.Info("create table %s", tableName)
+			err := db.Migrator().CreateTable(iBase)
+			this.PanicError(err)
+			continue
+		}
+
+		for _, field := range missingFields {
+			this.logger.Info("add column %s to table %s", field.Name, tableName)
+			err := db.Migrator().AddColumn(iBase, field.Name)
+			this.PanicError(err)
+		}
+	}
+}
+
 // get the list of admin.
 func (this *InstallController) AdminList(writer http.ResponseWriter, request *http.Request) *result.WebResult {
 
@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"net/http"
+)
+
+type JobController struct {
+	BaseController
+	jobDao     *JobDao
+	jobService *JobService
+}
+
+func (this *JobController) Init() {
+	this.BaseController.Init()
+
+	b := core.CONTEXT.GetBean(this.jobDao)
+	if b, ok := b.(*JobDao); ok {
+		this.jobDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.jobService)
+	if b, ok := b.(*JobService); ok {
+		this.jobService = b
+	}
+}
+
+func (this *JobController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
+
+	routeMap := make(map[string]func(writer http.ResponseWriter, request *http.Request))
+
+	routeMap["/api/job/page"] = this.Wrap(this.Page, USER_ROLE_USER)
+	routeMap["/api/job/detail"] = this.Wrap(this.Detail, USER_ROLE_USER)
+	routeMap["/api/job/cancel"] = this.Wrap(this.Cancel, USER_ROLE_USER)
+	routeMap["/api/job/retry"] = this.Wrap(this.Retry, USER_ROLE_USER)
+
+	return routeMap
+}
+
+// my jobs. administrator can see all the jobs. the latest comes first.
+func (this *JobController) Page(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	page := util.ExtractRequestOptionalInt(request, "page", 0)
+	pageSize := util.ExtractRequestOptionalInt(request, "pageSize", 200)
+	orderCreateTime := util.ExtractRequestOptionalString(request, "orderCreateTime", DIRECTION_DESC)
+	status := util.ExtractRequestOptionalString(request, "status", "")
+	jobType := util.ExtractRequestOptionalString(request, "type", "")
+
+	user := this.checkUser(request)
+	userUuid := user.Uuid
+	if user.Role == USER_ROLE_ADMINISTRATOR {
+		userUuid = util.ExtractRequestOptionalString(request, "userUuid", "")
+	}
+
+	sortArray := []builder.OrderPair{
+		{
+			Key:   "create_time",
+			Value: orderCreateTime,
+		},
+	}
+
+	pager := this.jobDao.Page(page, pageSize, userUuid, status, jobType, sortArray)
+
+	return this.Success(pager)
+}
+
+// poll a job's status, progress and logs.
+func (this *JobController) Detail(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	job := this.checkJob(request)
+
+	return this.Success(job)
+}
+
+func (this *JobController) Cancel(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	job := this.checkJob(request)
+
+	job = this.jobService.Cancel(job)
+
+	return this.Success(job)
+}
+
+func (this *JobController) Retry(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	job := this.checkJob(request)
+
+	job = this.jobService.Retry(job)
+
+	return this.Success(job)
+}
+
+// only the owner or administrator can access a job.
+func (this *JobController) checkJob(request *http.Request) *Job {
+
+	uuid := util.ExtractRequestString(request, "uuid")
+
+	user := this.checkUser(request)
+	job := this.jobDao.CheckByUuid(uuid)
+	if job.UserUuid != user.Uuid && user.Role != USER_ROLE_ADMINISTRATOR {
+		panic(result.UNAUTHORIZED)
+	}
+
+	return job
+}
@@ -0,0 +1,110 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type JobDao struct {
+	BaseDao
+}
+
+// find by uuid. if not found return nil.
+func (this *JobDao) FindByUuid(uuid string) *Job {
+	var entity = &Job{}
+	db := core.CONTEXT.GetDB().Where("uuid = ?", uuid).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+// find by uuid. if not found panic NotFound error
+func (this *JobDao) CheckByUuid(uuid string) *Job {
+	entity := this.FindByUuid(uuid)
+	if entity == nil {
+		panic(result.NotFound("not found record with uuid = %s", uuid))
+	}
+	return entity
+}
+
+func (this *JobDao) Page(page int, pageSize int, userUuid string, status string, jobType string, sortArray []builder.OrderPair) *Pager {
+
+	var wp = &builder.WherePair{}
+
+	if userUuid != "" {
+		wp = wp.And(&builder.WherePair{Query: "user_uuid = ?", Args: []interface{}{userUuid}})
+	}
+
+	if status != "" {
+		wp = wp.And(&builder.WherePair{Query: "status = ?", Args: []interface{}{status}})
+	}
+
+	if jobType != "" {
+		wp = wp.And(&builder.WherePair{Query: "type = ?", Args: []interface{}{jobType}})
+	}
+
+	var conditionDB *gorm.DB
+	conditionDB = core.CONTEXT.GetDB().Model(&Job{}).Where(wp.Query, wp.Args...)
+
+	var count int64 = 0
+	db := conditionDB.Count(&count)
+	this.PanicError(db.Error)
+
+	var jobs []*Job
+	db = conditionDB.Order(this.GetSortString(sortArray)).Offset(page * pageSize).Limit(pageSize).Find(&jobs)
+	this.PanicError(db.Error)
+	pager := NewPager(page, pageSize, int(count), jobs)
+
+	return pager
+}
+
+// the earliest comes first.
+func (this *JobDao) FindByStatus(status string) []*Job {
+	var jobs []*Job
+	db := core.CONTEXT.GetDB().Where("status = ?", status).Order("sort ASC").Find(&jobs)
+	this.PanicError(db.Error)
+	return jobs
+}
+
+func (this *JobDao) Create(job *Job) *Job {
+
+	timeUUID, _ := uuid.NewV4()
+	job.Uuid = string(timeUUID.String())
+	job.CreateTime = time.Now()
+	job.UpdateTime = time.Now()
+	job.Sort = time.Now().UnixNano() / 1e6
+	db := core.CONTEXT.GetDB().Create(job)
+	this.PanicError(db.Error)
+
+	return job
+}
+
+func (this *JobDao) Save(job *Job) *Job {
+
+	job.UpdateTime = time.Now()
+	db := core.CONTEXT.GetDB().Save(job)
+	this.PanicError(db.Error)
+
+	return job
+}
+
+func (this *JobDao) DeleteByUserUuid(userUuid string) {
+	db := core.CONTEXT.GetDB().Where("user_uuid = ?", userUuid).Delete(Job{})
+	this.PanicError(db.Error)
+}
+
+// System cleanup.
+func (this *JobDao) Cleanup() {
+	this.logger.Info("[JobDao] clean up. Delete all Job")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(Job{})
+	this.PanicError(db.Error)
+}
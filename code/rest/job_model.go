@@ -0,0 +1,192 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	JOB_STATUS_QUEUED   = "QUEUED"
+	JOB_STATUS_RUNNING  = "RUNNING"
+	JOB_STATUS_SUCCESS  = "SUCCESS"
+	JOB_STATUS_FAIL     = "FAIL"
+	JOB_STATUS_CANCELED = "CANCELED"
+)
+
+const (
+	JOB_TYPE_CRAWL       = "CRAWL"
+	JOB_TYPE_MIRROR      = "MIRROR"
+	JOB_TYPE_MOVE        = "MOVE"
+	JOB_TYPE_EXTRACT     = "EXTRACT"
+	JOB_TYPE_SCAN        = "SCAN"
+	JOB_TYPE_DELETE_USER = "DELETE_USER"
+)
+
+const (
+	//number of the jobs running at the same time.
+	JOB_WORKER_NUM = 4
+	//crawl jobs have their own workers, as they mostly wait for the network.
+	JOB_CRAWL_WORKER_NUM = 8
+	//jobs waiting for a worker. more are refused.
+	JOB_QUEUE_SIZE = 1000
+	//only the latest log lines of a job are kept.
+	JOB_LOG_MAX_LINES = 200
+	//a running job saves its progress and logs at most once in this interval.
+	JOB_FLUSH_INTERVAL = time.Second
+)
+
+/**
+ * a long operation running in the background. it keeps the params to run again when retried.
+ */
+type Job struct {
+	Uuid       string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort       int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	UserUuid   string    `json:"userUuid" gorm:"type:char(36) not null;index:idx_job_user_uuid"`
+	SpaceUuid  string    `json:"spaceUuid" gorm:"type:char(36) not null;default:''"`
+	Type       string    `json:"type" gorm:"type:varchar(45) not null"`
+	Status     string    `json:"status" gorm:"type:varchar(45) not null;index:idx_job_status"`
+	Progress   int64     `json:"progress" gorm:"type:bigint(20) not null;default:0"` //percentage from 0 to 100.
+	Params     string    `json:"params" gorm:"type:text"`                            //json of the type's params.
+	Result     string    `json:"result" gorm:"type:text"`                            //json of the result when succeed.
+	Logs       string    `json:"logs" gorm:"type:text"`                              //latest log lines joined by \n.
+	Error      string    `json:"error" gorm:"type:varchar(1024) not null;default:''"`
+	RetryTimes int64     `json:"retryTimes" gorm:"type:bigint(20) not null;default:0"`
+	Lang       string    `json:"lang" gorm:"type:varchar(45) not null;default:''"` //language of the messages.
+	StartTime  time.Time `json:"startTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	EndTime    time.Time `json:"endTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+}
+
+// whether the job has finished.
+func (this *Job) Finished() bool {
+	return this.Status == JOB_STATUS_SUCCESS || this.Status == JOB_STATUS_FAIL || this.Status == JOB_STATUS_CANCELED
+}
+
+type CrawlJobParams struct {
+	Url      string `json:"url"`
+	Filename string `json:"filename"`
+	DirUuid  string `json:"dirUuid"`
+}
+
+type MirrorJobParams struct {
+	SrcPath   string `json:"srcPath"`
+	DestPath  string `json:"destPath"`
+	Overwrite bool   `json:"overwrite"`
+}
+
+type MoveJobParams struct {
+	SrcUuids []string `json:"srcUuids"`
+	DestUuid string   `json:"destUuid"`
+}
+
+type ExtractJobParams struct {
+	Uuid     string `json:"uuid"`
+	DestUuid string `json:"destUuid"`
+}
+
+// the target user of scan and user deletion.
+type UserJobParams struct {
+	UserUuid string `json:"userUuid"`
+}
+
+type jobRunnerKey struct{}
+
+/**
+ * a job being run by a worker. the operations report through it, and a nil runner does nothing,
+ * so the same code runs in a http request or in a job.
+ * never report inside a transaction, the job is saved with another db connection.
+ */
+type JobRunner struct {
+	Job   *Job
+	User  *User
+	Space *Space
+	//a mock request in the job's language. its context is canceled when the job is canceled.
+	Request *http.Request
+
+	jobDao    *JobDao
+	mutex     sync.Mutex
+	logs      []string
+	flushTime time.Time
+}
+
+// the runner of the job which the request belongs to. nil if not in a job.
+func JobOf(request *http.Request) *JobRunner {
+	if request == nil {
+		return nil
+	}
+	runner, _ := request.Context().Value(jobRunnerKey{}).(*JobRunner)
+	return runner
+}
+
+func (this *JobRunner) Context() context.Context {
+	if this == nil {
+		return context.Background()
+	}
+	return this.Request.Context()
+}
+
+// decode the job's params into v.
+func (this *JobRunner) Params(v interface{}) {
+	err := json.Unmarshal([]byte(this.Job.Params), v)
+	if err != nil {
+		panic(result.BadRequest("job params error. %s", err.Error()))
+	}
+}
+
+// done of total finished.
+func (this *JobRunner) Progress(done int64, total int64) {
+	if this == nil || total <= 0 {
+		return
+	}
+	progress := done * 100 / total
+	if progress > 100 {
+		progress = 100
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.Job.Progress = progress
+	this.flush(false)
+}
+
+func (this *JobRunner) Log(format string, v ...interface{}) {
+	if this == nil {
+		return
+	}
+	line := fmt.Sprintf("%s %s", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, v...))
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	this.logs = append(this.logs, line)
+	if len(this.logs) > JOB_LOG_MAX_LINES {
+		this.logs = this.logs[len(this.logs)-JOB_LOG_MAX_LINES:]
+	}
+	this.Job.Logs = strings.Join(this.logs, "\n")
+	this.flush(false)
+}
+
+// stop the operation if the job has been canceled.
+func (this *JobRunner) CheckCanceled() {
+	if this == nil {
+		return
+	}
+	if this.Request.Context().Err() != nil {
+		panic(result.BadRequest("job has been canceled."))
+	}
+}
+
+// save the job. not forced ones are skipped within the flush interval. invoker must hold the mutex.
+func (this *JobRunner) flush(force bool) {
+	if !force && time.Since(this.flushTime) < JOB_FLUSH_INTERVAL {
+		return
+	}
+	this.flushTime = time.Now()
+	this.jobDao.Save(this.Job)
+}
@@ -0,0 +1,434 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/i18n"
+	"github.com/eyebluecn/tank/code/tool/result"
+	jsoniter "github.com/json-iterator/go"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/**
+ * run the long operations as jobs in a worker pool, instead of blocking the http requests.
+ */
+//@Service
+type JobService struct {
+	BaseBean
+	jobDao            *JobDao
+	userDao           *UserDao
+	spaceDao          *SpaceDao
+	spaceService      *SpaceService
+	matterDao         *MatterDao
+	matterService     *MatterService
+	userService       *UserService
+	unitOfWorkService *UnitOfWorkService
+
+	mutex   sync.Mutex
+	started bool
+	queue   chan string
+	//queue of the crawl jobs.
+	crawlQueue chan string
+	//cancel functions of the running jobs.
+	cancels map[string]context.CancelFunc
+	//key is the job type. the returned value is saved as the job's result.
+	handlers map[string]func(runner *JobRunner) interface{}
+}
+
+func (this *JobService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.jobDao)
+	if b, ok := b.(*JobDao); ok {
+		this.jobDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.userDao)
+	if b, ok := b.(*UserDao); ok {
+		this.userDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.spaceDao)
+	if b, ok := b.(*SpaceDao); ok {
+		this.spaceDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.spaceService)
+	if b, ok := b.(*SpaceService); ok {
+		this.spaceService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterService)
+	if b, ok := b.(*MatterService); ok {
+		this.matterService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.userService)
+	if b, ok := b.(*UserService); ok {
+		this.userService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.unitOfWorkService)
+	if b, ok := b.(*UnitOfWorkService); ok {
+		this.unitOfWorkService = b
+	}
+
+	this.queue = make(chan string, JOB_QUEUE_SIZE)
+	this.crawlQueue = make(chan string, JOB_QUEUE_SIZE)
+	this.cancels = make(map[string]context.CancelFunc)
+	this.handlers = map[string]func(runner *JobRunner) interface{}{
+		JOB_TYPE_CRAWL:       this.crawl,
+		JOB_TYPE_MIRROR:      this.mirror,
+		JOB_TYPE_MOVE:        this.move,
+		JOB_TYPE_EXTRACT:     this.extract,
+		JOB_TYPE_SCAN:        this.scan,
+		JOB_TYPE_DELETE_USER: this.deleteUser,
+	}
+}
+
+// start the workers, and continue the jobs left by the last shutdown.
+func (this *JobService) Bootstrap() {
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.started {
+		return
+	}
+
+	//the works interrupted by a crash must be recovered before any job runs.
+	this.unitOfWorkService.Bootstrap()
+
+	for _, job := range this.jobDao.FindByStatus(JOB_STATUS_RUNNING) {
+		this.logger.Info("job %s %s was interrupted by the shutdown.", job.Type, job.Uuid)
+		job.Status = JOB_STATUS_FAIL
+		job.Error = "interrupted by the shutdown. retry it if needed."
+		job.EndTime = time.Now()
+		this.jobDao.Save(job)
+	}
+
+	for _, job := range this.jobDao.FindByStatus(JOB_STATUS_QUEUED) {
+		select {
+		case this.queueOf(job.Type) <- job.Uuid:
+		default:
+			job.Status = JOB_STATUS_FAIL
+			job.Error = "too many jobs queued."
+			job.EndTime = time.Now()
+			this.jobDao.Save(job)
+		}
+	}
+
+	for i := 0; i < JOB_WORKER_NUM; i++ {
+		go this.work(this.queue)
+	}
+	for i := 0; i < JOB_CRAWL_WORKER_NUM; i++ {
+		go this.work(this.crawlQueue)
+	}
+	this.started = true
+}
+
+// queue a job of user in space. space is nil for the jobs not in a space.
+func (this *JobService) Submit(request *http.Request, user *User, space *Space, jobType string, params interface{}) *Job {
+
+	if _, ok := this.handlers[jobType]; !ok {
+		panic(result.BadRequest("job type %s not supported.", jobType))
+	}
+
+	paramsData, err := json.Marshal(params)
+	this.PanicError(err)
+
+	job := &Job{
+		UserUuid: user.Uuid,
+		Type:     jobType,
+		Status:   JOB_STATUS_QUEUED,
+		Params:   string(paramsData),
+		Lang:     i18n.Lang(request),
+	}
+	if space != nil {
+		job.SpaceUuid = space.Uuid
+	}
+	job = this.jobDao.Create(job)
+
+	this.enqueue(job)
+
+	return job
+}
+
+// a queued job is canceled at once, and a running one stops at its next check.
+func (this *JobService) Cancel(job *Job) *Job {
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	job = this.jobDao.CheckByUuid(job.Uuid)
+	switch job.Status {
+	case JOB_STATUS_QUEUED:
+		job.Status = JOB_STATUS_CANCELED
+		job.EndTime = time.Now()
+		job = this.jobDao.Save(job)
+	case JOB_STATUS_RUNNING:
+		if cancel, ok := this.cancels[job.Uuid]; ok {
+			cancel()
+		}
+	default:
+		panic(result.BadRequest("job has finished. Cannot cancel."))
+	}
+
+	return job
+}
+
+// run a failed or canceled job again with the same params.
+func (this *JobService) Retry(job *Job) *Job {
+
+	this.mutex.Lock()
+	job = this.jobDao.CheckByUuid(job.Uuid)
+	if job.Status != JOB_STATUS_FAIL && job.Status != JOB_STATUS_CANCELED {
+		this.mutex.Unlock()
+		panic(result.BadRequest("only failed or canceled job can be retried."))
+	}
+
+	job.Status = JOB_STATUS_QUEUED
+	job.RetryTimes++
+	job.Progress = 0
+	job.Result = ""
+	job.Logs = ""
+	job.Error = ""
+	job = this.jobDao.Save(job)
+	this.mutex.Unlock()
+
+	this.enqueue(job)
+
+	return job
+}
+
+func (this *JobService) queueOf(jobType string) chan string {
+	if jobType == JOB_TYPE_CRAWL {
+		return this.crawlQueue
+	}
+	return this.queue
+}
+
+func (this *JobService) enqueue(job *Job) {
+	select {
+	case this.queueOf(job.Type) <- job.Uuid:
+	default:
+		job.Status = JOB_STATUS_FAIL
+		job.Error = "too many jobs queued."
+		job.EndTime = time.Now()
+		this.jobDao.Save(job)
+		panic(result.BadRequest("too many jobs queued. Please try later."))
+	}
+}
+
+func (this *JobService) work(queue chan string) {
+	for uuid := range queue {
+		core.RunWithRecovery(func() {
+			this.run(uuid)
+		})
+	}
+}
+
+func (this *JobService) run(uuid string) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//a job canceled while queued is skipped.
+	this.mutex.Lock()
+	job := this.jobDao.FindByUuid(uuid)
+	if job == nil || job.Status != JOB_STATUS_QUEUED {
+		this.mutex.Unlock()
+		return
+	}
+	job.Status = JOB_STATUS_RUNNING
+	job.StartTime = time.Now()
+	job = this.jobDao.Save(job)
+	this.cancels[uuid] = cancel
+	this.mutex.Unlock()
+
+	defer func() {
+		this.mutex.Lock()
+		delete(this.cancels, uuid)
+		this.mutex.Unlock()
+	}()
+
+	runner := &JobRunner{Job: job, jobDao: this.jobDao}
+	header := http.Header{}
+	header.Set("Accept-Language", job.Lang)
+	runner.Request = (&http.Request{Header: header}).WithContext(context.WithValue(ctx, jobRunnerKey{}, runner))
+
+	this.logger.Info("run job %s %s", job.Type, job.Uuid)
+	value, err := this.invoke(runner)
+
+	runner.mutex.Lock()
+	defer runner.mutex.Unlock()
+	job.EndTime = time.Now()
+	if err != nil {
+		if ctx.Err() != nil {
+			job.Status = JOB_STATUS_CANCELED
+		} else {
+			job.Status = JOB_STATUS_FAIL
+		}
+		job.Error = jobErrorMessage(err)
+		this.logger.Error("job %s %s %s. %s", job.Type, job.Uuid, job.Status, job.Error)
+	} else {
+		job.Status = JOB_STATUS_SUCCESS
+		job.Progress = 100
+		if value != nil {
+			//same format as the web results.
+			resultData, err := jsoniter.ConfigCompatibleWithStandardLibrary.Marshal(value)
+			this.PanicError(err)
+			job.Result = string(resultData)
+		}
+	}
+	runner.flush(true)
+}
+
+// invoke the job's handler, and recover its panic as err.
+func (this *JobService) invoke(runner *JobRunner) (value interface{}, err interface{}) {
+
+	defer func() {
+		err = recover()
+	}()
+
+	job := runner.Job
+	runner.User = this.userDao.CheckByUuid(job.UserUuid)
+	if job.SpaceUuid != "" {
+		runner.Space = this.spaceService.CheckWritableByUuid(runner.Request, runner.User, job.SpaceUuid)
+	}
+
+	handler, ok := this.handlers[job.Type]
+	if !ok {
+		panic(result.BadRequest("job type %s not supported.", job.Type))
+	}
+	value = handler(runner)
+	return value, nil
+}
+
+func jobErrorMessage(err interface{}) string {
+	var message string
+	if value, ok := err.(string); ok {
+		message = value
+	} else if value, ok := err.(*result.CodeWrapper); ok {
+		message = value.Description
+	} else if value, ok := err.(error); ok {
+		message = value.Error()
+	} else {
+		message = fmt.Sprintf("%v", err)
+	}
+
+	//fit the column.
+	runes := []rune(message)
+	if len(runes) > 1000 {
+		message = string(runes[:1000])
+	}
+	return message
+}
+
+func (this *JobService) checkAdministrator(runner *JobRunner) {
+	if runner.User.Role != USER_ROLE_ADMINISTRATOR {
+		panic(result.UNAUTHORIZED)
+	}
+}
+
+func (this *JobService) crawl(runner *JobRunner) interface{} {
+
+	params := &CrawlJobParams{}
+	runner.Params(params)
+
+	dirMatter := this.matterDao.CheckWithRootByUuid(params.DirUuid, runner.Space)
+	if dirMatter.SpaceUuid != runner.Space.Uuid {
+		panic(result.UNAUTHORIZED)
+	}
+
+	runner.Log("crawl %s to %s/%s", params.Url, dirMatter.Path, params.Filename)
+	return this.matterService.AtomicCrawl(runner.Request, params.Url, params.Filename, runner.User, runner.Space, dirMatter, true)
+}
+
+func (this *JobService) mirror(runner *JobRunner) interface{} {
+
+	params := &MirrorJobParams{}
+	runner.Params(params)
+
+	runner.Log("mirror %s to %s", params.SrcPath, params.DestPath)
+	this.matterService.AtomicMirror(runner.Request, params.SrcPath, params.DestPath, params.Overwrite, runner.User, runner.Space)
+	return nil
+}
+
+func (this *JobService) move(runner *JobRunner) interface{} {
+
+	params := &MoveJobParams{}
+	runner.Params(params)
+
+	srcMatters, destMatter := this.matterService.CheckMoveBatch(runner.Request, params.SrcUuids, params.DestUuid, runner.User, runner.Space)
+
+	runner.Log("move %d matters to %s", len(srcMatters), destMatter.Path)
+	this.matterService.AtomicMoveBatch(runner.Request, srcMatters, destMatter, runner.User, runner.Space)
+	return nil
+}
+
+func (this *JobService) extract(runner *JobRunner) interface{} {
+
+	params := &ExtractJobParams{}
+	runner.Params(params)
+
+	matter := this.matterDao.CheckByUuid(params.Uuid)
+	if matter.SpaceUuid != runner.Space.Uuid {
+		panic(result.UNAUTHORIZED)
+	}
+	if matter.Deleted {
+		panic(result.BadRequest("matter has been deleted. Cannot extract."))
+	}
+	destMatter := this.matterDao.CheckWithRootByUuid(params.DestUuid, runner.Space)
+	if destMatter.SpaceUuid != runner.Space.Uuid {
+		panic(result.UNAUTHORIZED)
+	}
+
+	runner.Log("extract %s to %s", matter.Path, destMatter.Path)
+	return this.matterService.AtomicExtract(runner.Request, matter, destMatter, runner.User, runner.Space)
+}
+
+func (this *JobService) scan(runner *JobRunner) interface{} {
+
+	this.checkAdministrator(runner)
+
+	params := &UserJobParams{}
+	runner.Params(params)
+
+	user := this.userDao.CheckByUuid(params.UserUuid)
+	space := this.spaceDao.CheckByUuid(user.SpaceUuid)
+
+	runner.Log("delete the matters whose physics files not exist")
+	this.matterService.DeleteByPhysics(runner.Request, user, space)
+	runner.Progress(1, 2)
+
+	runner.Log("scan the physics files of %s", user.Username)
+	this.matterService.ScanPhysics(runner.Request, user, space)
+	return nil
+}
+
+func (this *JobService) deleteUser(runner *JobRunner) interface{} {
+
+	this.checkAdministrator(runner)
+
+	params := &UserJobParams{}
+	runner.Params(params)
+
+	user := this.userDao.CheckByUuid(params.UserUuid)
+	if user.Status != USER_STATUS_DISABLED {
+		panic(result.BadRequest("Only disabled user can be deleted."))
+	}
+
+	runner.Log("delete user %s", user.Username)
+	this.userService.DeleteUser(runner.Request, user)
+	return nil
+}
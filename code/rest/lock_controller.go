@@ -0,0 +1,48 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"net/http"
+)
+
+type LockController struct {
+	BaseController
+	lockService *LockService
+}
+
+func (this *LockController) Init() {
+	this.BaseController.Init()
+
+	b := core.CONTEXT.GetBean(this.lockService)
+	if b, ok := b.(*LockService); ok {
+		this.lockService = b
+	}
+}
+
+func (this *LockController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
+
+	routeMap := make(map[string]func(writer http.ResponseWriter, request *http.Request))
+
+	routeMap["/api/lock/list"] = this.Wrap(this.List, USER_ROLE_ADMINISTRATOR)
+	routeMap["/api/lock/release"] = this.Wrap(this.Release, USER_ROLE_ADMINISTRATOR)
+
+	return routeMap
+}
+
+// the held and waiting locks, for diagnosing the blocked operations.
+func (this *LockController) List(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	return this.Success(this.lockService.List())
+}
+
+// force release a stuck lock.
+func (this *LockController) Release(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	id := util.ExtractRequestInt64(request, "id")
+
+	this.lockService.Release(id)
+
+	return this.Success(nil)
+}
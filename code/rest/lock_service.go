@@ -0,0 +1,121 @@
+package rest
+
+import (
+	"context"
+	"github.com/eyebluecn/tank/code/tool/lock"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	//max time to wait for a conflicting operation.
+	LOCK_WAIT = 10 * time.Second
+	//a lock is dropped if not released or renewed in time, so that a dead operation blocks nothing for long.
+	LOCK_LEASE = 2 * time.Minute
+	//the held locks are renewed at this interval.
+	LOCK_RENEW_INTERVAL = LOCK_LEASE / 4
+)
+
+// locks held by an operation. they are renewed until released, or until the context of the operation is done, eg. the job is canceled.
+type lockKeep struct {
+	locks   []*lock.Lock
+	context context.Context
+}
+
+// path locks of the matter operations. operations on disjoint subtrees run in parallel.
+// @Service
+type LockService struct {
+	BaseBean
+	locker *lock.PathLocker
+
+	mutex sync.Mutex
+	//key is the id of the first lock.
+	keeps map[int64]*lockKeep
+}
+
+func (this *LockService) Init() {
+	this.BaseBean.Init()
+
+	this.locker = lock.NewPathLocker()
+	this.keeps = make(map[int64]*lockKeep)
+
+	go this.renewLoop()
+}
+
+// lock the paths for an operation of the request. panic 423 if not acquired in LOCK_WAIT.
+// locks are not reentrant, so never lock again before unlock.
+func (this *LockService) Lock(request *http.Request, user *User, operation string, requests ...lock.Request) []*lock.Lock {
+
+	owner := operation
+	if user != nil {
+		owner = user.Username + " " + operation
+	}
+
+	locks, err := this.locker.Acquire(requests, owner, LOCK_WAIT, LOCK_LEASE)
+	if err != nil {
+		this.logger.Warn("%s cannot acquire the lock. %s", owner, err.Error())
+		panic(result.CustomWebResult(result.LOCKED, "file is being operating, retry later"))
+	}
+
+	if len(locks) > 0 {
+		//a job is canceled by its runner, and a http request is done when the client goes away.
+		ctx := context.Background()
+		if runner := JobOf(request); runner != nil {
+			ctx = runner.Context()
+		} else if request != nil {
+			ctx = request.Context()
+		}
+
+		this.mutex.Lock()
+		this.keeps[locks[0].Id] = &lockKeep{locks: locks, context: ctx}
+		this.mutex.Unlock()
+	}
+	return locks
+}
+
+func (this *LockService) Unlock(locks []*lock.Lock) {
+	if len(locks) > 0 {
+		this.mutex.Lock()
+		delete(this.keeps, locks[0].Id)
+		this.mutex.Unlock()
+	}
+	this.locker.Release(locks)
+}
+
+// renew the held locks periodically, so that a long operation keeps them with a short lease.
+func (this *LockService) renewLoop() {
+	for range time.Tick(LOCK_RENEW_INTERVAL) {
+		this.renew()
+	}
+}
+
+func (this *LockService) renew() {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for id, keep := range this.keeps {
+		if keep.context.Err() != nil {
+			this.logger.Warn("stop renewing the locks of a canceled operation %s", keep.locks[0].Owner)
+			delete(this.keeps, id)
+			continue
+		}
+		if this.locker.Renew(keep.locks, LOCK_LEASE) != nil {
+			//released by force.
+			delete(this.keeps, id)
+		}
+	}
+}
+
+// the granted and waiting locks.
+func (this *LockService) List() []*lock.Lock {
+	return this.locker.List()
+}
+
+// force release a lock left by a stuck operation.
+func (this *LockService) Release(id int64) {
+	if !this.locker.ReleaseById(id) {
+		panic(result.NotFound("lock %d not found", id))
+	}
+}
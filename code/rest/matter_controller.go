@@ -2,12 +2,11 @@ package rest
 
 import (
 	"github.com/eyebluecn/tank/code/core"
-	"github.com/eyebluecn/tank/code/tool/i18n"
 	"github.com/eyebluecn/tank/code/tool/result"
 	"github.com/eyebluecn/tank/code/tool/util"
 	"net/http"
-	"sort"
 	"strings"
+	"time"
 )
 
 type MatterController struct {
@@ -22,6 +21,10 @@ type MatterController struct {
 	shareService      *ShareService
 	bridgeDao         *BridgeDao
 	imageCacheService *ImageCacheService
+	searchService     *SearchService
+	trashService      *TrashService
+	jobService        *JobService
+	crawlService      *CrawlService
 }
 
 func (this *MatterController) Init() {
@@ -71,6 +74,26 @@ func (this *MatterController) Init() {
 	if b, ok := b.(*ImageCacheService); ok {
 		this.imageCacheService = b
 	}
+
+	b = core.CONTEXT.GetBean(this.searchService)
+	if b, ok := b.(*SearchService); ok {
+		this.searchService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.trashService)
+	if b, ok := b.(*TrashService); ok {
+		this.trashService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.jobService)
+	if b, ok := b.(*JobService); ok {
+		this.jobService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.crawlService)
+	if b, ok := b.(*CrawlService); ok {
+		this.crawlService = b
+	}
 }
 
 func (this *MatterController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
@@ -79,10 +102,13 @@ func (this *MatterController) RegisterRoutes() map[string]func(writer http.Respo
 	routeMap["/api/matter/detail"] = this.Wrap(this.Detail, USER_ROLE_USER)
 	routeMap["/api/matter/page"] = this.Wrap(this.Page, USER_ROLE_USER)
 	routeMap["/api/matter/search"] = this.Wrap(this.Search, USER_ROLE_USER)
+	routeMap["/api/matter/search/rebuild"] = this.Wrap(this.SearchRebuild, USER_ROLE_ADMINISTRATOR)
 
 	routeMap["/api/matter/create/directory"] = this.Wrap(this.CreateDirectory, USER_ROLE_USER)
 	routeMap["/api/matter/upload"] = this.Wrap(this.Upload, USER_ROLE_USER)
+	routeMap["/api/matter/upload/instant"] = this.Wrap(this.InstantUpload, USER_ROLE_USER)
 	routeMap["/api/matter/crawl"] = this.Wrap(this.Crawl, USER_ROLE_USER)
+	routeMap["/api/matter/crawl/batch"] = this.Wrap(this.CrawlBatch, USER_ROLE_USER)
 	routeMap["/api/matter/soft/delete"] = this.Wrap(this.SoftDelete, USER_ROLE_USER)
 	routeMap["/api/matter/soft/delete/batch"] = this.Wrap(this.SoftDeleteBatch, USER_ROLE_USER)
 	routeMap["/api/matter/recovery"] = this.Wrap(this.Recovery, USER_ROLE_USER)
@@ -97,6 +123,9 @@ func (this *MatterController) RegisterRoutes() map[string]func(writer http.Respo
 	//mirror local files.
 	routeMap["/api/matter/mirror"] = this.Wrap(this.Mirror, USER_ROLE_USER)
 	routeMap["/api/matter/zip"] = this.Wrap(this.Zip, USER_ROLE_USER)
+	routeMap["/api/matter/extract"] = this.Wrap(this.Extract, USER_ROLE_USER)
+	routeMap["/api/matter/archive/list"] = this.Wrap(this.ArchiveList, USER_ROLE_USER)
+	routeMap["/api/matter/archive/download"] = this.WrapPure(this.ArchiveDownload, USER_ROLE_USER)
 
 	return routeMap
 }
@@ -143,6 +172,7 @@ func (this *MatterController) Page(writer http.ResponseWriter, request *http.Req
 	dir := util.ExtractRequestOptionalString(request, "dir", "")
 	deleted := util.ExtractRequestOptionalString(request, "deleted", "")
 	extensionsStr := util.ExtractRequestOptionalString(request, "extensions", "")
+	tagUuid := util.ExtractRequestOptionalString(request, "tagUuid", "")
 
 	user := this.checkUser(request)
 	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
@@ -170,59 +200,81 @@ func (this *MatterController) Page(writer http.ResponseWriter, request *http.Req
 		dir,
 		deleted,
 		extensions,
+		tagUuid,
 		spaceUuid,
 	)
 
 	return this.Success(pager)
 }
 
-// DFS search.
+// search by the index. results are ranked by score.
 func (this *MatterController) Search(writer http.ResponseWriter, request *http.Request) *result.WebResult {
 
+	page := util.ExtractRequestOptionalInt(request, "page", 0)
 	limit := util.ExtractRequestOptionalInt(request, "limit", 200)
-	puuid := util.ExtractRequestString(request, "puuid")
+	puuid := util.ExtractRequestOptionalString(request, "puuid", MATTER_ROOT)
 	keyword := util.ExtractRequestString(request, "keyword")
-	deletedStr := util.ExtractRequestOptionalString(request, "deleted", "")
-	var deleted = false
-	if deletedStr == TRUE {
-		deleted = true
+	dir := util.ExtractRequestOptionalString(request, "dir", "")
+	deleted := util.ExtractRequestOptionalBool(request, "deleted", false)
+	extensionsStr := util.ExtractRequestOptionalString(request, "extensions", "")
+	sizeMin := util.ExtractRequestOptionalInt64(request, "sizeMin", -1)
+	sizeMax := util.ExtractRequestOptionalInt64(request, "sizeMax", -1)
+
+	var updateTimeAfter *time.Time
+	if request.FormValue("updateTimeAfter") != "" {
+		t := util.ExtractRequestTime(request, "updateTimeAfter")
+		updateTimeAfter = &t
+	}
+	var updateTimeBefore *time.Time
+	if request.FormValue("updateTimeBefore") != "" {
+		t := util.ExtractRequestTime(request, "updateTimeBefore")
+		updateTimeBefore = &t
+	}
+
+	var extensions []string
+	if extensionsStr != "" {
+		extensions = strings.Split(extensionsStr, ",")
 	}
 
 	user := this.checkUser(request)
 	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
-	this.spaceService.CheckReadableByUuid(request, user, spaceUuid)
+	space := this.spaceService.CheckReadableByUuid(request, user, spaceUuid)
+
+	dirMatter := this.matterDao.CheckWithRootByUuid(puuid, space)
+	if dirMatter.SpaceUuid != space.Uuid {
+		panic(result.UNAUTHORIZED)
+	}
 
-	matters := this.matterService.DfsSearch(
+	pager := this.searchService.Search(
 		request,
+		page,
 		limit,
-		puuid,
+		space,
 		keyword,
-		spaceUuid,
+		dirMatter,
+		dir,
 		deleted,
+		extensions,
+		sizeMin,
+		sizeMax,
+		updateTimeAfter,
+		updateTimeBefore,
 	)
 
-	//sort.
-	//从小到大自定义排序
-	sort.Slice(matters, func(i, j int) bool {
-		matter1 := matters[i]
-		matter2 := matters[j]
-		if matter1.Dir {
-			return true
-		} else if matter2.Dir {
-			return false
-		} else {
-			cmp := strings.Compare(matter1.Name, matter2.Name)
-			if cmp < 0 {
-				return true
-			} else if cmp == 0 {
-				return true
-			} else {
-				return false
-			}
-		}
+	return this.Success(pager.Data)
+}
+
+// index all the matters of a space again. it runs in background.
+func (this *MatterController) SearchRebuild(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	spaceUuid := util.ExtractRequestString(request, "spaceUuid")
+	space := this.spaceDao.CheckByUuid(spaceUuid)
+
+	go core.RunWithRecovery(func() {
+		this.searchService.Rebuild(space)
 	})
 
-	return this.Success(matters)
+	return this.Success(nil)
 }
 
 func (this *MatterController) CreateDirectory(writer http.ResponseWriter, request *http.Request) *result.WebResult {
@@ -271,7 +323,28 @@ func (this *MatterController) Upload(writer http.ResponseWriter, request *http.R
 	dirMatter := this.matterDao.CheckWithRootByUuid(puuid, space)
 
 	//support upload simultaneously
-	matter := this.matterService.Upload(request, file, handler, user, space, dirMatter, fileName, privacy)
+	matter := this.matterService.AtomicUpload(request, file, handler, user, space, dirMatter, fileName, privacy)
+
+	return this.Success(matter)
+}
+
+// upload by the declared size and hash. if the content exists, the matter is created without any bytes.
+// return null if not exist, then upload as usual.
+func (this *MatterController) InstantUpload(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+	puuid := util.ExtractRequestString(request, "puuid")
+	filename := util.ExtractRequestString(request, "filename")
+	size := util.ExtractRequestInt64(request, "size")
+	sha256 := util.ExtractRequestString(request, "sha256")
+	md5 := util.ExtractRequestOptionalString(request, "md5", "")
+	privacy := util.ExtractRequestOptionalBool(request, "privacy", true)
+
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	space := this.spaceService.CheckWritableByUuid(request, user, spaceUuid)
+
+	dirMatter := this.matterDao.CheckWithRootByUuid(puuid, space)
+
+	matter := this.matterService.AtomicInstantUpload(request, size, sha256, md5, user, space, dirMatter, filename, privacy)
 
 	return this.Success(matter)
 }
@@ -280,14 +353,73 @@ func (this *MatterController) Upload(writer http.ResponseWriter, request *http.R
 func (this *MatterController) Crawl(writer http.ResponseWriter, request *http.Request) *result.WebResult {
 
 	url := util.ExtractRequestString(request, "url")
-	destPath := util.ExtractRequestOptionalString(request, "destPath", "")
-	puuid := util.ExtractRequestOptionalString(request, "puuid", "")
 	filename := util.ExtractRequestString(request, "filename")
 
 	user := this.checkUser(request)
 	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
 	space := this.spaceService.CheckWritableByUuid(request, user, spaceUuid)
 
+	dirMatter := this.crawlDir(request, user, space)
+
+	if url == "" || (!strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://")) {
+		panic(" url must start with  http:// or https://")
+	}
+	this.crawlService.CheckUrl(url)
+
+	if util.ExtractRequestOptionalBool(request, "async", false) {
+		job := this.jobService.Submit(request, user, space, JOB_TYPE_CRAWL, &CrawlJobParams{Url: url, Filename: filename, DirUuid: dirMatter.Uuid})
+		return this.Success(job)
+	}
+
+	matter := this.matterService.AtomicCrawl(request, url, filename, user, space, dirMatter, true)
+
+	return this.Success(matter)
+}
+
+// queue the crawls of many urls, one job for each. the filenames come from the urls.
+func (this *MatterController) CrawlBatch(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	urlsStr := util.ExtractRequestString(request, "urls")
+
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	space := this.spaceService.CheckWritableByUuid(request, user, spaceUuid)
+
+	dirMatter := this.crawlDir(request, user, space)
+
+	//one url per line. check all of them before queueing.
+	var urls []string
+	for _, url := range strings.Split(urlsStr, "\n") {
+		url = strings.TrimSpace(url)
+		if url == "" {
+			continue
+		}
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			panic(result.BadRequest("url must start with http:// or https://. %s", url))
+		}
+		this.crawlService.CheckUrl(url)
+		CheckMatterName(request, CrawlFilename(url))
+		urls = append(urls, url)
+	}
+	if len(urls) == 0 {
+		panic(result.BadRequest("urls cannot be null"))
+	}
+
+	var jobs []*Job
+	for _, url := range urls {
+		job := this.jobService.Submit(request, user, space, JOB_TYPE_CRAWL, &CrawlJobParams{Url: url, Filename: CrawlFilename(url), DirUuid: dirMatter.Uuid})
+		jobs = append(jobs, job)
+	}
+
+	return this.Success(jobs)
+}
+
+// the directory to crawl into, by puuid or destPath.
+func (this *MatterController) crawlDir(request *http.Request, user *User, space *Space) *Matter {
+
+	destPath := util.ExtractRequestOptionalString(request, "destPath", "")
+	puuid := util.ExtractRequestOptionalString(request, "puuid", "")
+
 	var dirMatter *Matter
 	if puuid != "" {
 		dirMatter = this.matterDao.CheckWithRootByUuid(puuid, space)
@@ -303,14 +435,7 @@ func (this *MatterController) Crawl(writer http.ResponseWriter, request *http.Re
 		}
 		dirMatter = this.matterService.CreateDirectories(request, user, space, destPath)
 	}
-
-	if url == "" || (!strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://")) {
-		panic(" url must start with  http:// or https://")
-	}
-
-	matter := this.matterService.AtomicCrawl(request, url, filename, user, space, dirMatter, true)
-
-	return this.Success(matter)
+	return dirMatter
 }
 
 // soft delete.
@@ -366,10 +491,11 @@ func (this *MatterController) SoftDeleteBatch(writer http.ResponseWriter, reques
 	return this.Success("OK")
 }
 
-// recovery delete.
+// recovery delete. restored to the original directory.
 func (this *MatterController) Recovery(writer http.ResponseWriter, request *http.Request) *result.WebResult {
 
 	uuid := util.ExtractRequestString(request, "uuid")
+	conflict := this.trashService.CheckConflict(request, util.ExtractRequestOptionalString(request, "conflict", TRASH_CONFLICT_RENAME))
 
 	user := this.checkUser(request)
 	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
@@ -381,7 +507,7 @@ func (this *MatterController) Recovery(writer http.ResponseWriter, request *http
 		panic(result.UNAUTHORIZED)
 	}
 
-	this.matterService.AtomicRecovery(request, matter, user)
+	this.trashService.AtomicRestore(request, matter, nil, conflict, user, space)
 
 	return this.Success("OK")
 }
@@ -389,6 +515,7 @@ func (this *MatterController) Recovery(writer http.ResponseWriter, request *http
 // recovery batch.
 func (this *MatterController) RecoveryBatch(writer http.ResponseWriter, request *http.Request) *result.WebResult {
 	uuids := util.ExtractRequestString(request, "uuids")
+	conflict := this.trashService.CheckConflict(request, util.ExtractRequestOptionalString(request, "conflict", TRASH_CONFLICT_RENAME))
 
 	user := this.checkUser(request)
 	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
@@ -409,7 +536,7 @@ func (this *MatterController) RecoveryBatch(writer http.ResponseWriter, request
 			panic(result.UNAUTHORIZED)
 		}
 
-		this.matterService.AtomicRecovery(request, matter, user)
+		this.trashService.AtomicRestore(request, matter, nil, conflict, user, space)
 
 	}
 
@@ -533,48 +660,15 @@ func (this *MatterController) Move(writer http.ResponseWriter, request *http.Req
 	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
 	space := this.spaceService.CheckWritableByUuid(request, user, spaceUuid)
 
-	var srcUuids []string
-	srcUuids = strings.Split(srcUuidsStr, ",")
-
-	var destMatter = this.matterDao.CheckWithRootByUuid(destUuid, space)
-	if !destMatter.Dir {
-		panic(result.BadRequest("destination is not a directory"))
-	}
-
-	if destMatter.SpaceUuid != space.Uuid {
-		panic(result.UNAUTHORIZED)
-	}
+	srcUuids := strings.Split(srcUuidsStr, ",")
 
-	if destMatter.Deleted {
-		panic(result.BadRequest("dest matter has been deleted. Cannot move."))
-	}
-
-	var srcMatters []*Matter
-	for _, uuid := range srcUuids {
-		srcMatter := this.matterDao.CheckByUuid(uuid)
-
-		if srcMatter.Puuid == destMatter.Uuid {
-			panic(result.BadRequest("no move, invalid operation"))
-		}
-
-		if srcMatter.Deleted {
-			panic(result.BadRequest("src matter has been deleted. Cannot move."))
-		}
-
-		//check whether there are files with the same name.
-		count := this.matterDao.CountByUserUuidAndPuuidAndDirAndName(user.Uuid, destMatter.Uuid, srcMatter.Dir, srcMatter.Name)
-
-		if count > 0 {
-			panic(result.BadRequestI18n(request, i18n.MatterExist, srcMatter.Name))
-		}
-
-		if srcMatter.SpaceUuid != destMatter.SpaceUuid {
-			panic("space not the same")
-		}
-
-		srcMatters = append(srcMatters, srcMatter)
+	if util.ExtractRequestOptionalBool(request, "async", false) {
+		this.matterService.CheckMoveBatch(request, srcUuids, destUuid, user, space)
+		job := this.jobService.Submit(request, user, space, JOB_TYPE_MOVE, &MoveJobParams{SrcUuids: srcUuids, DestUuid: destUuid})
+		return this.Success(job)
 	}
 
+	srcMatters, destMatter := this.matterService.CheckMoveBatch(request, srcUuids, destUuid, user, space)
 	this.matterService.AtomicMoveBatch(request, srcMatters, destMatter, user, space)
 
 	return this.Success(nil)
@@ -591,6 +685,14 @@ func (this *MatterController) Mirror(writer http.ResponseWriter, request *http.R
 	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
 	space := this.spaceService.CheckWritableByUuid(request, user, spaceUuid)
 
+	if util.ExtractRequestOptionalBool(request, "async", false) {
+		//fail fast. checked again when the job runs.
+		roots := this.matterService.CheckMirrorAble(request, user, space)
+		this.matterService.checkMirrorPath(roots, srcPath)
+		job := this.jobService.Submit(request, user, space, JOB_TYPE_MIRROR, &MirrorJobParams{SrcPath: srcPath, DestPath: destPath, Overwrite: overwrite})
+		return this.Success(job)
+	}
+
 	this.matterService.AtomicMirror(request, srcPath, destPath, overwrite, user, space)
 
 	return this.Success(nil)
@@ -632,3 +734,63 @@ func (this *MatterController) Zip(writer http.ResponseWriter, request *http.Requ
 
 	return nil
 }
+
+// extract a zip or tar.gz into a directory. default to the archive's directory.
+func (this *MatterController) Extract(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	uuid := util.ExtractRequestString(request, "uuid")
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	space := this.spaceService.CheckWritableByUuid(request, user, spaceUuid)
+
+	matter := this.matterDao.CheckByUuid(uuid)
+	if matter.SpaceUuid != space.Uuid {
+		panic(result.UNAUTHORIZED)
+	}
+	if matter.Deleted {
+		panic(result.BadRequest("matter has been deleted. Cannot extract."))
+	}
+
+	destUuid := util.ExtractRequestOptionalString(request, "destUuid", matter.Puuid)
+	destMatter := this.matterDao.CheckWithRootByUuid(destUuid, space)
+	if destMatter.SpaceUuid != space.Uuid {
+		panic(result.UNAUTHORIZED)
+	}
+
+	if util.ExtractRequestOptionalBool(request, "async", false) {
+		job := this.jobService.Submit(request, user, space, JOB_TYPE_EXTRACT, &ExtractJobParams{Uuid: matter.Uuid, DestUuid: destMatter.Uuid})
+		return this.Success(job)
+	}
+
+	destMatter = this.matterService.AtomicExtract(request, matter, destMatter, user, space)
+
+	return this.Success(destMatter)
+}
+
+// list the entries of an archive.
+func (this *MatterController) ArchiveList(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	uuid := util.ExtractRequestString(request, "uuid")
+	user := this.checkUser(request)
+
+	matter := this.matterDao.CheckByUuid(uuid)
+	this.spaceService.CheckReadableByUuid(request, user, matter.SpaceUuid)
+
+	entries := this.matterService.ArchiveEntries(request, matter)
+
+	return this.Success(entries)
+}
+
+// download a single file inside an archive. Support chunk download.
+func (this *MatterController) ArchiveDownload(writer http.ResponseWriter, request *http.Request) {
+
+	uuid := util.ExtractRequestString(request, "uuid")
+	name := util.ExtractRequestString(request, "name")
+	withContentDisposition := util.ExtractRequestOptionalBool(request, "download", true)
+	user := this.checkUser(request)
+
+	matter := this.matterDao.CheckByUuid(uuid)
+	this.spaceService.CheckReadableByUuid(request, user, matter.SpaceUuid)
+
+	this.matterService.DownloadArchiveEntry(writer, request, matter, name, withContentDisposition)
+}
@@ -1,6 +1,7 @@
 package rest
 
 import (
+	"fmt"
 	"github.com/eyebluecn/tank/code/core"
 	"github.com/eyebluecn/tank/code/tool/builder"
 	"github.com/eyebluecn/tank/code/tool/result"
@@ -9,13 +10,22 @@ import (
 	"gorm.io/gorm"
 	"math"
 	"os"
+	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 type MatterDao struct {
 	BaseDao
-	imageCacheDao *ImageCacheDao
-	bridgeDao     *BridgeDao
+	imageCacheDao        *ImageCacheDao
+	bridgeDao            *BridgeDao
+	blobService          *BlobService
+	matterVersionService *MatterVersionService
+	searchTermDao        *SearchTermDao
+	matterTagDao         *MatterTagDao
+	davPropDao           *DavPropDao
+	favoriteDao          *FavoriteDao
+	recentDao            *RecentDao
 }
 
 func (this *MatterDao) Init() {
@@ -31,11 +41,50 @@ func (this *MatterDao) Init() {
 		this.bridgeDao = b
 	}
 
+	b = core.CONTEXT.GetBean(this.blobService)
+	if b, ok := b.(*BlobService); ok {
+		this.blobService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterVersionService)
+	if b, ok := b.(*MatterVersionService); ok {
+		this.matterVersionService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.searchTermDao)
+	if b, ok := b.(*SearchTermDao); ok {
+		this.searchTermDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterTagDao)
+	if b, ok := b.(*MatterTagDao); ok {
+		this.matterTagDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.davPropDao)
+	if b, ok := b.(*DavPropDao); ok {
+		this.davPropDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.favoriteDao)
+	if b, ok := b.(*FavoriteDao); ok {
+		this.favoriteDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.recentDao)
+	if b, ok := b.(*RecentDao); ok {
+		this.recentDao = b
+	}
+
 }
 
 func (this *MatterDao) FindByUuid(uuid string) *Matter {
+	return this.FindByUuidTx(core.CONTEXT.GetDB(), uuid)
+}
+
+func (this *MatterDao) FindByUuidTx(tx *gorm.DB, uuid string) *Matter {
 	var entity = &Matter{}
-	db := core.CONTEXT.GetDB().Where("uuid = ?", uuid).First(entity)
+	db := tx.Where("uuid = ?", uuid).First(entity)
 	if db.Error != nil {
 		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
 			return nil
@@ -87,7 +136,7 @@ func (this *MatterDao) CheckWithRootByPath(path string, user *User, space *Space
 	if path == "" || path == "/" {
 		matter = NewRootMatter(space)
 	} else {
-		matter = this.checkByUserUuidAndPath(user.Uuid, path)
+		matter = this.checkBySpaceUuidAndPath(space.Uuid, path)
 	}
 
 	return matter
@@ -105,7 +154,7 @@ func (this *MatterDao) FindWithRootByPath(path string, user *User, space *Space)
 	if path == "" || path == "/" {
 		matter = NewRootMatter(space)
 	} else {
-		matter = this.findByUserUuidAndPath(user.Uuid, path)
+		matter = this.findBySpaceUuidAndPath(space.Uuid, path)
 	}
 
 	return matter
@@ -346,6 +395,37 @@ func (this *MatterDao) FindByPuuidAndUserUuidAndDeleted(puuid string, userUuid s
 	return matters
 }
 
+func (this *MatterDao) FindBySpaceUuidAndPuuidAndDeleted(spaceUuid string, puuid string, deleted string, sortArray []builder.OrderPair) []*Matter {
+	var matters []*Matter
+
+	var wp = &builder.WherePair{}
+	wp = wp.And(&builder.WherePair{Query: "space_uuid = ? AND puuid = ?", Args: []interface{}{spaceUuid, puuid}})
+	if deleted == TRUE {
+		wp = wp.And(&builder.WherePair{Query: "deleted = 1", Args: []interface{}{}})
+	} else if deleted == FALSE {
+		wp = wp.And(&builder.WherePair{Query: "deleted = 0", Args: []interface{}{}})
+	}
+
+	if sortArray == nil {
+
+		sortArray = []builder.OrderPair{
+			{
+				Key:   "dir",
+				Value: DIRECTION_DESC,
+			},
+			{
+				Key:   "create_time",
+				Value: DIRECTION_DESC,
+			},
+		}
+	}
+
+	db := core.CONTEXT.GetDB().Model(&Matter{}).Where(wp.Query, wp.Args...).Order(this.GetSortString(sortArray)).Find(&matters)
+	this.PanicError(db.Error)
+
+	return matters
+}
+
 func (this *MatterDao) FindByUuids(uuids []string, sortArray []builder.OrderPair) []*Matter {
 	var matters []*Matter
 
@@ -355,6 +435,48 @@ func (this *MatterDao) FindByUuids(uuids []string, sortArray []builder.OrderPair
 	return matters
 }
 
+// condition of matter m which has an ancestor directory in the trash.
+func (this *MatterDao) trashedAncestorCondition() string {
+	matterTable := fmt.Sprintf("`%smatter`", core.TABLE_PREFIX)
+	//the range uses the index idx_matter_sp, and LIKE only filters within the range.
+	return fmt.Sprintf("EXISTS (SELECT 1 FROM %s AS d WHERE d.space_uuid = m.space_uuid AND d.dir = 1 AND d.deleted = 1 AND m.path > CONCAT(d.path, '/') AND m.path < CONCAT(d.path, '0') AND m.path LIKE CONCAT(d.path, '/%%'))", matterTable)
+}
+
+// sub query of the uuids whose matter is neither in the trash nor under a directory in the trash.
+func (this *MatterDao) AliveUuidQuery() *gorm.DB {
+	matterTable := fmt.Sprintf("`%smatter`", core.TABLE_PREFIX)
+	return core.CONTEXT.GetDB().
+		Table(matterTable+" AS m").
+		Select("m.uuid").
+		Where("m.deleted = ?", false).
+		Where("NOT " + this.trashedAncestorCondition())
+}
+
+// query of the matters in the trash of a space, except those under a directory in the trash.
+func (this *MatterDao) trashRootQuery(spaceUuid string) *gorm.DB {
+	matterTable := fmt.Sprintf("`%smatter`", core.TABLE_PREFIX)
+	return core.CONTEXT.GetDB().
+		Table(matterTable+" AS m").
+		Where("m.space_uuid = ? AND m.deleted = ?", spaceUuid, true).
+		Where("NOT " + this.trashedAncestorCondition())
+}
+
+// find the alive matter with the name in a directory. if not found return nil.
+func (this *MatterDao) FindBySpaceUuidAndPuuidAndNameAndDeletedFalse(spaceUuid string, puuid string, name string) *Matter {
+
+	var matter = &Matter{}
+	db := core.CONTEXT.GetDB().Where("space_uuid = ? AND puuid = ? AND name = ? AND deleted = ?", spaceUuid, puuid, name, false).First(matter)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			this.PanicError(db.Error)
+		}
+	}
+
+	return matter
+}
+
 // pagination is 0 base.
 func (this *MatterDao) PlainPage(
 	page int,
@@ -367,6 +489,7 @@ func (this *MatterDao) PlainPage(
 	deleted string,
 	deleteTimeBefore *time.Time,
 	extensions []string,
+	tagUuid string,
 	sortArray []builder.OrderPair) (int, []*Matter) {
 
 	var wp = &builder.WherePair{}
@@ -403,6 +526,10 @@ func (this *MatterDao) PlainPage(
 		wp = wp.And(&builder.WherePair{Query: "deleted = ?", Args: []interface{}{0}})
 	}
 
+	if tagUuid != "" {
+		wp = wp.And(&builder.WherePair{Query: "uuid IN (?)", Args: []interface{}{core.CONTEXT.GetDB().Model(&MatterTag{}).Select("matter_uuid").Where("tag_uuid = ?", tagUuid)}})
+	}
+
 	var conditionDB *gorm.DB
 	if extensions != nil && len(extensions) > 0 {
 		var orWp = &builder.WherePair{}
@@ -426,9 +553,9 @@ func (this *MatterDao) PlainPage(
 
 	return int(count), matters
 }
-func (this *MatterDao) Page(page int, pageSize int, puuid string, userUuid string, spaceUuid string, name string, dir string, deleted string, extensions []string, sortArray []builder.OrderPair) *Pager {
+func (this *MatterDao) Page(page int, pageSize int, puuid string, userUuid string, spaceUuid string, name string, dir string, deleted string, extensions []string, tagUuid string, sortArray []builder.OrderPair) *Pager {
 
-	count, matters := this.PlainPage(page, pageSize, puuid, userUuid, spaceUuid, name, dir, deleted, nil, extensions, sortArray)
+	count, matters := this.PlainPage(page, pageSize, puuid, userUuid, spaceUuid, name, dir, deleted, nil, extensions, tagUuid, sortArray)
 	pager := NewPager(page, pageSize, count, matters)
 
 	return pager
@@ -456,13 +583,13 @@ func (this *MatterDao) PageHandle(
 		}
 	}
 
-	count, _ := this.PlainPage(0, pageSize, puuid, userUuid, spaceUuid, name, dir, deleted, deleteTimeBefore, nil, sortArray)
+	count, _ := this.PlainPage(0, pageSize, puuid, userUuid, spaceUuid, name, dir, deleted, deleteTimeBefore, nil, "", sortArray)
 	if count > 0 {
 		var totalPages = int(math.Ceil(float64(count) / float64(pageSize)))
 
 		var page int
 		for page = 0; page < totalPages; page++ {
-			_, matters := this.PlainPage(0, pageSize, puuid, userUuid, spaceUuid, name, dir, deleted, deleteTimeBefore, nil, sortArray)
+			_, matters := this.PlainPage(0, pageSize, puuid, userUuid, spaceUuid, name, dir, deleted, deleteTimeBefore, nil, "", sortArray)
 			for _, matter := range matters {
 				fun(matter)
 			}
@@ -471,27 +598,89 @@ func (this *MatterDao) PageHandle(
 }
 
 func (this *MatterDao) Create(matter *Matter) *Matter {
+	return this.CreateTx(core.CONTEXT.GetDB(), matter)
+}
+
+// create in a transaction.
+func (this *MatterDao) CreateTx(tx *gorm.DB, matter *Matter) *Matter {
 
 	timeUUID, _ := uuid.NewV4()
 	matter.Uuid = string(timeUUID.String())
 	matter.CreateTime = time.Now()
 	matter.UpdateTime = time.Now()
 	matter.Sort = time.Now().UnixNano() / 1e6
-	db := core.CONTEXT.GetDB().Create(matter)
+	db := tx.Create(matter)
 	this.PanicError(db.Error)
 
 	return matter
 }
 
 func (this *MatterDao) Save(matter *Matter) *Matter {
+	return this.SaveTx(core.CONTEXT.GetDB(), matter)
+}
+
+// save in a transaction.
+func (this *MatterDao) SaveTx(tx *gorm.DB, matter *Matter) *Matter {
 
 	matter.UpdateTime = time.Now()
-	db := core.CONTEXT.GetDB().Save(matter)
+	db := tx.Save(matter)
 	this.PanicError(db.Error)
 
 	return matter
 }
 
+// condition of the matters under the dir path, alias is the table alias with a dot or empty.
+// paths under the dir are between dirPath+"/" and dirPath+"0" ("0" is next to "/"), so the range goes through the index idx_matter_sp.
+// the prefix is checked again for the collations not ordering by bytes. no LIKE here, since "%" and "_" are allowed in the names.
+func (this *MatterDao) descendantCondition(alias string, spaceUuid string, dirPath string) *builder.WherePair {
+	prefix := dirPath + "/"
+	query := strings.ReplaceAll("@space_uuid = ? AND @path > ? AND @path < ? AND SUBSTR(@path, 1, ?) = ?", "@", alias)
+	return &builder.WherePair{Query: query, Args: []interface{}{spaceUuid, prefix, dirPath + "0", utf8.RuneCountInString(prefix), prefix}}
+}
+
+// condition of the matter together with the matters under it.
+func (this *MatterDao) subtreeCondition(alias string, matter *Matter) *builder.WherePair {
+	wp := this.descendantCondition(alias, matter.SpaceUuid, matter.Path)
+	query := strings.ReplaceAll("(@uuid = ? OR ("+wp.Query+"))", "@", alias)
+	return &builder.WherePair{Query: query, Args: append([]interface{}{matter.Uuid}, wp.Args...)}
+}
+
+// sub query of the uuids of all the matters under the dir path.
+func (this *MatterDao) DescendantUuidQuery(spaceUuid string, dirPath string) *gorm.DB {
+	wp := this.descendantCondition("", spaceUuid, dirPath)
+	return core.CONTEXT.GetDB().Model(&Matter{}).Select("uuid").Where(wp.Query, wp.Args...)
+}
+
+// sub query of the uuids of the matter and all the matters under it.
+func (this *MatterDao) SubtreeUuidQuery(matter *Matter) *gorm.DB {
+	wp := this.subtreeCondition("", matter)
+	return core.CONTEXT.GetDB().Model(&Matter{}).Select("uuid").Where(wp.Query, wp.Args...)
+}
+
+// add delta to the size of all the ancestor dirs of the path in one statement.
+func (this *MatterDao) AddAncestorSizeTx(tx *gorm.DB, spaceUuid string, matterPath string, delta int64) {
+
+	var paths []string
+	for i := strings.LastIndex(matterPath, "/"); i > 0; i = strings.LastIndex(matterPath[:i], "/") {
+		paths = append(paths, matterPath[:i])
+	}
+	if len(paths) == 0 || delta == 0 {
+		return
+	}
+
+	db := tx.Model(&Matter{}).Where("space_uuid = ? AND dir = ? AND path IN ?", spaceUuid, true, paths).
+		Update("size", gorm.Expr("size + ?", delta))
+	this.PanicError(db.Error)
+}
+
+// change the path of all the matters under a dir from oldPath to newPath in one statement.
+func (this *MatterDao) UpdateDescendantPathTx(tx *gorm.DB, spaceUuid string, oldPath string, newPath string) {
+	wp := this.descendantCondition("", spaceUuid, oldPath)
+	db := tx.Model(&Matter{}).Where(wp.Query, wp.Args...).
+		Update("path", gorm.Expr("CONCAT(?, SUBSTR(path, ?))", newPath+"/", utf8.RuneCountInString(oldPath+"/")+1))
+	this.PanicError(db.Error)
+}
+
 // download time add 1
 func (this *MatterDao) TimesIncrement(matterUuid string) {
 	db := core.CONTEXT.GetDB().Model(&Matter{}).Where("uuid = ?", matterUuid).Updates(map[string]interface{}{"times": gorm.Expr("times + 1"), "visit_time": time.Now()})
@@ -538,46 +727,112 @@ func (this *MatterDao) SizeByPuuidAndSpaceUuid(matterUuid string, spaceUuid stri
 	return sumSize
 }
 
-// delete a file from db and disk.
+// delete a file from db and disk. a dir is deleted with all the matters under it,
+// and the number of statements does not grow with the size of the dir.
 func (this *MatterDao) Delete(matter *Matter) {
 
-	// recursive if dir
-	if matter.Dir {
-		matters := this.FindByPuuidAndUserUuid(matter.Uuid, matter.UserUuid, nil)
+	if !matter.Dir {
+		this.deleteFile(matter)
+		return
+	}
 
-		for _, f := range matters {
-			this.Delete(f)
-		}
+	//delete from search index.
+	this.searchTermDao.DeleteByMatterUuidQuery(this.SubtreeUuidQuery(matter))
+
+	//delete the tag links.
+	this.matterTagDao.DeleteByMatterUuidQuery(this.SubtreeUuidQuery(matter))
+
+	//delete the webdav dead properties.
+	this.davPropDao.DeleteByMatterUuidQuery(this.SubtreeUuidQuery(matter))
+
+	//delete from favorites and recent lists.
+	this.favoriteDao.DeleteByMatterUuidQuery(this.SubtreeUuidQuery(matter))
+	this.recentDao.DeleteByMatterUuidQuery(this.SubtreeUuidQuery(matter))
+
+	//delete the image caches.
+	this.imageCacheDao.DeleteByMatterUuidQuery(this.SubtreeUuidQuery(matter))
+
+	//delete all the share.
+	this.bridgeDao.DeleteByMatterUuidQuery(this.SubtreeUuidQuery(matter))
+
+	//delete all the versions.
+	this.matterVersionService.DeleteByMatterUuidQuery(matter.SpaceUuid, this.SubtreeUuidQuery(matter))
+
+	//blob is deleted when its last reference goes away.
+	matterTable := fmt.Sprintf("`%smatter`", core.TABLE_PREFIX)
+	wp := this.subtreeCondition("r.", matter)
+	wp = wp.And(&builder.WherePair{Query: "r.dir = ? AND r.sha256 != ?", Args: []interface{}{false, ""}})
+	this.blobService.ReleaseByRefs(matterTable, wp)
 
-		//delete from db.
-		db := core.CONTEXT.GetDB().Delete(&matter)
-		this.PanicError(db.Error)
-		if util.PathExists(matter.AbsolutePath()) {
-			//delete dir from disk.
-			util.DeleteEmptyDir(matter.AbsolutePath())
+	//files stored before the blob store are on disk by their paths.
+	var legacies []*Matter
+	wp = this.subtreeCondition("", matter)
+	wp = wp.And(&builder.WherePair{Query: "dir = ? AND COALESCE(sha256, '') = ?", Args: []interface{}{false, ""}})
+	db := core.CONTEXT.GetDB().Select("space_name", "path").Where(wp.Query, wp.Args...).Find(&legacies)
+	this.PanicError(db.Error)
+
+	//delete from db.
+	wp = this.subtreeCondition("", matter)
+	db = core.CONTEXT.GetDB().Where(wp.Query, wp.Args...).Delete(Matter{})
+	this.PanicError(db.Error)
+
+	//delete from disk.
+	for _, legacy := range legacies {
+		err := os.Remove(legacy.AbsolutePath())
+		if err != nil && !os.IsNotExist(err) {
+			this.logger.Error("occur error when deleting file. %v", err)
 		}
+	}
+	util.DeleteEmptyDirTree(matter.AbsolutePath())
+}
 
-	} else {
+// delete a file by itself. its row may have been deleted in a transaction.
+func (this *MatterDao) deleteFile(matter *Matter) {
+
+	//delete from search index.
+	this.searchTermDao.DeleteByMatterUuid(matter.Uuid)
+
+	//delete the tag links.
+	this.matterTagDao.DeleteByMatterUuid(matter.Uuid)
 
-		//delete from db.
-		db := core.CONTEXT.GetDB().Delete(&matter)
-		this.PanicError(db.Error)
+	//delete the webdav dead properties.
+	this.davPropDao.DeleteByMatterUuid(matter.Uuid)
+
+	//delete from favorites and recent lists.
+	this.favoriteDao.DeleteByMatterUuid(matter.Uuid)
+	this.recentDao.DeleteByMatterUuid(matter.Uuid)
+
+	//delete from db.
+	db := core.CONTEXT.GetDB().Delete(&matter)
+	this.PanicError(db.Error)
 
-		//delete its image cache.
-		this.imageCacheDao.DeleteByMatterUuid(matter.Uuid)
+	//delete its image cache.
+	this.imageCacheDao.DeleteByMatterUuid(matter.Uuid)
 
-		//delete all the share.
-		this.bridgeDao.DeleteByMatterUuid(matter.Uuid)
+	//delete all the share.
+	this.bridgeDao.DeleteByMatterUuid(matter.Uuid)
 
+	//delete all the versions.
+	this.matterVersionService.DeleteByMatterUuid(matter.Uuid)
+
+	if matter.IsBlob() {
+		//blob is deleted when its last reference goes away.
+		this.blobService.Release(matter.Backend, matter.Sha256)
+	} else {
 		//delete from disk.
 		err := os.Remove(matter.AbsolutePath())
 		if err != nil {
 			this.logger.Error("occur error when deleting file. %v", err)
 		}
-
 	}
 }
 
+// delete only the row in a transaction. the rest is cleaned by Delete after the commit.
+func (this *MatterDao) DeleteRowTx(tx *gorm.DB, matter *Matter) {
+	db := tx.Delete(matter)
+	this.PanicError(db.Error)
+}
+
 // soft delete a file or dir
 func (this *MatterDao) SoftDelete(matter *Matter) {
 
@@ -596,9 +851,52 @@ func (this *MatterDao) Recovery(matter *Matter) {
 
 }
 
+// soft delete the alive children of a directory with the given delete time.
+func (this *MatterDao) SoftDeleteByPuuid(puuid string, deleteTime time.Time) {
+
+	db := core.CONTEXT.GetDB().Model(&Matter{}).Where("puuid = ? AND deleted = ?", puuid, false).Updates(map[string]interface{}{"deleted": true, "delete_time": deleteTime})
+	this.PanicError(db.Error)
+
+}
+
+// sum the size of the trash of a space. matters under a directory in the trash are counted by the directory.
+func (this *MatterDao) SumTrashSizeBySpaceUuid(spaceUuid string) int64 {
+
+	var sumSize int64
+	row := this.trashRootQuery(spaceUuid).Select("COALESCE(SUM(m.size), 0)").Row()
+	err := row.Scan(&sumSize)
+	core.PanicError(err)
+
+	return sumSize
+}
+
+// find the earliest deleted matter in the trash of a space. if not found return nil.
+func (this *MatterDao) FindEarliestTrashBySpaceUuid(spaceUuid string) *Matter {
+
+	var matters []*Matter
+	db := this.trashRootQuery(spaceUuid).Select("m.*").Order("m.delete_time ASC").Limit(1).Find(&matters)
+	this.PanicError(db.Error)
+
+	if len(matters) == 0 {
+		return nil
+	}
+	return matters[0]
+}
+
 func (this *MatterDao) DeleteByUserUuid(userUuid string) {
 
-	db := core.CONTEXT.GetDB().Where("user_uuid = ?", userUuid).Delete(Matter{})
+	this.searchTermDao.DeleteByUserUuid(userUuid)
+	this.matterTagDao.DeleteByUserUuid(userUuid)
+
+	//release the blobs referenced by this user.
+	var matters []*Matter
+	db := core.CONTEXT.GetDB().Select("backend", "sha256").Where("user_uuid = ? AND dir = ? AND sha256 != ?", userUuid, false, "").Find(&matters)
+	this.PanicError(db.Error)
+	for _, matter := range matters {
+		this.blobService.Release(matter.Backend, matter.Sha256)
+	}
+
+	db = core.CONTEXT.GetDB().Where("user_uuid = ?", userUuid).Delete(Matter{})
 	this.PanicError(db.Error)
 
 }
@@ -629,13 +927,18 @@ func (this *MatterDao) SizeBetweenTime(startTime time.Time, endTime time.Time) i
 	return size
 }
 
-// find by userUuid and path. if not found, return nil
-func (this *MatterDao) findByUserUuidAndPath(userUuid string, path string) *Matter {
+// find the alive matter by spaceUuid and path. the members of a shared space find the same matter. if not found, return nil
+func (this *MatterDao) findBySpaceUuidAndPath(spaceUuid string, path string) *Matter {
 
-	var wp = &builder.WherePair{Query: "user_uuid = ? AND path = ?", Args: []interface{}{userUuid, path}}
+	matterTable := fmt.Sprintf("`%smatter`", core.TABLE_PREFIX)
 
 	var matter = &Matter{}
-	db := core.CONTEXT.GetDB().Model(&Matter{}).Where(wp.Query, wp.Args...).First(matter)
+	db := core.CONTEXT.GetDB().
+		Table(matterTable+" AS m").
+		Select("m.*").
+		Where("m.space_uuid = ? AND m.path = ? AND m.deleted = ?", spaceUuid, path, false).
+		Where("NOT " + this.trashedAncestorCondition()).
+		First(matter)
 
 	if db.Error != nil {
 		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
@@ -648,13 +951,13 @@ func (this *MatterDao) findByUserUuidAndPath(userUuid string, path string) *Matt
 	return matter
 }
 
-// find by userUuid and path. if not found, panic
-func (this *MatterDao) checkByUserUuidAndPath(userUuid string, path string) *Matter {
+// find the alive matter by spaceUuid and path. if not found, panic
+func (this *MatterDao) checkBySpaceUuidAndPath(spaceUuid string, path string) *Matter {
 
 	if path == "" {
 		panic(result.BadRequest("path cannot be null"))
 	}
-	matter := this.findByUserUuidAndPath(userUuid, path)
+	matter := this.findBySpaceUuidAndPath(spaceUuid, path)
 	if matter == nil {
 		panic(result.NotFound("path = %s not exists", path))
 	}
@@ -662,25 +965,69 @@ func (this *MatterDao) checkByUserUuidAndPath(userUuid string, path string) *Mat
 	return matter
 }
 
-func (this *MatterDao) SumSizeByUserUuidAndPath(userUuid string, path string) int64 {
+// total size of the file or the files under the dir.
+func (this *MatterDao) SumSizeBySubtree(matter *Matter) int64 {
 
-	var wp = &builder.WherePair{Query: "user_uuid = ? AND path like ?", Args: []interface{}{userUuid, path + "%"}}
+	wp := this.subtreeCondition("", matter)
+	wp = wp.And(&builder.WherePair{Query: "dir = ?", Args: []interface{}{false}})
 
-	var count int64
-	db := core.CONTEXT.GetDB().Model(&Matter{}).Where(wp.Query, wp.Args...).Count(&count)
-	if count == 0 {
-		return 0
-	}
+	var sumSize int64
+	db := core.CONTEXT.GetDB().Model(&Matter{}).Where(wp.Query, wp.Args...).Select("COALESCE(SUM(size), 0)")
+	this.PanicError(db.Error)
+	row := db.Row()
+	err := row.Scan(&sumSize)
+	core.PanicError(err)
+
+	return sumSize
+
+}
+
+// total size of the files in a space.
+func (this *MatterDao) SumSizeBySpaceUuid(spaceUuid string) int64 {
+	return this.SumSizeBySpaceUuidTx(core.CONTEXT.GetDB(), spaceUuid)
+}
+
+func (this *MatterDao) SumSizeBySpaceUuidTx(tx *gorm.DB, spaceUuid string) int64 {
 
 	var sumSize int64
-	db = core.CONTEXT.GetDB().Model(&Matter{}).Where(wp.Query, wp.Args...).Select("SUM(size)")
+	db := tx.Model(&Matter{}).Where("space_uuid = ? AND dir = ?", spaceUuid, false).Select("COALESCE(SUM(size), 0)")
 	this.PanicError(db.Error)
 	row := db.Row()
 	err := row.Scan(&sumSize)
 	core.PanicError(err)
 
 	return sumSize
+}
+
+// the dirs of a space whose size differs from the total size of the files under them.
+func (this *MatterDao) FindDirSizeDriftsBySpaceUuid(spaceUuid string) []*DirSizeDrift {
+	return this.FindDirSizeDriftsBySpaceUuidTx(core.CONTEXT.GetDB(), spaceUuid)
+}
 
+func (this *MatterDao) FindDirSizeDriftsBySpaceUuidTx(tx *gorm.DB, spaceUuid string) []*DirSizeDrift {
+
+	matterTable := fmt.Sprintf("`%smatter`", core.TABLE_PREFIX)
+	rows, err := tx.
+		Table(matterTable+" AS d").
+		Select("d.uuid, d.path, d.size, COALESCE(SUM(f.size), 0)").
+		Joins("LEFT JOIN "+matterTable+" AS f ON f.space_uuid = d.space_uuid AND f.dir = ? AND f.path > CONCAT(d.path, '/') AND f.path < CONCAT(d.path, '0') AND f.path LIKE CONCAT(d.path, '/%')", false).
+		Where("d.space_uuid = ? AND d.dir = ?", spaceUuid, true).
+		Group("d.uuid, d.path, d.size").
+		Having("d.size != COALESCE(SUM(f.size), 0)").
+		Rows()
+	this.PanicError(err)
+	defer rows.Close()
+
+	var drifts []*DirSizeDrift
+	for rows.Next() {
+		drift := &DirSizeDrift{}
+		err := rows.Scan(&drift.Uuid, &drift.Path, &drift.Size, &drift.ActualSize)
+		this.PanicError(err)
+		drifts = append(drifts, drift)
+	}
+	this.PanicError(rows.Err())
+
+	return drifts
 }
 
 func (this *MatterDao) UpdateSize(matterUuid string, size int64) {
@@ -688,9 +1035,19 @@ func (this *MatterDao) UpdateSize(matterUuid string, size int64) {
 	this.PanicError(db.Error)
 }
 
-func (this *MatterDao) CountByUserUuidAndPath(userUuid string, path string) int64 {
+// add delta to the size of a matter in a transaction.
+func (this *MatterDao) AddSizeTx(tx *gorm.DB, matterUuid string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	db := tx.Model(&Matter{}).Where("uuid = ?", matterUuid).Update("size", gorm.Expr("size + ?", delta))
+	this.PanicError(db.Error)
+}
+
+// count the matter and the matters under it.
+func (this *MatterDao) CountBySubtree(matter *Matter) int64 {
 
-	var wp = &builder.WherePair{Query: "user_uuid = ? AND path like ?", Args: []interface{}{userUuid, path + "%"}}
+	wp := this.subtreeCondition("", matter)
 
 	var count int64
 	db := core.CONTEXT.GetDB().Model(&Matter{}).Where(wp.Query, wp.Args...).Count(&count)
@@ -700,6 +1057,27 @@ func (this *MatterDao) CountByUserUuidAndPath(userUuid string, path string) int6
 
 }
 
+// the alive matters under the dir ordered by path, at most limit ones.
+func (this *MatterDao) FindAliveDescendants(matter *Matter, limit int) []*Matter {
+
+	matterTable := fmt.Sprintf("`%smatter`", core.TABLE_PREFIX)
+	wp := this.descendantCondition("m.", matter.SpaceUuid, matter.Path)
+
+	var matters []*Matter
+	db := core.CONTEXT.GetDB().
+		Table(matterTable+" AS m").
+		Select("m.*").
+		Where(wp.Query, wp.Args...).
+		Where("m.deleted = ?", false).
+		Where("NOT " + this.trashedAncestorCondition()).
+		Order("m.path").
+		Limit(limit).
+		Find(&matters)
+	this.PanicError(db.Error)
+
+	return matters
+}
+
 func (this *MatterDao) CountByUserUuid(userUuid string) int64 {
 
 	var wp = &builder.WherePair{Query: "user_uuid = ?", Args: []interface{}{userUuid}}
@@ -723,6 +1101,28 @@ func (this *MatterDao) Count() int64 {
 
 }
 
+// the children of a directory in a space, with only the fields to locate them.
+func (this *MatterDao) FindPathsBySpaceUuidAndPuuid(spaceUuid string, puuid string) []*Matter {
+	var matters []*Matter
+	db := core.CONTEXT.GetDB().Select("uuid", "dir", "name", "path").Where("space_uuid = ? AND puuid = ?", spaceUuid, puuid).Find(&matters)
+	this.PanicError(db.Error)
+	return matters
+}
+
+func (this *MatterDao) UpdatePath(matterUuid string, path string) {
+	db := core.CONTEXT.GetDB().Model(&Matter{}).Where("uuid = ?", matterUuid).Update("path", path)
+	this.PanicError(db.Error)
+}
+
+func (this *MatterDao) HasPathIndex() bool {
+	return core.CONTEXT.GetDB().Migrator().HasIndex(&Matter{}, MATTER_PATH_INDEX)
+}
+
+func (this *MatterDao) CreatePathIndex() {
+	err := core.CONTEXT.GetDB().Migrator().CreateIndex(&Matter{}, MATTER_PATH_INDEX)
+	this.PanicError(err)
+}
+
 // System cleanup.
 func (this *MatterDao) Cleanup() {
 	this.logger.Info("[MatterDao] clean up. Delete all Matter record in db and on disk.")
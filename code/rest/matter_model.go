@@ -19,11 +19,20 @@ const (
 	//cache directory name.
 	MATTER_CACHE = "cache"
 	//zip file temp directory.
-	MATTER_ZIP             = "zip"
+	MATTER_ZIP = "zip"
+	//resumable upload staging directory.
+	MATTER_UPLOAD          = "upload"
 	MATTER_NAME_MAX_LENGTH = 200
 	MATTER_NAME_MAX_DEPTH  = 32
+	//max entries of an archive to be extracted.
+	MATTER_EXTRACT_MAX_NUM = 10000
+	//max compression ratio of an archive to be extracted. small archives are not limited.
+	MATTER_EXTRACT_MAX_RATIO       = 200
+	MATTER_EXTRACT_RATIO_FREE_SIZE = 64 * 1024 * 1024
 	//matter name pattern
 	MATTER_NAME_PATTERN = `[\\/:*?"<>|]`
+	//index of space_uuid and path, which serves the queries of a subtree.
+	MATTER_PATH_INDEX = "idx_matter_sp"
 )
 
 /**
@@ -41,25 +50,41 @@ type Matter struct {
 	Dir        bool      `json:"dir" gorm:"type:tinyint(1) not null;default:0"`
 	Name       string    `json:"name" gorm:"type:varchar(255) not null"`
 	Md5        string    `json:"md5" gorm:"type:varchar(45)"`
+	Sha256     string    `json:"sha256" gorm:"type:varchar(64)"`
+	Backend    string    `json:"backend" gorm:"type:varchar(45) not null;default:''"`
 	Size       int64     `json:"size" gorm:"type:bigint(20) not null;default:0"`
 	Privacy    bool      `json:"privacy" gorm:"type:tinyint(1) not null;default:0"`
-	Path       string    `json:"path" gorm:"type:varchar(1024)"`
+	Path       string    `json:"path" gorm:"type:varchar(1024);index:idx_matter_sp,priority:2,length:255"`
 	Times      int64     `json:"times" gorm:"type:bigint(20) not null;default:0"`
 	Prop       string    `json:"prop" gorm:"type:varchar(1024) not null;default:'{}'"`
 	VisitTime  time.Time `json:"visitTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
 	Deleted    bool      `json:"deleted" gorm:"type:tinyint(1) not null;index:idx_matter_del;default:0"`
 	DeleteTime time.Time `json:"deleteTime" gorm:"type:timestamp not null;index:idx_matter_delt;default:'2018-01-01 00:00:00'"`
-	SpaceUuid  string    `json:"spaceUuid" gorm:"type:char(36) not null;index:idx_matter_space_uuid"`
+	SpaceUuid  string    `json:"spaceUuid" gorm:"type:char(36) not null;index:idx_matter_space_uuid;index:idx_matter_sp,priority:1"`
 	User       *User     `json:"user" gorm:"-"`
 	Parent     *Matter   `json:"parent" gorm:"-"`
 	Children   []*Matter `json:"-" gorm:"-"`
 }
 
 // get matter's absolute path. the Path property is relative path in db.
+// content of a file with Sha256 lives in the blob store, use Key() instead.
 func (this *Matter) AbsolutePath() string {
 	return GetSpaceMatterRootDir(this.SpaceName) + this.Path
 }
 
+// get the content's key in the storage backend.
+func (this *Matter) Key() string {
+	if this.IsBlob() {
+		return GetBlobKey(this.Sha256)
+	}
+	return fmt.Sprintf("%s/%s%s", this.SpaceName, MATTER_ROOT, this.Path)
+}
+
+// whether the content is stored in the blob store.
+func (this *Matter) IsBlob() bool {
+	return !this.Dir && this.Sha256 != ""
+}
+
 func (this *Matter) MimeType() string {
 	return util.GetMimeType(util.GetExtension(this.Name))
 }
@@ -112,6 +137,14 @@ func GetSpaceZipRootDir(spaceName string) (rootDirPath string) {
 	return rootDirPath
 }
 
+// get space's upload staging absolute path
+func GetSpaceUploadRootDir(spaceName string) (rootDirPath string) {
+
+	rootDirPath = fmt.Sprintf("%s/%s/%s", core.CONFIG.MatterPath(), spaceName, MATTER_UPLOAD)
+
+	return rootDirPath
+}
+
 // check matter's name. If error, panic.
 func CheckMatterName(request *http.Request, name string) string {
 
@@ -1,39 +1,59 @@
 package rest
 
 import (
-	"archive/zip"
+	"errors"
 	"fmt"
 	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/archive"
 	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/crawl"
 	"github.com/eyebluecn/tank/code/tool/download"
 	"github.com/eyebluecn/tank/code/tool/i18n"
+	"github.com/eyebluecn/tank/code/tool/lock"
 	"github.com/eyebluecn/tank/code/tool/result"
 	"github.com/eyebluecn/tank/code/tool/util"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
 /**
- * Methods start with Atomic has Lock. These method cannot be invoked by other Atomic Methods.
+ * Methods start with Atomic has path locks. These method cannot be invoked by other Atomic Methods.
  */
 //@Service
 type MatterService struct {
 	BaseBean
-	matterDao         *MatterDao
-	spaceDao          *SpaceDao
-	userDao           *UserDao
-	userService       *UserService
-	imageCacheDao     *ImageCacheDao
-	imageCacheService *ImageCacheService
-	preferenceService *PreferenceService
+	matterDao            *MatterDao
+	spaceDao             *SpaceDao
+	userDao              *UserDao
+	userService          *UserService
+	imageCacheDao        *ImageCacheDao
+	imageCacheService    *ImageCacheService
+	preferenceService    *PreferenceService
+	blobService          *BlobService
+	matterVersionDao     *MatterVersionDao
+	matterVersionService *MatterVersionService
+	storageService       *StorageService
+	searchService        *SearchService
+	tagService           *TagService
+	recentService        *RecentService
+	trashService         *TrashService
+	lockService          *LockService
+	unitOfWorkService    *UnitOfWorkService
+	crawlService         *CrawlService
+	davLockService       *DavLockService
+	davPropDao           *DavPropDao
 }
 
 func (this *MatterService) Init() {
@@ -74,6 +94,71 @@ func (this *MatterService) Init() {
 		this.preferenceService = b
 	}
 
+	b = core.CONTEXT.GetBean(this.blobService)
+	if b, ok := b.(*BlobService); ok {
+		this.blobService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterVersionDao)
+	if b, ok := b.(*MatterVersionDao); ok {
+		this.matterVersionDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterVersionService)
+	if b, ok := b.(*MatterVersionService); ok {
+		this.matterVersionService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.storageService)
+	if b, ok := b.(*StorageService); ok {
+		this.storageService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.searchService)
+	if b, ok := b.(*SearchService); ok {
+		this.searchService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.tagService)
+	if b, ok := b.(*TagService); ok {
+		this.tagService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.recentService)
+	if b, ok := b.(*RecentService); ok {
+		this.recentService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.trashService)
+	if b, ok := b.(*TrashService); ok {
+		this.trashService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.lockService)
+	if b, ok := b.(*LockService); ok {
+		this.lockService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.unitOfWorkService)
+	if b, ok := b.(*UnitOfWorkService); ok {
+		this.unitOfWorkService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.crawlService)
+	if b, ok := b.(*CrawlService); ok {
+		this.crawlService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.davLockService)
+	if b, ok := b.(*DavLockService); ok {
+		this.davLockService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.davPropDao)
+	if b, ok := b.(*DavPropDao); ok {
+		this.davPropDao = b
+	}
+
 }
 
 // get the page of matters.
@@ -94,6 +179,7 @@ func (this *MatterService) Page(
 	dir string,
 	deleted string,
 	extensions []string,
+	tagUuid string,
 	spaceUuid string,
 ) *Pager {
 
@@ -132,76 +218,96 @@ func (this *MatterService) Page(
 		},
 	}
 
-	pager := this.matterDao.Page(page, pageSize, puuid, "", spaceUuid, name, dir, deleted, extensions, sortArray)
+	pager := this.matterDao.Page(page, pageSize, puuid, "", spaceUuid, name, dir, deleted, extensions, tagUuid, sortArray)
 
 	return pager
 }
 
-// search files by dfs.
-func (this *MatterService) DfsSearch(
+// Download. Support chunk download.
+func (this *MatterService) DownloadFile(
+	writer http.ResponseWriter,
 	request *http.Request,
-	limit int,
-	puuid string,
-	keyword string,
-	spaceUuid string,
-	deleted bool,
-) []*Matter {
-
-	deletedStr := FALSE
-	if deleted {
-		deletedStr = FALSE
-	}
+	filePath string,
+	filename string,
+	withContentDisposition bool) {
 
-	//find all matters including dir and files.
-	_, matters := this.matterDao.PlainPage(0, limit, puuid, "", spaceUuid, keyword, "", deletedStr, nil, nil, nil)
-	if len(matters) >= limit {
-		return matters
-	}
+	download.DownloadFile(writer, request, filePath, filename, withContentDisposition)
+}
 
-	var resultList = make([]*Matter, 0)
-	for _, matter := range matters {
-		if !matter.Dir {
-			resultList = append(resultList, matter)
-		}
-	}
+// Download a matter's content from its storage backend. Support chunk download.
+func (this *MatterService) DownloadMatter(
+	writer http.ResponseWriter,
+	request *http.Request,
+	matter *Matter,
+	withContentDisposition bool) {
 
-	//dfs from puuid.
-	_, dirMatters := this.matterDao.PlainPage(0, 1000, puuid, "", spaceUuid, "", TRUE, "", nil, nil, nil)
-	for _, dirMatter := range dirMatters {
+	this.storageService.Download(writer, request, matter.Backend, matter.Key(), matter.Name, withContentDisposition)
+}
 
-		//add dir if match.
-		if strings.Contains(dirMatter.Name, keyword) {
-			if deleted == dirMatter.Deleted {
-				resultList = append(resultList, dirMatter)
-			}
-		}
+// list the entries of an archive matter(zip, tar or tar.gz) without extracting.
+func (this *MatterService) ArchiveEntries(request *http.Request, matter *Matter) []*archive.ArchiveEntry {
 
-		remainLimit := limit - len(resultList)
-		subMatters := this.DfsSearch(request, remainLimit, dirMatter.Uuid, keyword, spaceUuid, deleted)
-		for _, subMatter := range subMatters {
-			resultList = append(resultList, subMatter)
-		}
+	format := this.checkArchiveFormat(matter)
 
-		//enough then return
-		if len(resultList) >= limit {
-			return resultList
-		}
+	reader := this.storageService.OpenMatter(matter)
+	defer func() {
+		err := reader.Close()
+		this.PanicError(err)
+	}()
 
+	entries, err := archive.List(reader, matter.Size, format)
+	if err != nil {
+		panic(result.BadRequest("read %s error. %s", matter.Name, err.Error()))
 	}
-
-	//not enough ,return.
-	return resultList
+	if entries == nil {
+		entries = []*archive.ArchiveEntry{}
+	}
+	return entries
 }
 
-// Download. Support chunk download.
-func (this *MatterService) DownloadFile(
+// download a single file inside an archive matter. Support chunk download.
+func (this *MatterService) DownloadArchiveEntry(
 	writer http.ResponseWriter,
 	request *http.Request,
-	filePath string,
-	filename string,
+	matter *Matter,
+	name string,
 	withContentDisposition bool) {
 
-	download.DownloadFile(writer, request, filePath, filename, withContentDisposition)
+	format := this.checkArchiveFormat(matter)
+	cleanName, err := archive.CleanEntryName(name)
+	if err != nil || cleanName == "" {
+		panic(result.BadRequest("entry name %s is illegal.", name))
+	}
+
+	reader := this.storageService.OpenMatter(matter)
+	defer func() {
+		e := reader.Close()
+		this.PanicError(e)
+	}()
+
+	entry, content, err := archive.OpenEntry(reader, matter.Size, format, cleanName)
+	if err == archive.ErrEntryNotExist {
+		panic(result.NotFound("%s not exist in %s.", cleanName, matter.Name))
+	} else if err != nil {
+		panic(result.BadRequest("read %s error. %s", matter.Name, err.Error()))
+	}
+	defer func() {
+		e := content.Close()
+		this.PanicError(e)
+	}()
+
+	download.DownloadContent(writer, request, content, entry.Size, entry.Modified, util.GetFilenameOfPath("/"+entry.Name), withContentDisposition)
+}
+
+func (this *MatterService) checkArchiveFormat(matter *Matter) string {
+	if matter.Dir {
+		panic(result.BadRequest("directory is not an archive."))
+	}
+	format := archive.DetectFormat(matter.Name)
+	if format == "" {
+		panic(result.BadRequest("only .zip .tar .tar.gz .tgz are supported."))
+	}
+	return format
 }
 
 // Download specified matters. matters must have the same puuid.
@@ -229,7 +335,7 @@ func (this *MatterService) DownloadZip(
 	//count the num of files will be downloaded.
 	var count int64 = 0
 	for _, matter := range matters {
-		count = count + this.matterDao.CountByUserUuidAndPath(matter.UserUuid, matter.Path)
+		count = count + this.matterDao.CountBySubtree(matter)
 	}
 
 	if preference.DownloadDirMaxNum >= 0 {
@@ -241,7 +347,7 @@ func (this *MatterService) DownloadZip(
 	//count the size of files will be downloaded.
 	var sumSize int64 = 0
 	for _, matter := range matters {
-		sumSize = sumSize + this.matterDao.SumSizeByUserUuidAndPath(matter.UserUuid, matter.Path)
+		sumSize = sumSize + this.matterDao.SumSizeBySubtree(matter)
 	}
 
 	if preference.DownloadDirMaxSize >= 0 {
@@ -250,36 +356,32 @@ func (this *MatterService) DownloadZip(
 		}
 	}
 
-	//prepare the temp zip dir
-	destZipDirPath := fmt.Sprintf("%s/%d", GetSpaceZipRootDir(matters[0].SpaceName), time.Now().UnixNano()/1e6)
-	util.MakeDirAll(destZipDirPath)
-
 	destZipName := fmt.Sprintf("%s.zip", matters[0].Name)
 	if len(matters) > 1 || !matters[0].Dir {
 		destZipName = "archive.zip"
 	}
 
-	destZipPath := fmt.Sprintf("%s/%s", destZipDirPath, destZipName)
+	entries := this.zipEntries(request, matters)
 
-	this.zipMatters(request, matters, destZipPath)
+	//stored method makes the size known in advance.
+	writer.Header().Set("Content-Type", "application/zip")
+	writer.Header().Set("content-disposition", "attachment; filename=\""+url.QueryEscape(destZipName)+"\"")
+	writer.Header().Set("Content-Length", strconv.FormatInt(archive.StoredZipSize(entries), 10))
+	writer.WriteHeader(http.StatusOK)
 
-	download.DownloadFile(writer, request, destZipPath, destZipName, true)
+	if request.Method == http.MethodHead {
+		return
+	}
 
-	//delete the temp zip file.
-	err := os.Remove(destZipPath)
+	//the response has been started, errors cannot be sent to the client any more.
+	err := archive.WriteStoredZip(writer, entries)
 	if err != nil {
-		this.logger.Error("error while deleting zip file %s", err.Error())
+		this.logger.Error("error while streaming zip %s. %v", destZipName, err)
 	}
-	util.DeleteEmptyDir(destZipDirPath)
-
 }
 
-// zip matters.
-func (this *MatterService) zipMatters(request *http.Request, matters []*Matter, destPath string) {
-
-	if util.PathExists(destPath) {
-		panic(result.BadRequest("%s exists", destPath))
-	}
+// zip entries of the matters. matters must have the same puuid.
+func (this *MatterService) zipEntries(request *http.Request, matters []*Matter) []*archive.ZipEntry {
 
 	//matters must have the same puuid.
 	if matters == nil || len(matters) == 0 {
@@ -287,7 +389,8 @@ func (this *MatterService) zipMatters(request *http.Request, matters []*Matter,
 	}
 	userUuid := matters[0].UserUuid
 	puuid := matters[0].Puuid
-	baseDirPath := util.GetDirOfPath(matters[0].AbsolutePath()) + "/"
+	//blob's content is not in the tree, so use the relative path.
+	baseDirPath := util.GetDirOfPath(matters[0].Path) + "/"
 
 	for _, m := range matters {
 		if m.UserUuid != userUuid {
@@ -302,59 +405,35 @@ func (this *MatterService) zipMatters(request *http.Request, matters []*Matter,
 		this.WrapChildrenDetail(request, m)
 	}
 
-	// create temp zip file.
-	fileWriter, err := os.Create(destPath)
-	this.PanicError(err)
-
-	defer func() {
-		err := fileWriter.Close()
-		this.PanicError(err)
-	}()
-
-	zipWriter := zip.NewWriter(fileWriter)
-	defer func() {
-		err := zipWriter.Close()
-		this.PanicError(err)
-	}()
+	var entries []*archive.ZipEntry
 
 	//DFS algorithm
 	var walkFunc func(matter *Matter)
 	walkFunc = func(matter *Matter) {
 
-		path := matter.AbsolutePath()
-
-		fileInfo, err := os.Stat(path)
-		this.PanicError(err)
-
-		// Create file info.
-		fileHeader, err := zip.FileInfoHeader(fileInfo)
-		this.PanicError(err)
-
 		// Trim the baseDirPath
-		fileHeader.Name = strings.TrimPrefix(path, baseDirPath)
+		entry := &archive.ZipEntry{
+			Name:     strings.TrimPrefix(matter.Path, baseDirPath),
+			Modified: matter.UpdateTime,
+		}
 
 		// directory has prefix /
 		if matter.Dir {
-			fileHeader.Name += "/"
-		}
-
-		writer, err := zipWriter.CreateHeader(fileHeader)
-		this.PanicError(err)
-
-		// only regular file has things to write.
-		if fileHeader.Mode().IsRegular() {
+			entry.Name += "/"
+		} else {
+			entry.Size = matter.Size
+			entry.Open = func() (io.ReadCloser, error) {
+				return this.storageService.Backend(matter.Backend).Open(matter.Key())
+			}
 
-			fileToBeZip, err := os.Open(path)
-			defer func() {
-				err = fileToBeZip.Close()
+			//legacy file in the tree may be changed outside.
+			if !matter.IsBlob() {
+				fileInfo, err := this.storageService.Backend(matter.Backend).Stat(matter.Key())
 				this.PanicError(err)
-			}()
-			this.PanicError(err)
-
-			_, err = io.Copy(writer, fileToBeZip)
-			this.PanicError(err)
-
+				entry.Size = fileInfo.Size
+			}
 		}
+		entries = append(entries, entry)
 
 		//dfs.
 		for _, m := range matter.Children {
@@ -365,6 +444,8 @@ func (this *MatterService) zipMatters(request *http.Request, matters []*Matter,
 	for _, m := range matters {
 		walkFunc(m)
 	}
+
+	return entries
 }
 
 // delete files.
@@ -374,10 +455,20 @@ func (this *MatterService) Delete(request *http.Request, matter *Matter, user *U
 		panic(result.BadRequest("matter cannot be nil"))
 	}
 
-	this.matterDao.Delete(matter)
+	//the row goes with its size in one transaction. the size of a dir is the total size of the files under it.
+	err := core.CONTEXT.GetDB().Transaction(func(tx *gorm.DB) error {
+		//the size may have changed since the matter was read.
+		latest := this.matterDao.FindByUuidTx(tx, matter.Uuid)
+		if latest != nil {
+			this.matterDao.DeleteRowTx(tx, latest)
+			this.addSizeTx(tx, latest.SpaceUuid, latest.Path, -latest.Size)
+		}
+		return nil
+	})
+	this.PanicError(err)
 
-	//re compute the size of Route.
-	this.ComputeRouteSize(matter.Puuid, user, space)
+	//the rest is cleaned after the commit.
+	this.matterDao.Delete(matter)
 }
 
 // soft delete files.
@@ -395,21 +486,6 @@ func (this *MatterService) SoftDelete(request *http.Request, matter *Matter, use
 	//no need to recompute size.
 }
 
-// recovery delete files.
-func (this *MatterService) Recovery(request *http.Request, matter *Matter, user *User) {
-
-	if matter == nil {
-		panic(result.BadRequest("matter cannot be nil"))
-	}
-
-	if !matter.Deleted {
-		panic(result.BadRequest("matter has not been deleted"))
-	}
-
-	this.matterDao.Recovery(matter)
-	//no need to recompute size.
-}
-
 // atomic delete files
 func (this *MatterService) AtomicDelete(request *http.Request, matter *Matter, user *User, space *Space) {
 
@@ -418,8 +494,9 @@ func (this *MatterService) AtomicDelete(request *http.Request, matter *Matter, u
 	}
 
 	//lock
-	this.userService.MatterLock(matter.UserUuid)
-	defer this.userService.MatterUnlock(matter.UserUuid)
+	locks := this.lockService.Lock(request, user, "delete", lock.Write(space.Uuid, matter.Path))
+	defer this.lockService.Unlock(locks)
+	this.davLockService.CheckUnlocked(request, space, matter.Path, true)
 
 	this.Delete(request, matter, user, space)
 }
@@ -435,44 +512,103 @@ func (this *MatterService) AtomicSoftDelete(request *http.Request, matter *Matte
 		panic(result.BadRequest("matter has been deleted"))
 	}
 
-	//lock
-	this.userService.MatterLock(matter.UserUuid)
-	defer this.userService.MatterUnlock(matter.UserUuid)
-
 	//if disabled the recycle feature. then we hard delete.
 	preference := this.preferenceService.Fetch()
-	if preference.DeletedKeepDays == 0 {
-		this.Delete(request, matter, user, space)
-	} else {
+	trashed := func() bool {
+		//lock
+		locks := this.lockService.Lock(request, user, "soft delete", lock.Write(space.Uuid, matter.Path))
+		defer this.lockService.Unlock(locks)
+		this.davLockService.CheckUnlocked(request, space, matter.Path, true)
+
+		if preference.DeletedKeepDays == 0 {
+			this.Delete(request, matter, user, space)
+			return false
+		}
 		this.SoftDelete(request, matter, user)
+		return true
+	}()
+
+	//the earliest matters in the trash are deleted under their own locks, so the lock above must be released first.
+	if trashed {
+		this.trashService.CheckSizeLimit(request, user, space)
 	}
 
 }
 
-// atomic recovery delete files
-func (this *MatterService) AtomicRecovery(request *http.Request, matter *Matter, user *User) {
+// upload files. the content is received without lock.
+func (this *MatterService) AtomicUpload(request *http.Request, file io.Reader, fileHeader *multipart.FileHeader, user *User, space *Space, dirMatter *Matter, filename string, privacy bool) *Matter {
 
-	if matter == nil {
-		panic(result.BadRequest("matter cannot be nil"))
+	if user == nil {
+		panic(result.BadRequest("user cannot be nil."))
 	}
 
-	if !matter.Deleted {
-		panic(result.BadRequest("matter has not been deleted"))
+	//if fileHeader.Size not nill . check size in advance.
+	if fileHeader != nil {
+		this.checkUploadSize(request, space, fileHeader.Size)
 	}
 
-	//lock
-	this.userService.MatterLock(matter.UserUuid)
-	defer this.userService.MatterUnlock(matter.UserUuid)
+	this.checkUploadName(request, space, dirMatter, filename)
+
+	//write to blob store's temp dir and compute the hashes at the same time.
+	tmpPath, fileSize, md5, sha256 := this.blobService.WriteTmp(file)
+
+	this.logger.Info("upload %s %v ", filename, util.HumanFileSize(fileSize))
+
+	//the temp file is moved into blob store when committed, otherwise delete it.
+	defer this.blobService.Discard(tmpPath)
+
+	if fileHeader == nil {
+		this.checkUploadSize(request, space, fileSize)
+	}
+
+	locks := this.lockService.Lock(request, user, "upload", lock.Write(space.Uuid, dirMatter.Path+"/"+filename))
+	defer this.lockService.Unlock(locks)
+	dirMatter = this.reloadLocked(dirMatter)
+	this.checkUploadName(request, space, dirMatter, filename)
+
+	blob := this.blobService.Commit(space.Backend, tmpPath, md5, sha256, fileSize)
+
+	matter := this.createNonDirMatter(request, dirMatter, filename, fileSize, blob, false, privacy, user, space)
+
+	this.recentService.Record(user, matter, RECENT_MODE_UPLOAD)
+
+	return matter
+}
 
-	this.Recovery(request, matter, user)
+// check the size limit and total size limit of the space.
+func (this *MatterService) checkUploadSize(request *http.Request, space *Space, fileSize int64) {
+	this.checkSize(request, space, fileSize, fileSize)
 }
 
-// upload files.
-func (this *MatterService) Upload(request *http.Request, file io.Reader, fileHeader *multipart.FileHeader, user *User, space *Space, dirMatter *Matter, filename string, privacy bool) *Matter {
+// check the size limit with the new content of matter, and the total size limit with the change. the version kept counts too.
+func (this *MatterService) checkReplaceSize(request *http.Request, space *Space, matter *Matter, fileSize int64, archive bool) {
+	change := fileSize - matter.Size
+	if archive && space.KeepVersion() {
+		change += matter.Size
+	}
+	this.checkSize(request, space, fileSize, change)
+}
 
-	if user == nil {
-		panic(result.BadRequest("user cannot be nil."))
+// check the size limit with fileSize, and the total size limit with the size to charge.
+func (this *MatterService) checkSize(request *http.Request, space *Space, fileSize int64, charge int64) {
+
+	//check the size limit.
+	if space.SizeLimit >= 0 {
+		if fileSize > space.SizeLimit {
+			panic(result.BadRequestI18n(request, i18n.MatterSizeExceedLimit, util.HumanFileSize(fileSize), util.HumanFileSize(space.SizeLimit)))
+		}
+	}
+
+	//check total size.
+	if space.TotalSizeLimit >= 0 && charge > 0 {
+		if space.TotalSize+charge > space.TotalSizeLimit {
+			panic(result.BadRequestI18n(request, i18n.MatterSizeExceedTotalLimit, util.HumanFileSize(space.TotalSize), util.HumanFileSize(space.TotalSizeLimit)))
+		}
 	}
+}
+
+// check whether a file named filename can be put under dirMatter.
+func (this *MatterService) checkUploadName(request *http.Request, space *Space, dirMatter *Matter, filename string) {
 
 	if dirMatter == nil {
 		panic(result.BadRequest("dirMatter cannot be nil."))
@@ -486,24 +622,7 @@ func (this *MatterService) Upload(request *http.Request, file io.Reader, fileHea
 		panic(result.BadRequestI18n(request, i18n.MatterNameLengthExceedLimit, len(filename), MATTER_NAME_MAX_LENGTH))
 	}
 
-	//if fileHeader.Size not nill . check size in advance.
-	if fileHeader != nil {
-		//check the size limit.
-		if space.SizeLimit >= 0 {
-			if fileHeader.Size > space.SizeLimit {
-				panic(result.BadRequestI18n(request, i18n.MatterSizeExceedLimit, util.HumanFileSize(fileHeader.Size), util.HumanFileSize(space.SizeLimit)))
-			}
-		}
-
-		//check total size.
-		if space.TotalSizeLimit >= 0 {
-			if space.TotalSize+fileHeader.Size > space.TotalSizeLimit {
-				panic(result.BadRequestI18n(request, i18n.MatterSizeExceedTotalLimit, util.HumanFileSize(space.TotalSize), util.HumanFileSize(space.TotalSizeLimit)))
-			}
-		}
-	}
-
-	dirAbsolutePath := dirMatter.AbsolutePath()
+	this.davLockService.CheckUnlocked(request, space, dirMatter.Path+"/"+filename, false)
 
 	dbMatter := this.matterDao.FindBySpaceUuidAndPuuidAndDirAndName(space.Uuid, dirMatter.Uuid, false, filename)
 	if dbMatter != nil {
@@ -512,73 +631,107 @@ func (this *MatterService) Upload(request *http.Request, file io.Reader, fileHea
 		} else {
 			panic(result.BadRequestI18n(request, i18n.MatterExist, filename))
 		}
-
 	}
+}
 
-	fileAbsolutePath := dirAbsolutePath + "/" + filename
-
-	util.MakeDirAll(dirAbsolutePath)
+// assemble a staged file(eg. from resumable upload) into a matter. the staged file is moved rather than copied.
+func (this *MatterService) AtomicUploadStaged(request *http.Request, stagedPath string, md5 string, sha256 string, user *User, space *Space, dirMatter *Matter, filename string, privacy bool) *Matter {
 
-	//if exist, overwrite it.
-	exist := util.PathExists(fileAbsolutePath)
-	if exist {
-		this.logger.Error("%s exits, overwrite it.", fileAbsolutePath)
-		removeError := os.Remove(fileAbsolutePath)
-		this.PanicError(removeError)
-	}
+	locks := this.lockService.Lock(request, user, "upload", lock.Write(space.Uuid, dirMatter.Path+"/"+filename))
+	defer this.lockService.Unlock(locks)
+	dirMatter = this.reloadLocked(dirMatter)
+	this.checkUploadName(request, space, dirMatter, filename)
 
-	destFile, err := os.OpenFile(fileAbsolutePath, os.O_WRONLY|os.O_CREATE, 0777)
+	fileInfo, err := os.Stat(stagedPath)
 	this.PanicError(err)
-	closeDestFile := func() {
-		err := destFile.Close()
-		this.PanicError(err)
-	}
+	size := fileInfo.Size()
 
-	fileSize, err := io.Copy(destFile, file)
+	//charge the size before the staged file is moved into blob store, so that it can be assembled again if the quota is exceeded.
+	err = core.CONTEXT.GetDB().Transaction(func(tx *gorm.DB) error {
+		this.chargeSizeTx(request, tx, space, dirMatter.Path+"/"+filename, size)
+		return nil
+	})
 	this.PanicError(err)
+	created := false
+	defer func() {
+		if !created {
+			err := core.CONTEXT.GetDB().Transaction(func(tx *gorm.DB) error {
+				this.addSizeTx(tx, space.Uuid, dirMatter.Path+"/"+filename, -size)
+				return nil
+			})
+			this.PanicError(err)
+		}
+	}()
 
-	this.logger.Info("upload %s %v ", filename, util.HumanFileSize(fileSize))
+	blob := this.blobService.Commit(space.Backend, stagedPath, md5, sha256, size)
 
-	if fileHeader == nil {
-		//check the size limit.
-		if space.SizeLimit >= 0 {
-			if fileSize > space.SizeLimit {
-				closeDestFile()
+	this.logger.Info("assemble staged upload %s %v ", filename, util.HumanFileSize(size))
 
-				//delete the file on disk.
-				err = os.Remove(fileAbsolutePath)
-				this.PanicError(err)
+	matter := this.createNonDirMatter(request, dirMatter, filename, size, blob, true, privacy, user, space)
+	created = true
 
-				panic(result.BadRequestI18n(request, i18n.MatterSizeExceedLimit, util.HumanFileSize(fileSize), util.HumanFileSize(space.SizeLimit)))
-			}
-		}
+	this.recentService.Record(user, matter, RECENT_MODE_UPLOAD)
 
-		//check total size.
-		if space.TotalSizeLimit >= 0 {
-			if space.TotalSize+fileSize > space.TotalSizeLimit {
-				closeDestFile()
+	return matter
+}
 
-				//delete the file on disk.
-				err = os.Remove(fileAbsolutePath)
-				this.PanicError(err)
+// create a matter from an existing blob without receiving any bytes. return nil if no blob matches.
+func (this *MatterService) AtomicInstantUpload(request *http.Request, size int64, sha256 string, md5 string, user *User, space *Space, dirMatter *Matter, filename string, privacy bool) *Matter {
 
-				panic(result.BadRequestI18n(request, i18n.MatterSizeExceedTotalLimit, util.HumanFileSize(space.TotalSize), util.HumanFileSize(space.TotalSizeLimit)))
-			}
-		}
+	if user == nil {
+		panic(result.BadRequest("user cannot be nil."))
+	}
+	if sha256 == "" {
+		panic(result.BadRequest("sha256 is required."))
 	}
 
-	closeDestFile()
+	filename = CheckMatterName(request, filename)
+
+	locks := this.lockService.Lock(request, user, "upload", lock.Write(space.Uuid, dirMatter.Path+"/"+filename))
+	defer this.lockService.Unlock(locks)
+	dirMatter = this.reloadLocked(dirMatter)
+
+	//the space is charged as a normal upload.
+	this.checkUploadSize(request, space, size)
+	this.checkUploadName(request, space, dirMatter, filename)
+
+	blob := this.blobService.ReferenceMatch(space.Backend, size, sha256, md5)
+	if blob == nil {
+		return nil
+	}
 
-	matter := this.createNonDirMatter(dirMatter, filename, fileSize, privacy, user, space)
+	this.logger.Info("instant upload %s %v ", filename, util.HumanFileSize(size))
+
+	matter := this.createNonDirMatter(request, dirMatter, filename, size, blob, false, privacy, user, space)
+
+	this.recentService.Record(user, matter, RECENT_MODE_UPLOAD)
 
 	return matter
 }
 
-// create a non dir matter.
-func (this *MatterService) createNonDirMatter(dirMatter *Matter, filename string, fileSize int64, privacy bool, user *User, space *Space) *Matter {
+// create a non dir matter. blob is nil if the file is in the space's root dir.
+// the matter takes over the reference of blob, which is released if failed. charged means the invoker has charged the size.
+func (this *MatterService) createNonDirMatter(request *http.Request, dirMatter *Matter, filename string, fileSize int64, blob *Blob, charged bool, privacy bool, user *User, space *Space) *Matter {
+
+	created := false
+	defer func() {
+		if !created && blob != nil {
+			this.blobService.Release(blob.Backend, blob.Sha256)
+		}
+	}()
+
 	dirRelativePath := dirMatter.Path
 	fileRelativePath := dirRelativePath + "/" + filename
 
+	md5 := ""
+	sha256 := ""
+	backend := ""
+	if blob != nil {
+		md5 = blob.Md5
+		sha256 = blob.Sha256
+		backend = blob.Backend
+	}
+
 	//write to db.
 	matter := &Matter{
 		Puuid:     dirMatter.Uuid,
@@ -587,19 +740,26 @@ func (this *MatterService) createNonDirMatter(dirMatter *Matter, filename string
 		SpaceUuid: space.Uuid,
 		Dir:       false,
 		Name:      filename,
-		Md5:       "",
+		Md5:       md5,
+		Sha256:    sha256,
+		Backend:   backend,
 		Size:      fileSize,
 		Privacy:   privacy,
 		Path:      fileRelativePath,
 		Prop:      EMPTY_JSON_MAP,
 		VisitTime: time.Now(),
 	}
-	matter = this.matterDao.Create(matter)
-
-	//compute the size of directory
-	go core.RunWithRecovery(func() {
-		this.ComputeRouteSize(dirMatter.Uuid, user, space)
+	err := core.CONTEXT.GetDB().Transaction(func(tx *gorm.DB) error {
+		matter = this.matterDao.CreateTx(tx, matter)
+		if !charged {
+			this.chargeSizeTx(request, tx, space, matter.Path, fileSize)
+		}
+		return nil
 	})
+	this.PanicError(err)
+	created = true
+
+	this.searchService.Index(matter)
 
 	return matter
 }
@@ -607,94 +767,114 @@ func (this *MatterService) createNonDirMatter(dirMatter *Matter, filename string
 // create a non dir matter.
 func (this *MatterService) updateNonDirMatter(matter *Matter, fileSize int64, user *User, space *Space) *Matter {
 
+	delta := fileSize - matter.Size
 	matter.Size = fileSize
 
-	matter = this.matterDao.Save(matter)
-
-	//compute the size of directory
-	go core.RunWithRecovery(func() {
-		this.ComputeRouteSize(matter.Puuid, user, space)
+	err := core.CONTEXT.GetDB().Transaction(func(tx *gorm.DB) error {
+		matter = this.matterDao.SaveTx(tx, matter)
+		this.addSizeTx(tx, matter.SpaceUuid, matter.Path, delta)
+		return nil
 	})
+	this.PanicError(err)
 
 	return matter
 }
 
-// compute route size. It will compute upward until root directory
-func (this *MatterService) ComputeRouteSize(matterUuid string, user *User, space *Space) {
-
-	//if to root directory, then update to user's info.
-	if matterUuid == MATTER_ROOT {
+// add delta to the ancestor dirs of the matter at matterPath and the space's total size, in the transaction.
+func (this *MatterService) addSizeTx(tx *gorm.DB, spaceUuid string, matterPath string, delta int64) {
+	this.matterDao.AddAncestorSizeTx(tx, spaceUuid, matterPath, delta)
+	this.spaceDao.AddTotalSizeTx(tx, spaceUuid, delta)
+}
 
-		size := this.matterDao.SizeByPuuidAndSpaceUuid(MATTER_ROOT, space.Uuid)
+// same as addSizeTx, but panic if the total size limit of the space is exceeded.
+func (this *MatterService) chargeSizeTx(request *http.Request, tx *gorm.DB, space *Space, matterPath string, size int64) {
+	this.chargeTotalSizeTx(request, tx, space, size)
+	this.matterDao.AddAncestorSizeTx(tx, space.Uuid, matterPath, size)
+}
 
-		this.spaceDao.UpdateTotalSize(space.Uuid, size)
+// add size to the space's total size only, and panic if the limit is exceeded. eg. the size of a version.
+func (this *MatterService) chargeTotalSizeTx(request *http.Request, tx *gorm.DB, space *Space, size int64) {
+	if !this.spaceDao.ChargeTotalSizeTx(tx, space.Uuid, size) {
+		panic(result.BadRequestI18n(request, i18n.MatterSizeExceedTotalLimit, util.HumanFileSize(space.TotalSize), util.HumanFileSize(space.TotalSizeLimit)))
+	}
+}
 
-		//update user total size info in cache.
-		space.TotalSize = size
+// migrate the installs upgraded from an old version. the subtree queries rely on the path index and the right paths.
+func (this *MatterService) Bootstrap() {
 
+	if this.matterDao.HasPathIndex() {
 		return
 	}
 
-	matter := this.matterDao.CheckByUuid(matterUuid)
-
-	//only compute dir
-	if matter.Dir {
-		//compute the total size.
-		size := this.matterDao.SizeByPuuidAndSpaceUuid(matterUuid, space.Uuid)
-
-		//when changed, we update
-		if matter.Size != size {
-			this.matterDao.UpdateSize(matterUuid, size)
-
-			matter.Size = size
+	this.logger.Info("create the path index of matters, and repair the paths not matching the directories.")
+	this.spaceDao.PageHandle(func(space *Space) {
+		count := this.RepairPath(space)
+		if count > 0 {
+			this.logger.Info("repaired %d paths in space %s", count, space.Name)
 		}
+	})
 
-	}
-
-	//update parent recursively.
-	this.ComputeRouteSize(matter.Puuid, user, space)
-}
-
-// compute all dir's size.
-func (this *MatterService) ComputeAllDirSize(user *User, space *Space) {
-
-	this.logger.Info("Compute all dir's size for user %s %s", user.Uuid, user.Username)
-
-	rootMatter := NewRootMatter(space)
-	this.ComputeDirSize(rootMatter, user, space)
+	this.matterDao.CreatePathIndex()
 }
 
-// compute a dir's size.
-func (this *MatterService) ComputeDirSize(dirMatter *Matter, user *User, space *Space) {
-
-	this.logger.Info("Compute dir's size %s %s", dirMatter.Uuid, dirMatter.Name)
-
-	//update sub dir first
-	childrenDirMatters := this.matterDao.FindByUserUuidAndPuuidAndDirTrue(user.Uuid, dirMatter.Uuid)
-	for _, childrenDirMatter := range childrenDirMatters {
-		this.ComputeDirSize(childrenDirMatter, user, space)
+// rebuild the paths from the directories breadth first. return the number of paths repaired.
+func (this *MatterService) RepairPath(space *Space) int {
+
+	count := 0
+	queue := []*Matter{NewRootMatter(space)}
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+
+		for _, child := range this.matterDao.FindPathsBySpaceUuidAndPuuid(space.Uuid, dir.Uuid) {
+			path := dir.Path + "/" + child.Name
+			if child.Path != path {
+				this.matterDao.UpdatePath(child.Uuid, path)
+				child.Path = path
+				count++
+			}
+			if child.Dir {
+				queue = append(queue, child)
+			}
+		}
 	}
 
-	//if to root directory, then update to user's info.
-	if dirMatter.Uuid == MATTER_ROOT {
-
-		size := this.matterDao.SizeByPuuidAndSpaceUuid(MATTER_ROOT, space.Uuid)
-
-		this.spaceDao.UpdateTotalSize(space.Uuid, size)
-
-		//update user total size info in cache.
-		space.TotalSize = size
-	} else {
+	return count
+}
 
-		//compute self.
-		size := this.matterDao.SizeByPuuidAndSpaceUuid(dirMatter.Uuid, user.Uuid)
+// recompute the sizes of a space from its files and report the drift. the drifted sizes are corrected if fix.
+// the sizes are read and corrected by deltas in one transaction, so the concurrent changes are kept.
+func (this *MatterService) RecomputeSize(user *User, space *Space, fix bool) *SizeDrift {
+
+	var drift *SizeDrift
+	err := core.CONTEXT.GetDB().Transaction(func(tx *gorm.DB) error {
+		space = this.spaceDao.CheckByUuidTx(tx, space.Uuid)
+		drift = &SizeDrift{
+			SpaceUuid: space.Uuid,
+			SpaceName: space.Name,
+			TotalSize: space.TotalSize,
+			//versions are counted too.
+			ActualTotalSize: this.matterDao.SumSizeBySpaceUuidTx(tx, space.Uuid) + this.matterVersionDao.SumSizeBySpaceUuidTx(tx, space.Uuid),
+			Dirs:            this.matterDao.FindDirSizeDriftsBySpaceUuidTx(tx, space.Uuid),
+		}
 
-		//when changed, we update
-		if dirMatter.Size != size {
-			this.spaceDao.UpdateTotalSize(space.Uuid, size)
+		if !drift.Drifted() || !fix {
+			return nil
+		}
+		for _, dir := range drift.Dirs {
+			this.matterDao.AddSizeTx(tx, dir.Uuid, dir.ActualSize-dir.Size)
 		}
+		this.spaceDao.AddTotalSizeTx(tx, space.Uuid, drift.ActualTotalSize-drift.TotalSize)
+		drift.Fixed = true
+		return nil
+	})
+	this.PanicError(err)
+
+	if drift.Drifted() {
+		this.logger.Info("size of space %s drifted. total size %d -> %d, %d dirs drifted", space.Name, drift.TotalSize, drift.ActualTotalSize, len(drift.Dirs))
 	}
 
+	return drift
 }
 
 // inner create directory.
@@ -767,6 +947,8 @@ func (this *MatterService) createDirectory(request *http.Request, dirMatter *Mat
 
 	matter = this.matterDao.Create(matter)
 
+	this.searchService.IndexName(matter)
+
 	return matter
 }
 
@@ -776,21 +958,28 @@ func (this *MatterService) AtomicCreateDirectory(request *http.Request, dirMatte
 		panic(result.BadRequest("Dir has been deleted. Cannot create sub dir under it."))
 	}
 
-	this.userService.MatterLock(user.Uuid)
-	defer this.userService.MatterUnlock(user.Uuid)
+	locks := this.lockService.Lock(request, user, "create directory", lock.Write(space.Uuid, dirMatter.Path+"/"+name))
+	defer this.lockService.Unlock(locks)
 
 	matter := this.createDirectory(request, dirMatter, name, user, space)
 
 	return matter
 }
 
-// copy or move may overwrite.
-func (this *MatterService) handleOverwrite(request *http.Request, user *User, space *Space, destinationPath string, overwrite bool) {
+// handle the overwrite. if both the src and the existing dest are files, return the dest whose content will be replaced,
+// so that its content can be kept as a version. otherwise the dest is deleted.
+func (this *MatterService) handleOverwrite(request *http.Request, user *User, space *Space, srcMatter *Matter, destinationPath string, overwrite bool) *Matter {
 
-	destMatter := this.matterDao.findByUserUuidAndPath(user.Uuid, destinationPath)
+	destMatter := this.matterDao.findBySpaceUuidAndPath(space.Uuid, destinationPath)
 	if destMatter != nil {
 		//if exist
 		if overwrite {
+			if destMatter.Uuid == srcMatter.Uuid {
+				panic(result.BadRequest("cannot overwrite itself."))
+			}
+			if !srcMatter.Dir && !destMatter.Dir {
+				return destMatter
+			}
 			//delete.
 			this.Delete(request, destMatter, user, space)
 		} else {
@@ -799,67 +988,289 @@ func (this *MatterService) handleOverwrite(request *http.Request, user *User, sp
 		}
 	}
 
+	return nil
 }
 
-// move srcMatter to destMatter. invoker must handled the overwrite and lock.
-func (this *MatterService) move(request *http.Request, srcMatter *Matter, destDirMatter *Matter, user *User, space *Space) {
+// replace the content of a file. the previous content is kept as a version if archive. invoker must handle the lock.
+// the change of size and the version are charged together, so nothing changes if the total size limit is exceeded.
+func (this *MatterService) replaceContent(request *http.Request, matter *Matter, blob *Blob, user *User, space *Space, archive bool) *Matter {
 
-	if srcMatter == nil {
-		panic(result.BadRequest("srcMatter cannot be nil."))
+	this.logger.Info("replace content of %s", matter.Path)
+
+	var version *MatterVersion
+	if archive {
+		version = this.matterVersionService.NewVersion(matter, space)
 	}
+	previous := *matter
+	replaced := false
+	defer func() {
+		if !replaced {
+			*matter = previous
+			if version != nil {
+				this.blobService.Release(version.Backend, version.Sha256)
+			}
+		}
+	}()
 
-	if !destDirMatter.Dir {
-		panic(result.BadRequestI18n(request, i18n.MatterDestinationMustDirectory))
+	delta := blob.Size - matter.Size
+	charge := delta
+	if version != nil {
+		charge += version.Size
+	}
+	matter.Md5 = blob.Md5
+	matter.Sha256 = blob.Sha256
+	matter.Backend = blob.Backend
+	matter.Size = blob.Size
+	err := core.CONTEXT.GetDB().Transaction(func(tx *gorm.DB) error {
+		matter = this.matterDao.SaveTx(tx, matter)
+		if version != nil {
+			this.matterVersionDao.CreateTx(tx, version)
+		}
+		//the version counts in the space's total size, but not in the directories'.
+		this.chargeTotalSizeTx(request, tx, space, charge)
+		this.matterDao.AddAncestorSizeTx(tx, space.Uuid, matter.Path, delta)
+		return nil
+	})
+	this.PanicError(err)
+	replaced = true
+
+	//release the previous content.
+	if previous.IsBlob() {
+		this.blobService.Release(previous.Backend, previous.Sha256)
+	} else {
+		err := os.Remove(previous.AbsolutePath())
+		if err != nil {
+			this.logger.Error("occur error when deleting file. %v", err)
+		}
 	}
 
-	srcPuuid := srcMatter.Puuid
-	destDirUuid := destDirMatter.Uuid
+	//delete caches.
+	this.imageCacheDao.DeleteByMatterUuid(matter.Uuid)
 
-	if srcMatter.Dir {
+	if version != nil {
+		this.matterVersionService.Prune(matter.Uuid, space.VersionKeepNum, space.VersionKeepDays)
+	}
 
-		//if src is dir.
-		destAbsolutePath := destDirMatter.AbsolutePath() + "/" + srcMatter.Name
-		srcAbsolutePath := srcMatter.AbsolutePath()
+	this.searchService.IndexContent(matter)
 
-		//move src to dest on disk.
-		err := os.Rename(srcAbsolutePath, destAbsolutePath)
-		this.PanicError(err)
+	return matter
+}
 
-		//change info on db.
-		srcMatter.Puuid = destDirMatter.Uuid
-		srcMatter.Path = destDirMatter.Path + "/" + srcMatter.Name
-		srcMatter = this.matterDao.Save(srcMatter)
+// read the matter again under the lock of its path, so that the latest one is operated.
+func (this *MatterService) reloadLocked(matter *Matter) *Matter {
+	if matter.Uuid == MATTER_ROOT {
+		return matter
+	}
+	latest := this.matterDao.CheckByUuid(matter.Uuid)
+	if latest.Deleted || latest.Path != matter.Path {
+		panic(result.CustomWebResult(result.CONFLICT, fmt.Sprintf("%s has been moved or deleted", matter.Path)))
+	}
+	return latest
+}
 
-		//reCompute the path.
-		matters := this.matterDao.FindByPuuidAndUserUuid(srcMatter.Uuid, srcMatter.UserUuid, nil)
-		for _, m := range matters {
-			this.adjustPath(m, srcMatter)
+// replace the content of a file with a blob which has been referenced. the reference is released if failed.
+func (this *MatterService) AtomicReplace(request *http.Request, matter *Matter, blob *Blob, user *User, space *Space) *Matter {
+
+	replaced := false
+	defer func() {
+		if !replaced {
+			this.blobService.Release(blob.Backend, blob.Sha256)
 		}
+	}()
 
-	} else {
+	locks := this.lockService.Lock(request, user, "replace", lock.Write(space.Uuid, matter.Path))
+	defer this.lockService.Unlock(locks)
+	matter = this.reloadLocked(matter)
+	this.davLockService.CheckUnlocked(request, space, matter.Path, false)
+
+	matter = this.replaceContent(request, matter, blob, user, space, true)
+	replaced = true
+
+	return matter
+}
+
+// upload to an existing file. the previous content is kept as a version.
+// check is invoked with the latest file under the lock if not nil. eg. the preconditions of webdav.
+func (this *MatterService) AtomicReplaceUpload(request *http.Request, file io.Reader, user *User, space *Space, matter *Matter, check func(matter *Matter)) *Matter {
+
+	if matter.Dir {
+		panic(result.BadRequest("cannot replace the content of a directory."))
+	}
+
+	tmpPath, fileSize, md5, sha256 := this.blobService.WriteTmp(file)
+	defer this.blobService.Discard(tmpPath)
+
+	this.logger.Info("upload %s %v ", matter.Name, util.HumanFileSize(fileSize))
+
+	locks := this.lockService.Lock(request, user, "upload", lock.Write(space.Uuid, matter.Path))
+	defer this.lockService.Unlock(locks)
+	matter = this.reloadLocked(matter)
+	if check != nil {
+		check(matter)
+	}
+	this.davLockService.CheckUnlocked(request, space, matter.Path, false)
+	this.checkReplaceSize(request, space, matter, fileSize, true)
+
+	blob := this.blobService.Commit(space.Backend, tmpPath, md5, sha256, fileSize)
+	replaced := false
+	defer func() {
+		if !replaced {
+			this.blobService.Release(blob.Backend, blob.Sha256)
+		}
+	}()
+
+	matter = this.replaceContent(request, matter, blob, user, space, true)
+	replaced = true
+
+	this.recentService.Record(user, matter, RECENT_MODE_UPLOAD)
+
+	return matter
+}
+
+// replace the file's content from an offset with the body of length. the blob store keeps whole files, so the content is written again.
+// a partial update doesn't keep a version, or a client writing a file in chunks would leave a version per chunk.
+// startOf is invoked with the latest file under the lock, checks it and returns the offset, so the head and the tail are read from it.
+func (this *MatterService) AtomicUpdateRange(request *http.Request, body io.Reader, length int64, user *User, space *Space, matter *Matter, startOf func(matter *Matter) int64) *Matter {
+
+	if matter.Dir {
+		panic(result.BadRequest("cannot replace the content of a directory."))
+	}
+
+	//the range is received before the lock, so that a slow client never holds it.
+	rangePath, length, _, _ := this.blobService.WriteTmp(io.LimitReader(body, length))
+	defer this.blobService.Discard(rangePath)
 
-		//if src is NOT dir.
-		destAbsolutePath := destDirMatter.AbsolutePath() + "/" + srcMatter.Name
-		srcAbsolutePath := srcMatter.AbsolutePath()
+	//the content around the range mustn't change before the new one is written.
+	locks := this.lockService.Lock(request, user, "upload", lock.Write(space.Uuid, matter.Path))
+	defer this.lockService.Unlock(locks)
+	matter = this.reloadLocked(matter)
+	start := startOf(matter)
+	this.davLockService.CheckUnlocked(request, space, matter.Path, false)
 
-		//move src to dest on disk.
-		err := os.Rename(srcAbsolutePath, destAbsolutePath)
+	head := this.storageService.OpenMatter(matter)
+	defer func() {
+		err := head.Close()
+		this.PanicError(err)
+	}()
+	rangeFile, err := os.Open(rangePath)
+	this.PanicError(err)
+	defer func() {
+		err := rangeFile.Close()
+		this.PanicError(err)
+	}()
+	readers := []io.Reader{io.LimitReader(head, start), rangeFile}
+
+	//the content after the range is kept.
+	if start+length < matter.Size {
+		tail := this.storageService.OpenMatter(matter)
+		defer func() {
+			err := tail.Close()
+			this.PanicError(err)
+		}()
+		_, err = tail.Seek(start+length, io.SeekStart)
 		this.PanicError(err)
+		readers = append(readers, tail)
+	}
+
+	tmpPath, fileSize, md5, sha256 := this.blobService.WriteTmp(io.MultiReader(readers...))
+	defer this.blobService.Discard(tmpPath)
+
+	this.logger.Info("update %s from %d %v ", matter.Name, start, util.HumanFileSize(fileSize))
+
+	this.checkReplaceSize(request, space, matter, fileSize, false)
+
+	blob := this.blobService.Commit(space.Backend, tmpPath, md5, sha256, fileSize)
+	replaced := false
+	defer func() {
+		if !replaced {
+			this.blobService.Release(blob.Backend, blob.Sha256)
+		}
+	}()
+
+	matter = this.replaceContent(request, matter, blob, user, space, false)
+	replaced = true
+
+	this.recentService.Record(user, matter, RECENT_MODE_UPLOAD)
+
+	return matter
+}
+
+// the content of srcMatter replaces destMatter's, and srcMatter's versions go with it. then srcMatter is deleted.
+func (this *MatterService) moveOnto(request *http.Request, srcMatter *Matter, destMatter *Matter, user *User, space *Space) {
+
+	this.logger.Info("move %s onto %s", srcMatter.Path, destMatter.Path)
+
+	destMatter = this.replaceContent(request, destMatter, this.referenceContent(srcMatter, space), user, space, true)
+
+	this.matterVersionDao.UpdateMatterUuid(srcMatter.Uuid, destMatter.Uuid)
+	this.tagService.CopyTags(srcMatter, destMatter)
+
+	this.Delete(request, srcMatter, user, space)
+}
+
+// add a reference to the content of a file in the space's backend. legacy file or file in other backend is imported.
+func (this *MatterService) referenceContent(matter *Matter, space *Space) *Blob {
+	var blob *Blob
+	if matter.IsBlob() {
+		blob = this.blobService.Reference(space.Backend, matter.Sha256)
+	}
+	if blob == nil {
+		reader := this.storageService.OpenMatter(matter)
+		defer func() {
+			err := reader.Close()
+			this.PanicError(err)
+		}()
+		blob = this.blobService.Import(space.Backend, reader)
+	}
+	return blob
+}
 
-		//delete caches.
-		this.imageCacheDao.DeleteByMatterUuid(srcMatter.Uuid)
+// move srcMatter to destMatter. invoker must handled the overwrite and lock.
+func (this *MatterService) move(request *http.Request, srcMatter *Matter, destDirMatter *Matter, user *User, space *Space) {
 
-		//change info in db.
+	if srcMatter == nil {
+		panic(result.BadRequest("srcMatter cannot be nil."))
+	}
+
+	if !destDirMatter.Dir {
+		panic(result.BadRequestI18n(request, i18n.MatterDestinationMustDirectory))
+	}
+
+	srcPath := srcMatter.Path
+	srcAbsolutePath := srcMatter.AbsolutePath()
+	destAbsolutePath := destDirMatter.AbsolutePath() + "/" + srcMatter.Name
+
+	this.unitOfWorkService.Run(func(work *UnitOfWork) {
+
+		//change info in db. the children's paths are changed at once.
 		srcMatter.Puuid = destDirMatter.Uuid
 		srcMatter.Path = destDirMatter.Path + "/" + srcMatter.Name
-		srcMatter = this.matterDao.Save(srcMatter)
+		this.matterDao.SaveTx(work.DB, srcMatter)
+		if srcMatter.Dir {
+			this.matterDao.UpdateDescendantPathTx(work.DB, srcMatter.SpaceUuid, srcPath, srcMatter.Path)
+		}
 
-	}
+		//the size goes from the src ancestors to the dest ones.
+		this.matterDao.AddAncestorSizeTx(work.DB, srcMatter.SpaceUuid, srcPath, -srcMatter.Size)
+		this.matterDao.AddAncestorSizeTx(work.DB, srcMatter.SpaceUuid, srcMatter.Path, srcMatter.Size)
+
+		//move src to dest on disk. blob stays where it is, only the metadata moves.
+		if srcMatter.Dir || !srcMatter.IsBlob() {
+			work.Rename(srcAbsolutePath, destAbsolutePath)
+		}
+	})
 
-	//reCompute the size of src and dest.
-	this.ComputeRouteSize(srcPuuid, user, space)
-	this.ComputeRouteSize(destDirUuid, user, space)
+	//delete caches.
+	this.deleteImageCaches(srcMatter)
+}
 
+// delete the image caches of a matter and the matters under it.
+func (this *MatterService) deleteImageCaches(matter *Matter) {
+	if matter.Dir {
+		this.imageCacheDao.DeleteByMatterUuidQuery(this.matterDao.DescendantUuidQuery(matter.SpaceUuid, matter.Path))
+	} else {
+		this.imageCacheDao.DeleteByMatterUuid(matter.Uuid)
+	}
 }
 
 // move srcMatter to destMatter(must be dir)
@@ -869,9 +1280,6 @@ func (this *MatterService) AtomicMove(request *http.Request, srcMatter *Matter,
 		panic(result.BadRequest("srcMatter cannot be nil."))
 	}
 
-	this.userService.MatterLock(srcMatter.UserUuid)
-	defer this.userService.MatterUnlock(srcMatter.UserUuid)
-
 	if destDirMatter == nil {
 		panic(result.BadRequest("destDirMatter cannot be nil."))
 	}
@@ -879,6 +1287,11 @@ func (this *MatterService) AtomicMove(request *http.Request, srcMatter *Matter,
 		panic(result.BadRequestI18n(request, i18n.MatterDestinationMustDirectory))
 	}
 
+	locks := this.lockService.Lock(request, user, "move", lock.Write(space.Uuid, srcMatter.Path), lock.Write(space.Uuid, destDirMatter.Path+"/"+srcMatter.Name))
+	defer this.lockService.Unlock(locks)
+	this.davLockService.CheckUnlocked(request, space, srcMatter.Path, true)
+	this.davLockService.CheckUnlocked(request, space, destDirMatter.Path+"/"+srcMatter.Name, true)
+
 	//neither move to itself, nor move to its children.
 	destDirMatter = this.WrapParentDetail(request, destDirMatter)
 	tmpMatter := destDirMatter
@@ -886,15 +1299,64 @@ func (this *MatterService) AtomicMove(request *http.Request, srcMatter *Matter,
 		if srcMatter.Uuid == tmpMatter.Uuid {
 			panic(result.BadRequestI18n(request, i18n.MatterMoveRecursive))
 		}
-		tmpMatter = tmpMatter.Parent
-	}
+		tmpMatter = tmpMatter.Parent
+	}
+
+	//handle the overwrite
+	destinationPath := destDirMatter.Path + "/" + srcMatter.Name
+	destMatter := this.handleOverwrite(request, user, space, srcMatter, destinationPath, overwrite)
+	if destMatter != nil {
+		this.moveOnto(request, srcMatter, destMatter, user, space)
+		return
+	}
+
+	//do the move operation.
+	this.move(request, srcMatter, destDirMatter, user, space)
+}
+
+// check the matters to move and the destination directory.
+func (this *MatterService) CheckMoveBatch(request *http.Request, srcUuids []string, destUuid string, user *User, space *Space) ([]*Matter, *Matter) {
+
+	var destMatter = this.matterDao.CheckWithRootByUuid(destUuid, space)
+	if !destMatter.Dir {
+		panic(result.BadRequest("destination is not a directory"))
+	}
+
+	if destMatter.SpaceUuid != space.Uuid {
+		panic(result.UNAUTHORIZED)
+	}
+
+	if destMatter.Deleted {
+		panic(result.BadRequest("dest matter has been deleted. Cannot move."))
+	}
+
+	var srcMatters []*Matter
+	for _, uuid := range srcUuids {
+		srcMatter := this.matterDao.CheckByUuid(uuid)
+
+		if srcMatter.Puuid == destMatter.Uuid {
+			panic(result.BadRequest("no move, invalid operation"))
+		}
+
+		if srcMatter.Deleted {
+			panic(result.BadRequest("src matter has been deleted. Cannot move."))
+		}
+
+		//check whether there are files with the same name.
+		count := this.matterDao.CountByUserUuidAndPuuidAndDirAndName(user.Uuid, destMatter.Uuid, srcMatter.Dir, srcMatter.Name)
+
+		if count > 0 {
+			panic(result.BadRequestI18n(request, i18n.MatterExist, srcMatter.Name))
+		}
 
-	//handle the overwrite
-	destinationPath := destDirMatter.Path + "/" + srcMatter.Name
-	this.handleOverwrite(request, user, space, destinationPath, overwrite)
+		if srcMatter.SpaceUuid != destMatter.SpaceUuid {
+			panic("space not the same")
+		}
 
-	//do the move operation.
-	this.move(request, srcMatter, destDirMatter, user, space)
+		srcMatters = append(srcMatters, srcMatter)
+	}
+
+	return srcMatters, destMatter
 }
 
 // move srcMatters to destMatter(must be dir)
@@ -904,13 +1366,21 @@ func (this *MatterService) AtomicMoveBatch(request *http.Request, srcMatters []*
 		panic(result.BadRequest("destDirMatter cannot be nil."))
 	}
 
-	this.userService.MatterLock(destDirMatter.UserUuid)
-	defer this.userService.MatterUnlock(destDirMatter.UserUuid)
-
 	if srcMatters == nil {
 		panic(result.BadRequest("srcMatters cannot be nil."))
 	}
 
+	requests := make([]lock.Request, 0, 2*len(srcMatters))
+	for _, srcMatter := range srcMatters {
+		requests = append(requests, lock.Write(space.Uuid, srcMatter.Path), lock.Write(space.Uuid, destDirMatter.Path+"/"+srcMatter.Name))
+	}
+	locks := this.lockService.Lock(request, user, "move", requests...)
+	defer this.lockService.Unlock(locks)
+	for _, srcMatter := range srcMatters {
+		this.davLockService.CheckUnlocked(request, space, srcMatter.Path, true)
+		this.davLockService.CheckUnlocked(request, space, destDirMatter.Path+"/"+srcMatter.Name, true)
+	}
+
 	if !destDirMatter.Dir {
 		panic(result.BadRequestI18n(request, i18n.MatterDestinationMustDirectory))
 	}
@@ -928,67 +1398,109 @@ func (this *MatterService) AtomicMoveBatch(request *http.Request, srcMatters []*
 		}
 	}
 
-	for _, srcMatter := range srcMatters {
+	runner := JobOf(request)
+	for i, srcMatter := range srcMatters {
+		runner.CheckCanceled()
+		runner.Log("move %s", srcMatter.Path)
 		this.move(request, srcMatter, destDirMatter, user, space)
+		runner.Progress(int64(i+1), int64(len(srcMatters)))
 	}
 
 }
 
+// a matter to copy with the content referenced for the copy.
+type matterCopy struct {
+	src      *Matter
+	name     string
+	blob     *Blob
+	children []*matterCopy
+}
+
 // copy srcMatter to destMatter. invoker must handled the overwrite and lock.
-func (this *MatterService) copy(request *http.Request, srcMatter *Matter, destDirMatter *Matter, name string) {
+func (this *MatterService) copy(request *http.Request, srcMatter *Matter, destDirMatter *Matter, name string, space *Space) {
 
 	this.logger.Info("copy srcPath = %s destPath = %s/%s", srcMatter.Path, destDirMatter.Path, name)
 
-	if srcMatter.Dir {
-
-		newMatter := &Matter{
-			Puuid:     destDirMatter.Uuid,
-			UserUuid:  srcMatter.UserUuid,
-			SpaceName: srcMatter.SpaceName,
-			Dir:       srcMatter.Dir,
-			Name:      name,
-			Md5:       "",
-			Size:      srcMatter.Size,
-			Privacy:   srcMatter.Privacy,
-			Path:      destDirMatter.Path + "/" + name,
-			Prop:      EMPTY_JSON_MAP,
-			VisitTime: time.Now(),
+	//the contents are referenced before the work, and released if the copy fails.
+	var blobs []*Blob
+	committed := false
+	defer func() {
+		if !committed {
+			for _, blob := range blobs {
+				this.blobService.Release(blob.Backend, blob.Sha256)
+			}
 		}
+	}()
+	plan := this.planCopy(srcMatter, name, space, &blobs)
 
-		newMatter = this.matterDao.Create(newMatter)
+	this.unitOfWorkService.Run(func(work *UnitOfWork) {
+		this.copyTx(work, plan, destDirMatter)
+		this.chargeSizeTx(request, work.DB, space, destDirMatter.Path+"/"+name, srcMatter.Size)
+	})
+	committed = true
+}
 
-		//make the dir
-		util.MakeDirAll(newMatter.AbsolutePath())
+// read the tree of srcMatter and reference the contents.
+func (this *MatterService) planCopy(srcMatter *Matter, name string, space *Space, blobs *[]*Blob) *matterCopy {
 
-		//copy children
+	plan := &matterCopy{src: srcMatter, name: name}
+
+	if srcMatter.Dir {
 		matters := this.matterDao.FindByPuuidAndUserUuid(srcMatter.Uuid, srcMatter.UserUuid, nil)
 		for _, m := range matters {
-			this.copy(request, m, newMatter, m.Name)
+			plan.children = append(plan.children, this.planCopy(m, m.Name, space, blobs))
 		}
-
 	} else {
+		//only add a reference to the blob. legacy file is imported into blob store.
+		plan.blob = this.referenceContent(srcMatter, space)
+		*blobs = append(*blobs, plan.blob)
+	}
 
-		destAbsolutePath := destDirMatter.AbsolutePath() + "/" + name
-		srcAbsolutePath := srcMatter.AbsolutePath()
+	return plan
+}
 
-		//copy file on disk.
-		util.CopyFile(srcAbsolutePath, destAbsolutePath)
+// create the copies in the work.
+func (this *MatterService) copyTx(work *UnitOfWork, plan *matterCopy, destDirMatter *Matter) {
+
+	srcMatter := plan.src
+	newMatter := &Matter{
+		Puuid:     destDirMatter.Uuid,
+		UserUuid:  srcMatter.UserUuid,
+		SpaceName: srcMatter.SpaceName,
+		SpaceUuid: srcMatter.SpaceUuid,
+		Dir:       srcMatter.Dir,
+		Name:      plan.name,
+		Size:      srcMatter.Size,
+		Privacy:   srcMatter.Privacy,
+		Path:      destDirMatter.Path + "/" + plan.name,
+		Prop:      EMPTY_JSON_MAP,
+		VisitTime: time.Now(),
+	}
+	if plan.blob != nil {
+		newMatter.Md5 = plan.blob.Md5
+		newMatter.Sha256 = plan.blob.Sha256
+		newMatter.Backend = plan.blob.Backend
+	}
+	newMatter = this.matterDao.CreateTx(work.DB, newMatter)
+	this.davPropDao.CopyTx(work.DB, srcMatter, newMatter)
 
-		newMatter := &Matter{
-			Puuid:     destDirMatter.Uuid,
-			UserUuid:  srcMatter.UserUuid,
-			SpaceName: srcMatter.SpaceName,
-			Dir:       srcMatter.Dir,
-			Name:      name,
-			Md5:       "",
-			Size:      srcMatter.Size,
-			Privacy:   srcMatter.Privacy,
-			Path:      destDirMatter.Path + "/" + name,
-			Prop:      EMPTY_JSON_MAP,
-			VisitTime: time.Now(),
+	work.AfterCommit(func() {
+		if newMatter.Dir {
+			this.searchService.IndexName(newMatter)
+		} else {
+			this.searchService.Index(newMatter)
 		}
-		newMatter = this.matterDao.Create(newMatter)
+		this.tagService.CopyTags(srcMatter, newMatter)
+	})
+
+	if srcMatter.Dir {
+		//make the dir
+		work.MakeDir(newMatter.AbsolutePath())
 
+		//copy children
+		for _, child := range plan.children {
+			this.copyTx(work, child, newMatter)
+		}
 	}
 }
 
@@ -999,17 +1511,24 @@ func (this *MatterService) AtomicCopy(request *http.Request, srcMatter *Matter,
 		panic(result.BadRequest("srcMatter cannot be nil."))
 	}
 
-	this.userService.MatterLock(srcMatter.UserUuid)
-	defer this.userService.MatterUnlock(srcMatter.UserUuid)
-
 	if !destDirMatter.Dir {
 		panic(result.BadRequestI18n(request, i18n.MatterDestinationMustDirectory))
 	}
 
 	destinationPath := destDirMatter.Path + "/" + name
-	this.handleOverwrite(request, user, space, destinationPath, overwrite)
 
-	this.copy(request, srcMatter, destDirMatter, name)
+	locks := this.lockService.Lock(request, user, "copy", lock.Read(space.Uuid, srcMatter.Path), lock.Write(space.Uuid, destinationPath))
+	defer this.lockService.Unlock(locks)
+	this.davLockService.CheckUnlocked(request, space, destinationPath, true)
+
+	destMatter := this.handleOverwrite(request, user, space, srcMatter, destinationPath, overwrite)
+	if destMatter != nil {
+		//only the content is copied.
+		this.replaceContent(request, destMatter, this.referenceContent(srcMatter, space), user, space, true)
+		return
+	}
+
+	this.copy(request, srcMatter, destDirMatter, name, space)
 }
 
 // rename matter to name
@@ -1025,11 +1544,13 @@ func (this *MatterService) AtomicRename(request *http.Request, matter *Matter, n
 		panic(result.BadRequest("matter has been deleted. Cannot rename."))
 	}
 
-	this.userService.MatterLock(user.Uuid)
-	defer this.userService.MatterUnlock(user.Uuid)
-
 	name = CheckMatterName(request, name)
 
+	locks := this.lockService.Lock(request, user, "rename", lock.Write(space.Uuid, matter.Path), lock.Write(space.Uuid, path.Dir(matter.Path)+"/"+name))
+	defer this.lockService.Unlock(locks)
+	this.davLockService.CheckUnlocked(request, space, matter.Path, true)
+	this.davLockService.CheckUnlocked(request, space, path.Dir(matter.Path)+"/"+name, true)
+
 	if name == matter.Name {
 		panic(result.BadRequestI18n(request, i18n.MatterNameNoChange))
 	}
@@ -1038,6 +1559,11 @@ func (this *MatterService) AtomicRename(request *http.Request, matter *Matter, n
 	oldMatter := this.matterDao.FindBySpaceNameAndPuuidAndDirAndName(space.Name, matter.Puuid, "", name)
 	if oldMatter != nil {
 		if overwrite {
+			if !matter.Dir && !oldMatter.Dir {
+				//keep the content of the old one as a version.
+				this.moveOnto(request, matter, oldMatter, user, space)
+				return
+			}
 			//delete this one.
 			this.Delete(request, oldMatter, user, space)
 		} else {
@@ -1046,52 +1572,36 @@ func (this *MatterService) AtomicRename(request *http.Request, matter *Matter, n
 
 	}
 
-	if matter.Dir {
-		//如果源是文件夹
+	this.rename(request, matter, name, user, space)
+}
 
-		oldAbsolutePath := matter.AbsolutePath()
-		absoluteDirPath := util.GetDirOfPath(oldAbsolutePath)
-		relativeDirPath := util.GetDirOfPath(matter.Path)
-		newAbsolutePath := absoluteDirPath + "/" + name
+// rename matter to name in the same directory. invoker must handled the overwrite and lock.
+func (this *MatterService) rename(request *http.Request, matter *Matter, name string, user *User, space *Space) {
 
-		//物理文件一口气移动
-		err := os.Rename(oldAbsolutePath, newAbsolutePath)
-		this.PanicError(err)
+	oldPath := matter.Path
+	oldAbsolutePath := matter.AbsolutePath()
+	newAbsolutePath := util.GetDirOfPath(oldAbsolutePath) + "/" + name
 
-		//修改数据库中信息
-		matter.Name = name
-		matter.Path = relativeDirPath + "/" + name
-		matter = this.matterDao.Save(matter)
+	this.unitOfWorkService.Run(func(work *UnitOfWork) {
 
-		//调整该文件夹下文件的Path.
-		matters := this.matterDao.FindByPuuidAndUserUuid(matter.Uuid, matter.UserUuid, nil)
-		for _, m := range matters {
-			this.adjustPath(m, matter)
+		//修改数据库中信息，文件夹下文件的Path一次性调整
+		matter.Name = name
+		matter.Path = util.GetDirOfPath(oldPath) + "/" + name
+		this.matterDao.SaveTx(work.DB, matter)
+		if matter.Dir {
+			this.matterDao.UpdateDescendantPathTx(work.DB, matter.SpaceUuid, oldPath, matter.Path)
 		}
 
-	} else {
-		//如果源是普通文件
-
-		oldAbsolutePath := matter.AbsolutePath()
-		absoluteDirPath := util.GetDirOfPath(oldAbsolutePath)
-		relativeDirPath := util.GetDirOfPath(matter.Path)
-		newAbsolutePath := absoluteDirPath + "/" + name
-
-		//物理文件进行移动
-		err := os.Rename(oldAbsolutePath, newAbsolutePath)
-		this.PanicError(err)
-
-		//删除对应的缓存。
-		this.imageCacheDao.DeleteByMatterUuid(matter.Uuid)
-
-		//修改数据库中信息
-		matter.Name = name
-		matter.Path = relativeDirPath + "/" + name
-		matter = this.matterDao.Save(matter)
+		//物理文件进行移动，blob中的文件无需移动
+		if matter.Dir || !matter.IsBlob() {
+			work.Rename(oldAbsolutePath, newAbsolutePath)
+		}
+	})
 
-	}
+	//删除对应的缓存。
+	this.deleteImageCaches(matter)
 
-	return
+	this.searchService.IndexName(matter)
 }
 
 // 将本地文件映射到蓝眼云盘中去。
@@ -1101,32 +1611,153 @@ func (this *MatterService) AtomicMirror(request *http.Request, srcPath string, d
 		panic(result.BadRequest("user cannot be nil"))
 	}
 
-	//操作锁
-	this.userService.MatterLock(user.Uuid)
-	defer this.userService.MatterUnlock(user.Uuid)
-
 	//验证参数。
 	if destPath == "" {
 		panic(result.BadRequest("dest cannot be null"))
 	}
 
+	//only the configured directories can be mirrored.
+	roots := this.CheckMirrorAble(request, user, space)
+	this.checkMirrorPath(roots, srcPath)
+
+	//操作锁
+	locks := this.lockService.Lock(request, user, "mirror", lock.Write(space.Uuid, destPath))
+	defer this.lockService.Unlock(locks)
+
 	destDirMatter := this.CreateDirectories(request, user, space, destPath)
 
 	if destDirMatter.Deleted {
 		panic(result.BadRequest("dest matter has been deleted. Cannot mirror."))
 	}
 
-	this.mirror(request, srcPath, destDirMatter, overwrite, user, space)
+	this.mirror(request, roots, srcPath, destDirMatter, overwrite, user, space)
+}
+
+// check a local directory configured to mirror from. return its real path.
+func (this *MatterService) CheckMirrorRoot(root string) string {
+	realRoot, err := mirrorRoot(root)
+	if err != nil {
+		panic(result.BadRequest("mirror root %s error. %s", root, err.Error()))
+	}
+	return realRoot
+}
+
+// the real path of a mirror root, which cannot overlap the matters.
+func mirrorRoot(root string) (string, error) {
+	if !filepath.IsAbs(root) {
+		return "", errors.New("not an absolute path")
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+	fileStat, err := os.Stat(realRoot)
+	if err != nil {
+		return "", err
+	}
+	if !fileStat.IsDir() {
+		return "", errors.New("not a directory")
+	}
+	matterPath, err := filepath.EvalSymlinks(core.CONFIG.MatterPath())
+	if err != nil {
+		matterPath = filepath.Clean(core.CONFIG.MatterPath())
+	}
+	if util.IsSubPath(realRoot, matterPath) || util.IsSubPath(matterPath, realRoot) {
+		return "", errors.New("overlap the matter path")
+	}
+	return realRoot, nil
+}
+
+// check whether the user can mirror into the space. return the real paths of the roots to mirror from.
+func (this *MatterService) CheckMirrorAble(request *http.Request, user *User, space *Space) []string {
+
+	mirrorConfig := this.preferenceService.Fetch().FetchMirrorConfig()
+	if !mirrorConfig.Allow(user) {
+		panic(result.BadRequestI18n(request, i18n.PermissionDenied))
+	}
+
+	var roots []string
+	for _, root := range mirrorConfig.FetchRoots(space) {
+		realRoot, err := mirrorRoot(root)
+		if err != nil {
+			//the root may be removed after configured.
+			this.logger.Error("mirror root %s error. %s", root, err.Error())
+			continue
+		}
+		roots = append(roots, realRoot)
+	}
+	if len(roots) == 0 {
+		panic(result.BadRequest("no local directory can be mirrored from."))
+	}
+	return roots
+}
+
+// the real path of a local file to mirror, which must be under the roots after the symlinks resolved.
+func (this *MatterService) checkMirrorPath(roots []string, srcPath string) string {
+
+	absPath, err := filepath.Abs(srcPath)
+	this.PanicError(err)
+	realPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			panic(result.BadRequest("srcPath %s not exist", srcPath))
+		}
+		panic(result.BadRequest("srcPath err %s %s", srcPath, err.Error()))
+	}
+
+	for _, root := range roots {
+		if util.IsSubPath(realPath, root) {
+			return realPath
+		}
+	}
+	panic(result.BadRequest("srcPath %s is not under the directories can be mirrored from.", srcPath))
+}
+
+// a local file or directory to mirror.
+type matterMirror struct {
+	name string
+	dir  bool
+	//the matter existing in the space.
+	matter *Matter
+	//the imported content of a file.
+	blob     *Blob
+	children []*matterMirror
 }
 
 // 将本地文件/文件夹映射到蓝眼云盘中去。
-func (this *MatterService) mirror(request *http.Request, srcPath string, destDirMatter *Matter, overwrite bool, user *User, space *Space) {
+func (this *MatterService) mirror(request *http.Request, roots []string, srcPath string, destDirMatter *Matter, overwrite bool, user *User, space *Space) {
 
 	if user == nil {
 		panic(result.BadRequest("user cannot be nil"))
 	}
 
-	fileStat, err := os.Stat(srcPath)
+	//先导入所有内容，失败时释放
+	var blobs []*Blob
+	committed := false
+	defer func() {
+		if !committed {
+			for _, blob := range blobs {
+				this.blobService.Release(blob.Backend, blob.Sha256)
+			}
+		}
+	}()
+	plan := this.planMirror(request, roots, srcPath, destDirMatter, destDirMatter.Path, overwrite, space, map[string]bool{}, &blobs)
+
+	if plan != nil {
+		this.unitOfWorkService.Run(func(work *UnitOfWork) {
+			this.mirrorTx(request, work, plan, destDirMatter, user, space)
+		})
+	}
+	committed = true
+}
+
+// read the local tree, check it and import the contents. return nil if nothing to mirror.
+// destDirMatter is nil if the directory at destPath will be created. visiting has the real paths of the directories being read.
+func (this *MatterService) planMirror(request *http.Request, roots []string, srcPath string, destDirMatter *Matter, destPath string, overwrite bool, space *Space, visiting map[string]bool, blobs *[]*Blob) *matterMirror {
+
+	//a symlink is read from where it points to, which must be under the roots too.
+	realPath := this.checkMirrorPath(roots, srcPath)
+	fileStat, err := os.Stat(realPath)
 	if err != nil {
 
 		if os.IsNotExist(err) {
@@ -1138,53 +1769,322 @@ func (this *MatterService) mirror(request *http.Request, srcPath string, destDir
 
 	}
 
-	this.logger.Info("mirror srcPath = %s destPath = %s", srcPath, destDirMatter.Path)
+	this.logger.Info("mirror srcPath = %s", srcPath)
+	JobOf(request).CheckCanceled()
+	JobOf(request).Log("read %s", srcPath)
+
+	plan := &matterMirror{name: filepath.Base(srcPath), dir: fileStat.IsDir()}
 
 	if fileStat.IsDir() {
 
-		//判断当前文件夹下，文件是否已经存在了。
-		srcDirMatter := this.matterDao.FindBySpaceNameAndPuuidAndDirAndName(space.Name, destDirMatter.Uuid, TRUE, fileStat.Name())
+		//a symlink to an ancestor never ends.
+		if visiting[realPath] {
+			panic(result.BadRequest("srcPath %s links to its ancestor %s", srcPath, realPath))
+		}
+		visiting[realPath] = true
+		defer delete(visiting, realPath)
+
+		//the directories are created without createDirectory, so check the depth here.
+		parts := strings.Split(destPath, "/")
+		if len(parts) > MATTER_NAME_MAX_DEPTH {
+			panic(result.BadRequestI18n(request, i18n.MatterDepthExceedLimit, len(parts), MATTER_NAME_MAX_DEPTH))
+		}
 
-		if srcDirMatter == nil {
-			srcDirMatter = this.createDirectory(request, destDirMatter, fileStat.Name(), user, space)
+		//判断当前文件夹下，文件夹是否已经存在了。
+		if destDirMatter != nil {
+			plan.matter = this.matterDao.FindBySpaceNameAndPuuidAndDirAndName(space.Name, destDirMatter.Uuid, TRUE, plan.name)
+		}
+		if plan.matter == nil {
+			CheckMatterName(request, plan.name)
 		}
 
-		fileInfos, err := ioutil.ReadDir(srcPath)
+		fileInfos, err := ioutil.ReadDir(realPath)
 		this.PanicError(err)
 
 		//递归处理本文件夹下的文件或文件夹
 		for _, fileInfo := range fileInfos {
 
 			path := fmt.Sprintf("%s/%s", srcPath, fileInfo.Name())
-			this.mirror(request, path, srcDirMatter, overwrite, user, space)
+			child := this.planMirror(request, roots, path, plan.matter, destPath+"/"+plan.name, overwrite, space, visiting, blobs)
+			if child != nil {
+				plan.children = append(plan.children, child)
+			}
 		}
 
-	} else {
+		return plan
+	}
 
-		//判断当前文件夹下，文件是否已经存在了。
-		matter := this.matterDao.FindBySpaceNameAndPuuidAndDirAndName(space.Name, destDirMatter.Uuid, FALSE, fileStat.Name())
-		if matter != nil {
-			//如果是覆盖，那么删除之前的文件
-			if overwrite {
-				this.Delete(request, matter, user, space)
-			} else {
-				//直接完成。
-				return
+	//判断当前文件夹下，文件是否已经存在了。
+	if destDirMatter != nil {
+		plan.matter = this.matterDao.FindBySpaceNameAndPuuidAndDirAndName(space.Name, destDirMatter.Uuid, FALSE, plan.name)
+		if plan.matter != nil && !overwrite {
+			//直接完成。
+			return nil
+		}
+
+		if plan.matter == nil {
+			this.checkUploadName(request, space, destDirMatter, plan.name)
+		}
+	}
+	this.checkUploadSize(request, space, fileStat.Size())
+
+	//导入blob，内容已经存在时只增加引用。
+	srcFile, err := os.Open(realPath)
+	this.PanicError(err)
+	defer func() {
+		err := srcFile.Close()
+		this.PanicError(err)
+	}()
+	blob := this.blobService.Import(space.Backend, srcFile)
+
+	//内容相同，无需变化。
+	if plan.matter != nil && plan.matter.Sha256 == blob.Sha256 && plan.matter.Backend == blob.Backend {
+		this.blobService.Release(blob.Backend, blob.Sha256)
+		return nil
+	}
+
+	*blobs = append(*blobs, blob)
+	plan.blob = blob
+
+	return plan
+}
+
+// create the mirrored matters in the work.
+func (this *MatterService) mirrorTx(request *http.Request, work *UnitOfWork, plan *matterMirror, destDirMatter *Matter, user *User, space *Space) {
+
+	if plan.dir {
+
+		dirMatter := plan.matter
+		if dirMatter == nil {
+			dirMatter = &Matter{
+				Puuid:     destDirMatter.Uuid,
+				UserUuid:  user.Uuid,
+				SpaceUuid: space.Uuid,
+				SpaceName: space.Name,
+				Dir:       true,
+				Name:      plan.name,
+				Path:      destDirMatter.Path + "/" + plan.name,
+				Privacy:   false,
+				VisitTime: time.Now(),
 			}
+			dirMatter = this.matterDao.CreateTx(work.DB, dirMatter)
+			work.MakeDir(dirMatter.AbsolutePath())
+
+			work.AfterCommit(func() {
+				this.searchService.IndexName(dirMatter)
+			})
 		}
 
-		//准备直接从本地上传了。
-		file, err := os.Open(srcPath)
+		for _, child := range plan.children {
+			this.mirrorTx(request, work, child, dirMatter, user, space)
+		}
+		return
+	}
+
+	//如果是覆盖，那么删除之前的文件
+	if plan.matter != nil {
+		oldMatter := plan.matter
+		this.matterDao.DeleteRowTx(work.DB, oldMatter)
+		this.addSizeTx(work.DB, oldMatter.SpaceUuid, oldMatter.Path, -oldMatter.Size)
+		work.AfterCommit(func() {
+			this.matterDao.Delete(oldMatter)
+		})
+	}
+
+	matter := &Matter{
+		Puuid:     destDirMatter.Uuid,
+		UserUuid:  user.Uuid,
+		SpaceName: space.Name,
+		SpaceUuid: space.Uuid,
+		Dir:       false,
+		Name:      plan.name,
+		Md5:       plan.blob.Md5,
+		Sha256:    plan.blob.Sha256,
+		Backend:   plan.blob.Backend,
+		Size:      plan.blob.Size,
+		Privacy:   true,
+		Path:      destDirMatter.Path + "/" + plan.name,
+		Prop:      EMPTY_JSON_MAP,
+		VisitTime: time.Now(),
+	}
+	matter = this.matterDao.CreateTx(work.DB, matter)
+	this.chargeSizeTx(request, work.DB, space, matter.Path, matter.Size)
+
+	work.AfterCommit(func() {
+		this.searchService.Index(matter)
+	})
+}
+
+// extract an archive matter(zip or tar.gz) into dirMatter. everything is checked before writing.
+func (this *MatterService) AtomicExtract(request *http.Request, matter *Matter, dirMatter *Matter, user *User, space *Space) *Matter {
+
+	if !dirMatter.Dir {
+		panic(result.BadRequestI18n(request, i18n.MatterDestinationMustDirectory))
+	}
+	if dirMatter.Deleted {
+		panic(result.BadRequest("Dir has been deleted. Cannot extract under it."))
+	}
+	format := this.checkArchiveFormat(matter)
+
+	locks := this.lockService.Lock(request, user, "extract", lock.Read(space.Uuid, matter.Path), lock.Write(space.Uuid, dirMatter.Path))
+	defer this.lockService.Unlock(locks)
+
+	reader := this.storageService.OpenMatter(matter)
+	defer func() {
+		err := reader.Close()
 		this.PanicError(err)
-		defer func() {
-			err := file.Close()
-			this.PanicError(err)
-		}()
+	}()
+
+	this.checkExtract(request, reader, matter, format, dirMatter, space)
+
+	//walk again to write.
+	_, err := reader.Seek(0, io.SeekStart)
+	this.PanicError(err)
+
+	//the matters created are deleted if the extraction fails, children before their parents.
+	var created []*Matter
+	extracted := false
+	defer func() {
+		if !extracted {
+			for i := len(created) - 1; i >= 0; i-- {
+				this.Delete(request, created[i], user, space)
+			}
+		}
+	}()
 
-		this.Upload(request, file, nil, user, space, destDirMatter, fileStat.Name(), true)
+	//directories. key is the relative path in the archive.
+	dirMatters := map[string]*Matter{"": dirMatter}
+	var ensureDir func(name string) *Matter
+	ensureDir = func(name string) *Matter {
+		if m, ok := dirMatters[name]; ok {
+			return m
+		}
+		parentName, dirName := archive.SplitEntryName(name)
+		parent := ensureDir(parentName)
+		m := this.matterDao.FindBySpaceUuidAndPuuidAndDirAndName(space.Uuid, parent.Uuid, true, dirName)
+		if m == nil {
+			m = this.createDirectory(request, parent, dirName, user, space)
+			created = append(created, m)
+		}
+		dirMatters[name] = m
+		return m
+	}
+
+	runner := JobOf(request)
+	err = archive.Walk(reader, matter.Size, format, func(entry *archive.ArchiveEntry, content io.Reader) error {
+		runner.CheckCanceled()
+		if entry.Dir {
+			ensureDir(entry.Name)
+			return nil
+		}
+		runner.Log("extract %s", entry.Name)
+
+		parentName, filename := archive.SplitEntryName(entry.Name)
+		parent := ensureDir(parentName)
+
+		tmpPath, fileSize, md5, sha256 := this.blobService.WriteTmp(content)
+		defer this.blobService.Discard(tmpPath)
+
+		blob := this.blobService.Commit(space.Backend, tmpPath, md5, sha256, fileSize)
+		created = append(created, this.createNonDirMatter(request, parent, filename, fileSize, blob, false, true, user, space))
+		return nil
+	})
+	if err != nil {
+		panic(result.BadRequest("extract %s error. %s", matter.Name, err.Error()))
+	}
+	extracted = true
+
+	this.logger.Info("extract %s to %s", matter.Path, dirMatter.Path)
+
+	return dirMatter
+}
+
+// check names, depth, conflicts, quota and zip bomb of an archive before extracting.
+func (this *MatterService) checkExtract(request *http.Request, reader io.ReadSeeker, matter *Matter, format string, dirMatter *Matter, space *Space) {
+
+	//existing directories. nil means not exist. key is the relative path in the archive.
+	existDirs := map[string]*Matter{"": dirMatter}
+	var findDir func(name string) *Matter
+	findDir = func(name string) *Matter {
+		if m, ok := existDirs[name]; ok {
+			return m
+		}
+		var m *Matter
+		parentName, dirName := archive.SplitEntryName(name)
+		parent := findDir(parentName)
+		if parent != nil {
+			m = this.matterDao.FindBySpaceUuidAndPuuidAndDirAndName(space.Uuid, parent.Uuid, true, dirName)
+			if m == nil {
+				//a file with the same name blocks the directory.
+				this.checkUploadName(request, space, parent, dirName)
+			}
+		}
+		existDirs[name] = m
+		return m
+	}
+
+	var count int64 = 0
+	var totalSize int64 = 0
+	files := make(map[string]bool)
+	err := archive.Walk(reader, matter.Size, format, func(entry *archive.ArchiveEntry, content io.Reader) error {
+
+		count++
+		if count > MATTER_EXTRACT_MAX_NUM {
+			panic(result.BadRequest("archive contains more than %d entries.", MATTER_EXTRACT_MAX_NUM))
+		}
+
+		for _, part := range strings.Split(entry.Name, "/") {
+			CheckMatterName(request, part)
+		}
+		parentName, name := archive.SplitEntryName(entry.Name)
+		parentPath := dirMatter.Path
+		if parentName != "" {
+			parentPath = parentPath + "/" + parentName
+		}
+		parentParts := strings.Split(parentPath, "/")
+		if len(parentParts) > MATTER_NAME_MAX_DEPTH {
+			panic(result.BadRequestI18n(request, i18n.MatterDepthExceedLimit, len(parentParts), MATTER_NAME_MAX_DEPTH))
+		}
+
+		if parentName != "" {
+			findDir(parentName)
+		}
+		if entry.Dir {
+			findDir(entry.Name)
+			return nil
+		}
 
+		if files[entry.Name] {
+			panic(result.BadRequest("%s duplicated in archive.", entry.Name))
+		}
+		files[entry.Name] = true
+
+		parent := findDir(parentName)
+		if parent != nil {
+			this.checkUploadName(request, space, parent, name)
+		}
+
+		this.checkUploadSize(request, space, entry.Size)
+		totalSize = totalSize + entry.Size
+		if space.TotalSizeLimit >= 0 && space.TotalSize+totalSize > space.TotalSizeLimit {
+			panic(result.BadRequestI18n(request, i18n.MatterSizeExceedTotalLimit, util.HumanFileSize(space.TotalSize), util.HumanFileSize(space.TotalSizeLimit)))
+		}
+		//zip bomb.
+		if totalSize > MATTER_EXTRACT_RATIO_FREE_SIZE && totalSize > matter.Size*MATTER_EXTRACT_MAX_RATIO {
+			panic(result.BadRequest("compression ratio of %s exceeds %d.", matter.Name, MATTER_EXTRACT_MAX_RATIO))
+		}
+		return nil
+	})
+	if err != nil {
+		panic(result.BadRequest("extract %s error. %s", matter.Name, err.Error()))
 	}
 
+	//a file and a directory with the same name.
+	for name := range files {
+		if _, ok := existDirs[name]; ok {
+			panic(result.BadRequest("%s duplicated in archive.", name))
+		}
+	}
 }
 
 // 根据一个文件夹路径，依次创建，找到最后一个文件夹的matter，如果中途出错，返回err. 如果存在了那就直接返回即可。
@@ -1287,9 +2187,6 @@ func (this *MatterService) AtomicCrawl(request *http.Request, url string, filena
 		panic(result.BadRequest("Dir has been deleted. Cannot crawl under it."))
 	}
 
-	this.userService.MatterLock(user.Uuid)
-	defer this.userService.MatterUnlock(user.Uuid)
-
 	if url == "" || (!strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://")) {
 		panic(`url must start with http:// or https://`)
 	}
@@ -1298,39 +2195,63 @@ func (this *MatterService) AtomicCrawl(request *http.Request, url string, filena
 		panic(result.BadRequest("filename cannot be null."))
 	}
 
-	//download from url.
-	resp, err := http.Get(url)
-	this.PanicError(err)
-	//if resp is not ok.
-	if resp.StatusCode != 200 {
-		panic(result.BadRequest("error when crawl from url."))
+	//fail fast before downloading.
+	this.crawlService.CheckUrl(url)
+	this.checkUploadName(request, space, dirMatter, filename)
+
+	//the received bytes of a job are kept for its retry.
+	var tmpPath string
+	runner := JobOf(request)
+	if runner != nil {
+		tmpPath = GetCrawlTmpPath(runner.Job.Uuid)
+	} else {
+		timeUUID, _ := uuid.NewV4()
+		tmpPath = GetCrawlTmpPath(string(timeUUID.String()))
 	}
+	util.MakeDirAll(GetBlobTmpDir())
+	keep := false
+	defer func() {
+		if !keep {
+			this.blobService.Discard(tmpPath)
+		}
+	}()
 
-	return this.Upload(request, resp.Body, nil, user, space, dirMatter, filename, privacy)
-}
+	//download without lock. it stops when the job is canceled.
+	size, err := this.crawlService.Download(request, url, tmpPath, this.crawlMaxSize(space))
+	if err != nil {
+		var sizeError *crawl.SizeError
+		if errors.As(err, &sizeError) {
+			this.checkUploadSize(request, space, sizeError.Size)
+			panic(result.BadRequest("file size %s exceeds the crawl limit %s", util.HumanFileSize(sizeError.Size), util.HumanFileSize(sizeError.MaxSize)))
+		}
+		var policyError *crawl.PolicyError
+		if errors.As(err, &policyError) {
+			panic(result.BadRequest("url not allowed. %s", policyError.Error()))
+		}
+		keep = runner != nil && crawl.Retryable(err) && request.Context().Err() == nil
+		panic(result.BadRequest("error when crawl from url. %s", err.Error()))
+	}
 
-// adjust a matter's path.
-func (this *MatterService) adjustPath(matter *Matter, parentMatter *Matter) {
+	this.logger.Info("crawl %s %v", url, util.HumanFileSize(size))
+	md5, sha256 := this.blobService.HashFile(tmpPath)
 
-	if matter.Dir {
+	return this.AtomicUploadStaged(request, tmpPath, md5, sha256, user, space, dirMatter, filename, privacy)
+}
 
-		matter.Path = parentMatter.Path + "/" + matter.Name
-		matter = this.matterDao.Save(matter)
+// the max size of a crawled file, limited by the space's size limit and the space left. -1 means no limit.
+func (this *MatterService) crawlMaxSize(space *Space) int64 {
 
-		//adjust children.
-		matters := this.matterDao.FindByPuuidAndUserUuid(matter.Uuid, matter.UserUuid, nil)
-		for _, m := range matters {
-			this.adjustPath(m, matter)
+	maxSize := space.SizeLimit
+	if space.TotalSizeLimit >= 0 {
+		left := space.TotalSizeLimit - space.TotalSize
+		if left < 0 {
+			left = 0
+		}
+		if maxSize < 0 || left < maxSize {
+			maxSize = left
 		}
-
-	} else {
-		//delete caches.
-		this.imageCacheDao.DeleteByMatterUuid(matter.Uuid)
-
-		matter.Path = parentMatter.Path + "/" + matter.Name
-		matter = this.matterDao.Save(matter)
 	}
-
+	return maxSize
 }
 
 // delete someone's EyeblueTank files according to physics files.
@@ -1356,7 +2277,8 @@ func (this *MatterService) deleteFolderByPhysics(request *http.Request, dirMatte
 			this.deleteFolderByPhysics(request, matter, user, space)
 		}
 
-		if !util.PathExists(matter.AbsolutePath()) {
+		//blob's content is not in the tree.
+		if !matter.IsBlob() && !util.PathExists(matter.AbsolutePath()) {
 			this.logger.Info("physics file not exist. delete from tank. %s", matter.Name)
 			this.AtomicDelete(nil, matter, user, space)
 		}
@@ -1393,7 +2315,7 @@ func (this *MatterService) scanPhysicsFolder(request *http.Request, dirInfo os.F
 	}
 
 	//fetch all matters under this folder.
-	_, matters := this.matterDao.PlainPage(0, 1000, dirMatter.Uuid, "", space.Uuid, "", "", "", nil, nil, nil)
+	_, matters := this.matterDao.PlainPage(0, 1000, dirMatter.Uuid, "", space.Uuid, "", "", "", nil, nil, "", nil)
 	nameMatterMap := make(map[string]*Matter)
 	for _, m := range matters {
 		nameMatterMap[m.Name] = m
@@ -1406,6 +2328,7 @@ func (this *MatterService) scanPhysicsFolder(request *http.Request, dirInfo os.F
 		return
 	}
 	for _, name := range names {
+		JobOf(request).CheckCanceled()
 		fileFullPath := filepath.Join(dirPath, name)
 		fileInfo, err := os.Lstat(fileFullPath)
 		if err != nil {
@@ -1446,7 +2369,7 @@ func (this *MatterService) scanPhysicsFolder(request *http.Request, dirInfo os.F
 
 				//not exist. add basic info.
 				this.logger.Info("Create matter: %s size:%d", name, fileInfo.Size())
-				matter = this.createNonDirMatter(dirMatter, name, fileInfo.Size(), true, user, space)
+				matter = this.createNonDirMatter(request, dirMatter, name, fileInfo.Size(), nil, false, true, user, space)
 
 			}
 
@@ -1488,6 +2411,9 @@ func (this *MatterService) CleanExpiredDeletedMatters() {
 			this.Delete(request, matter, user, space)
 		})
 
+		//remove the earliest deleted matters if the trash is too large.
+		this.trashService.CheckSizeLimit(request, user, space)
+
 	})
 
 }
@@ -0,0 +1,97 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type MatterTagDao struct {
+	BaseDao
+}
+
+// find by matterUuid and tagUuid. if not found return nil.
+func (this *MatterTagDao) FindByMatterUuidAndTagUuid(matterUuid string, tagUuid string) *MatterTag {
+	var entity = &MatterTag{}
+	db := core.CONTEXT.GetDB().Where("matter_uuid = ? AND tag_uuid = ?", matterUuid, tagUuid).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+func (this *MatterTagDao) FindByMatterUuid(matterUuid string) []*MatterTag {
+	var matterTags []*MatterTag
+	db := core.CONTEXT.GetDB().Where("matter_uuid = ?", matterUuid).Find(&matterTags)
+	this.PanicError(db.Error)
+	return matterTags
+}
+
+func (this *MatterTagDao) FindByTagUuid(tagUuid string) []*MatterTag {
+	var matterTags []*MatterTag
+	db := core.CONTEXT.GetDB().Where("tag_uuid = ?", tagUuid).Find(&matterTags)
+	this.PanicError(db.Error)
+	return matterTags
+}
+
+func (this *MatterTagDao) CountByMatterUuid(matterUuid string) int64 {
+	var count int64
+	db := core.CONTEXT.GetDB().Model(&MatterTag{}).Where("matter_uuid = ?", matterUuid).Count(&count)
+	this.PanicError(db.Error)
+	return count
+}
+
+func (this *MatterTagDao) Create(matterTag *MatterTag) *MatterTag {
+
+	timeUUID, _ := uuid.NewV4()
+	matterTag.Uuid = string(timeUUID.String())
+	matterTag.CreateTime = time.Now()
+	matterTag.UpdateTime = time.Now()
+	matterTag.Sort = time.Now().UnixNano() / 1e6
+	db := core.CONTEXT.GetDB().Create(matterTag)
+	this.PanicError(db.Error)
+
+	return matterTag
+}
+
+func (this *MatterTagDao) Delete(matterTag *MatterTag) {
+
+	db := core.CONTEXT.GetDB().Delete(&matterTag)
+	this.PanicError(db.Error)
+}
+
+func (this *MatterTagDao) DeleteByMatterUuid(matterUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid = ?", matterUuid).Delete(MatterTag{})
+	this.PanicError(db.Error)
+}
+
+func (this *MatterTagDao) DeleteByMatterUuidQuery(matterUuidQuery *gorm.DB) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid IN (?)", matterUuidQuery).Delete(MatterTag{})
+	this.PanicError(db.Error)
+}
+
+func (this *MatterTagDao) DeleteByTagUuid(tagUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("tag_uuid = ?", tagUuid).Delete(MatterTag{})
+	this.PanicError(db.Error)
+}
+
+func (this *MatterTagDao) DeleteByUserUuid(userUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid IN (?)", core.CONTEXT.GetDB().Model(&Matter{}).Select("uuid").Where("user_uuid = ?", userUuid)).Delete(MatterTag{})
+	this.PanicError(db.Error)
+}
+
+func (this *MatterTagDao) Cleanup() {
+	this.logger.Info("[MatterTagDao] clean up. Delete all MatterTag")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(MatterTag{})
+	this.PanicError(db.Error)
+}
@@ -0,0 +1,16 @@
+package rest
+
+import "time"
+
+/**
+ * the link table for Tag and Matter.
+ */
+type MatterTag struct {
+	Uuid       string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort       int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	SpaceUuid  string    `json:"spaceUuid" gorm:"type:char(36) not null"`
+	TagUuid    string    `json:"tagUuid" gorm:"type:char(36) not null;uniqueIndex:idx_matter_tag_mt,priority:2;index:idx_matter_tag_tu"`
+	MatterUuid string    `json:"matterUuid" gorm:"type:char(36) not null;uniqueIndex:idx_matter_tag_mt,priority:1"`
+}
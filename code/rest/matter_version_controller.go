@@ -0,0 +1,139 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"net/http"
+)
+
+type MatterVersionController struct {
+	BaseController
+	matterVersionDao     *MatterVersionDao
+	matterVersionService *MatterVersionService
+	matterDao            *MatterDao
+	matterService        *MatterService
+	storageService       *StorageService
+}
+
+func (this *MatterVersionController) Init() {
+	this.BaseController.Init()
+
+	b := core.CONTEXT.GetBean(this.matterVersionDao)
+	if b, ok := b.(*MatterVersionDao); ok {
+		this.matterVersionDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterVersionService)
+	if b, ok := b.(*MatterVersionService); ok {
+		this.matterVersionService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterService)
+	if b, ok := b.(*MatterService); ok {
+		this.matterService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.storageService)
+	if b, ok := b.(*StorageService); ok {
+		this.storageService = b
+	}
+}
+
+func (this *MatterVersionController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
+
+	routeMap := make(map[string]func(writer http.ResponseWriter, request *http.Request))
+
+	routeMap["/api/matter/version/page"] = this.Wrap(this.Page, USER_ROLE_USER)
+	routeMap["/api/matter/version/download"] = this.WrapPure(this.Download, USER_ROLE_USER)
+	routeMap["/api/matter/version/restore"] = this.Wrap(this.Restore, USER_ROLE_USER)
+	routeMap["/api/matter/version/delete"] = this.Wrap(this.Delete, USER_ROLE_USER)
+	routeMap["/api/matter/version/prune"] = this.Wrap(this.Prune, USER_ROLE_USER)
+
+	return routeMap
+}
+
+// versions of a file. newest first by default.
+func (this *MatterVersionController) Page(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	matterUuid := util.ExtractRequestString(request, "matterUuid")
+	page := util.ExtractRequestOptionalInt(request, "page", 0)
+	pageSize := util.ExtractRequestOptionalInt(request, "pageSize", 200)
+	orderCreateTime := util.ExtractRequestOptionalString(request, "orderCreateTime", DIRECTION_DESC)
+
+	user := this.checkUser(request)
+	matter := this.matterDao.CheckByUuid(matterUuid)
+	this.spaceService.CheckReadableByUuid(request, user, matter.SpaceUuid)
+
+	sortArray := []builder.OrderPair{
+		{
+			Key:   "create_time",
+			Value: orderCreateTime,
+		},
+	}
+
+	pager := this.matterVersionDao.Page(page, pageSize, matter.Uuid, sortArray)
+
+	return this.Success(pager)
+}
+
+func (this *MatterVersionController) Download(writer http.ResponseWriter, request *http.Request) {
+
+	uuid := util.ExtractRequestString(request, "uuid")
+
+	user := this.checkUser(request)
+	version := this.matterVersionDao.CheckByUuid(uuid)
+	this.spaceService.CheckReadableByUuid(request, user, version.SpaceUuid)
+
+	this.storageService.Download(writer, request, version.Backend, version.Key(), version.Name, true)
+}
+
+// the version becomes the current content, and the current content is kept as a new version.
+func (this *MatterVersionController) Restore(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	uuid := util.ExtractRequestString(request, "uuid")
+
+	user := this.checkUser(request)
+	version := this.matterVersionDao.CheckByUuid(uuid)
+	space := this.spaceService.CheckWritableByUuid(request, user, version.SpaceUuid)
+
+	matter := this.matterVersionService.Restore(request, version, user, space)
+
+	return this.Success(matter)
+}
+
+func (this *MatterVersionController) Delete(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	uuid := util.ExtractRequestString(request, "uuid")
+
+	user := this.checkUser(request)
+	version := this.matterVersionDao.CheckByUuid(uuid)
+	this.spaceService.CheckWritableByUuid(request, user, version.SpaceUuid)
+
+	this.matterVersionService.Delete(version)
+
+	return this.Success("OK")
+}
+
+// only keep the newest keepNum versions within keepDays. use the space's policy by default.
+func (this *MatterVersionController) Prune(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	matterUuid := util.ExtractRequestString(request, "matterUuid")
+
+	user := this.checkUser(request)
+	matter := this.matterDao.CheckByUuid(matterUuid)
+	space := this.spaceService.CheckWritableByUuid(request, user, matter.SpaceUuid)
+
+	keepNum := util.ExtractRequestOptionalInt64(request, "keepNum", space.VersionKeepNum)
+	keepDays := util.ExtractRequestOptionalInt64(request, "keepDays", space.VersionKeepDays)
+
+	count := this.matterVersionService.Prune(matter.Uuid, keepNum, keepDays)
+
+	return this.Success(count)
+}
@@ -0,0 +1,207 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
+	"math"
+	"time"
+)
+
+type MatterVersionDao struct {
+	BaseDao
+}
+
+// find by uuid. if not found return nil.
+func (this *MatterVersionDao) FindByUuid(uuid string) *MatterVersion {
+	var entity = &MatterVersion{}
+	db := core.CONTEXT.GetDB().Where("uuid = ?", uuid).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+// find by uuid. if not found panic NotFound error
+func (this *MatterVersionDao) CheckByUuid(uuid string) *MatterVersion {
+	entity := this.FindByUuid(uuid)
+	if entity == nil {
+		panic(result.NotFound("not found record with uuid = %s", uuid))
+	}
+	return entity
+}
+
+// newest first.
+func (this *MatterVersionDao) FindByMatterUuid(matterUuid string) []*MatterVersion {
+	var versions []*MatterVersion
+	db := core.CONTEXT.GetDB().Where("matter_uuid = ?", matterUuid).Order("create_time DESC, sort DESC").Find(&versions)
+	this.PanicError(db.Error)
+	return versions
+}
+
+func (this *MatterVersionDao) PlainPage(page int, pageSize int, matterUuid string, spaceUuid string, createTimeBefore *time.Time, sortArray []builder.OrderPair) (int, []*MatterVersion) {
+
+	var wp = &builder.WherePair{}
+
+	if matterUuid != "" {
+		wp = wp.And(&builder.WherePair{Query: "matter_uuid = ?", Args: []interface{}{matterUuid}})
+	}
+
+	if spaceUuid != "" {
+		wp = wp.And(&builder.WherePair{Query: "space_uuid = ?", Args: []interface{}{spaceUuid}})
+	}
+
+	if createTimeBefore != nil {
+		wp = wp.And(&builder.WherePair{Query: "create_time < ?", Args: []interface{}{createTimeBefore}})
+	}
+
+	var conditionDB *gorm.DB
+	conditionDB = core.CONTEXT.GetDB().Model(&MatterVersion{}).Where(wp.Query, wp.Args...)
+
+	var count int64 = 0
+	db := conditionDB.Count(&count)
+	this.PanicError(db.Error)
+
+	var versions []*MatterVersion
+	db = conditionDB.Order(this.GetSortString(sortArray)).Offset(page * pageSize).Limit(pageSize).Find(&versions)
+	this.PanicError(db.Error)
+
+	return int(count), versions
+}
+
+func (this *MatterVersionDao) Page(page int, pageSize int, matterUuid string, sortArray []builder.OrderPair) *Pager {
+
+	count, versions := this.PlainPage(page, pageSize, matterUuid, "", nil, sortArray)
+	pager := NewPager(page, pageSize, count, versions)
+
+	return pager
+}
+
+// handle the versions created before the time page by page. the handled versions must be deleted.
+func (this *MatterVersionDao) PageHandleBefore(spaceUuid string, createTimeBefore time.Time, fun func(version *MatterVersion)) {
+
+	pageSize := 1000
+	sortArray := []builder.OrderPair{
+		{
+			Key:   "uuid",
+			Value: DIRECTION_ASC,
+		},
+	}
+	count, _ := this.PlainPage(0, pageSize, "", spaceUuid, &createTimeBefore, sortArray)
+	if count > 0 {
+		var totalPages = int(math.Ceil(float64(count) / float64(pageSize)))
+		var page int
+		for page = 0; page < totalPages; page++ {
+			_, versions := this.PlainPage(0, pageSize, "", spaceUuid, &createTimeBefore, sortArray)
+			for _, version := range versions {
+				fun(version)
+			}
+		}
+	}
+}
+
+func (this *MatterVersionDao) Create(version *MatterVersion) *MatterVersion {
+	return this.CreateTx(core.CONTEXT.GetDB(), version)
+}
+
+func (this *MatterVersionDao) CreateTx(tx *gorm.DB, version *MatterVersion) *MatterVersion {
+
+	timeUUID, _ := uuid.NewV4()
+	version.Uuid = string(timeUUID.String())
+	version.CreateTime = time.Now()
+	version.UpdateTime = time.Now()
+	version.Sort = time.Now().UnixNano() / 1e6
+	db := tx.Create(version)
+	this.PanicError(db.Error)
+
+	return version
+}
+
+func (this *MatterVersionDao) Save(version *MatterVersion) *MatterVersion {
+
+	version.UpdateTime = time.Now()
+	db := core.CONTEXT.GetDB().Save(version)
+	this.PanicError(db.Error)
+
+	return version
+}
+
+func (this *MatterVersionDao) Delete(version *MatterVersion) {
+	this.DeleteTx(core.CONTEXT.GetDB(), version)
+}
+
+func (this *MatterVersionDao) DeleteTx(tx *gorm.DB, version *MatterVersion) {
+
+	db := tx.Delete(&version)
+	this.PanicError(db.Error)
+}
+
+// the versions follow another matter.
+func (this *MatterVersionDao) UpdateMatterUuid(oldMatterUuid string, newMatterUuid string) {
+	db := core.CONTEXT.GetDB().Model(&MatterVersion{}).Where("matter_uuid = ?", oldMatterUuid).Update("matter_uuid", newMatterUuid)
+	this.PanicError(db.Error)
+}
+
+// sha256 of all the versions belong to the user.
+func (this *MatterVersionDao) FindContentsByUserUuid(userUuid string) []*MatterVersion {
+	var versions []*MatterVersion
+	db := core.CONTEXT.GetDB().Select("backend", "sha256").Where("user_uuid = ?", userUuid).Find(&versions)
+	this.PanicError(db.Error)
+	return versions
+}
+
+func (this *MatterVersionDao) DeleteByUserUuid(userUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("user_uuid = ?", userUuid).Delete(MatterVersion{})
+	this.PanicError(db.Error)
+}
+
+// delete the versions of the matters selected by the sub query. the blobs are released by the caller.
+func (this *MatterVersionDao) DeleteByMatterUuidQuery(matterUuidQuery *gorm.DB) {
+	this.DeleteByMatterUuidQueryTx(core.CONTEXT.GetDB(), matterUuidQuery)
+}
+
+func (this *MatterVersionDao) DeleteByMatterUuidQueryTx(tx *gorm.DB, matterUuidQuery *gorm.DB) {
+
+	db := tx.Where("matter_uuid IN (?)", matterUuidQuery).Delete(MatterVersion{})
+	this.PanicError(db.Error)
+}
+
+// total size of the versions of the matters selected by the sub query.
+func (this *MatterVersionDao) SumSizeByMatterUuidQuery(matterUuidQuery *gorm.DB) int64 {
+	return this.SumSizeByMatterUuidQueryTx(core.CONTEXT.GetDB(), matterUuidQuery)
+}
+
+func (this *MatterVersionDao) SumSizeByMatterUuidQueryTx(tx *gorm.DB, matterUuidQuery *gorm.DB) int64 {
+	var sumSize int64
+	row := tx.Model(&MatterVersion{}).Where("matter_uuid IN (?)", matterUuidQuery).Select("COALESCE(SUM(size), 0)").Row()
+	err := row.Scan(&sumSize)
+	this.PanicError(err)
+	return sumSize
+}
+
+// total size of the versions in a space.
+func (this *MatterVersionDao) SumSizeBySpaceUuid(spaceUuid string) int64 {
+	return this.SumSizeBySpaceUuidTx(core.CONTEXT.GetDB(), spaceUuid)
+}
+
+func (this *MatterVersionDao) SumSizeBySpaceUuidTx(tx *gorm.DB, spaceUuid string) int64 {
+	var sumSize int64
+	row := tx.Model(&MatterVersion{}).Where("space_uuid = ?", spaceUuid).Select("COALESCE(SUM(size), 0)").Row()
+	err := row.Scan(&sumSize)
+	this.PanicError(err)
+	return sumSize
+}
+
+// System cleanup.
+func (this *MatterVersionDao) Cleanup() {
+	this.logger.Info("[MatterVersionDao] clean up. Delete all MatterVersion")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(MatterVersion{})
+	this.PanicError(db.Error)
+}
@@ -0,0 +1,31 @@
+package rest
+
+import (
+	"time"
+)
+
+/**
+ * the previous content of a file matter which has been overwritten.
+ * the content is referenced in blob store, and counted in the space's total size.
+ */
+type MatterVersion struct {
+	Uuid       string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort       int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	MatterUuid string    `json:"matterUuid" gorm:"type:char(36) not null;index:idx_matter_version_mu"`
+	SpaceUuid  string    `json:"spaceUuid" gorm:"type:char(36) not null;index:idx_matter_version_su"`
+	UserUuid   string    `json:"userUuid" gorm:"type:char(36) not null;index:idx_matter_version_uu"`
+	Name       string    `json:"name" gorm:"type:varchar(255) not null"`
+	Md5        string    `json:"md5" gorm:"type:varchar(45)"`
+	Backend    string    `json:"backend" gorm:"type:varchar(45) not null;default:''"`
+	Sha256     string    `json:"sha256" gorm:"type:varchar(64) not null"`
+	Size       int64     `json:"size" gorm:"type:bigint(20) not null;default:0"`
+	//when the content was written.
+	ContentTime time.Time `json:"contentTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+}
+
+// get the content's key in the storage backend.
+func (this *MatterVersion) Key() string {
+	return GetBlobKey(this.Sha256)
+}
@@ -0,0 +1,195 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+// keep the overwritten content of files.
+// @Service
+type MatterVersionService struct {
+	BaseBean
+	matterVersionDao *MatterVersionDao
+	matterDao        *MatterDao
+	spaceDao         *SpaceDao
+	blobService      *BlobService
+	matterService    *MatterService
+	storageService   *StorageService
+}
+
+func (this *MatterVersionService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.matterVersionDao)
+	if b, ok := b.(*MatterVersionDao); ok {
+		this.matterVersionDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.spaceDao)
+	if b, ok := b.(*SpaceDao); ok {
+		this.spaceDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.blobService)
+	if b, ok := b.(*BlobService); ok {
+		this.blobService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterService)
+	if b, ok := b.(*MatterService); ok {
+		this.matterService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.storageService)
+	if b, ok := b.(*StorageService); ok {
+		this.storageService = b
+	}
+}
+
+// reference the current content of a file for a version, which the invoker creates along with the new content and charges.
+// return nil if the space doesn't keep versions or the content is lost.
+func (this *MatterVersionService) NewVersion(matter *Matter, space *Space) *MatterVersion {
+
+	if matter.Dir || !space.KeepVersion() {
+		return nil
+	}
+
+	var blob *Blob
+	if matter.IsBlob() {
+		blob = this.blobService.Reference(matter.Backend, matter.Sha256)
+	}
+	if blob == nil {
+		reader, err := this.storageService.Backend(matter.Backend).Open(matter.Key())
+		if err != nil {
+			this.logger.Error("content of %s lost, cannot keep version. %v", matter.Path, err)
+			return nil
+		}
+		defer func() {
+			err := reader.Close()
+			this.PanicError(err)
+		}()
+		blob = this.blobService.Import(space.Backend, reader)
+	}
+
+	return &MatterVersion{
+		MatterUuid:  matter.Uuid,
+		SpaceUuid:   space.Uuid,
+		UserUuid:    matter.UserUuid,
+		Name:        matter.Name,
+		Md5:         blob.Md5,
+		Sha256:      blob.Sha256,
+		Backend:     blob.Backend,
+		Size:        blob.Size,
+		ContentTime: matter.UpdateTime,
+	}
+}
+
+// only keep the newest keepNum versions within keepDays. -1 means no limit.
+func (this *MatterVersionService) Prune(matterUuid string, keepNum int64, keepDays int64) int {
+
+	deadline := time.Now().AddDate(0, 0, -int(keepDays))
+
+	count := 0
+	versions := this.matterVersionDao.FindByMatterUuid(matterUuid)
+	for i, version := range versions {
+		if (keepNum >= 0 && int64(i) >= keepNum) || (keepDays >= 0 && version.CreateTime.Before(deadline)) {
+			this.Delete(version)
+			count++
+		}
+	}
+
+	return count
+}
+
+// delete a version and release its content.
+func (this *MatterVersionService) Delete(version *MatterVersion) {
+	err := core.CONTEXT.GetDB().Transaction(func(tx *gorm.DB) error {
+		this.matterVersionDao.DeleteTx(tx, version)
+		this.spaceDao.AddTotalSizeTx(tx, version.SpaceUuid, -version.Size)
+		return nil
+	})
+	this.PanicError(err)
+	this.blobService.Release(version.Backend, version.Sha256)
+}
+
+// delete all the versions of a matter.
+func (this *MatterVersionService) DeleteByMatterUuid(matterUuid string) {
+	for _, version := range this.matterVersionDao.FindByMatterUuid(matterUuid) {
+		this.Delete(version)
+	}
+}
+
+// delete all the versions of the matters selected by the sub query.
+func (this *MatterVersionService) DeleteByMatterUuidQuery(spaceUuid string, matterUuidQuery *gorm.DB) {
+	versionTable := fmt.Sprintf("`%smatter_version`", core.TABLE_PREFIX)
+	this.blobService.ReleaseByRefs(versionTable, &builder.WherePair{Query: "r.matter_uuid IN (?)", Args: []interface{}{matterUuidQuery}})
+	err := core.CONTEXT.GetDB().Transaction(func(tx *gorm.DB) error {
+		this.spaceDao.AddTotalSizeTx(tx, spaceUuid, -this.matterVersionDao.SumSizeByMatterUuidQueryTx(tx, matterUuidQuery))
+		this.matterVersionDao.DeleteByMatterUuidQueryTx(tx, matterUuidQuery)
+		return nil
+	})
+	this.PanicError(err)
+}
+
+// delete all the versions belong to the user.
+func (this *MatterVersionService) DeleteByUserUuid(userUuid string) {
+	for _, version := range this.matterVersionDao.FindContentsByUserUuid(userUuid) {
+		this.blobService.Release(version.Backend, version.Sha256)
+	}
+	this.matterVersionDao.DeleteByUserUuid(userUuid)
+}
+
+// restore a version. the current content is kept as a new version.
+func (this *MatterVersionService) Restore(request *http.Request, version *MatterVersion, user *User, space *Space) *Matter {
+
+	matter := this.matterDao.CheckByUuid(version.MatterUuid)
+	if matter.Deleted {
+		panic(result.BadRequest("matter has been deleted. Cannot restore."))
+	}
+
+	blob := this.blobService.Reference(version.Backend, version.Sha256)
+	if blob == nil {
+		panic(result.BadRequest("content of the version lost."))
+	}
+
+	return this.matterService.AtomicReplace(request, matter, blob, user, space)
+}
+
+// remove the expired versions of all the spaces.
+func (this *MatterVersionService) CleanExpiredVersions() {
+
+	this.logger.Info("[MatterVersionService] clean expired versions.")
+
+	this.spaceDao.PageHandle(func(space *Space) {
+
+		var deadline time.Time
+		if !space.KeepVersion() {
+			//versioning disabled, remove all.
+			deadline = time.Now()
+		} else if space.VersionKeepDays >= 0 {
+			deadline = time.Now().AddDate(0, 0, -int(space.VersionKeepDays))
+		} else {
+			return
+		}
+
+		count := 0
+		this.matterVersionDao.PageHandleBefore(space.Uuid, deadline, func(version *MatterVersion) {
+			this.Delete(version)
+			count++
+		})
+
+		if count > 0 {
+			this.logger.Info("remove %d expired versions of space %s", count, space.Name)
+		}
+	})
+}
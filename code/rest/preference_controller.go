@@ -2,11 +2,13 @@ package rest
 
 import (
 	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/crawl"
 	"github.com/eyebluecn/tank/code/tool/i18n"
 	"github.com/eyebluecn/tank/code/tool/result"
 	"github.com/eyebluecn/tank/code/tool/util"
 	jsoniter "github.com/json-iterator/go"
 	"net/http"
+	"path"
 	"strconv"
 )
 
@@ -56,6 +58,9 @@ func (this *PreferenceController) RegisterRoutes() map[string]func(writer http.R
 	routeMap["/api/preference/edit"] = this.Wrap(this.Edit, USER_ROLE_ADMINISTRATOR)
 	routeMap["/api/preference/edit/preview/config"] = this.Wrap(this.EditPreviewConfig, USER_ROLE_ADMINISTRATOR)
 	routeMap["/api/preference/edit/scan/config"] = this.Wrap(this.EditScanConfig, USER_ROLE_ADMINISTRATOR)
+	routeMap["/api/preference/edit/crawl/config"] = this.Wrap(this.EditCrawlConfig, USER_ROLE_ADMINISTRATOR)
+	routeMap["/api/preference/edit/mirror/config"] = this.Wrap(this.EditMirrorConfig, USER_ROLE_ADMINISTRATOR)
+	routeMap["/api/preference/edit/dav/config"] = this.Wrap(this.EditDavConfig, USER_ROLE_ADMINISTRATOR)
 	routeMap["/api/preference/scan/once"] = this.Wrap(this.ScanOnce, USER_ROLE_ADMINISTRATOR)
 	routeMap["/api/preference/system/cleanup"] = this.Wrap(this.SystemCleanup, USER_ROLE_ADMINISTRATOR)
 
@@ -219,6 +224,120 @@ func (this *PreferenceController) EditScanConfig(writer http.ResponseWriter, req
 	return this.Success(preference)
 }
 
+// edit the limits of crawling remote files.
+func (this *PreferenceController) EditCrawlConfig(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	crawlConfigStr := request.FormValue("crawlConfig")
+	if crawlConfigStr == "" {
+		panic(result.BadRequest("crawlConfig cannot be null"))
+	}
+
+	preference := this.preferenceDao.Fetch()
+
+	crawlConfig := &CrawlConfig{}
+	err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal([]byte(crawlConfigStr), &crawlConfig)
+	if err != nil {
+		panic(result.BadRequest("crawlConfig error. %s", err.Error()))
+	}
+
+	//validate the crawl config.
+	if crawlConfig.Concurrency < 1 || crawlConfig.Concurrency > CRAWL_MAX_CONCURRENCY {
+		panic(result.BadRequest("concurrency must between 1 and %d", CRAWL_MAX_CONCURRENCY))
+	}
+	if crawlConfig.Retries < 0 || crawlConfig.Retries > CRAWL_MAX_RETRIES {
+		panic(result.BadRequest("retries must between 0 and %d", CRAWL_MAX_RETRIES))
+	}
+	for _, host := range crawlConfig.AllowHosts {
+		if !crawl.ValidPattern(host) {
+			panic(result.BadRequest("allowHosts error. %s is not a host, ip or cidr", host))
+		}
+	}
+
+	preference.CrawlConfig = crawlConfigStr
+	preference = this.preferenceService.Save(preference)
+
+	return this.Success(preference)
+}
+
+// edit the local directories which can be mirrored from, and who can mirror.
+func (this *PreferenceController) EditMirrorConfig(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	mirrorConfigStr := request.FormValue("mirrorConfig")
+	if mirrorConfigStr == "" {
+		panic(result.BadRequest("mirrorConfig cannot be null"))
+	}
+
+	preference := this.preferenceDao.Fetch()
+
+	mirrorConfig := &MirrorConfig{}
+	err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal([]byte(mirrorConfigStr), &mirrorConfig)
+	if err != nil {
+		panic(result.BadRequest("mirrorConfig error. %s", err.Error()))
+	}
+
+	//validate the mirror config.
+	roots := append([]string{}, mirrorConfig.Roots...)
+	for spaceName, spaceRoots := range mirrorConfig.SpaceRoots {
+		if this.spaceDao.FindByName(spaceName) == nil {
+			panic(result.BadRequest("space %s not exist", spaceName))
+		}
+		roots = append(roots, spaceRoots...)
+	}
+	for _, root := range roots {
+		this.matterService.CheckMirrorRoot(root)
+	}
+	for _, username := range mirrorConfig.Usernames {
+		if this.userDao.FindByUsername(username) == nil {
+			panic(result.BadRequest("user %s not exist", username))
+		}
+	}
+
+	preference.MirrorConfig = mirrorConfigStr
+	preference = this.preferenceService.Save(preference)
+
+	return this.Success(preference)
+}
+
+// edit the webdav config.
+func (this *PreferenceController) EditDavConfig(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	davConfigStr := request.FormValue("davConfig")
+	if davConfigStr == "" {
+		panic(result.BadRequest("davConfig cannot be null"))
+	}
+
+	preference := this.preferenceDao.Fetch()
+
+	davConfig := &DavConfig{}
+	err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal([]byte(davConfigStr), &davConfig)
+	if err != nil {
+		panic(result.BadRequest("davConfig error. %s", err.Error()))
+	}
+
+	//validate the webdav config.
+	if davConfig.DepthInfinityLimit < 0 || davConfig.DepthInfinityLimit > DAV_MAX_DEPTH_INFINITY_LIMIT {
+		panic(result.BadRequest("depthInfinityLimit must between 0 and %d", DAV_MAX_DEPTH_INFINITY_LIMIT))
+	}
+	for _, pattern := range davConfig.MetadataPatterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			panic(result.BadRequest("metadataPattern %s error. %s", pattern, err.Error()))
+		}
+	}
+	for clientType, policy := range davConfig.MetadataPolicies {
+		if clientType != DAV_CLIENT_WINDOWS && clientType != DAV_CLIENT_FINDER && clientType != DAV_CLIENT_RCLONE && clientType != DAV_CLIENT_OTHER {
+			panic(result.BadRequest("client type %s not supported", clientType))
+		}
+		if policy != DAV_METADATA_ALLOW && policy != DAV_METADATA_IGNORE && policy != DAV_METADATA_DENY {
+			panic(result.BadRequest("metadata policy %s not supported", policy))
+		}
+	}
+
+	preference.DavConfig = davConfigStr
+	preference = this.preferenceService.Save(preference)
+
+	return this.Success(preference)
+}
+
 // scan immediately according the current config.
 func (this *PreferenceController) ScanOnce(writer http.ResponseWriter, request *http.Request) *result.WebResult {
 
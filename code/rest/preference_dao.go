@@ -24,6 +24,9 @@ func (this *PreferenceDao) Fetch() *Preference {
 			preference.Version = core.VERSION
 			preference.PreviewConfig = "{}"
 			preference.ScanConfig = "{}"
+			preference.CrawlConfig = "{}"
+			preference.MirrorConfig = "{}"
+			preference.DavConfig = "{}"
 			this.Create(preference)
 			return preference
 		} else {
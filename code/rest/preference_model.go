@@ -2,6 +2,7 @@ package rest
 
 import (
 	jsoniter "github.com/json-iterator/go"
+	"path"
 	"time"
 )
 
@@ -21,6 +22,9 @@ type Preference struct {
 	AllowRegister         bool      `json:"allowRegister" gorm:"type:tinyint(1) not null;default:0"`
 	PreviewConfig         string    `json:"previewConfig" gorm:"type:text"`
 	ScanConfig            string    `json:"scanConfig" gorm:"type:text"`
+	CrawlConfig           string    `json:"crawlConfig" gorm:"type:text"`
+	MirrorConfig          string    `json:"mirrorConfig" gorm:"type:text"`
+	DavConfig             string    `json:"davConfig" gorm:"type:text"`
 	DeletedKeepDays       int64     `json:"deletedKeepDays" gorm:"type:bigint(20) not null;default:7"`
 	Version               string    `json:"version" gorm:"-"`
 }
@@ -63,3 +67,131 @@ func (this *Preference) FetchScanConfig() *ScanConfig {
 		return m
 	}
 }
+
+// crawl config struct.
+type CrawlConfig struct {
+	//max size of a crawled file. -1 means no limit.
+	SizeLimit int64 `json:"sizeLimit"`
+	//total bandwidth of all the crawls in bytes per second. -1 means no limit.
+	Bandwidth int64 `json:"bandwidth"`
+	//crawls running at the same time. the others wait in queue.
+	Concurrency int `json:"concurrency"`
+	//retry times after a crawl is broken. it continues from the received bytes.
+	Retries int `json:"retries"`
+	//hosts allowed even resolved to the private, loopback or link-local addresses. eg. "*.example.com", "10.0.0.0/8".
+	AllowHosts []string `json:"allowHosts"`
+}
+
+// fetch the crawl config
+func (this *Preference) FetchCrawlConfig() *CrawlConfig {
+
+	m := &CrawlConfig{
+		SizeLimit:   -1,
+		Bandwidth:   -1,
+		Concurrency: CRAWL_DEFAULT_CONCURRENCY,
+		Retries:     CRAWL_DEFAULT_RETRIES,
+	}
+
+	json := this.CrawlConfig
+	if json != "" && json != EMPTY_JSON_MAP {
+		err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal([]byte(json), &m)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return m
+}
+
+// mirror config struct. nothing can be mirrored until the roots are configured.
+type MirrorConfig struct {
+	//local directories which all the spaces can mirror from.
+	Roots []string `json:"roots"`
+	//local directories which only certain spaces can mirror from. spaceName -> directories.
+	SpaceRoots map[string][]string `json:"spaceRoots"`
+	//users who can mirror besides the administrators.
+	Usernames []string `json:"usernames"`
+}
+
+// fetch the mirror config
+func (this *Preference) FetchMirrorConfig() *MirrorConfig {
+
+	m := &MirrorConfig{}
+
+	json := this.MirrorConfig
+	if json != "" && json != EMPTY_JSON_MAP {
+		err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal([]byte(json), &m)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return m
+}
+
+// the local directories which the space can mirror from.
+func (this *MirrorConfig) FetchRoots(space *Space) []string {
+	roots := append([]string{}, this.Roots...)
+	if space != nil {
+		roots = append(roots, this.SpaceRoots[space.Name]...)
+	}
+	return roots
+}
+
+// whether the user can mirror.
+func (this *MirrorConfig) Allow(user *User) bool {
+	if user.Role == USER_ROLE_ADMINISTRATOR {
+		return true
+	}
+	for _, username := range this.Usernames {
+		if username == user.Username {
+			return true
+		}
+	}
+	return false
+}
+
+// webdav config struct.
+type DavConfig struct {
+	//max matters listed by a PROPFIND with Depth infinity. 0 means Depth infinity is refused.
+	DepthInfinityLimit int64 `json:"depthInfinityLimit"`
+	//names of the OS metadata files, in the syntax of path.Match. eg. "._*"
+	MetadataPatterns []string `json:"metadataPatterns"`
+	//how each client type treats the metadata files. DAV_CLIENT_xxx -> DAV_METADATA_xxx. the others allow them.
+	MetadataPolicies map[string]string `json:"metadataPolicies"`
+}
+
+// fetch the webdav config
+func (this *Preference) FetchDavConfig() *DavConfig {
+
+	m := &DavConfig{
+		DepthInfinityLimit: DAV_DEFAULT_DEPTH_INFINITY_LIMIT,
+		MetadataPatterns:   []string{"._*", ".DS_Store"},
+		MetadataPolicies:   map[string]string{DAV_CLIENT_FINDER: DAV_METADATA_IGNORE},
+	}
+
+	json := this.DavConfig
+	if json != "" && json != EMPTY_JSON_MAP {
+		err := jsoniter.ConfigCompatibleWithStandardLibrary.Unmarshal([]byte(json), &m)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return m
+}
+
+// whether the file is an OS metadata file.
+func (this *DavConfig) IsMetadata(name string) bool {
+	for _, pattern := range this.MetadataPatterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// how the client type treats the metadata files.
+func (this *DavConfig) MetadataPolicy(clientType string) string {
+	if policy, ok := this.MetadataPolicies[clientType]; ok {
+		return policy
+	}
+	return DAV_METADATA_ALLOW
+}
@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"net/http"
+)
+
+type RecentController struct {
+	BaseController
+	recentDao *RecentDao
+	matterDao *MatterDao
+}
+
+func (this *RecentController) Init() {
+	this.BaseController.Init()
+
+	b := core.CONTEXT.GetBean(this.recentDao)
+	if b, ok := b.(*RecentDao); ok {
+		this.recentDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+}
+
+func (this *RecentController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
+
+	routeMap := make(map[string]func(writer http.ResponseWriter, request *http.Request))
+
+	routeMap["/api/recent/page"] = this.Wrap(this.Page, USER_ROLE_USER)
+	routeMap["/api/recent/delete"] = this.Wrap(this.Delete, USER_ROLE_USER)
+	routeMap["/api/recent/clear"] = this.Wrap(this.Clear, USER_ROLE_USER)
+
+	return routeMap
+}
+
+// my recently accessed files in a space. the latest comes first.
+func (this *RecentController) Page(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	page := util.ExtractRequestOptionalInt(request, "page", 0)
+	pageSize := util.ExtractRequestOptionalInt(request, "pageSize", 200)
+	orderVisitTime := util.ExtractRequestOptionalString(request, "orderVisitTime", DIRECTION_DESC)
+	orderTimes := util.ExtractRequestOptionalString(request, "orderTimes", "")
+	mode := util.ExtractRequestOptionalString(request, "mode", "")
+
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	this.spaceService.CheckReadableByUuid(request, user, spaceUuid)
+
+	sortArray := []builder.OrderPair{
+		{
+			Key:   "times",
+			Value: orderTimes,
+		},
+		{
+			Key:   "visit_time",
+			Value: orderVisitTime,
+		},
+	}
+
+	pager := this.recentDao.Page(page, pageSize, user.Uuid, spaceUuid, mode, sortArray)
+
+	//fill the matters.
+	recents := pager.Data.([]*Recent)
+	var matterUuids []string
+	for _, recent := range recents {
+		matterUuids = append(matterUuids, recent.MatterUuid)
+	}
+	if len(matterUuids) > 0 {
+		matterMap := make(map[string]*Matter)
+		for _, matter := range this.matterDao.FindByUuids(matterUuids, nil) {
+			matterMap[matter.Uuid] = matter
+		}
+		for _, recent := range recents {
+			recent.Matter = matterMap[recent.MatterUuid]
+		}
+	}
+
+	return this.Success(pager)
+}
+
+// remove a file from my recent list.
+func (this *RecentController) Delete(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	matterUuid := util.ExtractRequestString(request, "matterUuid")
+
+	user := this.checkUser(request)
+	recent := this.recentDao.FindByUserUuidAndMatterUuid(user.Uuid, matterUuid)
+	if recent != nil {
+		this.recentDao.Delete(recent)
+	}
+
+	return this.Success(nil)
+}
+
+// clear my recent list.
+func (this *RecentController) Clear(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	user := this.checkUser(request)
+	this.recentDao.DeleteByUserUuid(user.Uuid)
+
+	return this.Success(nil)
+}
@@ -0,0 +1,143 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
+	"time"
+)
+
+type RecentDao struct {
+	BaseDao
+	matterDao *MatterDao
+}
+
+func (this *RecentDao) Init() {
+	this.BaseDao.Init()
+
+	b := core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+}
+
+// find by userUuid and matterUuid. if not found return nil.
+func (this *RecentDao) FindByUserUuidAndMatterUuid(userUuid string, matterUuid string) *Recent {
+	var entity = &Recent{}
+	db := core.CONTEXT.GetDB().Where("user_uuid = ? AND matter_uuid = ?", userUuid, matterUuid).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+// matters in the trash are skipped.
+func (this *RecentDao) Page(page int, pageSize int, userUuid string, spaceUuid string, mode string, sortArray []builder.OrderPair) *Pager {
+
+	var wp = &builder.WherePair{Query: "matter_uuid IN (?)", Args: []interface{}{this.matterDao.AliveUuidQuery()}}
+
+	if userUuid != "" {
+		wp = wp.And(&builder.WherePair{Query: "user_uuid = ?", Args: []interface{}{userUuid}})
+	}
+
+	if spaceUuid != "" {
+		wp = wp.And(&builder.WherePair{Query: "space_uuid = ?", Args: []interface{}{spaceUuid}})
+	}
+
+	if mode != "" {
+		wp = wp.And(&builder.WherePair{Query: "mode = ?", Args: []interface{}{mode}})
+	}
+
+	var conditionDB *gorm.DB
+	conditionDB = core.CONTEXT.GetDB().Model(&Recent{}).Where(wp.Query, wp.Args...)
+
+	var count int64 = 0
+	db := conditionDB.Count(&count)
+	this.PanicError(db.Error)
+
+	var recents []*Recent
+	db = conditionDB.Order(this.GetSortString(sortArray)).Offset(page * pageSize).Limit(pageSize).Find(&recents)
+	this.PanicError(db.Error)
+	pager := NewPager(page, pageSize, int(count), recents)
+
+	return pager
+}
+
+func (this *RecentDao) CountByUserUuid(userUuid string) int64 {
+	var count int64
+	db := core.CONTEXT.GetDB().Model(&Recent{}).Where("user_uuid = ?", userUuid).Count(&count)
+	this.PanicError(db.Error)
+	return count
+}
+
+func (this *RecentDao) Create(recent *Recent) *Recent {
+
+	timeUUID, _ := uuid.NewV4()
+	recent.Uuid = string(timeUUID.String())
+	recent.CreateTime = time.Now()
+	recent.UpdateTime = time.Now()
+	recent.Sort = time.Now().UnixNano() / 1e6
+	db := core.CONTEXT.GetDB().Create(recent)
+	this.PanicError(db.Error)
+
+	return recent
+}
+
+func (this *RecentDao) Save(recent *Recent) *Recent {
+
+	recent.UpdateTime = time.Now()
+	db := core.CONTEXT.GetDB().Save(recent)
+	this.PanicError(db.Error)
+
+	return recent
+}
+
+func (this *RecentDao) Delete(recent *Recent) {
+
+	db := core.CONTEXT.GetDB().Delete(&recent)
+	this.PanicError(db.Error)
+}
+
+// keep the latest num records of a user, delete the others.
+func (this *RecentDao) DeleteByUserUuidExceptLatest(userUuid string, num int) {
+
+	var recents []*Recent
+	db := core.CONTEXT.GetDB().Select("visit_time").Where("user_uuid = ?", userUuid).Order("visit_time DESC").Offset(num - 1).Limit(1).Find(&recents)
+	this.PanicError(db.Error)
+	if len(recents) == 0 {
+		return
+	}
+
+	db = core.CONTEXT.GetDB().Where("user_uuid = ? AND visit_time < ?", userUuid, recents[0].VisitTime).Delete(Recent{})
+	this.PanicError(db.Error)
+}
+
+func (this *RecentDao) DeleteByMatterUuid(matterUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid = ?", matterUuid).Delete(Recent{})
+	this.PanicError(db.Error)
+}
+
+func (this *RecentDao) DeleteByMatterUuidQuery(matterUuidQuery *gorm.DB) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid IN (?)", matterUuidQuery).Delete(Recent{})
+	this.PanicError(db.Error)
+}
+
+func (this *RecentDao) DeleteByUserUuid(userUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("user_uuid = ?", userUuid).Delete(Recent{})
+	this.PanicError(db.Error)
+}
+
+func (this *RecentDao) Cleanup() {
+	this.logger.Info("[RecentDao] clean up. Delete all Recent")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(Recent{})
+	this.PanicError(db.Error)
+}
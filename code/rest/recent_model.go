@@ -0,0 +1,31 @@
+package rest
+
+import "time"
+
+const (
+	//preview in browser.
+	RECENT_MODE_VIEW = "VIEW"
+	//download by browser or webdav client.
+	RECENT_MODE_DOWNLOAD = "DOWNLOAD"
+	RECENT_MODE_UPLOAD   = "UPLOAD"
+
+	//only the latest records of a user are kept.
+	RECENT_MAX_NUM_PER_USER = 500
+)
+
+/**
+ * a matter recently accessed by a user. one record for each user and matter.
+ */
+type Recent struct {
+	Uuid       string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort       int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	UserUuid   string    `json:"userUuid" gorm:"type:char(36) not null;uniqueIndex:idx_recent_um,priority:1"`
+	SpaceUuid  string    `json:"spaceUuid" gorm:"type:char(36) not null"`
+	MatterUuid string    `json:"matterUuid" gorm:"type:char(36) not null;uniqueIndex:idx_recent_um,priority:2;index:idx_recent_mu"`
+	Mode       string    `json:"mode" gorm:"type:varchar(45) not null"`
+	Times      int64     `json:"times" gorm:"type:bigint(20) not null;default:0"`
+	VisitTime  time.Time `json:"visitTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	Matter     *Matter   `json:"matter" gorm:"-"`
+}
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"time"
+)
+
+// @Service
+type RecentService struct {
+	BaseBean
+	recentDao *RecentDao
+}
+
+func (this *RecentService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.recentDao)
+	if b, ok := b.(*RecentDao); ok {
+		this.recentDao = b
+	}
+}
+
+// async record the access of a file. directories are not recorded.
+func (this *RecentService) Record(user *User, matter *Matter, mode string) {
+
+	if user == nil || matter == nil || matter.Dir {
+		return
+	}
+
+	go core.RunWithRecovery(func() {
+
+		recent := this.recentDao.FindByUserUuidAndMatterUuid(user.Uuid, matter.Uuid)
+		if recent != nil {
+			recent.Mode = mode
+			recent.Times = recent.Times + 1
+			recent.VisitTime = time.Now()
+			this.recentDao.Save(recent)
+			return
+		}
+
+		this.recentDao.Create(&Recent{
+			UserUuid:   user.Uuid,
+			SpaceUuid:  matter.SpaceUuid,
+			MatterUuid: matter.Uuid,
+			Mode:       mode,
+			Times:      1,
+			VisitTime:  time.Now(),
+		})
+		this.recentDao.DeleteByUserUuidExceptLatest(user.Uuid, RECENT_MAX_NUM_PER_USER)
+	})
+}
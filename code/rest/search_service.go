@@ -0,0 +1,217 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/search"
+	"net/http"
+	"time"
+)
+
+// inverted index of names, extensions, tags and texts. updated when matters change.
+// @Service
+type SearchService struct {
+	BaseBean
+	matterDao      *MatterDao
+	searchTermDao  *SearchTermDao
+	storageService *StorageService
+}
+
+func (this *SearchService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.searchTermDao)
+	if b, ok := b.(*SearchTermDao); ok {
+		this.searchTermDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.storageService)
+	if b, ok := b.(*StorageService); ok {
+		this.storageService = b
+	}
+}
+
+func (this *SearchService) newTerms(matter *Matter, field string, counts map[string]int, weight int64, maxCount int) []*SearchTerm {
+	var terms []*SearchTerm
+	for term, count := range counts {
+		if maxCount > 0 && count > maxCount {
+			count = maxCount
+		}
+		terms = append(terms, &SearchTerm{
+			SpaceUuid:  matter.SpaceUuid,
+			MatterUuid: matter.Uuid,
+			Term:       term,
+			Field:      field,
+			Weight:     weight * int64(count),
+		})
+	}
+	return terms
+}
+
+// index the name and extension of a matter.
+func (this *SearchService) IndexName(matter *Matter) {
+
+	this.searchTermDao.DeleteByMatterUuid(matter.Uuid, SEARCH_FIELD_NAME, SEARCH_FIELD_EXTENSION)
+
+	terms := this.newTerms(matter, SEARCH_FIELD_NAME, search.CountTerms(matter.Name, 0), SEARCH_WEIGHT_NAME, 0)
+	if !matter.Dir {
+		extension := search.Extension(matter.Name)
+		if extension != "" {
+			terms = append(terms, this.newTerms(matter, SEARCH_FIELD_EXTENSION, map[string]int{extension: 1}, SEARCH_WEIGHT_EXTENSION, 0)...)
+		}
+	}
+	this.searchTermDao.CreateBatch(terms)
+}
+
+// index the tags of a matter.
+func (this *SearchService) IndexTags(matter *Matter, tags []string) {
+
+	this.searchTermDao.DeleteByMatterUuid(matter.Uuid, SEARCH_FIELD_TAG)
+
+	counts := make(map[string]int)
+	for _, tag := range tags {
+		for term := range search.CountTerms(tag, 0) {
+			counts[term] = 1
+		}
+	}
+	this.searchTermDao.CreateBatch(this.newTerms(matter, SEARCH_FIELD_TAG, counts, SEARCH_WEIGHT_TAG, 0))
+}
+
+// index the text of a file. files which cannot be read are skipped.
+func (this *SearchService) IndexContent(matter *Matter) {
+
+	this.searchTermDao.DeleteByMatterUuid(matter.Uuid, SEARCH_FIELD_CONTENT)
+
+	if matter.Dir || !search.Extractable(matter.Name, matter.Size) {
+		return
+	}
+
+	reader, err := this.storageService.Backend(matter.Backend).Open(matter.Key())
+	if err != nil {
+		this.logger.Error("cannot open %s to index. %v", matter.Path, err)
+		return
+	}
+	defer func() {
+		err := reader.Close()
+		this.PanicError(err)
+	}()
+
+	text, err := search.ExtractText(matter.Name, reader, matter.Size)
+	if err != nil {
+		this.logger.Error("cannot extract text of %s. %v", matter.Path, err)
+		return
+	}
+
+	counts := search.CountTerms(text, SEARCH_CONTENT_MAX_TERMS)
+	this.searchTermDao.CreateBatch(this.newTerms(matter, SEARCH_FIELD_CONTENT, counts, SEARCH_WEIGHT_CONTENT, SEARCH_CONTENT_MAX_COUNT))
+}
+
+// index the name and the content of a matter.
+func (this *SearchService) Index(matter *Matter) {
+	this.IndexName(matter)
+	this.IndexContent(matter)
+}
+
+// index all the matters of a space again. tags are kept.
+func (this *SearchService) Rebuild(space *Space) {
+
+	this.logger.Info("rebuild search index of space %s", space.Name)
+
+	pageSize := 1000
+	sortArray := []builder.OrderPair{{Key: "uuid", Value: DIRECTION_ASC}}
+	count, _ := this.matterDao.PlainPage(0, 1, "", "", space.Uuid, "", "", "", nil, nil, "", sortArray)
+	for page := 0; page*pageSize < count; page++ {
+		_, matters := this.matterDao.PlainPage(page, pageSize, "", "", space.Uuid, "", "", "", nil, nil, "", sortArray)
+		for _, matter := range matters {
+			this.Index(matter)
+		}
+	}
+
+	this.logger.Info("search index of space %s rebuilt. %d matters", space.Name, count)
+}
+
+// search the matters in a space with keyword. dirMatter limits to its descendants. results are ranked by score.
+func (this *SearchService) Search(
+	request *http.Request,
+	page int,
+	pageSize int,
+	space *Space,
+	keyword string,
+	dirMatter *Matter,
+	dir string,
+	deleted bool,
+	extensions []string,
+	sizeMin int64,
+	sizeMax int64,
+	updateTimeAfter *time.Time,
+	updateTimeBefore *time.Time) *Pager {
+
+	//distinct terms in order.
+	var terms []string
+	exists := make(map[string]bool)
+	for _, term := range search.Tokenize(keyword) {
+		if !exists[term] {
+			exists[term] = true
+			terms = append(terms, term)
+		}
+	}
+	if len(terms) == 0 {
+		return NewPager(page, pageSize, 0, []*Matter{})
+	}
+
+	wp := &builder.WherePair{Query: "m.deleted = ?", Args: []interface{}{deleted}}
+	if dirMatter != nil && dirMatter.Uuid != MATTER_ROOT {
+		wp = wp.And(this.matterDao.descendantCondition("m.", dirMatter.SpaceUuid, dirMatter.Path))
+	}
+	if dir == TRUE {
+		wp = wp.And(&builder.WherePair{Query: "m.dir = ?", Args: []interface{}{1}})
+	} else if dir == FALSE {
+		wp = wp.And(&builder.WherePair{Query: "m.dir = ?", Args: []interface{}{0}})
+	}
+	if sizeMin >= 0 {
+		wp = wp.And(&builder.WherePair{Query: "m.size >= ?", Args: []interface{}{sizeMin}})
+	}
+	if sizeMax >= 0 {
+		wp = wp.And(&builder.WherePair{Query: "m.size <= ?", Args: []interface{}{sizeMax}})
+	}
+	if updateTimeAfter != nil {
+		wp = wp.And(&builder.WherePair{Query: "m.update_time >= ?", Args: []interface{}{updateTimeAfter}})
+	}
+	if updateTimeBefore != nil {
+		wp = wp.And(&builder.WherePair{Query: "m.update_time <= ?", Args: []interface{}{updateTimeBefore}})
+	}
+	if len(extensions) > 0 {
+		var orWp = &builder.WherePair{}
+		for _, extension := range extensions {
+			orWp = orWp.Or(&builder.WherePair{Query: "m.name LIKE ?", Args: []interface{}{"%." + extension}})
+		}
+		wp = wp.And(&builder.WherePair{Query: "(" + orWp.Query + ")", Args: orWp.Args})
+	}
+
+	count, hits := this.searchTermDao.Search(page, pageSize, space.Uuid, terms, wp)
+
+	//keep the order of scores.
+	uuids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		uuids = append(uuids, hit.MatterUuid)
+	}
+	matterMap := make(map[string]*Matter)
+	if len(uuids) > 0 {
+		for _, matter := range this.matterDao.FindByUuids(uuids, nil) {
+			matterMap[matter.Uuid] = matter
+		}
+	}
+	matters := make([]*Matter, 0, len(hits))
+	for _, uuid := range uuids {
+		if matter, ok := matterMap[uuid]; ok {
+			matters = append(matters, matter)
+		}
+	}
+
+	return NewPager(page, pageSize, count, matters)
+}
@@ -0,0 +1,115 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+type SearchTermDao struct {
+	BaseDao
+}
+
+// create the terms of a matter in batch.
+func (this *SearchTermDao) CreateBatch(terms []*SearchTerm) {
+
+	if len(terms) == 0 {
+		return
+	}
+
+	now := time.Now()
+	for _, term := range terms {
+		timeUUID, _ := uuid.NewV4()
+		term.Uuid = string(timeUUID.String())
+		term.CreateTime = now
+		term.UpdateTime = now
+		term.Sort = now.UnixNano() / 1e6
+	}
+	db := core.CONTEXT.GetDB().CreateInBatches(terms, 200)
+	this.PanicError(db.Error)
+}
+
+// delete the terms of some fields of a matter. all the fields if none given.
+func (this *SearchTermDao) DeleteByMatterUuid(matterUuid string, fields ...string) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid = ?", matterUuid)
+	if len(fields) > 0 {
+		db = db.Where("field IN ?", fields)
+	}
+	db = db.Delete(SearchTerm{})
+	this.PanicError(db.Error)
+}
+
+// delete by the matters selected by the sub query.
+func (this *SearchTermDao) DeleteByMatterUuidQuery(matterUuidQuery *gorm.DB) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid IN (?)", matterUuidQuery).Delete(SearchTerm{})
+	this.PanicError(db.Error)
+}
+
+func (this *SearchTermDao) DeleteByUserUuid(userUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("matter_uuid IN (?)", core.CONTEXT.GetDB().Model(&Matter{}).Select("uuid").Where("user_uuid = ?", userUuid)).Delete(SearchTerm{})
+	this.PanicError(db.Error)
+}
+
+func (this *SearchTermDao) DeleteBySpaceUuid(spaceUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("space_uuid = ?", spaceUuid).Delete(SearchTerm{})
+	this.PanicError(db.Error)
+}
+
+// find the matters containing every term. the last term also matches as a prefix, so that results show while typing.
+// matterWp filters the matters, whose columns are prefixed by "m.". hits are ordered by score.
+func (this *SearchTermDao) Search(page int, pageSize int, spaceUuid string, terms []string, matterWp *builder.WherePair) (int, []*SearchHit) {
+
+	termWp := &builder.WherePair{}
+	hitQueries := make([]string, 0, len(terms))
+	var hitArgs []interface{}
+	for i, term := range terms {
+		query := "t.term = ?"
+		arg := term
+		if i == len(terms)-1 {
+			query = "t.term LIKE ?"
+			arg = term + "%"
+		}
+		termWp = termWp.Or(&builder.WherePair{Query: query, Args: []interface{}{arg}})
+		hitQueries = append(hitQueries, fmt.Sprintf("MAX(CASE WHEN %s THEN 1 ELSE 0 END)", query))
+		hitArgs = append(hitArgs, arg)
+	}
+
+	wp := &builder.WherePair{Query: "t.space_uuid = ?", Args: []interface{}{spaceUuid}}
+	wp = wp.And(&builder.WherePair{Query: "(" + termWp.Query + ")", Args: termWp.Args})
+	if matterWp != nil && matterWp.Query != "" {
+		wp = wp.And(matterWp)
+	}
+
+	//exact terms score double.
+	conditionDB := core.CONTEXT.GetDB().
+		Table(fmt.Sprintf("`%ssearch_term` t", core.TABLE_PREFIX)).
+		Select("t.matter_uuid AS matter_uuid, SUM(t.weight * CASE WHEN t.term IN ? THEN 2 ELSE 1 END) AS score", terms).
+		Joins(fmt.Sprintf("JOIN `%smatter` m ON m.uuid = t.matter_uuid", core.TABLE_PREFIX)).
+		Where(wp.Query, wp.Args...).
+		Group("t.matter_uuid").
+		Having(fmt.Sprintf("%s = ?", strings.Join(hitQueries, " + ")), append(hitArgs, len(terms))...)
+
+	var count int64 = 0
+	db := core.CONTEXT.GetDB().Table("(?) AS h", conditionDB).Count(&count)
+	this.PanicError(db.Error)
+
+	var hits []*SearchHit
+	db = conditionDB.Order("score DESC, matter_uuid").Offset(page * pageSize).Limit(pageSize).Scan(&hits)
+	this.PanicError(db.Error)
+
+	return int(count), hits
+}
+
+func (this *SearchTermDao) Cleanup() {
+	this.logger.Info("[SearchTermDao] clean up. Delete all SearchTerm")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(SearchTerm{})
+	this.PanicError(db.Error)
+}
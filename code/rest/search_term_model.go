@@ -0,0 +1,43 @@
+package rest
+
+import (
+	"time"
+)
+
+const (
+	SEARCH_FIELD_NAME      = "name"
+	SEARCH_FIELD_EXTENSION = "extension"
+	SEARCH_FIELD_TAG       = "tag"
+	SEARCH_FIELD_CONTENT   = "content"
+
+	//weight of each occurrence. a term in the name is worth more than in the content.
+	SEARCH_WEIGHT_NAME      = 10
+	SEARCH_WEIGHT_EXTENSION = 5
+	SEARCH_WEIGHT_TAG       = 8
+	SEARCH_WEIGHT_CONTENT   = 1
+	//occurrences in the content beyond it are not counted.
+	SEARCH_CONTENT_MAX_COUNT = 10
+	//distinct terms of a content to be indexed.
+	SEARCH_CONTENT_MAX_TERMS = 5000
+)
+
+/**
+ * inverted index of the matters. one row for each term in each field of a matter.
+ */
+type SearchTerm struct {
+	Uuid       string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort       int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	SpaceUuid  string    `json:"spaceUuid" gorm:"type:char(36) not null;index:idx_search_term_st,priority:1"`
+	Term       string    `json:"term" gorm:"type:varchar(100) not null;index:idx_search_term_st,priority:2"`
+	MatterUuid string    `json:"matterUuid" gorm:"type:char(36) not null;index:idx_search_term_mu"`
+	Field      string    `json:"field" gorm:"type:varchar(45) not null"`
+	Weight     int64     `json:"weight" gorm:"type:bigint(20) not null;default:0"`
+}
+
+// a matter and its score in a search.
+type SearchHit struct {
+	MatterUuid string
+	Score      int64
+}
@@ -72,6 +72,8 @@ func (this *ShareController) RegisterRoutes() map[string]func(writer http.Respon
 	routeMap["/api/share/matter/page"] = this.Wrap(this.MatterPage, USER_ROLE_GUEST)
 	routeMap["/api/share/matter/preview"] = this.WrapPure(this.MatterPreview, USER_ROLE_GUEST)
 	routeMap["/api/share/matter/download"] = this.WrapPure(this.MatterDownload, USER_ROLE_GUEST)
+	routeMap["/api/share/matter/archive/list"] = this.Wrap(this.MatterArchiveList, USER_ROLE_GUEST)
+	routeMap["/api/share/matter/archive/download"] = this.WrapPure(this.MatterArchiveDownload, USER_ROLE_GUEST)
 
 	return routeMap
 }
@@ -427,6 +429,7 @@ func (this *ShareController) MatterPage(writer http.ResponseWriter, request *htt
 		dir,
 		deleted,
 		extensions,
+		"",
 		share.SpaceUuid,
 	)
 
@@ -454,3 +457,36 @@ func (this *ShareController) MatterPreview(writer http.ResponseWriter, request *
 func (this *ShareController) MatterDownload(writer http.ResponseWriter, request *http.Request) {
 	this.MatterPreviewOrDownload(writer, request, true)
 }
+
+// list the entries of a shared archive.
+func (this *ShareController) MatterArchiveList(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+	//auth by shareUuid.
+	matterUuid := util.ExtractRequestString(request, "matterUuid")
+	shareUuid := util.ExtractRequestString(request, "shareUuid")
+	shareCode := util.ExtractRequestString(request, "shareCode")
+	shareRootUuid := util.ExtractRequestString(request, "shareRootUuid")
+
+	matter := this.matterDao.CheckByUuid(matterUuid)
+	operator := this.findUser(request)
+
+	this.shareService.ValidateMatter(request, shareUuid, shareCode, operator, shareRootUuid, matter)
+
+	return this.Success(this.matterService.ArchiveEntries(request, matter))
+}
+
+// download a single file inside a shared archive.
+func (this *ShareController) MatterArchiveDownload(writer http.ResponseWriter, request *http.Request) {
+	//auth by shareUuid.
+	matterUuid := util.ExtractRequestString(request, "matterUuid")
+	shareUuid := util.ExtractRequestString(request, "shareUuid")
+	shareCode := util.ExtractRequestString(request, "shareCode")
+	shareRootUuid := util.ExtractRequestString(request, "shareRootUuid")
+	name := util.ExtractRequestString(request, "name")
+	withContentDisposition := util.ExtractRequestOptionalBool(request, "download", true)
+
+	matter := this.matterDao.CheckByUuid(matterUuid)
+	operator := this.findUser(request)
+
+	this.shareService.ValidateMatter(request, shareUuid, shareCode, operator, shareRootUuid, matter)
+	this.matterService.DownloadArchiveEntry(writer, request, matter, name, withContentDisposition)
+}
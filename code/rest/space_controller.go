@@ -18,6 +18,7 @@ type SpaceController struct {
 	matterService      *MatterService
 	spaceService       *SpaceService
 	userService        *UserService
+	trashService       *TrashService
 }
 
 func (this *SpaceController) Init() {
@@ -58,6 +59,11 @@ func (this *SpaceController) Init() {
 		this.userService = b
 	}
 
+	b = core.CONTEXT.GetBean(this.trashService)
+	if b, ok := b.(*TrashService); ok {
+		this.trashService = b
+	}
+
 }
 
 func (this *SpaceController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
@@ -66,9 +72,13 @@ func (this *SpaceController) RegisterRoutes() map[string]func(writer http.Respon
 
 	routeMap["/api/space/create"] = this.Wrap(this.Create, USER_ROLE_ADMINISTRATOR)
 	routeMap["/api/space/edit"] = this.Wrap(this.Edit, USER_ROLE_ADMINISTRATOR)
+	routeMap["/api/space/edit/version"] = this.Wrap(this.EditVersion, USER_ROLE_USER)
+	routeMap["/api/space/edit/trash"] = this.Wrap(this.EditTrash, USER_ROLE_USER)
+	routeMap["/api/space/edit/backend"] = this.Wrap(this.EditBackend, USER_ROLE_ADMINISTRATOR)
 	routeMap["/api/space/delete"] = this.Wrap(this.Delete, USER_ROLE_ADMINISTRATOR)
 	routeMap["/api/space/detail"] = this.Wrap(this.Detail, USER_ROLE_USER)
 	routeMap["/api/space/page"] = this.Wrap(this.Page, USER_ROLE_USER)
+	routeMap["/api/space/size/recompute"] = this.Wrap(this.RecomputeSize, USER_ROLE_ADMINISTRATOR)
 	return routeMap
 }
 
@@ -77,9 +87,11 @@ func (this *SpaceController) Create(writer http.ResponseWriter, request *http.Re
 	name := util.ExtractRequestString(request, "name")
 	sizeLimit := util.ExtractRequestInt64(request, "sizeLimit")
 	totalSizeLimit := util.ExtractRequestInt64(request, "totalSizeLimit")
+	//storage backend configured in tank.json. empty means local.
+	backend := util.ExtractRequestOptionalString(request, "backend", "")
 
 	//create related space.
-	space := this.spaceService.CreateSpace(request, name, nil, sizeLimit, totalSizeLimit, SPACE_TYPE_SHARED)
+	space := this.spaceService.CreateSpace(request, name, nil, sizeLimit, totalSizeLimit, SPACE_TYPE_SHARED, backend)
 
 	return this.Success(space)
 }
@@ -97,6 +109,47 @@ func (this *SpaceController) Edit(writer http.ResponseWriter, request *http.Requ
 	return this.Success(space)
 }
 
+// edit the version retention policy. versions are counted in the space's total size.
+func (this *SpaceController) EditVersion(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	//space's uuid
+	uuid := util.ExtractRequestString(request, "uuid")
+	versionKeepNum := util.ExtractRequestInt64(request, "versionKeepNum")
+	versionKeepDays := util.ExtractRequestInt64(request, "versionKeepDays")
+
+	user := this.checkUser(request)
+	space := this.spaceService.EditVersion(request, user, uuid, versionKeepNum, versionKeepDays)
+
+	return this.Success(space)
+}
+
+// edit the trash size limit.
+func (this *SpaceController) EditTrash(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	//space's uuid
+	uuid := util.ExtractRequestString(request, "uuid")
+	trashSizeLimit := util.ExtractRequestInt64(request, "trashSizeLimit")
+
+	user := this.checkUser(request)
+	space := this.spaceService.EditTrash(request, user, uuid, trashSizeLimit)
+	this.trashService.CheckSizeLimit(request, user, space)
+
+	return this.Success(space)
+}
+
+// edit the storage backend of new contents.
+func (this *SpaceController) EditBackend(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	//space's uuid
+	uuid := util.ExtractRequestString(request, "uuid")
+	backend := util.ExtractRequestOptionalString(request, "backend", "")
+
+	user := this.checkUser(request)
+	space := this.spaceService.EditBackend(request, user, uuid, backend)
+
+	return this.Success(space)
+}
+
 func (this *SpaceController) Delete(writer http.ResponseWriter, request *http.Request) *result.WebResult {
 
 	//space's name
@@ -161,3 +214,27 @@ func (this *SpaceController) Page(writer http.ResponseWriter, request *http.Requ
 
 	return this.Success(pager)
 }
+
+// recompute the sizes from the files and report the drift. all the spaces if uuid is empty, and only the drifted ones are reported.
+func (this *SpaceController) RecomputeSize(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	uuid := util.ExtractRequestOptionalString(request, "uuid", "")
+	fix := util.ExtractRequestOptionalBool(request, "fix", false)
+
+	user := this.checkUser(request)
+
+	drifts := []*SizeDrift{}
+	if uuid != "" {
+		space := this.spaceDao.CheckByUuid(uuid)
+		drifts = append(drifts, this.matterService.RecomputeSize(user, space, fix))
+	} else {
+		this.spaceDao.PageHandle(func(space *Space) {
+			drift := this.matterService.RecomputeSize(user, space, fix)
+			if drift.Drifted() {
+				drifts = append(drifts, drift)
+			}
+		})
+	}
+
+	return this.Success(drifts)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/eyebluecn/tank/code/tool/builder"
 	"github.com/eyebluecn/tank/code/tool/result"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"math"
 
 	"github.com/eyebluecn/tank/code/tool/uuid"
@@ -18,8 +19,12 @@ type SpaceDao struct {
 
 // find by uuid. if not found return nil.
 func (this *SpaceDao) FindByUuid(uuid string) *Space {
+	return this.FindByUuidTx(core.CONTEXT.GetDB(), uuid)
+}
+
+func (this *SpaceDao) FindByUuidTx(tx *gorm.DB, uuid string) *Space {
 	var entity = &Space{}
-	db := core.CONTEXT.GetDB().Where("uuid = ?", uuid).First(entity)
+	db := tx.Where("uuid = ?", uuid).First(entity)
 	if db.Error != nil {
 		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
 			return nil
@@ -32,13 +37,22 @@ func (this *SpaceDao) FindByUuid(uuid string) *Space {
 
 // find by uuid. if not found panic NotFound error
 func (this *SpaceDao) CheckByUuid(uuid string) *Space {
-	entity := this.FindByUuid(uuid)
+	return this.CheckByUuidTx(core.CONTEXT.GetDB(), uuid)
+}
+
+func (this *SpaceDao) CheckByUuidTx(tx *gorm.DB, uuid string) *Space {
+	entity := this.FindByUuidTx(tx, uuid)
 	if entity == nil {
 		panic(result.NotFound("not found record with uuid = %s", uuid))
 	}
 	return entity
 }
 
+// find by uuid and lock the row until the transaction ends, so that the instances change the space one by one.
+func (this *SpaceDao) CheckByUuidForUpdateTx(tx *gorm.DB, uuid string) *Space {
+	return this.CheckByUuidTx(tx.Clauses(clause.Locking{Strength: "UPDATE"}), uuid)
+}
+
 func (this *SpaceDao) CountByName(name string) int {
 	var count int64
 	db := core.CONTEXT.GetDB().
@@ -63,6 +77,18 @@ func (this *SpaceDao) FindByName(name string) *Space {
 	return space
 }
 
+// the private spaces of the user and the spaces the user is a member of, ordered by name.
+func (this *SpaceDao) FindByUserUuidOrMember(userUuid string) []*Space {
+	var spaces []*Space
+	memberQuery := core.CONTEXT.GetDB().Model(&SpaceMember{}).Select("space_uuid").Where("user_uuid = ?", userUuid)
+	db := core.CONTEXT.GetDB().
+		Where("(user_uuid = ? AND type = ?) OR uuid IN (?)", userUuid, SPACE_TYPE_PRIVATE, memberQuery).
+		Order("name").
+		Find(&spaces)
+	this.PanicError(db.Error)
+	return spaces
+}
+
 func (this *SpaceDao) CountByUserUuid(userUuid string) int {
 	var count int64
 	db := core.CONTEXT.GetDB().
@@ -155,11 +181,45 @@ func (this *SpaceDao) Save(space *Space) *Space {
 	return space
 }
 
+// update only the given columns, so that the total size changed meanwhile is not overwritten. return the latest space.
+func (this *SpaceDao) UpdateColumns(spaceUuid string, columns map[string]interface{}) *Space {
+	columns["update_time"] = time.Now()
+	db := core.CONTEXT.GetDB().Model(&Space{}).Where("uuid = ?", spaceUuid).Updates(columns)
+	this.PanicError(db.Error)
+
+	return this.CheckByUuid(spaceUuid)
+}
+
 func (this *SpaceDao) UpdateTotalSize(spaceUuid string, totalSize int64) {
 	db := core.CONTEXT.GetDB().Model(&Space{}).Where("uuid = ?", spaceUuid).Update("total_size", totalSize)
 	this.PanicError(db.Error)
 }
 
+func (this *SpaceDao) AddTotalSize(spaceUuid string, delta int64) {
+	this.AddTotalSizeTx(core.CONTEXT.GetDB(), spaceUuid, delta)
+}
+
+// add delta to the total size in a transaction.
+func (this *SpaceDao) AddTotalSizeTx(tx *gorm.DB, spaceUuid string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	db := tx.Model(&Space{}).Where("uuid = ?", spaceUuid).Update("total_size", gorm.Expr("total_size + ?", delta))
+	this.PanicError(db.Error)
+}
+
+// add size to the total size in a transaction unless the total size limit is exceeded. return whether added.
+func (this *SpaceDao) ChargeTotalSizeTx(tx *gorm.DB, spaceUuid string, size int64) bool {
+	if size <= 0 {
+		this.AddTotalSizeTx(tx, spaceUuid, size)
+		return true
+	}
+	db := tx.Model(&Space{}).Where("uuid = ? AND (total_size_limit < 0 OR total_size + ? <= total_size_limit)", spaceUuid, size).
+		Update("total_size", gorm.Expr("total_size + ?", size))
+	this.PanicError(db.Error)
+	return db.RowsAffected > 0
+}
+
 // handle user page by page.
 func (this *SpaceDao) PageHandle(fun func(space *Space)) {
 
@@ -13,17 +13,51 @@ const (
 
 /**
  * shared space
+ * VersionKeepNum 0 disables the versions. VersionKeepNum, VersionKeepDays and TrashSizeLimit -1 mean no limit.
+ * Backend is the storage of new contents, empty means local.
  */
 type Space struct {
-	Uuid           string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
-	Sort           int64     `json:"sort" gorm:"type:bigint(20) not null"`
-	UpdateTime     time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
-	CreateTime     time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
-	Name           string    `json:"name" gorm:"type:varchar(100) not null;unique"`
-	UserUuid       string    `json:"userUuid" gorm:"type:char(36)"`
-	SizeLimit      int64     `json:"sizeLimit" gorm:"type:bigint(20) not null;default:-1"`
-	TotalSizeLimit int64     `json:"totalSizeLimit" gorm:"type:bigint(20) not null;default:-1"`
-	TotalSize      int64     `json:"totalSize" gorm:"type:bigint(20) not null;default:0"`
-	Type           string    `json:"type" gorm:"type:varchar(45)"`
-	User           *User     `json:"user" gorm:"-"`
+	Uuid            string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort            int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime      time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime      time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	Name            string    `json:"name" gorm:"type:varchar(100) not null;unique"`
+	UserUuid        string    `json:"userUuid" gorm:"type:char(36)"`
+	SizeLimit       int64     `json:"sizeLimit" gorm:"type:bigint(20) not null;default:-1"`
+	TotalSizeLimit  int64     `json:"totalSizeLimit" gorm:"type:bigint(20) not null;default:-1"`
+	TotalSize       int64     `json:"totalSize" gorm:"type:bigint(20) not null;default:0"`
+	Type            string    `json:"type" gorm:"type:varchar(45)"`
+	VersionKeepNum  int64     `json:"versionKeepNum" gorm:"type:bigint(20) not null;default:0"`
+	VersionKeepDays int64     `json:"versionKeepDays" gorm:"type:bigint(20) not null;default:-1"`
+	Backend         string    `json:"backend" gorm:"type:varchar(45) not null;default:''"`
+	TrashSizeLimit  int64     `json:"trashSizeLimit" gorm:"type:bigint(20) not null;default:-1"`
+	User            *User     `json:"user" gorm:"-"`
+}
+
+/**
+ * the recorded sizes of a space compared with the ones computed from its files.
+ */
+type SizeDrift struct {
+	SpaceUuid       string          `json:"spaceUuid"`
+	SpaceName       string          `json:"spaceName"`
+	TotalSize       int64           `json:"totalSize"`
+	ActualTotalSize int64           `json:"actualTotalSize"`
+	Dirs            []*DirSizeDrift `json:"dirs"`
+	Fixed           bool            `json:"fixed"`
+}
+
+type DirSizeDrift struct {
+	Uuid       string `json:"uuid"`
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	ActualSize int64  `json:"actualSize"`
+}
+
+func (this *SizeDrift) Drifted() bool {
+	return this.TotalSize != this.ActualTotalSize || len(this.Dirs) > 0
+}
+
+// whether the overwritten content is kept as a version.
+func (this *Space) KeepVersion() bool {
+	return this.VersionKeepNum != 0
 }
@@ -16,6 +16,7 @@ type SpaceService struct {
 	matterDao          *MatterDao
 	bridgeDao          *BridgeDao
 	userDao            *UserDao
+	storageService     *StorageService
 }
 
 func (this *SpaceService) Init() {
@@ -46,6 +47,11 @@ func (this *SpaceService) Init() {
 		this.userDao = b
 	}
 
+	b = core.CONTEXT.GetBean(this.storageService)
+	if b, ok := b.(*StorageService); ok {
+		this.storageService = b
+	}
+
 }
 
 func (this *SpaceService) Detail(uuid string) *Space {
@@ -62,7 +68,8 @@ func (this *SpaceService) CreateSpace(
 	user *User,
 	sizeLimit int64,
 	totalSizeLimit int64,
-	spaceType string) *Space {
+	spaceType string,
+	backend string) *Space {
 
 	userUuid := ""
 	//validation work.
@@ -90,13 +97,19 @@ func (this *SpaceService) CreateSpace(
 		panic(result.BadRequestI18n(request, i18n.SpaceNameExist, name))
 	}
 
+	this.storageService.CheckName(backend)
+
 	space := &Space{
-		Name:           name,
-		UserUuid:       userUuid,
-		SizeLimit:      sizeLimit,
-		TotalSizeLimit: totalSizeLimit,
-		TotalSize:      0,
-		Type:           spaceType,
+		Name:            name,
+		UserUuid:        userUuid,
+		SizeLimit:       sizeLimit,
+		TotalSizeLimit:  totalSizeLimit,
+		TotalSize:       0,
+		Type:            spaceType,
+		VersionKeepNum:  0,
+		VersionKeepDays: -1,
+		TrashSizeLimit:  -1,
+		Backend:         backend,
 	}
 
 	space = this.spaceDao.Create(space)
@@ -162,9 +175,47 @@ func (this *SpaceService) Edit(request *http.Request, user *User, spaceUuid stri
 		panic("totalSizeLimit cannot be negative expect -1.")
 	}
 
-	space.SizeLimit = sizeLimit
-	space.TotalSizeLimit = totalSizeLimit
-	space = this.spaceDao.Save(space)
+	space = this.spaceDao.UpdateColumns(space.Uuid, map[string]interface{}{"size_limit": sizeLimit, "total_size_limit": totalSizeLimit})
+
+	return space
+}
+
+// edit space's version retention policy.
+func (this *SpaceService) EditVersion(request *http.Request, user *User, spaceUuid string, versionKeepNum int64, versionKeepDays int64) *Space {
+	space := this.CheckAdminAbleByUuid(request, user, spaceUuid)
+
+	if versionKeepNum < 0 && versionKeepNum != -1 {
+		panic(result.BadRequest("versionKeepNum cannot be negative expect -1."))
+	}
+
+	if versionKeepDays < 0 && versionKeepDays != -1 {
+		panic(result.BadRequest("versionKeepDays cannot be negative expect -1."))
+	}
+
+	space = this.spaceDao.UpdateColumns(space.Uuid, map[string]interface{}{"version_keep_num": versionKeepNum, "version_keep_days": versionKeepDays})
+
+	return space
+}
+
+// edit space's trash size limit. works together with the DeletedKeepDays of preference.
+func (this *SpaceService) EditTrash(request *http.Request, user *User, spaceUuid string, trashSizeLimit int64) *Space {
+	space := this.CheckAdminAbleByUuid(request, user, spaceUuid)
+
+	if trashSizeLimit < 0 && trashSizeLimit != -1 {
+		panic(result.BadRequest("trashSizeLimit cannot be negative expect -1."))
+	}
+
+	space = this.spaceDao.UpdateColumns(space.Uuid, map[string]interface{}{"trash_size_limit": trashSizeLimit})
+
+	return space
+}
+
+// edit space's storage backend. only new contents go to the backend, existing contents stay where they are.
+func (this *SpaceService) EditBackend(request *http.Request, user *User, spaceUuid string, backend string) *Space {
+	space := this.CheckAdminAbleByUuid(request, user, spaceUuid)
+
+	backend = this.storageService.CheckName(backend)
+	space = this.spaceDao.UpdateColumns(space.Uuid, map[string]interface{}{"backend": backend})
 
 	return space
 }
@@ -0,0 +1,94 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/download"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/storage"
+	"net/http"
+	"sync"
+)
+
+// storage backends of the contents. "" is the local matter path, others come from StorageBackends in tank.json
+// @Service
+type StorageService struct {
+	BaseBean
+	backends map[string]storage.StorageBackend
+	mutex    sync.Mutex
+}
+
+func (this *StorageService) Init() {
+	this.BaseBean.Init()
+}
+
+// backends are created lazily, because the config is ready only after installed.
+func (this *StorageService) loadBackends() map[string]storage.StorageBackend {
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.backends != nil {
+		return this.backends
+	}
+
+	backends := make(map[string]storage.StorageBackend)
+	for name, config := range core.CONFIG.StorageBackends() {
+		if name == "" || config == nil {
+			continue
+		}
+		backend, err := storage.NewBackend(config, core.CONFIG.MatterPath())
+		if err != nil {
+			this.logger.Error("cannot create storage backend %s. %v", name, err)
+			continue
+		}
+		backends[name] = backend
+	}
+	backends[""] = storage.NewLocalBackend(core.CONFIG.MatterPath())
+
+	//tank.json may change when installing.
+	if core.CONFIG.Installed() {
+		this.backends = backends
+	}
+	return backends
+}
+
+// check the backend name is configured.
+func (this *StorageService) CheckName(name string) string {
+	if _, ok := this.loadBackends()[name]; !ok {
+		panic(result.BadRequest("storage backend %s not exist.", name))
+	}
+	return name
+}
+
+// get a backend by name.
+func (this *StorageService) Backend(name string) storage.StorageBackend {
+	backend, ok := this.loadBackends()[name]
+	if !ok {
+		panic(result.BadRequest("storage backend %s not exist.", name))
+	}
+	return backend
+}
+
+// open a matter's content to read.
+func (this *StorageService) OpenMatter(matter *Matter) storage.ReadSeekCloser {
+	reader, err := this.Backend(matter.Backend).Open(matter.Key())
+	this.PanicError(err)
+	return reader
+}
+
+// download a content in the backend. Support chunk download.
+func (this *StorageService) Download(writer http.ResponseWriter, request *http.Request, backendName string, key string, filename string, withContentDisposition bool) {
+
+	backend := this.Backend(backendName)
+	fileInfo, err := backend.Stat(key)
+	this.PanicError(err)
+
+	reader, err := backend.Open(key)
+	this.PanicError(err)
+	defer func() {
+		e := reader.Close()
+		this.PanicError(e)
+	}()
+
+	download.DownloadContent(writer, request, reader, fileInfo.Size, fileInfo.ModTime, filename, withContentDisposition)
+}
@@ -0,0 +1,155 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"net/http"
+)
+
+type TagController struct {
+	BaseController
+	tagDao     *TagDao
+	tagService *TagService
+	matterDao  *MatterDao
+}
+
+func (this *TagController) Init() {
+	this.BaseController.Init()
+
+	b := core.CONTEXT.GetBean(this.tagDao)
+	if b, ok := b.(*TagDao); ok {
+		this.tagDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.tagService)
+	if b, ok := b.(*TagService); ok {
+		this.tagService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+}
+
+func (this *TagController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
+
+	routeMap := make(map[string]func(writer http.ResponseWriter, request *http.Request))
+
+	routeMap["/api/tag/create"] = this.Wrap(this.Create, USER_ROLE_USER)
+	routeMap["/api/tag/edit"] = this.Wrap(this.Edit, USER_ROLE_USER)
+	routeMap["/api/tag/delete"] = this.Wrap(this.Delete, USER_ROLE_USER)
+	routeMap["/api/tag/list"] = this.Wrap(this.List, USER_ROLE_USER)
+	routeMap["/api/tag/add"] = this.Wrap(this.Add, USER_ROLE_USER)
+	routeMap["/api/tag/remove"] = this.Wrap(this.Remove, USER_ROLE_USER)
+	routeMap["/api/tag/matter/list"] = this.Wrap(this.MatterList, USER_ROLE_USER)
+
+	return routeMap
+}
+
+func (this *TagController) Create(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	name := util.ExtractRequestString(request, "name")
+	color := util.ExtractRequestOptionalString(request, "color", "")
+
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	space := this.spaceService.CheckWritableByUuid(request, user, spaceUuid)
+
+	tag := this.tagService.Create(request, name, color, user, space)
+
+	return this.Success(tag)
+}
+
+func (this *TagController) Edit(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	uuid := util.ExtractRequestString(request, "uuid")
+	name := util.ExtractRequestString(request, "name")
+	color := util.ExtractRequestOptionalString(request, "color", "")
+
+	user := this.checkUser(request)
+	tag := this.tagDao.CheckByUuid(uuid)
+	this.spaceService.CheckWritableByUuid(request, user, tag.SpaceUuid)
+
+	tag = this.tagService.Edit(request, tag, name, color)
+
+	return this.Success(tag)
+}
+
+func (this *TagController) Delete(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	uuid := util.ExtractRequestString(request, "uuid")
+
+	user := this.checkUser(request)
+	tag := this.tagDao.CheckByUuid(uuid)
+	this.spaceService.CheckWritableByUuid(request, user, tag.SpaceUuid)
+
+	this.tagService.Delete(request, tag)
+
+	return this.Success(nil)
+}
+
+// all the tags of a space.
+func (this *TagController) List(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	space := this.spaceService.CheckReadableByUuid(request, user, spaceUuid)
+
+	tags := this.tagDao.FindBySpaceUuid(space.Uuid)
+
+	return this.Success(tags)
+}
+
+// tag a matter by tagUuid, or by name which is created if not exist.
+func (this *TagController) Add(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	matterUuid := util.ExtractRequestString(request, "matterUuid")
+	tagUuid := util.ExtractRequestOptionalString(request, "tagUuid", "")
+
+	user := this.checkUser(request)
+	matter := this.matterDao.CheckByUuid(matterUuid)
+	space := this.spaceService.CheckWritableByUuid(request, user, matter.SpaceUuid)
+
+	var tag *Tag
+	if tagUuid != "" {
+		tag = this.tagDao.CheckByUuid(tagUuid)
+	} else {
+		name := util.ExtractRequestString(request, "name")
+		tag = this.tagService.FindOrCreate(request, name, user, space)
+	}
+
+	this.tagService.AddToMatter(request, matter, tag)
+
+	return this.Success(tag)
+}
+
+func (this *TagController) Remove(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	matterUuid := util.ExtractRequestString(request, "matterUuid")
+	tagUuid := util.ExtractRequestString(request, "tagUuid")
+
+	user := this.checkUser(request)
+	matter := this.matterDao.CheckByUuid(matterUuid)
+	this.spaceService.CheckWritableByUuid(request, user, matter.SpaceUuid)
+	tag := this.tagDao.CheckByUuid(tagUuid)
+
+	this.tagService.RemoveFromMatter(request, matter, tag)
+
+	return this.Success(nil)
+}
+
+// the tags of a matter.
+func (this *TagController) MatterList(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	matterUuid := util.ExtractRequestString(request, "matterUuid")
+
+	user := this.checkUser(request)
+	matter := this.matterDao.CheckByUuid(matterUuid)
+	this.spaceService.CheckReadableByUuid(request, user, matter.SpaceUuid)
+
+	tags := this.tagDao.FindByMatterUuid(matter.Uuid)
+
+	return this.Success(tags)
+}
@@ -0,0 +1,108 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"time"
+)
+
+type TagDao struct {
+	BaseDao
+}
+
+// find by uuid. if not found return nil.
+func (this *TagDao) FindByUuid(uuid string) *Tag {
+	var entity = &Tag{}
+	db := core.CONTEXT.GetDB().Where("uuid = ?", uuid).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+// find by uuid. if not found panic NotFound error
+func (this *TagDao) CheckByUuid(uuid string) *Tag {
+	entity := this.FindByUuid(uuid)
+	if entity == nil {
+		panic(result.NotFound("not found record with uuid = %s", uuid))
+	}
+	return entity
+}
+
+// find by spaceUuid and name. if not found return nil.
+func (this *TagDao) FindBySpaceUuidAndName(spaceUuid string, name string) *Tag {
+	var entity = &Tag{}
+	db := core.CONTEXT.GetDB().Where("space_uuid = ? AND name = ?", spaceUuid, name).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+// all the tags of a space, ordered by name.
+func (this *TagDao) FindBySpaceUuid(spaceUuid string) []*Tag {
+	var tags []*Tag
+	db := core.CONTEXT.GetDB().Where("space_uuid = ?", spaceUuid).Order("name ASC").Find(&tags)
+	this.PanicError(db.Error)
+	return tags
+}
+
+// the tags of a matter, ordered by name.
+func (this *TagDao) FindByMatterUuid(matterUuid string) []*Tag {
+	var tags []*Tag
+	db := core.CONTEXT.GetDB().
+		Where("uuid IN (?)", core.CONTEXT.GetDB().Model(&MatterTag{}).Select("tag_uuid").Where("matter_uuid = ?", matterUuid)).
+		Order("name ASC").
+		Find(&tags)
+	this.PanicError(db.Error)
+	return tags
+}
+
+func (this *TagDao) Create(tag *Tag) *Tag {
+
+	timeUUID, _ := uuid.NewV4()
+	tag.Uuid = string(timeUUID.String())
+	tag.CreateTime = time.Now()
+	tag.UpdateTime = time.Now()
+	tag.Sort = time.Now().UnixNano() / 1e6
+	db := core.CONTEXT.GetDB().Create(tag)
+	this.PanicError(db.Error)
+
+	return tag
+}
+
+func (this *TagDao) Save(tag *Tag) *Tag {
+
+	tag.UpdateTime = time.Now()
+	db := core.CONTEXT.GetDB().Save(tag)
+	this.PanicError(db.Error)
+
+	return tag
+}
+
+func (this *TagDao) Delete(tag *Tag) {
+
+	db := core.CONTEXT.GetDB().Delete(&tag)
+	this.PanicError(db.Error)
+}
+
+func (this *TagDao) DeleteBySpaceUuid(spaceUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("space_uuid = ?", spaceUuid).Delete(Tag{})
+	this.PanicError(db.Error)
+}
+
+func (this *TagDao) Cleanup() {
+	this.logger.Info("[TagDao] clean up. Delete all Tag")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(Tag{})
+	this.PanicError(db.Error)
+}
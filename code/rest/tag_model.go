@@ -0,0 +1,25 @@
+package rest
+
+import (
+	"time"
+)
+
+const (
+	TAG_NAME_MAX_LENGTH = 45
+	//max tags of a matter.
+	TAG_MAX_NUM_PER_MATTER = 50
+)
+
+/**
+ * a tag of a space. matters in the space are linked to it through MatterTag.
+ */
+type Tag struct {
+	Uuid       string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort       int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	SpaceUuid  string    `json:"spaceUuid" gorm:"type:char(36) not null;uniqueIndex:idx_tag_sn"`
+	UserUuid   string    `json:"userUuid" gorm:"type:char(36) not null"`
+	Name       string    `json:"name" gorm:"type:varchar(45) not null;uniqueIndex:idx_tag_sn"`
+	Color      string    `json:"color" gorm:"type:varchar(45) not null;default:''"`
+}
@@ -0,0 +1,184 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"net/http"
+	"strings"
+)
+
+// @Service
+type TagService struct {
+	BaseBean
+	tagDao        *TagDao
+	matterTagDao  *MatterTagDao
+	matterDao     *MatterDao
+	searchService *SearchService
+}
+
+func (this *TagService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.tagDao)
+	if b, ok := b.(*TagDao); ok {
+		this.tagDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterTagDao)
+	if b, ok := b.(*MatterTagDao); ok {
+		this.matterTagDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.searchService)
+	if b, ok := b.(*SearchService); ok {
+		this.searchService = b
+	}
+}
+
+// check the tag name. return the trimmed name.
+func (this *TagService) checkName(request *http.Request, name string) string {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		panic(result.BadRequest("tag name cannot be blank."))
+	}
+	if len([]rune(name)) > TAG_NAME_MAX_LENGTH {
+		panic(result.BadRequest("tag name cannot exceed %d characters.", TAG_NAME_MAX_LENGTH))
+	}
+	if strings.Contains(name, ",") {
+		panic(result.BadRequest("tag name cannot contain ','."))
+	}
+	return name
+}
+
+func (this *TagService) Create(request *http.Request, name string, color string, user *User, space *Space) *Tag {
+
+	name = this.checkName(request, name)
+	if this.tagDao.FindBySpaceUuidAndName(space.Uuid, name) != nil {
+		panic(result.BadRequest("tag %s already exists.", name))
+	}
+
+	tag := &Tag{
+		SpaceUuid: space.Uuid,
+		UserUuid:  user.Uuid,
+		Name:      name,
+		Color:     color,
+	}
+	return this.tagDao.Create(tag)
+}
+
+// find a tag by name. create it if not exist.
+func (this *TagService) FindOrCreate(request *http.Request, name string, user *User, space *Space) *Tag {
+
+	tag := this.tagDao.FindBySpaceUuidAndName(space.Uuid, this.checkName(request, name))
+	if tag != nil {
+		return tag
+	}
+	return this.Create(request, name, "", user, space)
+}
+
+func (this *TagService) Edit(request *http.Request, tag *Tag, name string, color string) *Tag {
+
+	name = this.checkName(request, name)
+	if name != tag.Name {
+		if this.tagDao.FindBySpaceUuidAndName(tag.SpaceUuid, name) != nil {
+			panic(result.BadRequest("tag %s already exists.", name))
+		}
+		tag.Name = name
+	}
+	tag.Color = color
+	tag = this.tagDao.Save(tag)
+
+	this.indexTagMatters(tag)
+
+	return tag
+}
+
+// delete a tag and its links.
+func (this *TagService) Delete(request *http.Request, tag *Tag) {
+
+	matterTags := this.matterTagDao.FindByTagUuid(tag.Uuid)
+	this.matterTagDao.DeleteByTagUuid(tag.Uuid)
+	this.tagDao.Delete(tag)
+
+	for _, matterTag := range matterTags {
+		this.indexMatterTags(matterTag.MatterUuid)
+	}
+}
+
+// tag a matter. nothing happens if tagged already.
+func (this *TagService) AddToMatter(request *http.Request, matter *Matter, tag *Tag) {
+
+	if matter.SpaceUuid != tag.SpaceUuid {
+		panic(result.BadRequest("tag's space not the same"))
+	}
+	if this.matterTagDao.FindByMatterUuidAndTagUuid(matter.Uuid, tag.Uuid) != nil {
+		return
+	}
+	if this.matterTagDao.CountByMatterUuid(matter.Uuid) >= TAG_MAX_NUM_PER_MATTER {
+		panic(result.BadRequest("a matter can have %d tags at most.", TAG_MAX_NUM_PER_MATTER))
+	}
+
+	this.matterTagDao.Create(&MatterTag{
+		SpaceUuid:  matter.SpaceUuid,
+		TagUuid:    tag.Uuid,
+		MatterUuid: matter.Uuid,
+	})
+
+	this.indexMatterTags(matter.Uuid)
+}
+
+func (this *TagService) RemoveFromMatter(request *http.Request, matter *Matter, tag *Tag) {
+
+	matterTag := this.matterTagDao.FindByMatterUuidAndTagUuid(matter.Uuid, tag.Uuid)
+	if matterTag == nil {
+		return
+	}
+	this.matterTagDao.Delete(matterTag)
+
+	this.indexMatterTags(matter.Uuid)
+}
+
+// the copy of a matter has the same tags.
+func (this *TagService) CopyTags(srcMatter *Matter, destMatter *Matter) {
+
+	matterTags := this.matterTagDao.FindByMatterUuid(srcMatter.Uuid)
+	if len(matterTags) == 0 {
+		return
+	}
+	for _, matterTag := range matterTags {
+		if this.matterTagDao.FindByMatterUuidAndTagUuid(destMatter.Uuid, matterTag.TagUuid) == nil {
+			this.matterTagDao.Create(&MatterTag{
+				SpaceUuid:  destMatter.SpaceUuid,
+				TagUuid:    matterTag.TagUuid,
+				MatterUuid: destMatter.Uuid,
+			})
+		}
+	}
+
+	this.indexMatterTags(destMatter.Uuid)
+}
+
+func (this *TagService) indexMatterTags(matterUuid string) {
+
+	matter := this.matterDao.FindByUuid(matterUuid)
+	if matter == nil {
+		return
+	}
+
+	var names []string
+	for _, tag := range this.tagDao.FindByMatterUuid(matterUuid) {
+		names = append(names, tag.Name)
+	}
+	this.searchService.IndexTags(matter, names)
+}
+
+func (this *TagService) indexTagMatters(tag *Tag) {
+	for _, matterTag := range this.matterTagDao.FindByTagUuid(tag.Uuid) {
+		this.indexMatterTags(matterTag.MatterUuid)
+	}
+}
@@ -11,12 +11,15 @@ import (
 // @Service
 type TaskService struct {
 	BaseBean
-	footprintService  *FootprintService
-	dashboardService  *DashboardService
-	preferenceService *PreferenceService
-	matterService     *MatterService
-	userDao           *UserDao
-	spaceDao          *SpaceDao
+	footprintService     *FootprintService
+	dashboardService     *DashboardService
+	preferenceService    *PreferenceService
+	matterService        *MatterService
+	uploadSessionService *UploadSessionService
+	matterVersionService *MatterVersionService
+	davLockService       *DavLockService
+	userDao              *UserDao
+	spaceDao             *SpaceDao
 
 	//whether scan task is running
 	scanTaskRunning bool
@@ -45,6 +48,19 @@ func (this *TaskService) Init() {
 	if b, ok := b.(*MatterService); ok {
 		this.matterService = b
 	}
+	b = core.CONTEXT.GetBean(this.uploadSessionService)
+	if b, ok := b.(*UploadSessionService); ok {
+		this.uploadSessionService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterVersionService)
+	if b, ok := b.(*MatterVersionService); ok {
+		this.matterVersionService = b
+	}
+	b = core.CONTEXT.GetBean(this.davLockService)
+	if b, ok := b.(*DavLockService); ok {
+		this.davLockService = b
+	}
 	b = core.CONTEXT.GetBean(this.userDao)
 	if b, ok := b.(*UserDao); ok {
 		this.userDao = b
@@ -94,6 +110,30 @@ func (this *TaskService) InitCleanDeletedMattersTask() {
 	this.logger.Info("[cron job] Everyday 01:00 Clean deleted matters.")
 }
 
+// init the clean expired upload sessions task.
+func (this *TaskService) InitCleanUploadSessionsTask() {
+
+	expression := "30 1 * * *"
+	cronJob := cron.New()
+	_, err := cronJob.AddFunc(expression, this.uploadSessionService.CleanExpiredSessions)
+	core.PanicError(err)
+	cronJob.Start()
+
+	this.logger.Info("[cron job] Everyday 01:30 Clean expired upload sessions.")
+}
+
+// init the clean expired webdav locks task.
+func (this *TaskService) InitCleanDavLocksTask() {
+
+	expression := "*/10 * * * *"
+	cronJob := cron.New()
+	_, err := cronJob.AddFunc(expression, this.davLockService.CleanExpiredLocks)
+	core.PanicError(err)
+	cronJob.Start()
+
+	this.logger.Info("[cron job] Every 10 minutes clean expired webdav locks.")
+}
+
 // scan task.
 func (this *TaskService) doScanTask() {
 
@@ -199,6 +239,18 @@ func (this *TaskService) InitScanTask() {
 	this.logger.Info("[cron job] %s do scan task.", scanConfig.Cron)
 }
 
+// clean expired versions
+func (this *TaskService) InitCleanVersionsTask() {
+
+	expression := "40 1 * * *"
+	cronJob := cron.New()
+	_, err := cronJob.AddFunc(expression, this.matterVersionService.CleanExpiredVersions)
+	core.PanicError(err)
+	cronJob.Start()
+
+	this.logger.Info("[cron job] Everyday 01:40 Clean expired matter versions.")
+}
+
 func (this *TaskService) Bootstrap() {
 
 	//load the clean footprint task.
@@ -210,6 +262,15 @@ func (this *TaskService) Bootstrap() {
 	//load the clean deleted matters task.
 	this.InitCleanDeletedMattersTask()
 
+	//load the clean expired upload sessions task.
+	this.InitCleanUploadSessionsTask()
+
+	//load the clean expired webdav locks task.
+	this.InitCleanDavLocksTask()
+
+	//load the clean expired versions task.
+	this.InitCleanVersionsTask()
+
 	//load the scan task.
 	this.InitScanTask()
 
@@ -0,0 +1,106 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"net/http"
+	"strings"
+)
+
+type TrashController struct {
+	BaseController
+	matterDao    *MatterDao
+	trashService *TrashService
+}
+
+func (this *TrashController) Init() {
+	this.BaseController.Init()
+
+	b := core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.trashService)
+	if b, ok := b.(*TrashService); ok {
+		this.trashService = b
+	}
+}
+
+func (this *TrashController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
+
+	routeMap := make(map[string]func(writer http.ResponseWriter, request *http.Request))
+
+	routeMap["/api/trash/page"] = this.Wrap(this.Page, USER_ROLE_USER)
+	routeMap["/api/trash/restore"] = this.Wrap(this.Restore, USER_ROLE_USER)
+	routeMap["/api/trash/empty"] = this.Wrap(this.Empty, USER_ROLE_USER)
+
+	return routeMap
+}
+
+// the trash of a space. Path of each matter is its original path.
+func (this *TrashController) Page(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	page := util.ExtractRequestOptionalInt(request, "page", 0)
+	pageSize := util.ExtractRequestOptionalInt(request, "pageSize", 200)
+	name := util.ExtractRequestOptionalString(request, "name", "")
+	orderDeleteTime := util.ExtractRequestOptionalString(request, "orderDeleteTime", DIRECTION_DESC)
+	orderSize := util.ExtractRequestOptionalString(request, "orderSize", "")
+
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	space := this.spaceService.CheckReadableByUuid(request, user, spaceUuid)
+
+	pager := this.trashService.Page(request, page, pageSize, name, orderDeleteTime, orderSize, space)
+
+	return this.Success(pager)
+}
+
+// restore matters to their original directories or to destUuid.
+func (this *TrashController) Restore(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	uuids := util.ExtractRequestString(request, "uuids")
+	destUuid := util.ExtractRequestOptionalString(request, "destUuid", "")
+	conflict := util.ExtractRequestOptionalString(request, "conflict", TRASH_CONFLICT_RENAME)
+	conflict = this.trashService.CheckConflict(request, conflict)
+
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	space := this.spaceService.CheckWritableByUuid(request, user, spaceUuid)
+
+	var destDirMatter *Matter
+	if destUuid != "" {
+		destDirMatter = this.matterDao.CheckWithRootByUuid(destUuid, space)
+	}
+
+	restores := make([]*TrashRestore, 0)
+	for _, uuid := range strings.Split(uuids, ",") {
+
+		matter := this.matterDao.FindByUuid(uuid)
+		if matter == nil {
+			this.logger.Warn("%s not exist anymore", uuid)
+			continue
+		}
+
+		if matter.SpaceUuid != space.Uuid {
+			panic(result.UNAUTHORIZED)
+		}
+
+		restores = append(restores, this.trashService.AtomicRestore(request, matter, destDirMatter, conflict, user, space))
+	}
+
+	return this.Success(restores)
+}
+
+// delete all the matters in the trash.
+func (this *TrashController) Empty(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	space := this.spaceService.CheckWritableByUuid(request, user, spaceUuid)
+
+	this.trashService.AtomicEmpty(request, user, space)
+
+	return this.Success("OK")
+}
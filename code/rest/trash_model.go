@@ -0,0 +1,23 @@
+package rest
+
+const (
+	//keep both. the restored one is renamed like "a (1).txt".
+	TRASH_CONFLICT_RENAME = "RENAME"
+	//leave the restored one in the trash.
+	TRASH_CONFLICT_SKIP = "SKIP"
+	//delete the existing one.
+	TRASH_CONFLICT_OVERWRITE = "OVERWRITE"
+
+	TRASH_RESTORE_RESTORED    = "RESTORED"
+	TRASH_RESTORE_RENAMED     = "RENAMED"
+	TRASH_RESTORE_OVERWRITTEN = "OVERWRITTEN"
+	TRASH_RESTORE_SKIPPED     = "SKIPPED"
+)
+
+/**
+ * result of restoring a matter from the trash.
+ */
+type TrashRestore struct {
+	Matter *Matter `json:"matter"`
+	Status string  `json:"status"`
+}
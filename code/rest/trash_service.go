@@ -0,0 +1,307 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/i18n"
+	"github.com/eyebluecn/tank/code/tool/lock"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"net/http"
+	"path"
+	"strings"
+)
+
+/**
+ * trash is made of the soft deleted matters. they stay where they were, so Path is the original path.
+ */
+//@Service
+type TrashService struct {
+	BaseBean
+	matterDao      *MatterDao
+	matterService  *MatterService
+	lockService    *LockService
+	davLockService *DavLockService
+}
+
+func (this *TrashService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterService)
+	if b, ok := b.(*MatterService); ok {
+		this.matterService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.lockService)
+	if b, ok := b.(*LockService); ok {
+		this.lockService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.davLockService)
+	if b, ok := b.(*DavLockService); ok {
+		this.davLockService = b
+	}
+}
+
+// page the trash of a space.
+func (this *TrashService) Page(request *http.Request, page int, pageSize int, name string, orderDeleteTime string, orderSize string, space *Space) *Pager {
+
+	sortArray := []builder.OrderPair{
+		{
+			Key:   "delete_time",
+			Value: orderDeleteTime,
+		},
+		{
+			Key:   "size",
+			Value: orderSize,
+		},
+	}
+
+	return this.matterDao.Page(page, pageSize, "", "", space.Uuid, name, "", TRUE, nil, "", sortArray)
+}
+
+func (this *TrashService) CheckConflict(request *http.Request, conflict string) string {
+	if conflict != TRASH_CONFLICT_RENAME && conflict != TRASH_CONFLICT_SKIP && conflict != TRASH_CONFLICT_OVERWRITE {
+		panic(result.BadRequest("conflict must be one of %s, %s, %s.", TRASH_CONFLICT_RENAME, TRASH_CONFLICT_SKIP, TRASH_CONFLICT_OVERWRITE))
+	}
+	return conflict
+}
+
+// restore a matter from the trash. destDirMatter nil means the original directory.
+func (this *TrashService) AtomicRestore(request *http.Request, matter *Matter, destDirMatter *Matter, conflict string, user *User, space *Space) *TrashRestore {
+
+	if matter == nil {
+		panic(result.BadRequest("matter cannot be nil"))
+	}
+
+	//the conflicts are resolved among the siblings, so lock the whole destination directory.
+	destPath := path.Dir(matter.Path)
+	if destDirMatter != nil {
+		destPath = destDirMatter.Path
+	}
+	requests := []lock.Request{lock.Write(space.Uuid, matter.Path), lock.Write(space.Uuid, destPath)}
+
+	//the ancestors in the trash or missing are rebuilt, so lock them as well.
+	var rebuiltPaths []string
+	if destDirMatter == nil {
+		rebuiltPaths = this.rebuiltPaths(matter)
+		for _, rebuiltPath := range rebuiltPaths {
+			requests = append(requests, lock.Write(space.Uuid, rebuiltPath))
+		}
+	}
+	locks := this.lockService.Lock(request, user, "restore", requests...)
+	defer this.lockService.Unlock(locks)
+
+	//the matter or its ancestors may have been changed before locked.
+	latest := this.matterDao.CheckByUuid(matter.Uuid)
+	changed := latest.Path != matter.Path
+	if destDirMatter == nil && strings.Join(this.rebuiltPaths(latest), "\n") != strings.Join(rebuiltPaths, "\n") {
+		changed = true
+	}
+	if changed {
+		panic(result.CustomWebResult(result.CONFLICT, fmt.Sprintf("%s has been changed, retry later", matter.Path)))
+	}
+	matter = latest
+
+	return this.restore(request, matter, destDirMatter, conflict, user, space)
+}
+
+func (this *TrashService) restore(request *http.Request, matter *Matter, destDirMatter *Matter, conflict string, user *User, space *Space) *TrashRestore {
+
+	if !matter.Deleted {
+		panic(result.BadRequest("matter has not been deleted"))
+	}
+
+	if destDirMatter == nil {
+		destDirMatter = this.restoreParent(request, matter, user, space)
+	} else {
+		if !destDirMatter.Dir {
+			panic(result.BadRequestI18n(request, i18n.MatterDestinationMustDirectory))
+		}
+		if destDirMatter.SpaceUuid != space.Uuid {
+			panic(result.BadRequest("destination's space not the same"))
+		}
+		if this.InTrash(destDirMatter) {
+			panic(result.BadRequest("destination is in the trash"))
+		}
+		if matter.Dir && strings.HasPrefix(destDirMatter.Path+"/", matter.Path+"/") {
+			panic(result.BadRequestI18n(request, i18n.MatterMoveRecursive))
+		}
+	}
+
+	status := TRASH_RESTORE_RESTORED
+	name := matter.Name
+	aliveMatter := this.matterDao.FindBySpaceUuidAndPuuidAndNameAndDeletedFalse(space.Uuid, destDirMatter.Uuid, name)
+	if aliveMatter != nil {
+		if conflict == TRASH_CONFLICT_SKIP {
+			return &TrashRestore{Matter: matter, Status: TRASH_RESTORE_SKIPPED}
+		} else if conflict == TRASH_CONFLICT_OVERWRITE {
+			this.logger.Info("restore %s overwrites %s", matter.Path, aliveMatter.Path)
+			this.davLockService.CheckUnlocked(request, space, aliveMatter.Path, true)
+			if !matter.Dir && !aliveMatter.Dir {
+				//the content is replaced, so that the overwritten one is kept as a version.
+				this.matterService.moveOnto(request, matter, aliveMatter, user, space)
+				return &TrashRestore{Matter: this.matterDao.CheckByUuid(aliveMatter.Uuid), Status: TRASH_RESTORE_OVERWRITTEN}
+			}
+			this.matterService.Delete(request, aliveMatter, user, space)
+			status = TRASH_RESTORE_OVERWRITTEN
+		} else {
+			name = this.freeName(name, matter.Dir, space, matter.Puuid, destDirMatter.Uuid)
+			status = TRASH_RESTORE_RENAMED
+		}
+	} else if matter.Puuid != destDirMatter.Uuid && this.usedName(name, space, destDirMatter.Uuid) {
+		//another matter in the trash takes the name.
+		name = this.freeName(name, matter.Dir, space, matter.Puuid, destDirMatter.Uuid)
+		status = TRASH_RESTORE_RENAMED
+	}
+
+	if name != matter.Name {
+		this.matterService.rename(request, matter, name, user, space)
+	}
+	if matter.Puuid != destDirMatter.Uuid {
+		this.matterService.move(request, matter, destDirMatter, user, space)
+	}
+
+	this.matterDao.Recovery(matter)
+	matter.Deleted = false
+
+	return &TrashRestore{Matter: matter, Status: status}
+}
+
+// make sure the parent of a matter is alive. parents in the trash are restored without their other children, and missing ones are created again.
+func (this *TrashService) restoreParent(request *http.Request, matter *Matter, user *User, space *Space) *Matter {
+
+	if matter.Puuid == MATTER_ROOT {
+		return NewRootMatter(space)
+	}
+
+	parent := this.matterDao.FindByUuid(matter.Puuid)
+	if parent == nil {
+		this.logger.Info("parent of %s has gone, create it again.", matter.Path)
+		return this.matterService.CreateDirectories(request, user, space, util.GetDirOfPath(matter.Path))
+	}
+
+	grandParent := this.restoreParent(request, parent, user, space)
+
+	//the parent may be changed when restoring its own parent.
+	parent = this.matterDao.CheckByUuid(parent.Uuid)
+	if parent.Deleted {
+		//the other children stay in the trash, with the time the parent was deleted.
+		this.matterDao.SoftDeleteByPuuid(parent.Uuid, parent.DeleteTime)
+		this.matterDao.Recovery(parent)
+		parent.Deleted = false
+	}
+	if parent.Puuid != grandParent.Uuid {
+		this.matterService.move(request, parent, grandParent, user, space)
+	}
+
+	return parent
+}
+
+// paths of the ancestors which are in the trash or missing. they are rebuilt when the matter is restored to its original directory.
+func (this *TrashService) rebuiltPaths(matter *Matter) []string {
+	var paths []string
+	for matter.Puuid != MATTER_ROOT {
+		parent := this.matterDao.FindByUuid(matter.Puuid)
+		if parent == nil {
+			return append(paths, util.GetDirOfPath(matter.Path))
+		}
+		if parent.Deleted {
+			paths = append(paths, parent.Path)
+		}
+		matter = parent
+	}
+	return paths
+}
+
+// whether the matter or one of its ancestors is in the trash.
+func (this *TrashService) InTrash(matter *Matter) bool {
+	for matter != nil && matter.Uuid != MATTER_ROOT {
+		if matter.Deleted {
+			return true
+		}
+		matter = this.matterDao.FindByUuid(matter.Puuid)
+	}
+	return false
+}
+
+// whether the name is used in the directory, including the matters in the trash.
+func (this *TrashService) usedName(name string, space *Space, puuid string) bool {
+	return this.matterDao.FindBySpaceNameAndPuuidAndDirAndName(space.Name, puuid, "", name) != nil
+}
+
+// find a name like "a (1).txt" which is not used in all the directories.
+func (this *TrashService) freeName(name string, dir bool, space *Space, puuids ...string) string {
+
+	ext := ""
+	if !dir {
+		ext = path.Ext(name)
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		used := false
+		for _, puuid := range puuids {
+			if this.usedName(candidate, space, puuid) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			return candidate
+		}
+	}
+}
+
+// delete the earliest matters in the trash until its size is under the limit of the space.
+func (this *TrashService) CheckSizeLimit(request *http.Request, user *User, space *Space) {
+
+	if space.TrashSizeLimit < 0 {
+		return
+	}
+
+	for this.matterDao.SumTrashSizeBySpaceUuid(space.Uuid) > space.TrashSizeLimit {
+		matter := this.matterDao.FindEarliestTrashBySpaceUuid(space.Uuid)
+		if matter == nil {
+			return
+		}
+		this.deleteEarliest(request, matter, user, space)
+	}
+}
+
+// delete a matter in the trash under the lock of its path. skip it if it has been restored or moved meanwhile.
+func (this *TrashService) deleteEarliest(request *http.Request, matter *Matter, user *User, space *Space) {
+
+	locks := this.lockService.Lock(request, user, "trash limit", lock.Write(space.Uuid, matter.Path))
+	defer this.lockService.Unlock(locks)
+
+	latest := this.matterDao.FindByUuid(matter.Uuid)
+	if latest == nil || !latest.Deleted || latest.Path != matter.Path {
+		return
+	}
+
+	this.logger.Info("trash of %s exceeds %s, delete %s", space.Name, util.HumanFileSize(space.TrashSizeLimit), latest.Path)
+	this.matterService.Delete(request, latest, user, space)
+}
+
+// delete all the matters in the trash of a space.
+func (this *TrashService) AtomicEmpty(request *http.Request, user *User, space *Space) {
+
+	locks := this.lockService.Lock(request, user, "empty trash", lock.Write(space.Uuid, ""))
+	defer this.lockService.Unlock(locks)
+
+	for {
+		matter := this.matterDao.FindEarliestTrashBySpaceUuid(space.Uuid)
+		if matter == nil {
+			return
+		}
+		this.matterService.Delete(request, matter, user, space)
+	}
+}
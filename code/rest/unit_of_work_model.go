@@ -0,0 +1,73 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/journal"
+	"gorm.io/gorm"
+	"os"
+	"time"
+)
+
+const (
+	//directory of the filesystem journal. see USERNAME_PATTERN for the reserved directories.
+	WORK_JOURNAL = "work-journal"
+)
+
+/**
+ * mark of a committed unit of work. it is written in the same transaction as the work,
+ * so after a crash the filesystem actions of the work are replayed if it exists, otherwise rolled back.
+ */
+type WorkCommit struct {
+	Uuid       string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort       int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+}
+
+/**
+ * a db transaction together with the filesystem actions done in it.
+ * only DB can be used for db operations inside a work, and the filesystem actions go through Rename and MakeDir.
+ */
+type UnitOfWork struct {
+	Uuid    string
+	DB      *gorm.DB
+	journal *journal.Journal
+	actions []*journal.Action
+	//invoked after the commit, for the rebuildable data like search index, cache and size.
+	afterCommits []func()
+}
+
+// move a file or directory on disk. it is moved back if the work fails.
+func (this *UnitOfWork) Rename(src string, dest string) {
+	this.apply(&journal.Action{Op: journal.OP_RENAME, Src: src, Dest: dest})
+}
+
+// create a directory on disk if not exist. it is removed if the work fails.
+func (this *UnitOfWork) MakeDir(dir string) {
+	if _, err := os.Stat(dir); err == nil {
+		return
+	}
+	this.apply(&journal.Action{Op: journal.OP_MKDIR, Dest: dir})
+}
+
+func (this *UnitOfWork) AfterCommit(fn func()) {
+	this.afterCommits = append(this.afterCommits, fn)
+}
+
+func (this *UnitOfWork) apply(action *journal.Action) {
+	err := this.journal.Log(this.Uuid, action)
+	core.PanicError(err)
+
+	this.actions = append(this.actions, action)
+
+	err = journal.Apply(action)
+	if err != nil {
+		panic(fmt.Errorf("%s %s -> %s error. %s", action.Op, action.Src, action.Dest, err.Error()))
+	}
+}
+
+// get the journal file's absolute path
+func GetWorkJournalPath() string {
+	return fmt.Sprintf("%s/%s/journal.log", core.CONFIG.MatterPath(), WORK_JOURNAL)
+}
@@ -0,0 +1,133 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/journal"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"sync"
+)
+
+/**
+ * run the multi-step matter operations as units of work, so that the db and the disk never go out of sync.
+ */
+//@Service
+type UnitOfWorkService struct {
+	BaseBean
+	workCommitDao *WorkCommitDao
+
+	mutex   sync.Mutex
+	journal *journal.Journal
+}
+
+func (this *UnitOfWorkService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.workCommitDao)
+	if b, ok := b.(*WorkCommitDao); ok {
+		this.workCommitDao = b
+	}
+}
+
+// recover the works interrupted by the last crash.
+func (this *UnitOfWorkService) Bootstrap() {
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.journal != nil {
+		return
+	}
+
+	var err error
+	this.journal, err = journal.Open(GetWorkJournalPath())
+	core.PanicError(err)
+
+	works, actions, err := this.journal.Pending()
+	core.PanicError(err)
+
+	for _, work := range works {
+		workActions := actions[work]
+		if this.workCommitDao.FindByUuid(work) != nil {
+			this.logger.Info("replay the committed work %s with %d actions", work, len(workActions))
+			for _, action := range workActions {
+				err := journal.Apply(action)
+				if err != nil {
+					this.logger.Error("replay %s %s -> %s error. %s", action.Op, action.Src, action.Dest, err.Error())
+				}
+			}
+		} else {
+			this.logger.Info("roll back the uncommitted work %s with %d actions", work, len(workActions))
+			this.undo(workActions)
+		}
+	}
+
+	//all the works have finished.
+	this.workCommitDao.Cleanup()
+	err = this.journal.Reset()
+	core.PanicError(err)
+}
+
+// run fn in a unit of work. if fn panics or the commit fails, the transaction is rolled back
+// and the filesystem actions are undone, then the panic goes on.
+func (this *UnitOfWorkService) Run(fn func(work *UnitOfWork)) {
+
+	timeUUID, _ := uuid.NewV4()
+	work := &UnitOfWork{
+		Uuid:    string(timeUUID.String()),
+		journal: this.journal,
+	}
+
+	err := this.journal.Begin(work.Uuid)
+	core.PanicError(err)
+
+	work.DB = core.CONTEXT.GetDB().Begin()
+	if work.DB.Error != nil {
+		this.end(work)
+		panic(work.DB.Error)
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			work.DB.Rollback()
+			this.undo(work.actions)
+			this.end(work)
+		}
+	}()
+
+	fn(work)
+
+	this.workCommitDao.CreateTx(work.DB, work.Uuid)
+	err = work.DB.Commit().Error
+	core.PanicError(err)
+	committed = true
+
+	//the mark is kept if the journal still has the work, so that it is replayed rather than rolled back.
+	if this.end(work) {
+		this.workCommitDao.DeleteByUuid(work.Uuid)
+	}
+
+	for _, afterCommit := range work.afterCommits {
+		afterCommit()
+	}
+}
+
+// undo the actions in reverse order.
+func (this *UnitOfWorkService) undo(actions []*journal.Action) {
+	for i := len(actions) - 1; i >= 0; i-- {
+		action := actions[i]
+		err := journal.Undo(action)
+		if err != nil {
+			this.logger.Error("undo %s %s -> %s error. %s", action.Op, action.Src, action.Dest, err.Error())
+		}
+	}
+}
+
+func (this *UnitOfWorkService) end(work *UnitOfWork) bool {
+	err := this.journal.End(work.Uuid)
+	if err != nil {
+		this.logger.Error("end work %s error. %s", work.Uuid, err.Error())
+		return false
+	}
+	return true
+}
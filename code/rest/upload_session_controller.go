@@ -0,0 +1,174 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"io"
+	"net/http"
+	"strings"
+)
+
+type UploadSessionController struct {
+	BaseController
+	uploadSessionDao     *UploadSessionDao
+	uploadSessionService *UploadSessionService
+	matterDao            *MatterDao
+}
+
+func (this *UploadSessionController) Init() {
+	this.BaseController.Init()
+
+	b := core.CONTEXT.GetBean(this.uploadSessionDao)
+	if b, ok := b.(*UploadSessionDao); ok {
+		this.uploadSessionDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.uploadSessionService)
+	if b, ok := b.(*UploadSessionService); ok {
+		this.uploadSessionService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+}
+
+func (this *UploadSessionController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
+
+	routeMap := make(map[string]func(writer http.ResponseWriter, request *http.Request))
+
+	routeMap["/api/upload/session/init"] = this.Wrap(this.Create, USER_ROLE_USER)
+	routeMap["/api/upload/session/append"] = this.Wrap(this.Append, USER_ROLE_USER)
+	routeMap["/api/upload/session/finish"] = this.Wrap(this.Finish, USER_ROLE_USER)
+	routeMap["/api/upload/session/detail"] = this.Wrap(this.Detail, USER_ROLE_USER)
+	routeMap["/api/upload/session/delete"] = this.Wrap(this.Delete, USER_ROLE_USER)
+	routeMap["/api/upload/session/page"] = this.Wrap(this.Page, USER_ROLE_USER)
+
+	return routeMap
+}
+
+// check the session belongs to current user.
+func (this *UploadSessionController) checkSession(request *http.Request, user *User) *UploadSession {
+
+	uuid := util.ExtractRequestString(request, "uuid")
+	session := this.uploadSessionDao.CheckByUuid(uuid)
+	if session.UserUuid != user.Uuid {
+		panic(result.UNAUTHORIZED)
+	}
+	return session
+}
+
+// init an upload session with the declared size.
+func (this *UploadSessionController) Create(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	puuid := util.ExtractRequestString(request, "puuid")
+	filename := util.ExtractRequestString(request, "filename")
+	size := util.ExtractRequestInt64(request, "size")
+	privacy := util.ExtractRequestOptionalBool(request, "privacy", true)
+
+	user := this.checkUser(request)
+	spaceUuid := util.ExtractRequestOptionalString(request, "spaceUuid", user.SpaceUuid)
+	space := this.spaceService.CheckWritableByUuid(request, user, spaceUuid)
+
+	dirMatter := this.matterDao.CheckWithRootByUuid(puuid, space)
+
+	session := this.uploadSessionService.Create(request, user, space, dirMatter, filename, size, privacy, nil)
+
+	return this.Success(session)
+}
+
+// append a chunk. the chunk can be the raw request body or the "file" field of a multipart form.
+func (this *UploadSessionController) Append(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	user := this.checkUser(request)
+	session := this.checkSession(request, user)
+	offset := util.ExtractRequestInt64(request, "offset")
+	this.spaceService.CheckWritableByUuid(request, user, session.SpaceUuid)
+
+	reader, closeReader := ExtractChunkReader(request)
+	defer closeReader()
+
+	session = this.uploadSessionService.Append(request, session, offset, reader)
+
+	return this.Success(session)
+}
+
+// assemble the chunks to a matter.
+func (this *UploadSessionController) Finish(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	user := this.checkUser(request)
+	session := this.checkSession(request, user)
+	this.spaceService.CheckWritableByUuid(request, user, session.SpaceUuid)
+
+	matter := this.uploadSessionService.Finish(request, session)
+
+	return this.Success(matter)
+}
+
+// get the session. client can resume from session.offset
+func (this *UploadSessionController) Detail(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	user := this.checkUser(request)
+	session := this.checkSession(request, user)
+
+	return this.Success(session)
+}
+
+// cancel an upload session.
+func (this *UploadSessionController) Delete(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	user := this.checkUser(request)
+	session := this.checkSession(request, user)
+
+	this.uploadSessionService.Delete(request, session)
+
+	return this.Success("OK")
+}
+
+// unfinished sessions of current user.
+func (this *UploadSessionController) Page(writer http.ResponseWriter, request *http.Request) *result.WebResult {
+
+	page := util.ExtractRequestOptionalInt(request, "page", 0)
+	pageSize := util.ExtractRequestOptionalInt(request, "pageSize", 200)
+	orderCreateTime := util.ExtractRequestOptionalString(request, "orderCreateTime", "")
+
+	user := this.checkUser(request)
+
+	sortArray := []builder.OrderPair{
+		{
+			Key:   "create_time",
+			Value: orderCreateTime,
+		},
+	}
+
+	pager := this.uploadSessionDao.Page(page, pageSize, user.Uuid, sortArray)
+
+	return this.Success(pager)
+}
+
+// get the chunk reader of an append request.
+func ExtractChunkReader(request *http.Request) (io.Reader, func()) {
+
+	contentType := request.Header.Get("Content-Type")
+
+	//form body has been consumed when parsing params.
+	if strings.HasPrefix(contentType, "application/x-www-form-urlencoded") {
+		panic(result.BadRequest("chunk must be sent as application/octet-stream or multipart/form-data"))
+	}
+
+	if strings.HasPrefix(contentType, "multipart/form-data") {
+		file, _, err := request.FormFile("file")
+		if err != nil {
+			panic(result.BadRequest("file cannot be null"))
+		}
+		return file, func() {
+			err := file.Close()
+			core.PanicError(err)
+		}
+	}
+
+	return request.Body, func() {}
+}
@@ -0,0 +1,151 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/builder"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/uuid"
+	"gorm.io/gorm"
+	"math"
+	"time"
+)
+
+type UploadSessionDao struct {
+	BaseDao
+}
+
+// find by uuid. if not found return nil.
+func (this *UploadSessionDao) FindByUuid(uuid string) *UploadSession {
+	var entity = &UploadSession{}
+	db := core.CONTEXT.GetDB().Where("uuid = ?", uuid).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+// find by uuid. if not found panic NotFound error
+func (this *UploadSessionDao) CheckByUuid(uuid string) *UploadSession {
+	entity := this.FindByUuid(uuid)
+	if entity == nil {
+		panic(result.NotFound("not found record with uuid = %s", uuid))
+	}
+	return entity
+}
+
+// find the session of the upload token which has not expired. if not found return nil.
+func (this *UploadSessionDao) FindAliveByUploadTokenUuid(uploadTokenUuid string, now time.Time) *UploadSession {
+	var entity = &UploadSession{}
+	db := core.CONTEXT.GetDB().Where("upload_token_uuid = ? AND expire_time > ?", uploadTokenUuid, now).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+func (this *UploadSessionDao) PlainPage(page int, pageSize int, userUuid string, expireTimeBefore *time.Time, sortArray []builder.OrderPair) (int, []*UploadSession) {
+
+	var wp = &builder.WherePair{}
+
+	if userUuid != "" {
+		wp = wp.And(&builder.WherePair{Query: "user_uuid = ?", Args: []interface{}{userUuid}})
+	}
+
+	if expireTimeBefore != nil {
+		wp = wp.And(&builder.WherePair{Query: "expire_time < ?", Args: []interface{}{expireTimeBefore}})
+	}
+
+	var conditionDB *gorm.DB
+	conditionDB = core.CONTEXT.GetDB().Model(&UploadSession{}).Where(wp.Query, wp.Args...)
+
+	var count int64 = 0
+	db := conditionDB.Count(&count)
+	this.PanicError(db.Error)
+
+	var sessions []*UploadSession
+	db = conditionDB.Order(this.GetSortString(sortArray)).Offset(page * pageSize).Limit(pageSize).Find(&sessions)
+	this.PanicError(db.Error)
+
+	return int(count), sessions
+}
+
+func (this *UploadSessionDao) Page(page int, pageSize int, userUuid string, sortArray []builder.OrderPair) *Pager {
+
+	count, sessions := this.PlainPage(page, pageSize, userUuid, nil, sortArray)
+	pager := NewPager(page, pageSize, count, sessions)
+
+	return pager
+}
+
+// handle the expired sessions page by page.
+func (this *UploadSessionDao) PageHandleExpired(expireTimeBefore time.Time, fun func(session *UploadSession)) {
+
+	pageSize := 1000
+	sortArray := []builder.OrderPair{
+		{
+			Key:   "uuid",
+			Value: DIRECTION_ASC,
+		},
+	}
+	count, _ := this.PlainPage(0, pageSize, "", &expireTimeBefore, sortArray)
+	if count > 0 {
+		var totalPages = int(math.Ceil(float64(count) / float64(pageSize)))
+		var page int
+		for page = 0; page < totalPages; page++ {
+			//handled sessions are deleted, so always fetch the first page.
+			_, sessions := this.PlainPage(0, pageSize, "", &expireTimeBefore, sortArray)
+			for _, session := range sessions {
+				fun(session)
+			}
+		}
+	}
+}
+
+func (this *UploadSessionDao) Create(session *UploadSession) *UploadSession {
+
+	timeUUID, _ := uuid.NewV4()
+	session.Uuid = string(timeUUID.String())
+	session.CreateTime = time.Now()
+	session.UpdateTime = time.Now()
+	session.Sort = time.Now().UnixNano() / 1e6
+	db := core.CONTEXT.GetDB().Create(session)
+	this.PanicError(db.Error)
+
+	return session
+}
+
+func (this *UploadSessionDao) Save(session *UploadSession) *UploadSession {
+
+	session.UpdateTime = time.Now()
+	db := core.CONTEXT.GetDB().Save(session)
+	this.PanicError(db.Error)
+
+	return session
+}
+
+func (this *UploadSessionDao) Delete(session *UploadSession) {
+
+	db := core.CONTEXT.GetDB().Delete(&session)
+	this.PanicError(db.Error)
+}
+
+func (this *UploadSessionDao) DeleteByUserUuid(userUuid string) {
+
+	db := core.CONTEXT.GetDB().Where("user_uuid = ?", userUuid).Delete(UploadSession{})
+	this.PanicError(db.Error)
+}
+
+// System cleanup.
+func (this *UploadSessionDao) Cleanup() {
+	this.logger.Info("[UploadSessionDao] clean up. Delete all UploadSession")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(UploadSession{})
+	this.PanicError(db.Error)
+}
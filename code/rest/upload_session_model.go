@@ -0,0 +1,36 @@
+package rest
+
+import (
+	"time"
+)
+
+const (
+	//how long an unfinished upload session can be resumed.
+	UPLOAD_SESSION_EXPIRE_HOURS = 24
+)
+
+/**
+ * resumable upload session. chunks are appended to a staging file until the declared size is reached.
+ */
+type UploadSession struct {
+	Uuid            string    `json:"uuid" gorm:"type:char(36);primary_key;unique"`
+	Sort            int64     `json:"sort" gorm:"type:bigint(20) not null"`
+	UpdateTime      time.Time `json:"updateTime" gorm:"type:timestamp not null;default:CURRENT_TIMESTAMP"`
+	CreateTime      time.Time `json:"createTime" gorm:"type:timestamp not null;default:'2018-01-01 00:00:00'"`
+	UserUuid        string    `json:"userUuid" gorm:"type:char(36) not null;index:idx_upload_session_uu"`
+	SpaceUuid       string    `json:"spaceUuid" gorm:"type:char(36) not null"`
+	FolderUuid      string    `json:"folderUuid" gorm:"type:char(36) not null"`
+	UploadTokenUuid string    `json:"uploadTokenUuid" gorm:"type:char(36)"`
+	Filename        string    `json:"filename" gorm:"type:varchar(255) not null"`
+	Privacy         bool      `json:"privacy" gorm:"type:tinyint(1) not null;default:0"`
+	Size            int64     `json:"size" gorm:"type:bigint(20) not null;default:0"`
+	Offset          int64     `json:"offset" gorm:"type:bigint(20) not null;default:0"`
+	ExpireTime      time.Time `json:"expireTime" gorm:"type:timestamp not null;index:idx_upload_session_et;default:'2018-01-01 00:00:00'"`
+	Ip              string    `json:"ip" gorm:"type:varchar(128) not null"`
+	HashState       string    `json:"-" gorm:"type:varchar(512)"`
+}
+
+// get the staging file's absolute path.
+func (this *UploadSession) StagingPath(spaceName string) string {
+	return GetSpaceUploadRootDir(spaceName) + "/" + this.Uuid
+}
@@ -0,0 +1,294 @@
+package rest
+
+import (
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/i18n"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"github.com/eyebluecn/tank/code/tool/util"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// resumable upload service. init -> append -> append ... -> finish
+// @Service
+type UploadSessionService struct {
+	BaseBean
+	uploadSessionDao *UploadSessionDao
+	uploadTokenDao   *UploadTokenDao
+	matterDao        *MatterDao
+	matterService    *MatterService
+	spaceDao         *SpaceDao
+	userDao          *UserDao
+
+	//sessions which are being appended or assembled.
+	busyMap   map[string]bool
+	busyMutex sync.Mutex
+}
+
+func (this *UploadSessionService) Init() {
+	this.BaseBean.Init()
+
+	b := core.CONTEXT.GetBean(this.uploadSessionDao)
+	if b, ok := b.(*UploadSessionDao); ok {
+		this.uploadSessionDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.uploadTokenDao)
+	if b, ok := b.(*UploadTokenDao); ok {
+		this.uploadTokenDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterDao)
+	if b, ok := b.(*MatterDao); ok {
+		this.matterDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.matterService)
+	if b, ok := b.(*MatterService); ok {
+		this.matterService = b
+	}
+
+	b = core.CONTEXT.GetBean(this.spaceDao)
+	if b, ok := b.(*SpaceDao); ok {
+		this.spaceDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.userDao)
+	if b, ok := b.(*UserDao); ok {
+		this.userDao = b
+	}
+
+	this.busyMap = make(map[string]bool)
+}
+
+// mark a session busy. only one request can operate a session at the same time.
+func (this *UploadSessionService) lock(sessionUuid string) {
+	this.busyMutex.Lock()
+	defer this.busyMutex.Unlock()
+
+	if this.busyMap[sessionUuid] {
+		panic(result.CustomWebResult(result.CONFLICT, "upload session is being operating, retry later"))
+	}
+	this.busyMap[sessionUuid] = true
+}
+
+func (this *UploadSessionService) unlock(sessionUuid string) {
+	this.busyMutex.Lock()
+	defer this.busyMutex.Unlock()
+
+	delete(this.busyMap, sessionUuid)
+}
+
+// create an upload session. size limit and total size limit are checked with the declared size.
+func (this *UploadSessionService) Create(request *http.Request, user *User, space *Space, dirMatter *Matter, filename string, size int64, privacy bool, uploadToken *UploadToken) *UploadSession {
+
+	if dirMatter == nil {
+		panic(result.BadRequest("dirMatter cannot be nil."))
+	}
+	if dirMatter.Deleted {
+		panic(result.BadRequest("Dir has been deleted. Cannot upload under it."))
+	}
+	if size < 0 {
+		panic(result.BadRequest("file size error"))
+	}
+
+	filename = CheckMatterName(request, filename)
+
+	//an upload token uploads one file. its unfinished session is to be resumed rather than created again.
+	if uploadToken != nil {
+		this.lock(uploadToken.Uuid)
+		defer this.unlock(uploadToken.Uuid)
+
+		if session := this.uploadSessionDao.FindAliveByUploadTokenUuid(uploadToken.Uuid, time.Now()); session != nil {
+			panic(result.CustomWebResult(result.CONFLICT, fmt.Sprintf("upload session %s of the uploadToken is unfinished", session.Uuid)))
+		}
+	}
+
+	//check the size limit.
+	if space.SizeLimit >= 0 {
+		if size > space.SizeLimit {
+			panic(result.BadRequestI18n(request, i18n.MatterSizeExceedLimit, util.HumanFileSize(size), util.HumanFileSize(space.SizeLimit)))
+		}
+	}
+
+	//check total size.
+	if space.TotalSizeLimit >= 0 {
+		if space.TotalSize+size > space.TotalSizeLimit {
+			panic(result.BadRequestI18n(request, i18n.MatterSizeExceedTotalLimit, util.HumanFileSize(space.TotalSize), util.HumanFileSize(space.TotalSizeLimit)))
+		}
+	}
+
+	dbMatter := this.matterDao.FindBySpaceUuidAndPuuidAndDirAndName(space.Uuid, dirMatter.Uuid, false, filename)
+	if dbMatter != nil {
+		if dbMatter.Deleted {
+			panic(result.BadRequestI18n(request, i18n.MatterRecycleBinExist, filename))
+		} else {
+			panic(result.BadRequestI18n(request, i18n.MatterExist, filename))
+		}
+	}
+
+	session := &UploadSession{
+		UserUuid:   user.Uuid,
+		SpaceUuid:  space.Uuid,
+		FolderUuid: dirMatter.Uuid,
+		Filename:   filename,
+		Privacy:    privacy,
+		Size:       size,
+		Offset:     0,
+		ExpireTime: time.Now().Add(UPLOAD_SESSION_EXPIRE_HOURS * time.Hour),
+		Ip:         util.GetIpAddress(request),
+		HashState:  NewBlobHasher().MarshalState(),
+	}
+	if uploadToken != nil {
+		session.UploadTokenUuid = uploadToken.Uuid
+	}
+	session = this.uploadSessionDao.Create(session)
+
+	//create an empty staging file.
+	util.MakeDirAll(GetSpaceUploadRootDir(space.Name))
+	stagingFile, err := os.OpenFile(session.StagingPath(space.Name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+	this.PanicError(err)
+	err = stagingFile.Close()
+	this.PanicError(err)
+
+	this.logger.Info("create upload session %s for %s %s", session.Uuid, filename, util.HumanFileSize(size))
+
+	return session
+}
+
+// check whether the session is still usable.
+func (this *UploadSessionService) CheckAlive(session *UploadSession) {
+	if session.ExpireTime.Before(time.Now()) {
+		panic(result.BadRequest("upload session has expired"))
+	}
+}
+
+// append a chunk at offset. the offset must equal to the bytes already received.
+// if the connection drops, the bytes received are kept, and the client can resume from the new offset.
+func (this *UploadSessionService) Append(request *http.Request, session *UploadSession, offset int64, reader io.Reader) *UploadSession {
+
+	this.CheckAlive(session)
+
+	this.lock(session.Uuid)
+	defer this.unlock(session.Uuid)
+
+	//reload in case of concurrent modification.
+	session = this.uploadSessionDao.CheckByUuid(session.Uuid)
+	if offset != session.Offset {
+		panic(result.CustomWebResult(result.CONFLICT, fmt.Sprintf("offset mismatch. expect %d but got %d", session.Offset, offset)))
+	}
+
+	space := this.spaceDao.CheckByUuid(session.SpaceUuid)
+	stagingPath := session.StagingPath(space.Name)
+
+	stagingFile, err := os.OpenFile(stagingPath, os.O_WRONLY, 0777)
+	if err != nil {
+		panic(result.BadRequest("upload session's staging file lost, please init again"))
+	}
+	defer func() {
+		e := stagingFile.Close()
+		this.PanicError(e)
+	}()
+
+	//drop the bytes after the offset. they may come from a broken append.
+	err = stagingFile.Truncate(session.Offset)
+	this.PanicError(err)
+	_, err = stagingFile.Seek(session.Offset, io.SeekStart)
+	this.PanicError(err)
+
+	//continue hashing from the received bytes.
+	hasher := RestoreBlobHasher(session.HashState)
+
+	//read one more byte to detect overflow.
+	remaining := session.Size - session.Offset
+	written, copyErr := io.Copy(&HashedWriter{Writer: stagingFile, Hasher: hasher}, io.LimitReader(reader, remaining+1))
+	if written > remaining {
+		err = stagingFile.Truncate(session.Offset)
+		this.PanicError(err)
+		panic(result.BadRequest("chunk exceeds the declared size %d", session.Size))
+	}
+
+	session.Offset = session.Offset + written
+	session.HashState = hasher.MarshalState()
+	session = this.uploadSessionDao.Save(session)
+
+	if copyErr != nil {
+		this.logger.Error("append upload session %s broken at %d. %s", session.Uuid, session.Offset, copyErr.Error())
+		this.PanicError(copyErr)
+	}
+
+	return session
+}
+
+// assemble the staging file to a matter.
+func (this *UploadSessionService) Finish(request *http.Request, session *UploadSession) *Matter {
+
+	this.CheckAlive(session)
+
+	this.lock(session.Uuid)
+	defer this.unlock(session.Uuid)
+
+	session = this.uploadSessionDao.CheckByUuid(session.Uuid)
+	if session.Offset != session.Size {
+		panic(result.BadRequest("upload not completed. received %d of %d", session.Offset, session.Size))
+	}
+
+	user := this.userDao.CheckByUuid(session.UserUuid)
+	space := this.spaceDao.CheckByUuid(session.SpaceUuid)
+	dirMatter := this.matterDao.CheckWithRootByUuid(session.FolderUuid, space)
+
+	hasher := RestoreBlobHasher(session.HashState)
+	matter := this.matterService.AtomicUploadStaged(request, session.StagingPath(space.Name), hasher.Md5(), hasher.Sha256(), user, space, dirMatter, session.Filename, session.Privacy)
+
+	//the staging file has been moved.
+	this.uploadSessionDao.Delete(session)
+
+	//expire the upload token.
+	if session.UploadTokenUuid != "" {
+		uploadToken := this.uploadTokenDao.FindByUuid(session.UploadTokenUuid)
+		if uploadToken != nil {
+			uploadToken.ExpireTime = time.Now()
+			this.uploadTokenDao.Save(uploadToken)
+		}
+	}
+
+	return matter
+}
+
+// cancel an upload session and remove the staging file.
+func (this *UploadSessionService) Delete(request *http.Request, session *UploadSession) {
+
+	this.lock(session.Uuid)
+	defer this.unlock(session.Uuid)
+
+	this.deleteSession(session)
+}
+
+func (this *UploadSessionService) deleteSession(session *UploadSession) {
+
+	space := this.spaceDao.FindByUuid(session.SpaceUuid)
+	if space != nil {
+		stagingPath := session.StagingPath(space.Name)
+		if util.PathExists(stagingPath) {
+			err := os.Remove(stagingPath)
+			if err != nil {
+				this.logger.Error("cannot remove staging file %s. %s", stagingPath, err.Error())
+			}
+		}
+	}
+
+	this.uploadSessionDao.Delete(session)
+}
+
+// clean the expired sessions and their staging files.
+func (this *UploadSessionService) CleanExpiredSessions() {
+
+	this.uploadSessionDao.PageHandleExpired(time.Now(), func(session *UploadSession) {
+		this.logger.Info("clean expired upload session %s %s", session.Uuid, session.Filename)
+		this.deleteSession(session)
+	})
+}
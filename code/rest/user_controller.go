@@ -19,6 +19,7 @@ type UserController struct {
 	spaceDao          *SpaceDao
 	spaceService      *SpaceService
 	matterService     *MatterService
+	jobService        *JobService
 }
 
 func (this *UserController) Init() {
@@ -47,6 +48,11 @@ func (this *UserController) Init() {
 		this.matterService = b
 	}
 
+	b = core.CONTEXT.GetBean(this.jobService)
+	if b, ok := b.(*JobService); ok {
+		this.jobService = b
+	}
+
 }
 
 func (this *UserController) RegisterRoutes() map[string]func(writer http.ResponseWriter, request *http.Request) {
@@ -453,6 +459,12 @@ func (this *UserController) Scan(writer http.ResponseWriter, request *http.Reque
 
 	uuid := request.FormValue("uuid")
 	currentUser := this.userDao.CheckByUuid(uuid)
+
+	if util.ExtractRequestOptionalBool(request, "async", false) {
+		job := this.jobService.Submit(request, this.checkUser(request), nil, JOB_TYPE_SCAN, &UserJobParams{UserUuid: currentUser.Uuid})
+		return this.Success(job)
+	}
+
 	space := this.spaceDao.CheckByUuid(currentUser.SpaceUuid)
 	this.matterService.DeleteByPhysics(request, currentUser, space)
 	this.matterService.ScanPhysics(request, currentUser, space)
@@ -473,6 +485,11 @@ func (this *UserController) Delete(writer http.ResponseWriter, request *http.Req
 		panic(result.BadRequest("You cannot delete yourself."))
 	}
 
+	if util.ExtractRequestOptionalBool(request, "async", false) {
+		job := this.jobService.Submit(request, user, nil, JOB_TYPE_DELETE_USER, &UserJobParams{UserUuid: currentUser.Uuid})
+		return this.Success(job)
+	}
+
 	this.userService.DeleteUser(request, currentUser)
 
 	return this.Success("OK")
@@ -21,7 +21,8 @@ const (
 )
 
 const (
-	//username pattern
+	//username pattern. space names follow it too. the system directories next to the spaces' under the matter path
+	//contain "-", which is not allowed here, so they never conflict with a space. eg. BLOB_STORE, WORK_JOURNAL
 	USERNAME_PATTERN = "^[\\p{Han}0-9a-zA-Z_]+$"
 	USERNAME_DEMO    = "demo"
 )
@@ -3,7 +3,6 @@ package rest
 import (
 	"github.com/eyebluecn/tank/code/core"
 	"github.com/eyebluecn/tank/code/tool/cache"
-	"github.com/eyebluecn/tank/code/tool/result"
 	"github.com/eyebluecn/tank/code/tool/util"
 	"github.com/eyebluecn/tank/code/tool/uuid"
 	"net/http"
@@ -19,19 +18,24 @@ type UserService struct {
 
 	spaceService *SpaceService
 
-	//file lock
-	locker *cache.Table
-
-	matterDao        *MatterDao
-	matterService    *MatterService
-	imageCacheDao    *ImageCacheDao
-	spaceDao         *SpaceDao
-	spaceMemberDao   *SpaceMemberDao
-	shareDao         *ShareDao
-	shareService     *ShareService
-	downloadTokenDao *DownloadTokenDao
-	uploadTokenDao   *UploadTokenDao
-	footprintDao     *FootprintDao
+	matterDao            *MatterDao
+	matterService        *MatterService
+	imageCacheDao        *ImageCacheDao
+	spaceDao             *SpaceDao
+	spaceMemberDao       *SpaceMemberDao
+	shareDao             *ShareDao
+	shareService         *ShareService
+	downloadTokenDao     *DownloadTokenDao
+	uploadTokenDao       *UploadTokenDao
+	uploadSessionDao     *UploadSessionDao
+	davLockDao           *DavLockDao
+	davPropDao           *DavPropDao
+	footprintDao         *FootprintDao
+	matterVersionService *MatterVersionService
+	tagDao               *TagDao
+	favoriteDao          *FavoriteDao
+	recentDao            *RecentDao
+	jobDao               *JobDao
 }
 
 func (this *UserService) Init() {
@@ -91,40 +95,49 @@ func (this *UserService) Init() {
 		this.uploadTokenDao = b
 	}
 
-	b = core.CONTEXT.GetBean(this.footprintDao)
-	if b, ok := b.(*FootprintDao); ok {
-		this.footprintDao = b
+	b = core.CONTEXT.GetBean(this.uploadSessionDao)
+	if b, ok := b.(*UploadSessionDao); ok {
+		this.uploadSessionDao = b
 	}
 
-	//create a lock cache.
-	this.locker = cache.NewTable()
-}
+	b = core.CONTEXT.GetBean(this.davLockDao)
+	if b, ok := b.(*DavLockDao); ok {
+		this.davLockDao = b
+	}
 
-// lock a user's operation. If lock, user cannot operate file.
-func (this *UserService) MatterLock(userUuid string) {
+	b = core.CONTEXT.GetBean(this.davPropDao)
+	if b, ok := b.(*DavPropDao); ok {
+		this.davPropDao = b
+	}
 
-	cacheItem, err := this.locker.Value(userUuid)
-	if err != nil {
-		this.logger.Error("error while get cache" + err.Error())
+	b = core.CONTEXT.GetBean(this.matterVersionService)
+	if b, ok := b.(*MatterVersionService); ok {
+		this.matterVersionService = b
 	}
 
-	if cacheItem != nil && cacheItem.Data() != nil {
-		panic(result.BadRequest("file is being operating, retry later"))
+	b = core.CONTEXT.GetBean(this.footprintDao)
+	if b, ok := b.(*FootprintDao); ok {
+		this.footprintDao = b
 	}
 
-	duration := 12 * time.Hour
-	this.locker.Add(userUuid, duration, true)
-}
+	b = core.CONTEXT.GetBean(this.tagDao)
+	if b, ok := b.(*TagDao); ok {
+		this.tagDao = b
+	}
+
+	b = core.CONTEXT.GetBean(this.favoriteDao)
+	if b, ok := b.(*FavoriteDao); ok {
+		this.favoriteDao = b
+	}
 
-// unlock
-func (this *UserService) MatterUnlock(userUuid string) {
+	b = core.CONTEXT.GetBean(this.recentDao)
+	if b, ok := b.(*RecentDao); ok {
+		this.recentDao = b
+	}
 
-	exist := this.locker.Exists(userUuid)
-	if exist {
-		_, err := this.locker.Delete(userUuid)
-		this.PanicError(err)
-	} else {
-		this.logger.Error("unlock error. %s has no matter lock ", userUuid)
+	b = core.CONTEXT.GetBean(this.jobDao)
+	if b, ok := b.(*JobDao); ok {
+		this.jobDao = b
 	}
 }
 
@@ -264,7 +277,7 @@ func (this *UserService) CreateUser(request *http.Request, username string, size
 	user = this.userDao.Create(user)
 
 	//create space.
-	space := this.spaceService.CreateSpace(request, username, user, sizeLimit, totalSizeLimit, SPACE_TYPE_PRIVATE)
+	space := this.spaceService.CreateSpace(request, username, user, sizeLimit, totalSizeLimit, SPACE_TYPE_PRIVATE, "")
 
 	//update user's space.
 	user.SpaceUuid = space.Uuid
@@ -291,6 +304,14 @@ func (this *UserService) DeleteUser(request *http.Request, currentUser *User) {
 	this.logger.Info("delete upload tokens")
 	this.uploadTokenDao.DeleteByUserUuid(currentUser.Uuid)
 
+	//delete upload sessions
+	this.logger.Info("delete upload sessions")
+	this.uploadSessionDao.DeleteByUserUuid(currentUser.Uuid)
+
+	//delete webdav locks
+	this.logger.Info("delete webdav locks")
+	this.davLockDao.DeleteByUserUuid(currentUser.Uuid)
+
 	//delete footprints
 	this.logger.Info("delete footprints")
 	this.footprintDao.DeleteByUserUuid(currentUser.Uuid)
@@ -307,6 +328,19 @@ func (this *UserService) DeleteUser(request *http.Request, currentUser *User) {
 	this.logger.Info("delete caches")
 	this.imageCacheDao.DeleteByUserUuid(currentUser.Uuid)
 
+	//delete favorites and recent lists
+	this.logger.Info("delete favorites and recent lists")
+	this.favoriteDao.DeleteByUserUuid(currentUser.Uuid)
+	this.recentDao.DeleteByUserUuid(currentUser.Uuid)
+
+	//delete jobs
+	this.logger.Info("delete jobs")
+	this.jobDao.DeleteByUserUuid(currentUser.Uuid)
+
+	//delete matter versions
+	this.logger.Info("delete matter versions")
+	this.matterVersionService.DeleteByUserUuid(currentUser.Uuid)
+
 	//delete matters
 	this.logger.Info("delete matters")
 	this.matterDao.DeleteByUserUuid(currentUser.Uuid)
@@ -316,6 +350,14 @@ func (this *UserService) DeleteUser(request *http.Request, currentUser *User) {
 	this.logger.Info("delete space members")
 	this.spaceMemberDao.DeleteBySpaceUuid(space.Uuid)
 
+	//delete tags
+	this.logger.Info("delete tags")
+	this.tagDao.DeleteBySpaceUuid(space.Uuid)
+
+	//delete webdav dead properties
+	this.logger.Info("delete webdav dead properties")
+	this.davPropDao.DeleteBySpaceUuid(space.Uuid)
+
 	//delete spaces
 	this.logger.Info("delete spaces")
 	this.spaceDao.DeleteByUserUuid(currentUser.Uuid)
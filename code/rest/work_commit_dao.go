@@ -0,0 +1,53 @@
+package rest
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/result"
+	"gorm.io/gorm"
+	"time"
+)
+
+type WorkCommitDao struct {
+	BaseDao
+}
+
+// find by uuid. if not found return nil.
+func (this *WorkCommitDao) FindByUuid(uuid string) *WorkCommit {
+	var entity = &WorkCommit{}
+	db := core.CONTEXT.GetDB().Where("uuid = ?", uuid).First(entity)
+	if db.Error != nil {
+		if db.Error.Error() == result.DB_ERROR_NOT_FOUND {
+			return nil
+		} else {
+			panic(db.Error)
+		}
+	}
+	return entity
+}
+
+// mark the work committed in its own transaction.
+func (this *WorkCommitDao) CreateTx(tx *gorm.DB, uuid string) *WorkCommit {
+
+	workCommit := &WorkCommit{
+		Uuid:       uuid,
+		CreateTime: time.Now(),
+		UpdateTime: time.Now(),
+		Sort:       time.Now().UnixNano() / 1e6,
+	}
+	db := tx.Create(workCommit)
+	this.PanicError(db.Error)
+
+	return workCommit
+}
+
+func (this *WorkCommitDao) DeleteByUuid(uuid string) {
+	db := core.CONTEXT.GetDB().Where("uuid = ?", uuid).Delete(WorkCommit{})
+	this.PanicError(db.Error)
+}
+
+// System cleanup.
+func (this *WorkCommitDao) Cleanup() {
+	this.logger.Info("[WorkCommitDao] clean up. Delete all WorkCommit")
+	db := core.CONTEXT.GetDB().Where("uuid is not null").Delete(WorkCommit{})
+	this.PanicError(db.Error)
+}
@@ -2,6 +2,7 @@ package support
 
 import (
 	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/tool/storage"
 	"github.com/eyebluecn/tank/code/tool/util"
 	"github.com/json-iterator/go"
 	"gorm.io/gorm/schema"
@@ -51,6 +52,9 @@ type ConfigItem struct {
 	//********sqlite configurations..********
 	//default value is matter/
 	SqliteFolder string
+	//********storage configurations..********
+	//storage backends which spaces can choose. key is the backend's name.
+	StorageBackends map[string]*storage.BackendConfig
 }
 
 //validate whether the config file is ok
@@ -213,6 +217,14 @@ func (this *TankConfig) MatterPath() string {
 	return this.matterPath
 }
 
+//storage backends
+func (this *TankConfig) StorageBackends() map[string]*storage.BackendConfig {
+	if this.item == nil {
+		return nil
+	}
+	return this.item.StorageBackends
+}
+
 //matter path
 func (this *TankConfig) NamingStrategy() schema.NamingStrategy {
 	return schema.NamingStrategy{
@@ -238,6 +250,11 @@ func (this *TankConfig) FinishInstall(dbType string, mysqlPort int, mysqlHost st
 		MysqlCharset:  mysqlCharset,
 	}
 
+	//keep the storage backends.
+	if this.item != nil {
+		configItem.StorageBackends = this.item.StorageBackends
+	}
+
 	//pretty json.
 	jsonStr, _ := jsoniter.ConfigCompatibleWithStandardLibrary.MarshalIndent(configItem, "", " ")
 
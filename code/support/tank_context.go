@@ -214,6 +214,62 @@ func (this *TankContext) registerBeans() {
 	this.registerBean(new(rest.SpaceMemberDao))
 	this.registerBean(new(rest.SpaceMemberService))
 
+	//storage
+	this.registerBean(new(rest.StorageService))
+
+	//blob
+	this.registerBean(new(rest.BlobDao))
+	this.registerBean(new(rest.BlobService))
+
+	//matterVersion
+	this.registerBean(new(rest.MatterVersionController))
+	this.registerBean(new(rest.MatterVersionDao))
+	this.registerBean(new(rest.MatterVersionService))
+
+	//uploadSession
+	this.registerBean(new(rest.UploadSessionController))
+	this.registerBean(new(rest.UploadSessionDao))
+	this.registerBean(new(rest.UploadSessionService))
+
+	//search
+	this.registerBean(new(rest.SearchTermDao))
+	this.registerBean(new(rest.SearchService))
+
+	//tag
+	this.registerBean(new(rest.TagController))
+	this.registerBean(new(rest.TagDao))
+	this.registerBean(new(rest.MatterTagDao))
+	this.registerBean(new(rest.TagService))
+
+	//trash
+	this.registerBean(new(rest.TrashController))
+	this.registerBean(new(rest.TrashService))
+
+	//favorite
+	this.registerBean(new(rest.FavoriteController))
+	this.registerBean(new(rest.FavoriteDao))
+
+	//recent
+	this.registerBean(new(rest.RecentController))
+	this.registerBean(new(rest.RecentDao))
+	this.registerBean(new(rest.RecentService))
+
+	//crawl
+	this.registerBean(new(rest.CrawlService))
+
+	//job
+	this.registerBean(new(rest.JobController))
+	this.registerBean(new(rest.JobDao))
+	this.registerBean(new(rest.JobService))
+
+	//lock
+	this.registerBean(new(rest.LockController))
+	this.registerBean(new(rest.LockService))
+
+	//unitOfWork
+	this.registerBean(new(rest.UnitOfWorkService))
+	this.registerBean(new(rest.WorkCommitDao))
+
 	//uploadToken
 	this.registerBean(new(rest.UploadTokenDao))
 
@@ -228,6 +284,9 @@ func (this *TankContext) registerBeans() {
 	//webdav
 	this.registerBean(new(rest.DavController))
 	this.registerBean(new(rest.DavService))
+	this.registerBean(new(rest.DavLockDao))
+	this.registerBean(new(rest.DavLockService))
+	this.registerBean(new(rest.DavPropDao))
 
 }
 
@@ -257,6 +316,12 @@ func (this *TankContext) InstallOk() {
 	if core.CONFIG.Installed() {
 		this.OpenDb()
 
+		//the installs upgraded from an old version miss the new tables and columns.
+		b := this.GetBean(new(rest.InstallController))
+		if c, ok := b.(*rest.InstallController); ok {
+			c.Migrate()
+		}
+
 		for _, bean := range this.BeanMap {
 			bean.Bootstrap()
 		}
@@ -0,0 +1,287 @@
+package test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"github.com/eyebluecn/tank/code/tool/archive"
+	"github.com/eyebluecn/tank/code/tool/download"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanEntryName(t *testing.T) {
+
+	cases := map[string]string{
+		"docs/readme.txt":   "docs/readme.txt",
+		"docs/":             "docs",
+		"./docs//a.txt":     "docs/a.txt",
+		"docs\\windows.txt": "docs/windows.txt",
+		"./":                "",
+	}
+	for name, expected := range cases {
+		cleaned, err := archive.CleanEntryName(name)
+		if err != nil || cleaned != expected {
+			t.Errorf("clean %s error. %s %v", name, cleaned, err)
+		}
+	}
+
+	for _, name := range []string{"../evil.txt", "docs/../../evil.txt", "/etc/passwd", "C:/evil.txt", "..\\evil.txt"} {
+		_, err := archive.CleanEntryName(name)
+		if err == nil {
+			t.Errorf("%s should be rejected.", name)
+		}
+	}
+}
+
+func walkEntries(t *testing.T, content []byte, format string) map[string]string {
+
+	result := make(map[string]string)
+	err := archive.Walk(bytes.NewReader(content), int64(len(content)), format, func(entry *archive.ArchiveEntry, reader io.Reader) error {
+		if entry.Dir {
+			result[entry.Name] = "/"
+			return nil
+		}
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		result[entry.Name] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestWalkZip(t *testing.T) {
+
+	buffer := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buffer)
+	for _, name := range []string{"docs/", "docs/readme.txt", "top.txt"} {
+		writer, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name != "docs/" {
+			_, _ = io.WriteString(writer, "content of "+name)
+		}
+	}
+	err := zipWriter.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := walkEntries(t, buffer.Bytes(), archive.FORMAT_ZIP)
+	if len(entries) != 3 || entries["docs"] != "/" || entries["docs/readme.txt"] != "content of docs/readme.txt" || entries["top.txt"] != "content of top.txt" {
+		t.Errorf("walk zip error. %v", entries)
+	}
+
+	//zip slip.
+	buffer = &bytes.Buffer{}
+	zipWriter = zip.NewWriter(buffer)
+	_, _ = zipWriter.Create("../evil.txt")
+	_ = zipWriter.Close()
+	err = archive.Walk(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()), archive.FORMAT_ZIP, func(entry *archive.ArchiveEntry, reader io.Reader) error {
+		t.Errorf("%s should not be walked.", entry.Name)
+		return nil
+	})
+	if err == nil {
+		t.Error("zip slip should be rejected.")
+	}
+}
+
+func TestWalkTarGz(t *testing.T) {
+
+	buffer := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	tarWriter := tar.NewWriter(gzipWriter)
+	modified := time.Date(2021, 3, 4, 5, 6, 8, 0, time.UTC)
+
+	headers := []*tar.Header{
+		{Name: "docs/", Typeflag: tar.TypeDir, Mode: 0755, ModTime: modified},
+		{Name: "docs/readme.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 10, ModTime: modified},
+		{Name: "docs/link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd", ModTime: modified},
+	}
+	for _, header := range headers {
+		err := tarWriter.WriteHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			_, _ = io.WriteString(tarWriter, "hello tank")
+		}
+	}
+	_ = tarWriter.Close()
+	_ = gzipWriter.Close()
+
+	entries := walkEntries(t, buffer.Bytes(), archive.FORMAT_TAR_GZ)
+	if len(entries) != 2 || entries["docs"] != "/" || entries["docs/readme.txt"] != "hello tank" {
+		t.Errorf("walk tar.gz error. %v", entries)
+	}
+}
+
+func TestWalkLyingSize(t *testing.T) {
+
+	buffer := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buffer)
+	writer, err := zipWriter.Create("bomb.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(writer, "much more than declared")
+	_ = zipWriter.Close()
+
+	//shrink the declared size in the central directory.
+	content := buffer.Bytes()
+	directory := bytes.LastIndex(content, []byte("PK\x01\x02"))
+	content[directory+24] = 4
+	content[directory+25] = 0
+	content[directory+26] = 0
+	content[directory+27] = 0
+
+	err = archive.Walk(bytes.NewReader(content), int64(len(content)), archive.FORMAT_ZIP, func(entry *archive.ArchiveEntry, reader io.Reader) error {
+		if entry.Size != 4 {
+			t.Errorf("declared size error. %d", entry.Size)
+		}
+		_, err := ioutil.ReadAll(reader)
+		return err
+	})
+	if err == nil {
+		t.Error("content larger than declared should fail.")
+	}
+}
+
+// the same files in every format. big.txt is compressible, so zip deflates it.
+func buildArchives(t *testing.T) map[string][]byte {
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"logs/", ""},
+		{"logs/small.txt", "0123456789"},
+		{"logs/big.txt", strings.Repeat("tank log line\n", 1000)},
+	}
+	archives := make(map[string][]byte)
+
+	buffer := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buffer)
+	for _, file := range files {
+		header := &zip.FileHeader{Name: file.name, Method: zip.Deflate}
+		if file.name == "logs/small.txt" {
+			header.Method = zip.Store
+		}
+		writer, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(writer, file.content)
+	}
+	_ = zipWriter.Close()
+	archives[archive.FORMAT_ZIP] = buffer.Bytes()
+
+	buffer = &bytes.Buffer{}
+	tarWriter := tar.NewWriter(buffer)
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(file.content))}
+		if strings.HasSuffix(file.name, "/") {
+			header.Typeflag = tar.TypeDir
+		}
+		_ = tarWriter.WriteHeader(header)
+		_, _ = io.WriteString(tarWriter, file.content)
+	}
+	_ = tarWriter.Close()
+	archives[archive.FORMAT_TAR] = buffer.Bytes()
+
+	buffer = &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(buffer)
+	_, _ = gzipWriter.Write(archives[archive.FORMAT_TAR])
+	_ = gzipWriter.Close()
+	archives[archive.FORMAT_TAR_GZ] = buffer.Bytes()
+
+	return archives
+}
+
+func TestArchiveEntry(t *testing.T) {
+
+	big := strings.Repeat("tank log line\n", 1000)
+	for format, content := range buildArchives(t) {
+
+		entries, err := archive.List(bytes.NewReader(content), int64(len(content)), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 3 || !entries[0].Dir || entries[1].Name != "logs/small.txt" || entries[2].Size != int64(len(big)) {
+			t.Errorf("%s list error.", format)
+		}
+
+		for _, name := range []string{"logs/small.txt", "logs/big.txt"} {
+			entry, reader, err := archive.OpenEntry(bytes.NewReader(content), int64(len(content)), format, name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := "0123456789"
+			if name == "logs/big.txt" {
+				expected = big
+			}
+
+			//tail, then head again.
+			_, err = reader.Seek(entry.Size-5, io.SeekStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tail, err := ioutil.ReadAll(reader)
+			if err != nil || string(tail) != expected[len(expected)-5:] {
+				t.Errorf("%s %s tail error. %s %v", format, name, tail, err)
+			}
+			_, err = reader.Seek(0, io.SeekStart)
+			if err != nil {
+				t.Fatal(err)
+			}
+			all, err := ioutil.ReadAll(reader)
+			if err != nil || string(all) != expected {
+				t.Errorf("%s %s content error. %v", format, name, err)
+			}
+			_ = reader.Close()
+		}
+
+		_, _, err = archive.OpenEntry(bytes.NewReader(content), int64(len(content)), format, "logs/none.txt")
+		if err != archive.ErrEntryNotExist {
+			t.Errorf("%s missing entry error. %v", format, err)
+		}
+	}
+}
+
+// a single range must be sent only once.
+func TestArchiveEntryRange(t *testing.T) {
+
+	content := buildArchives(t)[archive.FORMAT_TAR_GZ]
+	entry, reader, err := archive.OpenEntry(bytes.NewReader(content), int64(len(content)), archive.FORMAT_TAR_GZ, "logs/big.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	request := httptest.NewRequest(http.MethodGet, "/api/matter/archive/download", nil)
+	request.Header.Set("Range", "bytes=14-27")
+	recorder := httptest.NewRecorder()
+	download.DownloadContent(recorder, request, reader, entry.Size, entry.Modified, "big.txt", true)
+
+	if recorder.Code != http.StatusPartialContent {
+		t.Fatalf("status error. %d", recorder.Code)
+	}
+	if recorder.Body.String() != "tank log line\n" {
+		t.Errorf("range body error. %q", recorder.Body.String())
+	}
+	if recorder.Header().Get("Content-Range") != "bytes 14-27/14000" || recorder.Header().Get("Content-Length") != "14" {
+		t.Errorf("range header error. %v", recorder.Header())
+	}
+}
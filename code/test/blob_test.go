@@ -0,0 +1,61 @@
+package test
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/rest"
+	"testing"
+)
+
+// the reference count of the matter's blob. 0 if the blob has gone.
+func blobRefCount(matter *rest.Matter) int64 {
+	blobDao := core.CONTEXT.GetBean(new(rest.BlobDao)).(*rest.BlobDao)
+	blob := blobDao.FindBySha256(matter.Backend, matter.Sha256)
+	if blob == nil {
+		return 0
+	}
+	return blob.RefCount
+}
+
+// identical content is stored once. copies reference it, replacing and deleting release it.
+func TestBlobRefCount(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+
+	davRequest(t, "MKCOL", davUrl+"/blob", nil, "")
+	davRequest(t, "PUT", davUrl+"/blob/a.txt", nil, "blob ref count")
+	a := davMatter(t, davTestUsername, "/blob/a.txt")
+	if a == nil || a.Sha256 == "" || blobRefCount(a) != 1 {
+		t.Fatalf("upload not referenced. %v", a)
+	}
+
+	//the same content uploaded again and the copies share the blob.
+	davRequest(t, "PUT", davUrl+"/blob/b.txt", nil, "blob ref count")
+	davRequest(t, "COPY", davUrl+"/blob/a.txt", map[string]string{"Destination": davUrl + "/blob/c.txt"}, "")
+	davRequest(t, "COPY", davUrl+"/blob", map[string]string{"Destination": davUrl + "/blob-copy"}, "")
+	if count := blobRefCount(a); count != 6 {
+		t.Errorf("after copies ref count %d", count)
+	}
+
+	//replacing the content releases the previous blob.
+	davRequest(t, "PUT", davUrl+"/blob/b.txt", nil, "blob replaced")
+	if count := blobRefCount(a); count != 5 {
+		t.Errorf("after replace ref count %d", count)
+	}
+	if b := davMatter(t, davTestUsername, "/blob/b.txt"); b.Sha256 == a.Sha256 || blobRefCount(b) != 1 {
+		t.Errorf("replaced blob ref count %d", blobRefCount(b))
+	}
+
+	//the blob goes with its last reference.
+	davRequest(t, "DELETE", davUrl+"/blob-copy", nil, "")
+	davRequest(t, "DELETE", davUrl+"/blob/c.txt", nil, "")
+	if count := blobRefCount(a); count != 1 {
+		t.Errorf("after delete ref count %d", count)
+	}
+	davRequest(t, "DELETE", davUrl+"/blob/a.txt", nil, "")
+	if count := blobRefCount(a); count != 0 {
+		t.Errorf("last reference deleted, ref count %d", count)
+	}
+	if status, body := davRequest(t, "GET", davUrl+"/blob/b.txt", nil, ""); status != 200 || body != "blob replaced" {
+		t.Errorf("content lost %d %s", status, body)
+	}
+}
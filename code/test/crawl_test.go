@@ -0,0 +1,186 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/eyebluecn/tank/code/tool/crawl"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCrawlResume(t *testing.T) {
+
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+
+	var requests int32
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		ranges = append(ranges, request.Header.Get("Range"))
+		if atomic.AddInt32(&requests, 1) == 1 {
+			//break in the middle.
+			writer.Header().Set("Content-Length", "100000")
+			_, _ = writer.Write(content[:40000])
+			return
+		}
+		http.ServeContent(writer, request, "a.bin", time.Now(), bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "crawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "a.bin")
+
+	downloader := &crawl.Downloader{MaxSize: -1, Retries: 2, Backoff: time.Millisecond}
+	size, err := downloader.Download(context.Background(), server.URL, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := ioutil.ReadFile(path)
+	if size != int64(len(content)) || !bytes.Equal(got, content) {
+		t.Errorf("content error. size %d", size)
+	}
+	if len(ranges) != 2 || ranges[0] != "" || ranges[1] != "bytes=40000-" {
+		t.Errorf("range error. %v", ranges)
+	}
+}
+
+func TestCrawlRetryAndSizeLimit(t *testing.T) {
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= 2 {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = writer.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "crawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//failed twice, then succeed.
+	var retries []int
+	downloader := &crawl.Downloader{MaxSize: -1, Retries: 3, Backoff: time.Millisecond, OnRetry: func(attempt int, err error) {
+		retries = append(retries, attempt)
+	}}
+	size, err := downloader.Download(context.Background(), server.URL, filepath.Join(dir, "a.txt"))
+	if err != nil || size != 5 || len(retries) != 2 {
+		t.Errorf("retry error. %v %d %v", err, size, retries)
+	}
+
+	//rejected by Content-Length up front, without retry.
+	atomic.StoreInt32(&requests, 2)
+	downloader = &crawl.Downloader{MaxSize: 4, Retries: 3, Backoff: time.Millisecond}
+	_, err = downloader.Download(context.Background(), server.URL, filepath.Join(dir, "b.txt"))
+	if _, ok := err.(*crawl.SizeError); !ok || atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("size limit error. %v %d", err, requests)
+	}
+
+	//client errors are not retried.
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	downloader = &crawl.Downloader{MaxSize: -1, Retries: 3, Backoff: time.Millisecond}
+	_, err = downloader.Download(context.Background(), notFound.URL, filepath.Join(dir, "c.txt"))
+	if statusError, ok := err.(*crawl.StatusError); !ok || statusError.Code != http.StatusNotFound {
+		t.Errorf("status error. %v", err)
+	}
+}
+
+func TestCrawlLimiter(t *testing.T) {
+
+	content := make([]byte, 50*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write(content)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "crawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	//50KB at 100KB/s.
+	downloader := &crawl.Downloader{MaxSize: -1, Limiter: crawl.NewLimiter(100 * 1024)}
+	start := time.Now()
+	_, err = downloader.Download(context.Background(), server.URL, filepath.Join(dir, "a.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("bandwidth not limited. %v", elapsed)
+	}
+}
+
+func TestCrawlPolicy(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		_, _ = writer.Write([]byte("hello"))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "crawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	policy := crawl.NewPolicy(nil)
+	for _, ip := range []string{"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0", "::1", "fd00::1", "fe80::1", "::ffff:127.0.0.1"} {
+		if policy.CheckIP(net.ParseIP(ip)) == nil {
+			t.Errorf("%s should be blocked", ip)
+		}
+	}
+	if err := policy.CheckIP(net.ParseIP("93.184.216.34")); err != nil {
+		t.Errorf("public address blocked. %v", err)
+	}
+	if policy.CheckUrl("file:///etc/passwd") == nil || policy.CheckUrl("http://[::1]/a") == nil {
+		t.Error("url should be blocked")
+	}
+
+	//a host name resolved to loopback is blocked when dialing, without retry.
+	localhost := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	client := &http.Client{Transport: &http.Transport{DialContext: policy.DialContext(&net.Dialer{})}}
+	downloader := &crawl.Downloader{Client: client, MaxSize: -1, Retries: 3, Backoff: time.Millisecond}
+	_, err = downloader.Download(context.Background(), localhost, filepath.Join(dir, "a.txt"))
+	var policyError *crawl.PolicyError
+	if !errors.As(err, &policyError) {
+		t.Errorf("loopback not blocked. %v", err)
+	}
+
+	//allowed by the host patterns.
+	for _, pattern := range []string{"localhost", "127.0.0.0/8", "*"} {
+		policy = crawl.NewPolicy([]string{pattern})
+		client = &http.Client{Transport: &http.Transport{DialContext: policy.DialContext(&net.Dialer{})}}
+		downloader = &crawl.Downloader{Client: client, MaxSize: -1}
+		size, err := downloader.Download(context.Background(), localhost, filepath.Join(dir, "b.txt"))
+		if err != nil || size != 5 {
+			t.Errorf("%s not allowed. %v", pattern, err)
+		}
+		_ = os.Remove(filepath.Join(dir, "b.txt"))
+	}
+
+	if !crawl.NewPolicy([]string{"*.example.com"}).AllowHost("files.example.com") || crawl.NewPolicy([]string{"*.example.com"}).AllowHost("example.org") {
+		t.Error("host pattern error")
+	}
+	if crawl.ValidPattern("http://a.com") || !crawl.ValidPattern("*.example.com") || !crawl.ValidPattern("10.0.0.0/8") {
+		t.Error("pattern validation error")
+	}
+}
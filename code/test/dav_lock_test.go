@@ -0,0 +1,91 @@
+package test
+
+import (
+	"bytes"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/rest"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// upload a file to the directory through the web api. return the code of the result.
+func apiUpload(t *testing.T, client *http.Client, puuid string, filename string, content string) string {
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	_ = writer.WriteField("puuid", puuid)
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write([]byte(content))
+	_ = writer.Close()
+
+	response, err := client.Post(davTestServer.URL+"/api/matter/upload", writer.FormDataContentType(), body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _, _ := davApiResult(t, response)
+	return code
+}
+
+// the webdav locks are kept in the database, and the web api cannot change the locked matters.
+func TestDavLockInApi(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+	davLockDao := core.CONTEXT.GetBean(new(rest.DavLockDao)).(*rest.DavLockDao)
+
+	davRequest(t, "MKCOL", davUrl+"/dlock", nil, "")
+	davRequest(t, "MKCOL", davUrl+"/dlock-dest", nil, "")
+	davRequest(t, "PUT", davUrl+"/dlock/a.txt", nil, "locked")
+	matter := davMatter(t, davTestUsername, "/dlock/a.txt")
+	dir := davMatter(t, davTestUsername, "/dlock")
+	dest := davMatter(t, davTestUsername, "/dlock-dest")
+
+	token := davLock(t, davUrl+"/dlock")
+	if davLockDao.FindActiveByToken(token, time.Now()) == nil {
+		t.Fatalf("lock not kept in the database")
+	}
+
+	apis := map[string]url.Values{
+		"/api/matter/rename":      {"uuid": {matter.Uuid}, "name": {"b.txt"}},
+		"/api/matter/move":        {"srcUuids": {matter.Uuid}, "destUuid": {dest.Uuid}},
+		"/api/matter/soft/delete": {"uuid": {matter.Uuid}},
+		"/api/matter/delete":      {"uuid": {dir.Uuid}},
+	}
+	for api, form := range apis {
+		if code, _, _ := davApiSend(t, admin, api, form, ""); code != "LOCKED" {
+			t.Errorf("%s on the locked %s", api, code)
+		}
+	}
+	if code := apiUpload(t, admin, dir.Uuid, "c.txt", "c"); code != "LOCKED" {
+		t.Errorf("upload into the locked %s", code)
+	}
+
+	//the webdav clients need the token.
+	if status, _ := davRequest(t, "PUT", davUrl+"/dlock/a.txt", nil, "changed"); status != http.StatusLocked {
+		t.Errorf("PUT without token status %d", status)
+	}
+	if status, _ := davRequest(t, "PUT", davUrl+"/dlock/a.txt", map[string]string{"If": "(<" + token + ">)"}, "changed"); status != http.StatusNoContent {
+		t.Errorf("PUT with token status %d", status)
+	}
+
+	davUnlock(t, davUrl+"/dlock", token)
+	if davLockDao.FindActiveByToken(token, time.Now()) != nil {
+		t.Errorf("lock kept after unlock")
+	}
+	davApiPost(t, admin, "/api/matter/rename", url.Values{"uuid": {matter.Uuid}, "name": {"b.txt"}})
+
+	//an expired lock doesn't count.
+	response, _ := davResponseAs(t, davTestUsername, davTestPassword, "LOCK", davUrl+"/dlock/b.txt", map[string]string{"Timeout": "Second-1"},
+		`<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`)
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("LOCK status %d", response.StatusCode)
+	}
+	time.Sleep(1100 * time.Millisecond)
+	davApiPost(t, admin, "/api/matter/delete", url.Values{"uuid": {dir.Uuid}})
+}
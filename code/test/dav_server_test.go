@@ -0,0 +1,628 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/rest"
+	"github.com/eyebluecn/tank/code/support"
+	"github.com/eyebluecn/tank/code/tool/storage"
+	"gorm.io/gorm/schema"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	davTestUsername = "admin"
+	davTestPassword = "123456"
+)
+
+// config of the tank served in tests. it's installed with sqlite in a temp dir.
+type davTestConfig struct {
+	dir       string
+	installed bool
+}
+
+func (this *davTestConfig) Installed() bool {
+	return this.installed
+}
+
+func (this *davTestConfig) ServerPort() int {
+	return core.DEFAULT_SERVER_PORT
+}
+
+func (this *davTestConfig) DbType() string {
+	return "sqlite"
+}
+
+func (this *davTestConfig) MysqlUrl() string {
+	return ""
+}
+
+func (this *davTestConfig) SqliteFolder() string {
+	return this.dir
+}
+
+func (this *davTestConfig) MatterPath() string {
+	return this.dir + "/matter"
+}
+
+func (this *davTestConfig) StorageBackends() map[string]*storage.BackendConfig {
+	return nil
+}
+
+func (this *davTestConfig) NamingStrategy() schema.NamingStrategy {
+	return schema.NamingStrategy{
+		TablePrefix:   core.TABLE_PREFIX,
+		SingularTable: true,
+	}
+}
+
+func (this *davTestConfig) FinishInstall(dbType string, mysqlPort int, mysqlHost string, mysqlSchema string, mysqlUsername string, mysqlPassword string, mysqlCharset string) {
+	this.installed = true
+}
+
+// logger printing to the console only.
+type davTestLogger struct {
+}
+
+func (this *davTestLogger) Log(prefix string, format string, v ...interface{}) {
+	fmt.Printf(prefix+format+"\n", v...)
+}
+
+func (this *davTestLogger) Debug(format string, v ...interface{}) {
+	this.Log("[DEBUG]", format, v...)
+}
+
+func (this *davTestLogger) Info(format string, v ...interface{}) {
+	this.Log("[INFO ]", format, v...)
+}
+
+func (this *davTestLogger) Warn(format string, v ...interface{}) {
+	this.Log("[WARN ]", format, v...)
+}
+
+func (this *davTestLogger) Error(format string, v ...interface{}) {
+	this.Log("[ERROR]", format, v...)
+}
+
+func (this *davTestLogger) Panic(format string, v ...interface{}) {
+	this.Log("[PANIC]", format, v...)
+	panic(fmt.Sprintf(format, v...))
+}
+
+var davTestOnce sync.Once
+var davTestServer *httptest.Server
+
+// start a tank installed in a temp dir, shared by the tests. return the webdav url.
+func startDavServer(t *testing.T) string {
+
+	davTestOnce.Do(func() {
+
+		dir, err := ioutil.TempDir("", "tank-dav")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		core.LOGGER = &davTestLogger{}
+		core.CONFIG = &davTestConfig{dir: dir}
+		tankContext := &support.TankContext{}
+		core.CONTEXT = tankContext
+		tankContext.Init()
+
+		davTestServer = httptest.NewServer(tankContext)
+
+		//install as the web page does.
+		form := url.Values{"dbType": {"sqlite"}, "adminUsername": {davTestUsername}, "adminPassword": {davTestPassword}}
+		for _, api := range []string{"/api/install/create/table", "/api/install/create/admin", "/api/install/finish"} {
+			response, err := http.PostForm(davTestServer.URL+api, form)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(response.Body)
+			_ = response.Body.Close()
+			if !strings.Contains(string(body), `"code":"OK"`) {
+				t.Fatalf("%s failed. %s", api, body)
+			}
+		}
+	})
+
+	if davTestServer == nil {
+		t.Fatal("the tank server failed to start")
+	}
+	return davTestServer.URL + "/api/dav"
+}
+
+// send a webdav request as the admin. return the status and the body.
+func davRequest(t *testing.T, method string, url string, header map[string]string, body string) (int, string) {
+	return davRequestAs(t, davTestUsername, davTestPassword, method, url, header, body)
+}
+
+// send a webdav request as the user. return the status and the body.
+func davRequestAs(t *testing.T, username string, password string, method string, url string, header map[string]string, body string) (int, string) {
+	response, body := davResponseAs(t, username, password, method, url, header, body)
+	return response.StatusCode, body
+}
+
+// send a webdav request as the user. return the response and the body.
+func davResponseAs(t *testing.T, username string, password string, method string, url string, header map[string]string, body string) (*http.Response, string) {
+
+	request, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.SetBasicAuth(username, password)
+	for k, v := range header {
+		request.Header.Set(k, v)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	bytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, string(bytes)
+}
+
+func TestDavPropfindDepthInfinity(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+
+	davRequest(t, "MKCOL", davUrl+"/infinity", nil, "")
+	davRequest(t, "MKCOL", davUrl+"/infinity/a", nil, "")
+	davRequest(t, "PUT", davUrl+"/infinity/a/b.txt", nil, "b")
+
+	for _, depth := range []string{"infinity", ""} {
+		header := map[string]string{}
+		if depth != "" {
+			header["Depth"] = depth
+		}
+		status, body := davRequest(t, "PROPFIND", davUrl+"/infinity", header, "")
+		if status != http.StatusMultiStatus {
+			t.Fatalf("Depth %q status %d", depth, status)
+		}
+		for _, href := range []string{"/api/dav/admin/infinity<", "/api/dav/admin/infinity/a<", "/api/dav/admin/infinity/a/b.txt<"} {
+			if !strings.Contains(body, href) {
+				t.Errorf("Depth %q misses %s", depth, href)
+			}
+		}
+	}
+
+	status, body := davRequest(t, "PROPFIND", davUrl+"/infinity", map[string]string{"Depth": "1"}, "")
+	if status != http.StatusMultiStatus || strings.Contains(body, "b.txt") {
+		t.Errorf("Depth 1 status %d lists the grandchildren", status)
+	}
+
+	status, _ = davRequest(t, "PROPFIND", davUrl+"/infinity", map[string]string{"Depth": "2"}, "")
+	if status != http.StatusBadRequest {
+		t.Errorf("Depth 2 status %d", status)
+	}
+}
+
+func TestDavPropname(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+
+	davRequest(t, "PUT", davUrl+"/propname.txt", nil, "propname")
+
+	status, body := davRequest(t, "PROPFIND", davUrl+"/propname.txt", map[string]string{"Depth": "0"},
+		`<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:propname/></D:propfind>`)
+	if status != http.StatusMultiStatus {
+		t.Fatalf("status %d", status)
+	}
+	if !strings.Contains(body, "<D:getcontentlength></D:getcontentlength>") {
+		t.Errorf("propname misses getcontentlength. %s", body)
+	}
+	if strings.Contains(body, ">8<") {
+		t.Errorf("propname has values. %s", body)
+	}
+}
+
+func TestDavDeadProps(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+
+	davRequest(t, "PUT", davUrl+"/dead.txt", nil, "dead")
+
+	status, body := davRequest(t, "PROPPATCH", davUrl+"/dead.txt", nil,
+		`<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://example.com/ns"><D:set><D:prop><Z:color>red</Z:color><Z:long>`+strings.Repeat("x", 4096)+`</Z:long></D:prop></D:set></D:propertyupdate>`)
+	if status != http.StatusMultiStatus || !strings.Contains(body, "200 OK") {
+		t.Fatalf("set status %d. %s", status, body)
+	}
+
+	//a protected property fails the whole request.
+	status, body = davRequest(t, "PROPPATCH", davUrl+"/dead.txt", nil,
+		`<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://example.com/ns"><D:set><D:prop><Z:color>blue</Z:color><D:getcontentlength>1</D:getcontentlength></D:prop></D:set></D:propertyupdate>`)
+	if status != http.StatusMultiStatus || !strings.Contains(body, "403 Forbidden") || !strings.Contains(body, "424 Failed Dependency") {
+		t.Fatalf("protected status %d. %s", status, body)
+	}
+
+	davRequest(t, "COPY", davUrl+"/dead.txt", map[string]string{"Destination": davUrl + "/dead-copy.txt"}, "")
+
+	propfind := `<?xml version="1.0"?><D:propfind xmlns:D="DAV:" xmlns:Z="http://example.com/ns"><D:prop><Z:color/><Z:long/></D:prop></D:propfind>`
+	for _, name := range []string{"/dead.txt", "/dead-copy.txt"} {
+		status, body = davRequest(t, "PROPFIND", davUrl+name, map[string]string{"Depth": "0"}, propfind)
+		if status != http.StatusMultiStatus || !strings.Contains(body, ">red</color>") || !strings.Contains(body, strings.Repeat("x", 4096)) {
+			t.Errorf("%s status %d. %s", name, status, body)
+		}
+	}
+
+	status, _ = davRequest(t, "PROPPATCH", davUrl+"/dead.txt", nil,
+		`<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:" xmlns:Z="http://example.com/ns"><D:remove><D:prop><Z:color/></D:prop></D:remove></D:propertyupdate>`)
+	if status != http.StatusMultiStatus {
+		t.Fatalf("remove status %d", status)
+	}
+	status, body = davRequest(t, "PROPFIND", davUrl+"/dead.txt", map[string]string{"Depth": "0"}, propfind)
+	if !strings.Contains(body, "404 Not Found") || strings.Contains(body, ">red<") {
+		t.Errorf("removed status %d. %s", status, body)
+	}
+}
+
+func TestDavETag(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+
+	//create only if not exist.
+	response, _ := davResponseAs(t, davTestUsername, davTestPassword, "PUT", davUrl+"/etag.txt", map[string]string{"If-None-Match": "*"}, "one")
+	if response.StatusCode != http.StatusCreated {
+		t.Fatalf("create status %d", response.StatusCode)
+	}
+	etag := response.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag")
+	}
+	status, _ := davRequest(t, "PUT", davUrl+"/etag.txt", map[string]string{"If-None-Match": "*"}, "two")
+	if status != http.StatusPreconditionFailed {
+		t.Errorf("create again status %d", status)
+	}
+
+	status, body := davRequest(t, "PROPFIND", davUrl+"/etag.txt", map[string]string{"Depth": "0"},
+		`<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><D:getetag/></D:prop></D:propfind>`)
+	if status != http.StatusMultiStatus || !strings.Contains(body, ">"+etag+"<") {
+		t.Errorf("getetag status %d. %s", status, body)
+	}
+
+	response, _ = davResponseAs(t, davTestUsername, davTestPassword, "GET", davUrl+"/etag.txt", map[string]string{"If-None-Match": etag}, "")
+	if response.StatusCode != http.StatusNotModified {
+		t.Errorf("get status %d", response.StatusCode)
+	}
+
+	//update with the ETag seen. the stale one fails.
+	response, _ = davResponseAs(t, davTestUsername, davTestPassword, "PUT", davUrl+"/etag.txt", map[string]string{"If-Match": etag}, "three")
+	if response.StatusCode != http.StatusNoContent || response.Header.Get("ETag") == etag {
+		t.Fatalf("update status %d", response.StatusCode)
+	}
+	for _, method := range []string{"PUT", "DELETE", "MOVE", "COPY"} {
+		status, _ = davRequest(t, method, davUrl+"/etag.txt", map[string]string{"If-Match": etag, "Destination": davUrl + "/etag-dest.txt"}, "four")
+		if status != http.StatusPreconditionFailed {
+			t.Errorf("stale %s status %d", method, status)
+		}
+	}
+
+	status, _ = davRequest(t, "DELETE", davUrl+"/etag.txt", map[string]string{"If-Match": "*"}, "")
+	if status != http.StatusOK && status != http.StatusNoContent {
+		t.Errorf("delete status %d", status)
+	}
+	status, _ = davRequest(t, "PUT", davUrl+"/etag.txt", map[string]string{"If-Match": "*"}, "five")
+	if status != http.StatusPreconditionFailed {
+		t.Errorf("update deleted status %d", status)
+	}
+}
+
+func TestDavQuota(t *testing.T) {
+
+	davUrl := startDavServer(t)
+
+	status, body := davRequest(t, "PROPFIND", davUrl, map[string]string{"Depth": "0"},
+		`<?xml version="1.0"?><D:propfind xmlns:D="DAV:"><D:prop><D:quota-available-bytes/><D:quota-used-bytes/></D:prop></D:propfind>`)
+	if status != http.StatusMultiStatus || !strings.Contains(body, "<D:quota-available-bytes>") || !strings.Contains(body, "<D:quota-used-bytes>") || strings.Contains(body, "404 Not Found") {
+		t.Errorf("status %d. %s", status, body)
+	}
+}
+
+func TestDavPartialUpdate(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+
+	//keep versions, so that the partial updates could leave them.
+	admin := davApiLogin(t, davTestUsername)
+	spaceUuid := davSpace(davTestUsername).Uuid
+	davApiPost(t, admin, "/api/space/edit/version", url.Values{"uuid": {spaceUuid}, "versionKeepNum": {"10"}, "versionKeepDays": {"-1"}})
+	defer davApiPost(t, admin, "/api/space/edit/version", url.Values{"uuid": {spaceUuid}, "versionKeepNum": {"0"}, "versionKeepDays": {"-1"}})
+
+	davRequest(t, "PUT", davUrl+"/partial.txt", nil, "0123456789")
+
+	updates := []struct {
+		method string
+		header map[string]string
+		body   string
+		want   string
+	}{
+		{"PUT", map[string]string{"Content-Range": "bytes 2-4/*"}, "abc", "01abc56789"},
+		{"PATCH", map[string]string{"X-Update-Range": "append"}, "XY", "01abc56789XY"},
+		{"PATCH", map[string]string{"X-Update-Range": "bytes=-2"}, "yz", "01abc56789yz"},
+		{"PATCH", map[string]string{"X-Update-Range": "bytes=10-"}, "!", "01abc56789!z"},
+		{"PATCH", map[string]string{"X-Update-Range": "bytes=0-0"}, "_", "_1abc56789!z"},
+	}
+	for _, update := range updates {
+		status, _ := davRequest(t, update.method, davUrl+"/partial.txt", update.header, update.body)
+		if status != http.StatusNoContent {
+			t.Fatalf("%v status %d", update.header, status)
+		}
+		_, body := davRequest(t, "GET", davUrl+"/partial.txt", nil, "")
+		if body != update.want {
+			t.Errorf("%v got %s, want %s", update.header, body, update.want)
+		}
+	}
+
+	//the chunks of a partial update don't leave versions, while a whole PUT does.
+	matter := davMatter(t, davTestUsername, "/partial.txt")
+	if matter == nil || len(davVersions(matter.Uuid)) != 0 {
+		t.Errorf("partial updates kept versions")
+	}
+	davRequest(t, "PUT", davUrl+"/partial.txt", nil, "whole")
+	if versions := davVersions(matter.Uuid); len(versions) != 1 || versions[0].Size != 12 {
+		t.Errorf("whole update kept %d versions", len(versions))
+	}
+
+	//a gap cannot be left.
+	status, _ := davRequest(t, "PUT", davUrl+"/partial.txt", map[string]string{"Content-Range": "bytes 20-21/*"}, "no")
+	if status != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("gap status %d", status)
+	}
+	status, _ = davRequest(t, "PATCH", davUrl+"/partial-none.txt", map[string]string{"X-Update-Range": "append"}, "no")
+	if status != http.StatusNotFound {
+		t.Errorf("patch none status %d", status)
+	}
+}
+
+func TestDavClients(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+
+	davRequest(t, "MKCOL", davUrl+"/clients", nil, "")
+
+	//Finder's metadata files are ignored.
+	finder := map[string]string{"User-Agent": "WebDAVFS/3.0.0 (03008000) Darwin/22.1.0 (arm64)"}
+	for _, name := range []string{"._photo.jpg", ".DS_Store"} {
+		status, _ := davRequest(t, "PUT", davUrl+"/clients/"+name, finder, "metadata")
+		if status != http.StatusCreated {
+			t.Errorf("%s status %d", name, status)
+		}
+		status, _ = davRequest(t, "GET", davUrl+"/clients/"+name, nil, "")
+		if status != http.StatusNotFound {
+			t.Errorf("%s kept. status %d", name, status)
+		}
+	}
+
+	//the other clients keep them, but Finder doesn't list them.
+	davRequest(t, "PUT", davUrl+"/clients/._kept.jpg", nil, "metadata")
+	_, body := davRequest(t, "PROPFIND", davUrl+"/clients", map[string]string{"Depth": "1"}, "")
+	if !strings.Contains(body, "._kept.jpg") {
+		t.Errorf("other client misses the metadata file. %s", body)
+	}
+	finder["Depth"] = "1"
+	_, body = davRequest(t, "PROPFIND", davUrl+"/clients", finder, "")
+	if strings.Contains(body, "._kept.jpg") {
+		t.Errorf("Finder lists the metadata file. %s", body)
+	}
+
+	//Win32 properties are listed for Windows, and kept when changed.
+	davRequest(t, "PUT", davUrl+"/clients/win.txt", nil, "win")
+	windows := map[string]string{"User-Agent": "Microsoft-WebDAV-MiniRedir/10.0.19045", "Depth": "0"}
+	status, body := davRequest(t, "PROPFIND", davUrl+"/clients/win.txt", windows, "")
+	if status != http.StatusMultiStatus || !strings.Contains(body, "Win32FileAttributes") || !strings.Contains(body, "creationdate") {
+		t.Errorf("windows allprop status %d. %s", status, body)
+	}
+	status, body = davRequest(t, "PROPPATCH", davUrl+"/clients/win.txt", windows,
+		`<?xml version="1.0"?><D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:schemas-microsoft-com:"><D:set><D:prop><Z:Win32CreationTime>Mon, 02 Jan 2006 15:04:05 GMT</Z:Win32CreationTime></D:prop></D:set></D:propertyupdate>`)
+	if status != http.StatusMultiStatus || !strings.Contains(body, "200 OK") {
+		t.Fatalf("win32 proppatch status %d. %s", status, body)
+	}
+	_, body = davRequest(t, "PROPFIND", davUrl+"/clients/win.txt", map[string]string{"Depth": "0"},
+		`<?xml version="1.0"?><D:propfind xmlns:D="DAV:" xmlns:Z="urn:schemas-microsoft-com:"><D:prop><Z:Win32CreationTime/></D:prop></D:propfind>`)
+	if !strings.Contains(body, "Mon, 02 Jan 2006 15:04:05 GMT") {
+		t.Errorf("win32 property not kept. %s", body)
+	}
+}
+
+// lock the url exclusively as the admin. return the lock token.
+func davLock(t *testing.T, url string) string {
+	response, body := davResponseAs(t, davTestUsername, davTestPassword, "LOCK", url, map[string]string{"Timeout": "Second-600"},
+		`<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype><D:owner>test</D:owner></D:lockinfo>`)
+	token := strings.Trim(response.Header.Get("Lock-Token"), "<>")
+	if response.StatusCode != http.StatusOK || token == "" {
+		t.Fatalf("LOCK %s status %d. %s", url, response.StatusCode, body)
+	}
+	return token
+}
+
+// unlock the url locked by davLock.
+func davUnlock(t *testing.T, url string, token string) {
+	if status, body := davRequest(t, "UNLOCK", url, map[string]string{"Lock-Token": "<" + token + ">"}, ""); status != http.StatusNoContent {
+		t.Fatalf("UNLOCK %s status %d. %s", url, status, body)
+	}
+}
+
+// the alive matter at the path of the space. return nil if not found.
+func davMatter(t *testing.T, spaceName string, path string) *rest.Matter {
+
+	var matters []*rest.Matter
+	db := core.CONTEXT.GetDB().Where("space_name = ? AND path = ? AND deleted = ?", spaceName, path, false).Find(&matters)
+	if db.Error != nil {
+		t.Fatal(db.Error)
+	}
+	if len(matters) == 0 {
+		return nil
+	}
+	return matters[0]
+}
+
+// the versions kept for the matter.
+func davVersions(matterUuid string) []*rest.MatterVersion {
+	matterVersionDao := core.CONTEXT.GetBean(new(rest.MatterVersionDao)).(*rest.MatterVersionDao)
+	return matterVersionDao.FindByMatterUuid(matterUuid)
+}
+
+// the space by name.
+func davSpace(name string) *rest.Space {
+	spaceDao := core.CONTEXT.GetBean(new(rest.SpaceDao)).(*rest.SpaceDao)
+	return spaceDao.FindByName(name)
+}
+
+// a client logged in as the user.
+func davApiLogin(t *testing.T, username string) *http.Client {
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	davApiPost(t, client, "/api/user/login", url.Values{"username": {username}, "password": {davTestPassword}})
+	return client
+}
+
+// call the api with the client logged in. return the data of the result.
+func davApiPost(t *testing.T, client *http.Client, api string, form url.Values) map[string]interface{} {
+
+	response, err := client.PostForm(davTestServer.URL+api, form)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, msg, data := davApiResult(t, response)
+	if code != "OK" {
+		t.Fatalf("%s failed. %s", api, msg)
+	}
+	object, _ := data.(map[string]interface{})
+	return object
+}
+
+// call the api with the params in the query and the raw body. return the code, the message and the data of the result.
+func davApiSend(t *testing.T, client *http.Client, api string, query url.Values, body string) (string, string, interface{}) {
+
+	response, err := client.Post(davTestServer.URL+api+"?"+query.Encode(), "application/octet-stream", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return davApiResult(t, response)
+}
+
+// read the web result of an api.
+func davApiResult(t *testing.T, response *http.Response) (string, string, interface{}) {
+
+	defer response.Body.Close()
+
+	webResult := &struct {
+		Code string      `json:"code"`
+		Msg  string      `json:"msg"`
+		Data interface{} `json:"data"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(webResult); err != nil {
+		t.Fatal(err)
+	}
+	return webResult.Code, webResult.Msg, webResult.Data
+}
+
+func TestDavSpaces(t *testing.T) {
+
+	davUrl := startDavServer(t)
+
+	admin := davApiLogin(t, davTestUsername)
+
+	var userUuids []string
+	for _, username := range []string{"davwriter", "davreader"} {
+		user := davApiPost(t, admin, "/api/user/create", url.Values{"username": {username}, "password": {davTestPassword}, "role": {"USER"}, "sizeLimit": {"-1"}, "totalSizeLimit": {"-1"}})
+		userUuids = append(userUuids, user["uuid"].(string))
+	}
+	space := davApiPost(t, admin, "/api/space/create", url.Values{"name": {"davteam"}, "sizeLimit": {"-1"}, "totalSizeLimit": {"-1"}})
+	for i, role := range []string{"READ_WRITE", "READ_ONLY"} {
+		davApiPost(t, admin, "/api/space/member/create", url.Values{"spaceUuid": {space["uuid"].(string)}, "userUuids": {userUuids[i]}, "role": {role}})
+	}
+
+	//the root lists the private space and the member spaces.
+	status, body := davRequestAs(t, "davreader", davTestPassword, "PROPFIND", davUrl, map[string]string{"Depth": "1"}, "")
+	if status != http.StatusMultiStatus || !strings.Contains(body, "/api/dav/davreader<") || !strings.Contains(body, "/api/dav/davteam<") {
+		t.Fatalf("root status %d. %s", status, body)
+	}
+
+	status, _ = davRequestAs(t, "davwriter", davTestPassword, "PUT", davUrl+"/davteam/team.txt", nil, "team")
+	if status != http.StatusCreated {
+		t.Fatalf("writer put status %d", status)
+	}
+
+	status, body = davRequestAs(t, "davreader", davTestPassword, "GET", davUrl+"/davteam/team.txt", nil, "")
+	if status != http.StatusOK || body != "team" {
+		t.Errorf("reader get status %d. %s", status, body)
+	}
+
+	for _, method := range []string{"PUT", "MKCOL", "DELETE"} {
+		status, _ = davRequestAs(t, "davreader", davTestPassword, method, davUrl+"/davteam/reader", nil, "")
+		if status != http.StatusForbidden {
+			t.Errorf("reader %s status %d", method, status)
+		}
+	}
+	status, _ = davRequestAs(t, "davreader", davTestPassword, "MOVE", davUrl+"/davteam/team.txt", map[string]string{"Destination": davUrl + "/davteam/moved.txt"}, "")
+	if status != http.StatusForbidden {
+		t.Errorf("reader MOVE status %d", status)
+	}
+
+	//the admin is not a member.
+	status, body = davRequest(t, "PROPFIND", davUrl, map[string]string{"Depth": "1"}, "")
+	if status != http.StatusMultiStatus || strings.Contains(body, "davteam") {
+		t.Errorf("admin root status %d. %s", status, body)
+	}
+
+	//the paths not starting with a space name are in the private space, as the old versions did.
+	status, _ = davRequest(t, "PUT", davUrl+"/davlegacy.txt", nil, "legacy")
+	if status != http.StatusCreated {
+		t.Fatalf("legacy put status %d", status)
+	}
+	status, body = davRequest(t, "GET", davUrl+"/"+davTestUsername+"/davlegacy.txt", nil, "")
+	if status != http.StatusOK || body != "legacy" {
+		t.Errorf("named get status %d. %s", status, body)
+	}
+	status, body = davRequest(t, "PROPFIND", davUrl+"/davlegacy.txt", map[string]string{"Depth": "0"}, "")
+	if status != http.StatusMultiStatus || !strings.Contains(body, "/api/dav/davlegacy.txt<") {
+		t.Errorf("legacy propfind status %d. %s", status, body)
+	}
+	status, _ = davRequest(t, "MOVE", davUrl+"/davlegacy.txt", map[string]string{"Destination": davUrl + "/davlegacy-moved.txt"}, "")
+	if status != http.StatusCreated || davMatter(t, davTestUsername, "/davlegacy-moved.txt") == nil {
+		t.Errorf("legacy move status %d", status)
+	}
+	davRequest(t, "DELETE", davUrl+"/davlegacy-moved.txt", nil, "")
+}
+
+// run the litmus suites(http://www.webdav.org/neon/litmus/) when litmus is installed.
+// LITMUS_TESTS chooses the suites, eg. "basic copymove props locks http".
+func TestDavLitmus(t *testing.T) {
+
+	litmus, err := exec.LookPath("litmus")
+	if err != nil {
+		t.Skip("litmus is not installed")
+	}
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+
+	cmd := exec.Command(litmus, davUrl+"/litmus/", davTestUsername, davTestPassword)
+	cmd.Env = os.Environ()
+	if tests := os.Getenv("LITMUS_TESTS"); tests != "" {
+		cmd.Env = append(cmd.Env, "TESTS="+tests)
+	}
+	davRequest(t, "MKCOL", davUrl+"/litmus", nil, "")
+
+	output, err := cmd.CombinedOutput()
+	t.Logf("%s", output)
+	if err != nil {
+		t.Errorf("litmus failed. %v", err)
+	}
+}
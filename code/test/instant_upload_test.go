@@ -0,0 +1,72 @@
+package test
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// an upload declared by an existing hash creates the file without the bytes, and still charges the space.
+func TestInstantUpload(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+
+	content := "instant upload"
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+	size := strconv.Itoa(len(content))
+	form := func(filename string, hash string) url.Values {
+		return url.Values{"puuid": {"root"}, "filename": {filename}, "size": {size}, "sha256": {hash}}
+	}
+
+	//an unknown content must be uploaded as usual.
+	code, _, data := davApiSend(t, admin, "/api/matter/upload/instant", form("instant-none.txt", hash), "")
+	if code != "OK" || data != nil {
+		t.Fatalf("unknown content %s %v", code, data)
+	}
+
+	davRequest(t, "PUT", davUrl+"/instant-src.txt", nil, content)
+	src := davMatter(t, davTestUsername, "/instant-src.txt")
+	totalSize := davSpace(davTestUsername).TotalSize
+
+	//sha256 is required, md5 is only checked along with it. the name is checked as a normal upload.
+	md5Only := url.Values{"puuid": {"root"}, "filename": {"instant-md5.txt"}, "size": {size}, "md5": {src.Md5}}
+	if code, _, _ := davApiSend(t, admin, "/api/matter/upload/instant", md5Only, ""); code != "BAD_REQUEST" {
+		t.Errorf("md5 only %s", code)
+	}
+	mismatch := form("instant-md5.txt", hash)
+	mismatch.Set("md5", fmt.Sprintf("%x", md5.Sum([]byte("other"))))
+	if code, _, data := davApiSend(t, admin, "/api/matter/upload/instant", mismatch, ""); code != "OK" || data != nil {
+		t.Errorf("mismatched md5 %s %v", code, data)
+	}
+	if code, _, _ := davApiSend(t, admin, "/api/matter/upload/instant", form("instant/bad.txt", hash), ""); code != "BAD_REQUEST" {
+		t.Errorf("bad name %s", code)
+	}
+	if blobRefCount(src) != 1 {
+		t.Errorf("refused uploads ref count %d", blobRefCount(src))
+	}
+
+	matter := davApiPost(t, admin, "/api/matter/upload/instant", form("instant.txt", hash))
+	if matter["sha256"] != hash || blobRefCount(src) != 2 {
+		t.Errorf("instant matter %v, ref count %d", matter, blobRefCount(src))
+	}
+	if davSpace(davTestUsername).TotalSize != totalSize+int64(len(content)) {
+		t.Errorf("total size %d, want %d", davSpace(davTestUsername).TotalSize, totalSize+int64(len(content)))
+	}
+	if _, body := davRequest(t, "GET", davUrl+"/instant.txt", nil, ""); body != content {
+		t.Errorf("content %s", body)
+	}
+
+	//the quota is checked as a normal upload, and the blob is not referenced.
+	space := davSpace(davTestUsername)
+	davApiPost(t, admin, "/api/space/edit", url.Values{"uuid": {space.Uuid}, "sizeLimit": {"-1"}, "totalSizeLimit": {strconv.FormatInt(space.TotalSize, 10)}})
+	defer davApiPost(t, admin, "/api/space/edit", url.Values{"uuid": {space.Uuid}, "sizeLimit": {"-1"}, "totalSizeLimit": {"-1"}})
+
+	code, _, _ = davApiSend(t, admin, "/api/matter/upload/instant", form("instant-over.txt", hash), "")
+	if code != "BAD_REQUEST" || blobRefCount(src) != 2 || davMatter(t, davTestUsername, "/instant-over.txt") != nil {
+		t.Errorf("over quota %s, ref count %d", code, blobRefCount(src))
+	}
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/eyebluecn/tank/code/rest"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// poll the job until its status is one of the expected. return the job.
+func waitJob(t *testing.T, client *http.Client, uuid string, statuses ...string) map[string]interface{} {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		job := davApiPost(t, client, "/api/job/detail", url.Values{"uuid": {uuid}})
+		for _, status := range statuses {
+			if job["status"] == status {
+				return job
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job status %v, want %v. %v", job["status"], statuses, job["error"])
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// a running crawl job can be canceled and retried. a failed one is retried with the same params.
+func TestJobCancelAndRetry(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+
+	content := []byte("0123456789")
+	var requests int32
+	started := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/job.bin" {
+			http.NotFound(writer, request)
+			return
+		}
+		if atomic.AddInt32(&requests, 1) == 1 {
+			//hang after the head until canceled.
+			writer.Header().Set("Content-Length", "10")
+			_, _ = writer.Write(content[:5])
+			writer.(http.Flusher).Flush()
+			started <- true
+			<-request.Context().Done()
+			return
+		}
+		http.ServeContent(writer, request, "job.bin", time.Now(), bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	//the test server is on the loopback.
+	crawlConfig := fmt.Sprintf(`{"sizeLimit":-1,"bandwidth":-1,"concurrency":%d,"retries":0,"allowHosts":["127.0.0.1","127.0.0.0/8"]}`, rest.CRAWL_DEFAULT_CONCURRENCY)
+	davApiPost(t, admin, "/api/preference/edit/crawl/config", url.Values{"crawlConfig": {crawlConfig}})
+	defer davApiPost(t, admin, "/api/preference/edit/crawl/config", url.Values{"crawlConfig": {fmt.Sprintf(`{"sizeLimit":-1,"bandwidth":-1,"concurrency":%d,"retries":%d}`, rest.CRAWL_DEFAULT_CONCURRENCY, rest.CRAWL_DEFAULT_RETRIES)}})
+
+	job := davApiPost(t, admin, "/api/matter/crawl", url.Values{"url": {server.URL + "/job.bin"}, "filename": {"job.bin"}, "puuid": {"root"}, "async": {"true"}})
+	uuid := job["uuid"].(string)
+
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("crawl not started")
+	}
+	davApiPost(t, admin, "/api/job/cancel", url.Values{"uuid": {uuid}})
+	waitJob(t, admin, uuid, "CANCELED")
+	if davMatter(t, davTestUsername, "/job.bin") != nil {
+		t.Errorf("canceled crawl created the file")
+	}
+
+	job = davApiPost(t, admin, "/api/job/retry", url.Values{"uuid": {uuid}})
+	if job["retryTimes"].(float64) != 1 {
+		t.Errorf("retry times %v", job["retryTimes"])
+	}
+	waitJob(t, admin, uuid, "SUCCESS")
+	if _, body := davRequest(t, "GET", davUrl+"/job.bin", nil, ""); body != string(content) {
+		t.Errorf("retried crawl %s", body)
+	}
+
+	//a finished job cannot be canceled.
+	if code, _, _ := davApiSend(t, admin, "/api/job/cancel", url.Values{"uuid": {uuid}}, ""); code != "BAD_REQUEST" {
+		t.Errorf("cancel finished job %s", code)
+	}
+
+	//a failed job fails again with the same params.
+	job = davApiPost(t, admin, "/api/matter/crawl", url.Values{"url": {server.URL + "/missing.bin"}, "filename": {"job-missing.bin"}, "puuid": {"root"}, "async": {"true"}})
+	uuid = job["uuid"].(string)
+	if job = waitJob(t, admin, uuid, "FAIL", "SUCCESS"); job["status"] != "FAIL" || job["error"] == "" {
+		t.Fatalf("missing url %v", job)
+	}
+	davApiPost(t, admin, "/api/job/retry", url.Values{"uuid": {uuid}})
+	if job = waitJob(t, admin, uuid, "FAIL", "SUCCESS"); job["status"] != "FAIL" || job["retryTimes"].(float64) != 1 {
+		t.Errorf("retried missing url %v", job)
+	}
+}
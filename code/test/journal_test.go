@@ -0,0 +1,97 @@
+package test
+
+import (
+	"github.com/eyebluecn/tank/code/tool/journal"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournalPending(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	j, err := journal.Open(filepath.Join(dir, "journal.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	action := &journal.Action{Op: journal.OP_RENAME, Src: "/a", Dest: "/b"}
+	_ = j.Begin("w1")
+	_ = j.Begin("w2")
+	_ = j.Log("w1", action)
+	_ = j.Log("w2", &journal.Action{Op: journal.OP_MKDIR, Dest: "/c"})
+	_ = j.End("w2")
+
+	//a torn tail is ignored.
+	file, _ := os.OpenFile(filepath.Join(dir, "journal.log"), os.O_APPEND|os.O_WRONLY, 0644)
+	_, _ = file.WriteString(`{"work":"w1","type":"ACT`)
+	_ = file.Close()
+
+	works, actions, err := j.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(works) != 1 || works[0] != "w1" || len(actions["w1"]) != 1 || *actions["w1"][0] != *action {
+		t.Errorf("pending error. %v %v", works, actions)
+	}
+
+	//truncated when no work is opening.
+	_ = j.End("w1")
+	works, _, _ = j.Pending()
+	if len(works) != 0 {
+		t.Errorf("journal should be empty. %v", works)
+	}
+}
+
+func TestJournalApplyAndUndo(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	_ = os.Mkdir(src, 0755)
+	_ = ioutil.WriteFile(filepath.Join(src, "a.txt"), []byte("a"), 0644)
+
+	rename := &journal.Action{Op: journal.OP_RENAME, Src: src, Dest: dest}
+	mkdir := &journal.Action{Op: journal.OP_MKDIR, Dest: filepath.Join(dest, "sub")}
+
+	//applied twice as a replay.
+	for i := 0; i < 2; i++ {
+		if err := journal.Apply(rename); err != nil {
+			t.Fatal(err)
+		}
+		if err := journal.Apply(mkdir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dest, "a.txt")); err != nil {
+		t.Errorf("rename not applied. %v", err)
+	}
+
+	//undone twice as a roll back.
+	for i := 0; i < 2; i++ {
+		if err := journal.Undo(mkdir); err != nil {
+			t.Fatal(err)
+		}
+		if err := journal.Undo(rename); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(src, "a.txt")); err != nil {
+		t.Errorf("rename not undone. %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "sub")); !os.IsNotExist(err) {
+		t.Errorf("mkdir not undone. %v", err)
+	}
+}
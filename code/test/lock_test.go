@@ -0,0 +1,160 @@
+package test
+
+import (
+	"github.com/eyebluecn/tank/code/tool/lock"
+	"testing"
+	"time"
+)
+
+func TestLockOverlap(t *testing.T) {
+
+	cases := []struct {
+		a       string
+		b       string
+		overlap bool
+	}{
+		{"/a", "/a", true},
+		{"/a", "/a/b", true},
+		{"/a/b/c", "/a", true},
+		{"", "/a", true},
+		{"/a", "/ab", false},
+		{"/a/b", "/a/c", false},
+	}
+	for _, c := range cases {
+		if lock.Overlap(c.a, c.b) != c.overlap {
+			t.Errorf("overlap of %s and %s should be %v", c.a, c.b, c.overlap)
+		}
+	}
+
+	if lock.CleanPath("/") != "" || lock.CleanPath("/a/b/") != "/a/b" || lock.CleanPath("a//b") != "/a/b" {
+		t.Error("clean path error.")
+	}
+}
+
+func TestLockConflict(t *testing.T) {
+
+	locker := lock.NewPathLocker()
+	wait := 50 * time.Millisecond
+
+	reads, err := locker.Acquire([]lock.Request{lock.Read("s1", "/a")}, "reader", wait, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//reads share.
+	other, err := locker.Acquire([]lock.Request{lock.Read("s1", "/a/b")}, "reader2", wait, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locker.Release(other)
+
+	//write on the descendant or the ancestor conflicts.
+	if _, err := locker.Acquire([]lock.Request{lock.Write("s1", "/a/b")}, "writer", wait, time.Hour); err != lock.ErrTimeout {
+		t.Errorf("write in a read subtree should timeout. %v", err)
+	}
+	if _, err := locker.Acquire([]lock.Request{lock.Write("s1", "/")}, "writer", wait, time.Hour); err != lock.ErrTimeout {
+		t.Errorf("write on the root should timeout. %v", err)
+	}
+
+	//sibling subtree and other scope are free.
+	other, err = locker.Acquire([]lock.Request{lock.Write("s1", "/ab"), lock.Write("s2", "/a")}, "writer", wait, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locker.Release(other)
+
+	//all or nothing.
+	if _, err := locker.Acquire([]lock.Request{lock.Write("s1", "/c"), lock.Write("s1", "/a")}, "mover", wait, time.Hour); err != lock.ErrTimeout {
+		t.Errorf("multi path write should timeout. %v", err)
+	}
+	other, err = locker.Acquire([]lock.Request{lock.Write("s1", "/c")}, "writer", wait, time.Hour)
+	if err != nil {
+		t.Errorf("failed acquire should hold nothing. %v", err)
+	}
+	locker.Release(other)
+
+	locker.Release(reads)
+	if len(locker.List()) != 0 {
+		t.Errorf("all the locks should be released. %v", locker.List())
+	}
+}
+
+func TestLockWait(t *testing.T) {
+
+	locker := lock.NewPathLocker()
+
+	held, err := locker.Acquire([]lock.Request{lock.Write("s1", "/a")}, "holder", time.Second, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		locks, err := locker.Acquire([]lock.Request{lock.Write("s1", "/a/b")}, "waiter", 5*time.Second, time.Hour)
+		locker.Release(locks)
+		done <- err
+	}()
+
+	//the waiter is listed.
+	deadline := time.Now().Add(time.Second)
+	for {
+		list := locker.List()
+		if len(list) == 2 && list[1].Waiting && list[1].Owner == "waiter" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("waiter not listed. %v", list)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	//release wakes the waiter.
+	locker.Release(held)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second):
+		t.Error("waiter not woken up.")
+	}
+
+	//an expired lease blocks nothing.
+	_, err = locker.Acquire([]lock.Request{lock.Write("s1", "/a")}, "dead", time.Second, 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	locks, err := locker.Acquire([]lock.Request{lock.Read("s1", "/a")}, "reader", 5*time.Second, time.Hour)
+	if err != nil || time.Since(start) > time.Second {
+		t.Errorf("expired lock should be dropped. %v %v", err, time.Since(start))
+	}
+	locker.Release(locks)
+}
+
+func TestLockRenew(t *testing.T) {
+
+	locker := lock.NewPathLocker()
+
+	held, err := locker.Acquire([]lock.Request{lock.Write("s1", "/a")}, "holder", time.Second, 30*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = locker.Renew(held, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the renewed lease still blocks after the first one ends.
+	time.Sleep(60 * time.Millisecond)
+	_, err = locker.Acquire([]lock.Request{lock.Read("s1", "/a/b")}, "reader", 50*time.Millisecond, time.Hour)
+	if err != lock.ErrTimeout {
+		t.Errorf("renewed lock should block. %v", err)
+	}
+
+	//a released lock cannot be renewed.
+	locker.Release(held)
+	if err = locker.Renew(held, time.Hour); err != lock.ErrExpired {
+		t.Errorf("released lock should not be renewed. %v", err)
+	}
+}
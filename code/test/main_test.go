@@ -3,6 +3,9 @@ package test
 import (
 	"fmt"
 	"github.com/eyebluecn/tank/code/tool/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -30,3 +33,48 @@ func TestDayAgo(t *testing.T) {
 	fmt.Printf("%s\n", util.ConvertTimeToDateTimeString(thenDay))
 
 }
+
+func TestDeleteEmptyDirTree(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "tree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_ = os.MkdirAll(filepath.Join(dir, "a", "b", "c"), 0755)
+	_ = os.MkdirAll(filepath.Join(dir, "a", "d"), 0755)
+	_ = os.MkdirAll(filepath.Join(dir, "e", "f"), 0755)
+	_ = ioutil.WriteFile(filepath.Join(dir, "e", "f", "g.txt"), []byte("g"), 0644)
+
+	if util.DeleteEmptyDirTree(dir) {
+		t.Errorf("dir with a file should be kept")
+	}
+	if util.PathExists(filepath.Join(dir, "a")) {
+		t.Errorf("empty tree a should be deleted")
+	}
+	if !util.PathExists(filepath.Join(dir, "e", "f", "g.txt")) {
+		t.Errorf("file should be kept")
+	}
+}
+
+func TestIsSubPath(t *testing.T) {
+
+	cases := []struct {
+		path   string
+		dir    string
+		expect bool
+	}{
+		{"/data/import", "/data/import", true},
+		{"/data/import/a/b", "/data/import", true},
+		{"/data/import2", "/data/import", false},
+		{"/data", "/data/import", false},
+		{"/data/..a", "/data", true},
+		{"/etc/passwd", "/", true},
+	}
+	for _, c := range cases {
+		if util.IsSubPath(c.path, c.dir) != c.expect {
+			t.Errorf("%s in %s should be %v", c.path, c.dir, c.expect)
+		}
+	}
+}
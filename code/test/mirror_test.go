@@ -0,0 +1,77 @@
+package test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// a local tree is mirrored only if it ends and is not too deep.
+func TestMirrorTree(t *testing.T) {
+
+	startDavServer(t)
+	admin := davApiLogin(t, davTestUsername)
+
+	root, err := ioutil.TempDir("", "mirror")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	davApiPost(t, admin, "/api/preference/edit/mirror/config", url.Values{"mirrorConfig": {`{"roots":["` + root + `"]}`}})
+	defer davApiPost(t, admin, "/api/preference/edit/mirror/config", url.Values{"mirrorConfig": {`{}`}})
+
+	mirror := func(srcPath string, destPath string) string {
+		code, _, _ := davApiSend(t, admin, "/api/matter/mirror", url.Values{"srcPath": {srcPath}, "destPath": {destPath}}, "")
+		return code
+	}
+
+	//a symlink to its ancestor.
+	loop := filepath.Join(root, "loop")
+	if err := os.MkdirAll(filepath.Join(loop, "a"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(loop, "a", "a.txt"), []byte("a"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(loop, filepath.Join(loop, "a", "back")); err != nil {
+		t.Fatal(err)
+	}
+	if code := mirror(loop, "/mirror-loop"); code != "BAD_REQUEST" {
+		t.Errorf("symlink cycle %s", code)
+	}
+	if davMatter(t, davTestUsername, "/mirror-loop/loop") != nil {
+		t.Errorf("symlink cycle mirrored")
+	}
+
+	//a symlink to a sibling is fine.
+	if err := os.Remove(filepath.Join(loop, "a", "back")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(loop, "b"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(loop, "a"), filepath.Join(loop, "b", "a")); err != nil {
+		t.Fatal(err)
+	}
+	if code := mirror(loop, "/mirror-loop"); code != "OK" {
+		t.Errorf("symlink to a sibling %s", code)
+	}
+	if davMatter(t, davTestUsername, "/mirror-loop/loop/b/a/a.txt") == nil {
+		t.Errorf("symlink to a sibling not mirrored")
+	}
+
+	//deeper than the limit.
+	deep := filepath.Join(root, "deep")
+	if err := os.MkdirAll(filepath.Join(deep, strings.Repeat("d/", 40)), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if code := mirror(deep, "/mirror-deep"); code != "BAD_REQUEST" {
+		t.Errorf("too deep %s", code)
+	}
+	if davMatter(t, davTestUsername, "/mirror-deep/deep") != nil {
+		t.Errorf("too deep mirrored")
+	}
+}
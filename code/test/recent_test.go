@@ -0,0 +1,50 @@
+package test
+
+import (
+	"net/url"
+	"testing"
+)
+
+// whether the page lists the matter.
+func pageHasMatter(pager map[string]interface{}, matterUuid string) bool {
+	items, _ := pager["data"].([]interface{})
+	for _, item := range items {
+		if entry, ok := item.(map[string]interface{}); ok && entry["matterUuid"] == matterUuid {
+			return true
+		}
+	}
+	return false
+}
+
+// uploads and downloads are recorded as the user's recent files. the trashed matters are filtered from recents and favorites.
+func TestRecentAndFavorite(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+
+	davRequest(t, "PUT", davUrl+"/recent.txt", nil, "recent")
+	matter := davMatter(t, davTestUsername, "/recent.txt")
+
+	recents := davApiPost(t, admin, "/api/recent/page", url.Values{"mode": {"UPLOAD"}})
+	if !pageHasMatter(recents, matter.Uuid) {
+		t.Errorf("upload not recorded")
+	}
+	davRequest(t, "GET", davUrl+"/recent.txt", nil, "")
+	recents = davApiPost(t, admin, "/api/recent/page", url.Values{"mode": {"DOWNLOAD"}})
+	if !pageHasMatter(recents, matter.Uuid) {
+		t.Errorf("download not recorded")
+	}
+
+	davApiPost(t, admin, "/api/favorite/add", url.Values{"matterUuid": {matter.Uuid}})
+	if !pageHasMatter(davApiPost(t, admin, "/api/favorite/page", url.Values{}), matter.Uuid) {
+		t.Errorf("favorite not listed")
+	}
+
+	davApiPost(t, admin, "/api/matter/soft/delete", url.Values{"uuid": {matter.Uuid}})
+	if pageHasMatter(davApiPost(t, admin, "/api/recent/page", url.Values{}), matter.Uuid) {
+		t.Errorf("trashed matter in recents")
+	}
+	if pageHasMatter(davApiPost(t, admin, "/api/favorite/page", url.Values{}), matter.Uuid) {
+		t.Errorf("trashed matter in favorites")
+	}
+}
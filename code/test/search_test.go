@@ -0,0 +1,63 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/eyebluecn/tank/code/tool/search"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+
+	cases := map[string][]string{
+		"Quarterly_Report-2021.PDF": {"quarterly", "report", "2021", "pdf"},
+		"年度报告":                      {"年度", "度报", "报告", "告"},
+		"tank云盘":                    {"tank", "云盘", "盘"},
+		"  ":                        nil,
+	}
+	for text, expected := range cases {
+		terms := search.Tokenize(text)
+		if !reflect.DeepEqual(terms, expected) {
+			t.Errorf("tokenize %s error. %v", text, terms)
+		}
+	}
+
+	long := strings.Repeat("a", 100)
+	if terms := search.Tokenize(long); len(terms) != 1 || len(terms[0]) != search.TERM_MAX_LENGTH {
+		t.Errorf("long word should be truncated. %v", terms)
+	}
+
+	counts := search.CountTerms("b a b c b a", 2)
+	if !reflect.DeepEqual(counts, map[string]int{"b": 3, "a": 2}) {
+		t.Errorf("count terms error. %v", counts)
+	}
+}
+
+func TestExtractText(t *testing.T) {
+
+	text, err := search.ExtractText("notes.md", strings.NewReader("# hello tank"), 12)
+	if err != nil || text != "# hello tank" {
+		t.Errorf("extract md error. %s %v", text, err)
+	}
+
+	buffer := &bytes.Buffer{}
+	zipWriter := zip.NewWriter(buffer)
+	writer, _ := zipWriter.Create("word/document.xml")
+	_, _ = io.WriteString(writer, `<w:document xmlns:w="w"><w:body><w:p><w:r><w:t>Bud</w:t></w:r><w:r><w:t>get</w:t></w:r></w:p><w:p><w:r><w:t>plan</w:t></w:r></w:p></w:body></w:document>`)
+	writer, _ = zipWriter.Create("word/styles.xml")
+	_, _ = io.WriteString(writer, `<w:styles xmlns:w="w"><w:t>ignored</w:t></w:styles>`)
+	_ = zipWriter.Close()
+
+	text, err = search.ExtractText("plan.docx", bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil || !reflect.DeepEqual(search.Tokenize(text), []string{"budget", "plan"}) {
+		t.Errorf("extract docx error. %s %v", text, err)
+	}
+
+	_, err = search.ExtractText("photo.png", strings.NewReader(""), 0)
+	if err != search.ErrNotExtractable {
+		t.Errorf("png should not be extractable. %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/rest"
+	"gorm.io/gorm"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// the directories and the space are charged along with the files.
+func TestSizeDelta(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+
+	davRequest(t, "MKCOL", davUrl+"/size", nil, "")
+	davRequest(t, "MKCOL", davUrl+"/size/sub", nil, "")
+	totalSize := davSpace(davTestUsername).TotalSize
+
+	davRequest(t, "PUT", davUrl+"/size/sub/a.txt", nil, "0123456789")
+	davRequest(t, "PUT", davUrl+"/size/b.txt", nil, "01234")
+	if size := davMatter(t, davTestUsername, "/size").Size; size != 15 {
+		t.Errorf("dir size %d", size)
+	}
+	if size := davMatter(t, davTestUsername, "/size/sub").Size; size != 10 {
+		t.Errorf("sub dir size %d", size)
+	}
+	if size := davSpace(davTestUsername).TotalSize; size != totalSize+15 {
+		t.Errorf("total size %d, want %d", size, totalSize+15)
+	}
+
+	davRequest(t, "PUT", davUrl+"/size/sub/a.txt", nil, "012")
+	davRequest(t, "MKCOL", davUrl+"/size-moved", nil, "")
+	davRequest(t, "MOVE", davUrl+"/size/sub/a.txt", map[string]string{"Destination": davUrl + "/size-moved/a.txt"}, "")
+	if size := davMatter(t, davTestUsername, "/size").Size; size != 5 {
+		t.Errorf("dir size after move %d", size)
+	}
+	if size := davMatter(t, davTestUsername, "/size-moved").Size; size != 3 {
+		t.Errorf("moved dir size %d", size)
+	}
+	davRequest(t, "DELETE", davUrl+"/size", nil, "")
+	davRequest(t, "DELETE", davUrl+"/size-moved", nil, "")
+	if size := davSpace(davTestUsername).TotalSize; size != totalSize {
+		t.Errorf("total size after delete %d, want %d", size, totalSize)
+	}
+}
+
+// the upload over the quota leaves neither the blob nor the charge. an upload session can finish once there is room.
+func TestSizeQuota(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+	blobDao := core.CONTEXT.GetBean(new(rest.BlobDao)).(*rest.BlobDao)
+
+	space := davSpace(davTestUsername)
+	limit := func(totalSizeLimit int64) {
+		davApiPost(t, admin, "/api/space/edit", url.Values{"uuid": {space.Uuid}, "sizeLimit": {"-1"}, "totalSizeLimit": {strconv.FormatInt(totalSizeLimit, 10)}})
+	}
+	defer limit(-1)
+
+	content := "over the quota"
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+
+	limit(space.TotalSize + 1)
+	if status, _ := davRequest(t, "PUT", davUrl+"/quota.txt", nil, content); status == http.StatusCreated {
+		t.Errorf("upload over quota created")
+	}
+	if davMatter(t, davTestUsername, "/quota.txt") != nil || blobDao.FindBySha256(space.Backend, hash) != nil {
+		t.Errorf("upload over quota left the file or the blob")
+	}
+	if size := davSpace(davTestUsername).TotalSize; size != space.TotalSize {
+		t.Errorf("total size %d, want %d", size, space.TotalSize)
+	}
+
+	//the quota is checked again when the session finishes.
+	limit(-1)
+	session := davApiPost(t, admin, "/api/upload/session/init", url.Values{"puuid": {"root"}, "filename": {"quota.txt"}, "size": {strconv.Itoa(len(content))}})
+	uuid := session["uuid"].(string)
+	davApiSend(t, admin, "/api/upload/session/append", url.Values{"uuid": {uuid}, "offset": {"0"}}, content)
+
+	limit(space.TotalSize + 1)
+	if code, _, _ := davApiSend(t, admin, "/api/upload/session/finish", url.Values{"uuid": {uuid}}, ""); code != "BAD_REQUEST" {
+		t.Errorf("finish over quota %s", code)
+	}
+	if blobDao.FindBySha256(space.Backend, hash) != nil || davSpace(davTestUsername).TotalSize != space.TotalSize {
+		t.Errorf("finish over quota left the blob or the charge")
+	}
+
+	limit(-1)
+	davApiPost(t, admin, "/api/upload/session/finish", url.Values{"uuid": {uuid}})
+	if _, body := davRequest(t, "GET", davUrl+"/quota.txt", nil, ""); body != content {
+		t.Errorf("retried finish %s", body)
+	}
+
+	//a copy is charged as an upload.
+	total := davSpace(davTestUsername).TotalSize
+	limit(total)
+	if status, _ := davRequest(t, "COPY", davUrl+"/quota.txt", map[string]string{"Destination": davUrl + "/quota-copy.txt"}, ""); status == http.StatusCreated {
+		t.Errorf("copy over quota created")
+	}
+	if davMatter(t, davTestUsername, "/quota-copy.txt") != nil || davSpace(davTestUsername).TotalSize != total {
+		t.Errorf("copy over quota left the file or the charge")
+	}
+	limit(-1)
+	davRequest(t, "DELETE", davUrl+"/quota.txt", nil, "")
+}
+
+// the drifted sizes are reported, and corrected if asked.
+func TestSizeRecompute(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+
+	davRequest(t, "MKCOL", davUrl+"/drift", nil, "")
+	davRequest(t, "PUT", davUrl+"/drift/a.txt", nil, "drift")
+	dir := davMatter(t, davTestUsername, "/drift")
+	space := davSpace(davTestUsername)
+
+	db := core.CONTEXT.GetDB()
+	db.Model(&rest.Matter{}).Where("uuid = ?", dir.Uuid).Update("size", gorm.Expr("size + ?", 100))
+	db.Model(&rest.Space{}).Where("uuid = ?", space.Uuid).Update("total_size", gorm.Expr("total_size + ?", 7))
+
+	recompute := func(fix string) map[string]interface{} {
+		code, msg, data := davApiSend(t, admin, "/api/space/size/recompute", url.Values{"uuid": {space.Uuid}, "fix": {fix}}, "")
+		drifts, _ := data.([]interface{})
+		if code != "OK" || len(drifts) != 1 {
+			t.Fatalf("recompute %s %v", msg, data)
+		}
+		return drifts[0].(map[string]interface{})
+	}
+
+	dirs := func(drift map[string]interface{}) int {
+		dirs, _ := drift["dirs"].([]interface{})
+		return len(dirs)
+	}
+
+	drift := recompute("false")
+	if drift["totalSize"].(float64)-drift["actualTotalSize"].(float64) != 7 || dirs(drift) != 1 {
+		t.Errorf("drift %v", drift)
+	}
+	if davMatter(t, davTestUsername, "/drift").Size != 105 {
+		t.Errorf("reported only but fixed")
+	}
+
+	recompute("true")
+	if size := davMatter(t, davTestUsername, "/drift").Size; size != 5 {
+		t.Errorf("fixed dir size %d", size)
+	}
+	if size := davSpace(davTestUsername).TotalSize; size != space.TotalSize {
+		t.Errorf("fixed total size %d, want %d", size, space.TotalSize)
+	}
+	if drift := recompute("false"); dirs(drift) != 0 || drift["totalSize"] != drift["actualTotalSize"] {
+		t.Errorf("drift after fix %v", drift)
+	}
+}
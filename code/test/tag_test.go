@@ -0,0 +1,60 @@
+package test
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/rest"
+	"net/url"
+	"testing"
+)
+
+// tags survive rename, move and copy, and go with the physical delete.
+func TestTag(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+	matterTagDao := core.CONTEXT.GetBean(new(rest.MatterTagDao)).(*rest.MatterTagDao)
+
+	davRequest(t, "MKCOL", davUrl+"/tag", nil, "")
+	davRequest(t, "PUT", davUrl+"/tag/a.txt", nil, "tag")
+	matter := davMatter(t, davTestUsername, "/tag/a.txt")
+
+	tag := davApiPost(t, admin, "/api/tag/add", url.Values{"matterUuid": {matter.Uuid}, "name": {"tested"}})
+	tagUuid := tag["uuid"].(string)
+
+	tagCount := func(path string) int {
+		m := davMatter(t, davTestUsername, path)
+		if m == nil {
+			t.Fatalf("%s not found", path)
+		}
+		code, msg, data := davApiSend(t, admin, "/api/tag/matter/list", url.Values{"matterUuid": {m.Uuid}}, "")
+		if code != "OK" {
+			t.Fatalf("tag list %s", msg)
+		}
+		tags, _ := data.([]interface{})
+		return len(tags)
+	}
+
+	davRequest(t, "MOVE", davUrl+"/tag/a.txt", map[string]string{"Destination": davUrl + "/tag/b.txt"}, "")
+	if tagCount("/tag/b.txt") != 1 {
+		t.Errorf("tag lost by rename")
+	}
+	davRequest(t, "MOVE", davUrl+"/tag", map[string]string{"Destination": davUrl + "/tag-moved"}, "")
+	if tagCount("/tag-moved/b.txt") != 1 {
+		t.Errorf("tag lost by move")
+	}
+	davRequest(t, "COPY", davUrl+"/tag-moved/b.txt", map[string]string{"Destination": davUrl + "/tag-moved/c.txt"}, "")
+	if tagCount("/tag-moved/c.txt") != 1 {
+		t.Errorf("tag not copied")
+	}
+
+	pager := davApiPost(t, admin, "/api/matter/page", url.Values{"tagUuid": {tagUuid}})
+	if pager["totalItems"].(float64) != 2 {
+		t.Errorf("matters by tag %v", pager["totalItems"])
+	}
+
+	copied := davMatter(t, davTestUsername, "/tag-moved/c.txt")
+	davRequest(t, "DELETE", davUrl+"/tag-moved", nil, "")
+	if len(matterTagDao.FindByMatterUuid(matter.Uuid)) != 0 || len(matterTagDao.FindByMatterUuid(copied.Uuid)) != 0 {
+		t.Errorf("tags left after delete")
+	}
+}
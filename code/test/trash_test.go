@@ -0,0 +1,119 @@
+package test
+
+import (
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/rest"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// restore a trashed matter to its original directory, or to destUuid if not empty. return the status and the restored matter.
+func trashRestore(t *testing.T, client *http.Client, matterUuid string, destUuid string, conflict string) (string, map[string]interface{}) {
+	code, msg, data := davApiSend(t, client, "/api/trash/restore", url.Values{"uuids": {matterUuid}, "destUuid": {destUuid}, "conflict": {conflict}}, "")
+	if code != "OK" {
+		return code, nil
+	}
+	restores, _ := data.([]interface{})
+	if len(restores) != 1 {
+		t.Fatalf("restore %s. %v", msg, data)
+	}
+	restore := restores[0].(map[string]interface{})
+	return restore["status"].(string), restore["matter"].(map[string]interface{})
+}
+
+// a matter is restored to its original path even if the parent is trashed, and the name conflicts in the destination are resolved as asked.
+func TestTrashRestore(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+
+	//the parent trashed after the child is restored with it.
+	davRequest(t, "MKCOL", davUrl+"/trash-dir", nil, "")
+	davRequest(t, "PUT", davUrl+"/trash-dir/child.txt", nil, "child")
+	child := davMatter(t, davTestUsername, "/trash-dir/child.txt")
+	davApiPost(t, admin, "/api/matter/soft/delete", url.Values{"uuid": {child.Uuid}})
+	davApiPost(t, admin, "/api/matter/soft/delete", url.Values{"uuid": {davMatter(t, davTestUsername, "/trash-dir").Uuid}})
+	if status, _ := trashRestore(t, admin, child.Uuid, "", "RENAME"); status != "RESTORED" {
+		t.Errorf("restore child %s", status)
+	}
+	if _, body := davRequest(t, "GET", davUrl+"/trash-dir/child.txt", nil, ""); body != "child" {
+		t.Errorf("restored child %s", body)
+	}
+
+	//a same named file is in the destination.
+	davRequest(t, "MKCOL", davUrl+"/trash-src", nil, "")
+	davRequest(t, "MKCOL", davUrl+"/trash-dest", nil, "")
+	dest := davMatter(t, davTestUsername, "/trash-dest")
+	trashed := func(name string) string {
+		davRequest(t, "PUT", davUrl+"/trash-src/"+name, nil, "trashed")
+		matter := davMatter(t, davTestUsername, "/trash-src/"+name)
+		davApiPost(t, admin, "/api/matter/soft/delete", url.Values{"uuid": {matter.Uuid}})
+		davRequest(t, "PUT", davUrl+"/trash-dest/"+name, nil, "alive")
+		return matter.Uuid
+	}
+
+	uuid := trashed("trash-skip.txt")
+	if status, _ := trashRestore(t, admin, uuid, dest.Uuid, "SKIP"); status != "SKIPPED" {
+		t.Errorf("skip %s", status)
+	}
+	if _, body := davRequest(t, "GET", davUrl+"/trash-dest/trash-skip.txt", nil, ""); body != "alive" {
+		t.Errorf("skipped %s", body)
+	}
+
+	uuid = trashed("trash-rename.txt")
+	status, matter := trashRestore(t, admin, uuid, dest.Uuid, "RENAME")
+	if status != "RENAMED" || matter["name"] == "trash-rename.txt" {
+		t.Fatalf("rename %s %v", status, matter)
+	}
+	if _, body := davRequest(t, "GET", davUrl+matter["path"].(string), nil, ""); body != "trashed" {
+		t.Errorf("renamed %s", body)
+	}
+
+	//overwriting keeps the alive content as a version, and respects the webdav locks.
+	space := davSpace(davTestUsername)
+	davApiPost(t, admin, "/api/space/edit/version", url.Values{"uuid": {space.Uuid}, "versionKeepNum": {"10"}, "versionKeepDays": {"-1"}})
+	defer davApiPost(t, admin, "/api/space/edit/version", url.Values{"uuid": {space.Uuid}, "versionKeepNum": {"0"}, "versionKeepDays": {"-1"}})
+
+	uuid = trashed("trash-overwrite.txt")
+	alive := davMatter(t, davTestUsername, "/trash-dest/trash-overwrite.txt")
+	token := davLock(t, davUrl+"/trash-dest/trash-overwrite.txt")
+	if status, _ := trashRestore(t, admin, uuid, dest.Uuid, "OVERWRITE"); status != "LOCKED" {
+		t.Errorf("overwrite locked %s", status)
+	}
+	davUnlock(t, davUrl+"/trash-dest/trash-overwrite.txt", token)
+
+	status, matter = trashRestore(t, admin, uuid, dest.Uuid, "OVERWRITE")
+	if status != "OVERWRITTEN" || matter["uuid"] != alive.Uuid {
+		t.Fatalf("overwrite %s %v", status, matter)
+	}
+	if _, body := davRequest(t, "GET", davUrl+"/trash-dest/trash-overwrite.txt", nil, ""); body != "trashed" {
+		t.Errorf("overwritten %s", body)
+	}
+	if versions := davVersions(alive.Uuid); len(versions) != 1 || versions[0].Size != int64(len("alive")) {
+		t.Errorf("overwritten versions %v", versions)
+	}
+}
+
+// the earliest matters are deleted when the trash exceeds its limit, under the locks of their own paths.
+func TestTrashSizeLimit(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+	matterDao := core.CONTEXT.GetBean(new(rest.MatterDao)).(*rest.MatterDao)
+
+	space := davSpace(davTestUsername)
+	davApiPost(t, admin, "/api/space/edit/trash", url.Values{"uuid": {space.Uuid}, "trashSizeLimit": {"0"}})
+	defer davApiPost(t, admin, "/api/space/edit/trash", url.Values{"uuid": {space.Uuid}, "trashSizeLimit": {"-1"}})
+
+	//the directory just trashed is the earliest one, and its path is locked by the soft delete.
+	davRequest(t, "MKCOL", davUrl+"/trash-limit", nil, "")
+	davRequest(t, "PUT", davUrl+"/trash-limit/a.txt", nil, "over the limit")
+	dir := davMatter(t, davTestUsername, "/trash-limit")
+	file := davMatter(t, davTestUsername, "/trash-limit/a.txt")
+	davApiPost(t, admin, "/api/matter/soft/delete", url.Values{"uuid": {dir.Uuid}})
+
+	if matterDao.FindByUuid(dir.Uuid) != nil || matterDao.FindByUuid(file.Uuid) != nil {
+		t.Errorf("trash over the limit is kept")
+	}
+}
@@ -0,0 +1,89 @@
+package test
+
+import (
+	"crypto/md5"
+	"fmt"
+	"github.com/eyebluecn/tank/code/core"
+	"github.com/eyebluecn/tank/code/rest"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// the chunks are appended at the received offset only, so a client can resume from it.
+func TestUploadSessionOffset(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+
+	session := davApiPost(t, admin, "/api/upload/session/init", url.Values{"puuid": {"root"}, "filename": {"session.txt"}, "size": {"10"}})
+	uuid := session["uuid"].(string)
+
+	offsetOf := func() float64 {
+		return davApiPost(t, admin, "/api/upload/session/detail", url.Values{"uuid": {uuid}})["offset"].(float64)
+	}
+
+	code, msg, _ := davApiSend(t, admin, "/api/upload/session/append", url.Values{"uuid": {uuid}, "offset": {"0"}}, "01234")
+	if code != "OK" || offsetOf() != 5 {
+		t.Fatalf("append %s %s, offset %v", code, msg, offsetOf())
+	}
+
+	//a chunk resent at a stale offset is refused.
+	code, _, _ = davApiSend(t, admin, "/api/upload/session/append", url.Values{"uuid": {uuid}, "offset": {"0"}}, "01234")
+	if code != "CONFLICT" || offsetOf() != 5 {
+		t.Errorf("stale append %s, offset %v", code, offsetOf())
+	}
+
+	//a chunk beyond the declared size is refused, and the received bytes are kept.
+	code, _, _ = davApiSend(t, admin, "/api/upload/session/append", url.Values{"uuid": {uuid}, "offset": {"5"}}, "56789X")
+	if code != "BAD_REQUEST" || offsetOf() != 5 {
+		t.Errorf("overflow append %s, offset %v", code, offsetOf())
+	}
+
+	//not finished until all the bytes are received.
+	code, _, _ = davApiSend(t, admin, "/api/upload/session/finish", url.Values{"uuid": {uuid}}, "")
+	if code != "BAD_REQUEST" {
+		t.Errorf("early finish %s", code)
+	}
+
+	code, msg, _ = davApiSend(t, admin, "/api/upload/session/append", url.Values{"uuid": {uuid}, "offset": {"5"}}, "56789")
+	if code != "OK" || offsetOf() != 10 {
+		t.Fatalf("resume %s %s, offset %v", code, msg, offsetOf())
+	}
+
+	matter := davApiPost(t, admin, "/api/upload/session/finish", url.Values{"uuid": {uuid}})
+	if matter["size"].(float64) != 10 || matter["md5"] != fmt.Sprintf("%x", md5.Sum([]byte("0123456789"))) {
+		t.Errorf("finished matter %v", matter)
+	}
+	if _, body := davRequest(t, "GET", davUrl+"/session.txt", nil, ""); body != "0123456789" {
+		t.Errorf("content %s", body)
+	}
+}
+
+// a guest uploads with one session per upload token, and only while the token is alive.
+func TestAlienUploadSession(t *testing.T) {
+
+	startDavServer(t)
+	admin := davApiLogin(t, davTestUsername)
+
+	expireTime := time.Now().Add(time.Hour).Format("2006-01-02 15:04:05")
+	uploadToken := davApiPost(t, admin, "/api/alien/fetch/upload/token", url.Values{"filename": {"alien.txt"}, "expireTime": {expireTime}, "size": {"5"}, "dirPath": {"/alien"}})
+	tokenUuid := uploadToken["uuid"].(string)
+
+	session := davApiPost(t, http.DefaultClient, "/api/alien/upload/init", url.Values{"uploadTokenUuid": {tokenUuid}, "size": {"5"}})
+	uuid := session["uuid"].(string)
+	if code, _, _ := davApiSend(t, http.DefaultClient, "/api/alien/upload/init", url.Values{"uploadTokenUuid": {tokenUuid}, "size": {"5"}}, ""); code != "CONFLICT" {
+		t.Errorf("second init %s", code)
+	}
+
+	//the session cannot outlive the token.
+	db := core.CONTEXT.GetDB().Model(&rest.UploadToken{}).Where("uuid = ?", tokenUuid).Update("expire_time", time.Now().Add(-time.Minute))
+	if db.Error != nil {
+		t.Fatal(db.Error)
+	}
+	code, _, _ := davApiSend(t, http.DefaultClient, "/api/alien/upload/append", url.Values{"uploadTokenUuid": {tokenUuid}, "uuid": {uuid}, "offset": {"0"}}, "01234")
+	if code != "BAD_REQUEST" {
+		t.Errorf("append with expired token %s", code)
+	}
+}
@@ -0,0 +1,109 @@
+package test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// overwriting keeps the previous content as a version within the space's policy. versions count in the space's size.
+func TestVersion(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+
+	space := davSpace(davTestUsername)
+	davApiPost(t, admin, "/api/space/edit/version", url.Values{"uuid": {space.Uuid}, "versionKeepNum": {"2"}, "versionKeepDays": {"-1"}})
+	defer davApiPost(t, admin, "/api/space/edit/version", url.Values{"uuid": {space.Uuid}, "versionKeepNum": {"0"}, "versionKeepDays": {"-1"}})
+
+	davRequest(t, "PUT", davUrl+"/version.txt", nil, "1")
+	matter := davMatter(t, davTestUsername, "/version.txt")
+	totalSize := davSpace(davTestUsername).TotalSize
+
+	for _, content := range []string{"22", "333", "4444"} {
+		davRequest(t, "PUT", davUrl+"/version.txt", nil, content)
+	}
+
+	//only the newest 2 are kept. the file and its versions are charged.
+	versions := davVersions(matter.Uuid)
+	if len(versions) != 2 || versions[0].Size != 3 || versions[1].Size != 2 {
+		t.Fatalf("versions %v", versions)
+	}
+	if size := davSpace(davTestUsername).TotalSize; size != totalSize+3+3+2 {
+		t.Errorf("total size %d, want %d", size, totalSize+3+3+2)
+	}
+
+	pager := davApiPost(t, admin, "/api/matter/version/page", url.Values{"matterUuid": {matter.Uuid}})
+	if pager["totalItems"].(float64) != 2 {
+		t.Errorf("version page %v", pager)
+	}
+
+	response, err := admin.Get(davTestServer.URL + "/api/matter/version/download?uuid=" + versions[0].Uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if string(body) != "333" {
+		t.Errorf("version content %s", body)
+	}
+
+	//the restored version becomes the content, and the current one is kept.
+	davApiPost(t, admin, "/api/matter/version/restore", url.Values{"uuid": {versions[0].Uuid}})
+	if _, body := davRequest(t, "GET", davUrl+"/version.txt", nil, ""); body != "333" {
+		t.Errorf("restored content %s", body)
+	}
+	versions = davVersions(matter.Uuid)
+	if len(versions) != 2 || versions[0].Size != 4 || versions[1].Size != 3 {
+		t.Errorf("versions after restore %v", versions)
+	}
+
+	//deleting a version frees its size, and the versions go with the file.
+	davApiPost(t, admin, "/api/matter/version/delete", url.Values{"uuid": {versions[0].Uuid}})
+	if versions := davVersions(matter.Uuid); len(versions) != 1 || versions[0].Size != 3 {
+		t.Errorf("versions after delete %v", versions)
+	}
+	if size := davSpace(davTestUsername).TotalSize; size != totalSize+2+3 {
+		t.Errorf("total size after deleting a version %d, want %d", size, totalSize+2+3)
+	}
+	davRequest(t, "DELETE", davUrl+"/version.txt", nil, "")
+	if len(davVersions(matter.Uuid)) != 0 || davSpace(davTestUsername).TotalSize != totalSize-1 {
+		t.Errorf("versions left %d, total size %d", len(davVersions(matter.Uuid)), davSpace(davTestUsername).TotalSize)
+	}
+}
+
+// overwriting is charged by the change of size and the version kept. nothing changes if over the quota.
+func TestVersionQuota(t *testing.T) {
+
+	davUrl := startDavServer(t) + "/" + davTestUsername
+	admin := davApiLogin(t, davTestUsername)
+
+	davRequest(t, "PUT", davUrl+"/version-quota.txt", nil, "0123456789")
+	matter := davMatter(t, davTestUsername, "/version-quota.txt")
+	space := davSpace(davTestUsername)
+	davApiPost(t, admin, "/api/space/edit", url.Values{"uuid": {space.Uuid}, "sizeLimit": {"-1"}, "totalSizeLimit": {strconv.FormatInt(space.TotalSize+2, 10)}})
+	defer davApiPost(t, admin, "/api/space/edit", url.Values{"uuid": {space.Uuid}, "sizeLimit": {"-1"}, "totalSizeLimit": {"-1"}})
+
+	if status, _ := davRequest(t, "PUT", davUrl+"/version-quota.txt", nil, "0123456789a"); status != http.StatusNoContent {
+		t.Errorf("grow within quota status %d", status)
+	}
+	if status, _ := davRequest(t, "PUT", davUrl+"/version-quota.txt", nil, "0123456789abc"); status == http.StatusNoContent {
+		t.Errorf("grow over quota replaced")
+	}
+
+	davApiPost(t, admin, "/api/space/edit/version", url.Values{"uuid": {space.Uuid}, "versionKeepNum": {"1"}, "versionKeepDays": {"-1"}})
+	defer davApiPost(t, admin, "/api/space/edit/version", url.Values{"uuid": {space.Uuid}, "versionKeepNum": {"0"}, "versionKeepDays": {"-1"}})
+	if status, _ := davRequest(t, "PUT", davUrl+"/version-quota.txt", nil, "abcdefghijk"); status == http.StatusNoContent {
+		t.Errorf("version over quota replaced")
+	}
+
+	if _, body := davRequest(t, "GET", davUrl+"/version-quota.txt", nil, ""); body != "0123456789a" {
+		t.Errorf("content %s", body)
+	}
+	if len(davVersions(matter.Uuid)) != 0 || davSpace(davTestUsername).TotalSize != space.TotalSize+1 {
+		t.Errorf("versions %d, total size %d", len(davVersions(matter.Uuid)), davSpace(davTestUsername).TotalSize)
+	}
+	davRequest(t, "DELETE", davUrl+"/version-quota.txt", nil, "")
+}
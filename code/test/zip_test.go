@@ -0,0 +1,80 @@
+package test
+
+import (
+	"archive/zip"
+	"bytes"
+	"github.com/eyebluecn/tank/code/tool/archive"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStoredZip(t *testing.T) {
+
+	modified := time.Date(2021, 3, 4, 5, 6, 8, 0, time.UTC)
+	contents := map[string]string{
+		"docs/readme.txt": "hello tank",
+		"docs/empty.txt":  "",
+		"docs/中文.md":      strings.Repeat("zip ", 1000),
+	}
+
+	entries := []*archive.ZipEntry{{Name: "docs/", Modified: modified}}
+	for _, name := range []string{"docs/readme.txt", "docs/empty.txt", "docs/中文.md"} {
+		content := contents[name]
+		entries = append(entries, &archive.ZipEntry{
+			Name:     name,
+			Size:     int64(len(content)),
+			Modified: modified,
+			Open: func() (io.ReadCloser, error) {
+				return ioutil.NopCloser(strings.NewReader(content)), nil
+			},
+		})
+	}
+
+	buffer := &bytes.Buffer{}
+	err := archive.WriteStoredZip(buffer, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if int64(buffer.Len()) != archive.StoredZipSize(entries) {
+		t.Errorf("size error. written %d, computed %d", buffer.Len(), archive.StoredZipSize(entries))
+	}
+
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reader.File) != 4 {
+		t.Fatalf("entry num error. %d", len(reader.File))
+	}
+	if !reader.File[0].FileInfo().IsDir() {
+		t.Error("docs/ should be a directory.")
+	}
+	for _, file := range reader.File[1:] {
+		if file.Method != zip.Store || !file.Modified.Equal(modified) {
+			t.Errorf("%s header error.", file.Name)
+		}
+		fileReader, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		//crc32 is checked when read to the end.
+		content, err := ioutil.ReadAll(fileReader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != contents[file.Name] {
+			t.Errorf("%s content error.", file.Name)
+		}
+	}
+
+	//the declared size must be respected.
+	entries[1].Size = 100
+	err = archive.WriteStoredZip(ioutil.Discard, entries)
+	if err == nil {
+		t.Error("short content should fail.")
+	}
+}
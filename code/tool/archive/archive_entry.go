@@ -0,0 +1,266 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+var ErrEntryNotExist = errors.New("entry not exist in archive")
+
+// list the entries of an archive without reading the contents. zip only reads the central directory.
+func List(reader io.ReadSeeker, size int64, format string) ([]*ArchiveEntry, error) {
+
+	var entries []*ArchiveEntry
+	switch format {
+	case FORMAT_ZIP:
+		zipReader, err := openZip(reader, size)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range zipReader.File {
+			entry, err := zipEntry(file)
+			if err != nil {
+				return nil, err
+			}
+			if entry != nil {
+				entries = append(entries, entry)
+			}
+		}
+	case FORMAT_TAR, FORMAT_TAR_GZ:
+		//unread contents are skipped by tar, and plain tar seeks over them.
+		err := Walk(reader, size, format, func(entry *ArchiveEntry, content io.Reader) error {
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, ErrNotSupported
+	}
+	return entries, nil
+}
+
+// open a file entry by its clean name. stored zip entries and plain tar entries are read in place,
+// compressed entries are decompressed from the beginning when seeking backward.
+// reader is shared with the returned content, so it must not be used until the content is closed.
+func OpenEntry(reader io.ReadSeeker, size int64, format string, name string) (*ArchiveEntry, io.ReadSeekCloser, error) {
+	switch format {
+	case FORMAT_ZIP:
+		return openZipEntry(reader, size, name)
+	case FORMAT_TAR:
+		return openTarEntry(reader, name)
+	case FORMAT_TAR_GZ:
+		return openTarGzEntry(reader, name)
+	default:
+		return nil, nil, ErrNotSupported
+	}
+}
+
+func openZipEntry(reader io.ReadSeeker, size int64, name string) (*ArchiveEntry, io.ReadSeekCloser, error) {
+
+	zipReader, err := openZip(reader, size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, file := range zipReader.File {
+		entry, err := zipEntry(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		if entry == nil || entry.Dir || entry.Name != name {
+			continue
+		}
+
+		if file.Method == zip.Store && file.CompressedSize64 == file.UncompressedSize64 {
+			offset, err := file.DataOffset()
+			if err != nil {
+				return nil, nil, err
+			}
+			readerAt, ok := reader.(io.ReaderAt)
+			if !ok {
+				readerAt = &seekReaderAt{reader: reader}
+			}
+			return entry, &sectionCloser{io.NewSectionReader(readerAt, offset, entry.Size)}, nil
+		}
+
+		content := &streamSeeker{name: entry.Name, size: entry.Size, open: func() (io.ReadCloser, error) {
+			return file.Open()
+		}}
+		return entry, content, nil
+	}
+	return nil, nil, ErrEntryNotExist
+}
+
+// move the tar reader to the entry.
+func nextTarEntry(tarReader *tar.Reader, name string) (*ArchiveEntry, error) {
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil, ErrEntryNotExist
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		entryName, err := CleanEntryName(header.Name)
+		if err != nil {
+			return nil, err
+		}
+		if entryName == name {
+			return &ArchiveEntry{Name: entryName, Size: header.Size, Modified: header.ModTime}, nil
+		}
+	}
+}
+
+func openTarEntry(reader io.ReadSeeker, name string) (*ArchiveEntry, io.ReadSeekCloser, error) {
+
+	_, err := reader.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, nil, err
+	}
+	entry, err := nextTarEntry(tar.NewReader(reader), name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	//tar reads block by block, so the reader stops right at the content.
+	offset, err := reader.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, nil, err
+	}
+	readerAt, ok := reader.(io.ReaderAt)
+	if !ok {
+		readerAt = &seekReaderAt{reader: reader}
+	}
+	return entry, &sectionCloser{io.NewSectionReader(readerAt, offset, entry.Size)}, nil
+}
+
+func openTarGzEntry(reader io.ReadSeeker, name string) (*ArchiveEntry, io.ReadSeekCloser, error) {
+
+	open := func() (io.ReadCloser, *ArchiveEntry, error) {
+		_, err := reader.Seek(0, io.SeekStart)
+		if err != nil {
+			return nil, nil, err
+		}
+		gzipReader, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		tarReader := tar.NewReader(gzipReader)
+		entry, err := nextTarEntry(tarReader, name)
+		if err != nil {
+			gzipReader.Close()
+			return nil, nil, err
+		}
+		return &readCloser{Reader: tarReader, Closer: gzipReader}, entry, nil
+	}
+
+	content, entry, err := open()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	seeker := &streamSeeker{name: entry.Name, size: entry.Size, reader: content, open: func() (io.ReadCloser, error) {
+		content, _, err := open()
+		return content, err
+	}}
+	return entry, seeker, nil
+}
+
+type sectionCloser struct {
+	*io.SectionReader
+}
+
+func (this *sectionCloser) Close() error {
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// make a forward only stream seekable. seeking backward opens the stream again.
+type streamSeeker struct {
+	name   string
+	size   int64
+	open   func() (io.ReadCloser, error)
+	reader io.ReadCloser
+	//position of reader.
+	current int64
+	//position to read.
+	offset int64
+}
+
+func (this *streamSeeker) Read(p []byte) (int, error) {
+
+	if this.offset >= this.size {
+		return 0, io.EOF
+	}
+
+	if this.reader == nil || this.offset < this.current {
+		err := this.Close()
+		if err != nil {
+			return 0, err
+		}
+		this.reader, err = this.open()
+		if err != nil {
+			return 0, err
+		}
+		this.current = 0
+	}
+
+	if this.offset > this.current {
+		n, err := io.CopyN(ioutil.Discard, this.reader, this.offset-this.current)
+		this.current += n
+		if err != nil {
+			return 0, fmt.Errorf("entry %s is smaller than declared. %v", this.name, err)
+		}
+	}
+
+	if int64(len(p)) > this.size-this.offset {
+		p = p[:this.size-this.offset]
+	}
+	n, err := this.reader.Read(p)
+	this.current += int64(n)
+	this.offset = this.current
+	if err == io.EOF && this.offset < this.size {
+		err = fmt.Errorf("entry %s is smaller than declared", this.name)
+	}
+	return n, err
+}
+
+func (this *streamSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += this.offset
+	case io.SeekEnd:
+		offset += this.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	this.offset = offset
+	return offset, nil
+}
+
+func (this *streamSeeker) Close() error {
+	if this.reader == nil {
+		return nil
+	}
+	err := this.reader.Close()
+	this.reader = nil
+	return err
+}
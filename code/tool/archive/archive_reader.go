@@ -0,0 +1,269 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	FORMAT_ZIP    = "zip"
+	FORMAT_TAR    = "tar"
+	FORMAT_TAR_GZ = "tar.gz"
+)
+
+var ErrNotSupported = errors.New("archive format not supported")
+
+// an entry in an archive. Name is a clean relative path without trailing "/".
+type ArchiveEntry struct {
+	Name     string    `json:"name"`
+	Dir      bool      `json:"dir"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// detect the archive format by the file name. return "" if not supported.
+func DetectFormat(filename string) string {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return FORMAT_ZIP
+	case strings.HasSuffix(lower, ".tar"):
+		return FORMAT_TAR
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FORMAT_TAR_GZ
+	default:
+		return ""
+	}
+}
+
+// clean an entry's name. absolute path and ".." are rejected, so that nothing can be written out of the target(zip slip).
+func CleanEntryName(name string) (string, error) {
+	cleaned := strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(cleaned, "/") || (len(cleaned) >= 2 && cleaned[1] == ':') {
+		return "", fmt.Errorf("absolute path %s in archive", name)
+	}
+	for _, part := range strings.Split(cleaned, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("illegal path %s in archive", name)
+		}
+	}
+	cleaned = path.Clean(cleaned)
+	if cleaned == "." {
+		return "", nil
+	}
+	return cleaned, nil
+}
+
+// split a clean entry name into its parent's name and its own name. parent is "" at top level.
+func SplitEntryName(name string) (string, string) {
+	index := strings.LastIndex(name, "/")
+	if index < 0 {
+		return "", name
+	}
+	return name[:index], name[index+1:]
+}
+
+// zip created on Chinese Windows usually uses GBK names.
+func decodeZipName(file *zip.File) string {
+	if !file.NonUTF8 || utf8.ValidString(file.Name) {
+		return file.Name
+	}
+	name, err := simplifiedchinese.GB18030.NewDecoder().String(file.Name)
+	if err != nil {
+		return file.Name
+	}
+	return name
+}
+
+// read a seeker at any offset.
+type seekReaderAt struct {
+	reader io.ReadSeeker
+	mutex  sync.Mutex
+}
+
+func (this *seekReaderAt) ReadAt(p []byte, offset int64) (int, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	_, err := this.reader.Seek(offset, io.SeekStart)
+	if err != nil {
+		return 0, err
+	}
+	return io.ReadFull(this.reader, p)
+}
+
+// walk the entries of an archive. content is nil for directories, and it returns exactly entry.Size bytes at most.
+// the walk stops when fun returns error.
+func Walk(reader io.ReadSeeker, size int64, format string, fun func(entry *ArchiveEntry, content io.Reader) error) error {
+	switch format {
+	case FORMAT_ZIP:
+		return walkZip(reader, size, fun)
+	case FORMAT_TAR:
+		return walkTar(reader, fun)
+	case FORMAT_TAR_GZ:
+		return walkTarGz(reader, fun)
+	default:
+		return ErrNotSupported
+	}
+}
+
+func openZip(reader io.ReadSeeker, size int64) (*zip.Reader, error) {
+	readerAt, ok := reader.(io.ReaderAt)
+	if !ok {
+		readerAt = &seekReaderAt{reader: reader}
+	}
+	return zip.NewReader(readerAt, size)
+}
+
+// build the entry of a zip file. nil if the name is empty after cleaning.
+func zipEntry(file *zip.File) (*ArchiveEntry, error) {
+	name, err := CleanEntryName(decodeZipName(file))
+	if err != nil || name == "" {
+		return nil, err
+	}
+
+	entry := &ArchiveEntry{
+		Name:     name,
+		Dir:      file.FileInfo().IsDir(),
+		Modified: file.Modified,
+	}
+	if !entry.Dir {
+		if file.UncompressedSize64 > 1<<62 {
+			return nil, fmt.Errorf("entry %s is too large", name)
+		}
+		entry.Size = int64(file.UncompressedSize64)
+	}
+	return entry, nil
+}
+
+func walkZip(reader io.ReadSeeker, size int64, fun func(entry *ArchiveEntry, content io.Reader) error) error {
+
+	zipReader, err := openZip(reader, size)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range zipReader.File {
+		entry, err := zipEntry(file)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			continue
+		}
+
+		if entry.Dir {
+			err = fun(entry, nil)
+		} else {
+			err = walkZipFile(file, entry, fun)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkZipFile(file *zip.File, entry *ArchiveEntry, fun func(entry *ArchiveEntry, content io.Reader) error) error {
+	content, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	//the declared size may lie. never read more than it.
+	return fun(entry, &exactReader{reader: content, name: entry.Name, remain: entry.Size})
+}
+
+func walkTarGz(reader io.Reader, fun func(entry *ArchiveEntry, content io.Reader) error) error {
+
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	return walkTar(gzipReader, fun)
+}
+
+func walkTar(reader io.Reader, fun func(entry *ArchiveEntry, content io.Reader) error) error {
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name, err := CleanEntryName(header.Name)
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			continue
+		}
+
+		entry := &ArchiveEntry{
+			Name:     name,
+			Modified: header.ModTime,
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			entry.Dir = true
+			err = fun(entry, nil)
+		case tar.TypeReg:
+			entry.Size = header.Size
+			err = fun(entry, &exactReader{reader: tarReader, name: name, remain: header.Size})
+		default:
+			//links and devices are ignored.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// read exactly remain bytes. more data is an error.
+type exactReader struct {
+	reader io.Reader
+	name   string
+	remain int64
+}
+
+func (this *exactReader) Read(p []byte) (int, error) {
+	if this.remain <= 0 {
+		//make sure there is no more data.
+		var one [1]byte
+		n, err := this.reader.Read(one[:])
+		if n > 0 {
+			return 0, fmt.Errorf("entry %s is larger than declared", this.name)
+		}
+		//eg. checksum error of zip.
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > this.remain {
+		p = p[:this.remain]
+	}
+	n, err := this.reader.Read(p)
+	this.remain -= int64(n)
+	if err == io.EOF && this.remain > 0 {
+		err = fmt.Errorf("entry %s is smaller than declared", this.name)
+	}
+	return n, err
+}
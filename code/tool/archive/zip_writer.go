@@ -0,0 +1,329 @@
+package archive
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	zipLocalHeaderSignature    = 0x04034b50
+	zipCentralHeaderSignature  = 0x02014b50
+	zipDataDescriptorSignature = 0x08074b50
+	zipEndSignature            = 0x06054b50
+	zip64EndSignature          = 0x06064b50
+	zip64LocatorSignature      = 0x07064b50
+	zipExtTimeExtraID          = 0x5455
+	zip64ExtraID               = 0x0001
+	zipVersion20               = 20
+	zipVersion45               = 45
+	zipCreatorUnix             = 3
+	zipFlagDataDescriptor      = 0x8
+	zipFlagUTF8                = 0x800
+	zipUint16Max               = 1<<16 - 1
+	zipUint32Max               = 1<<32 - 1
+	zipUnixModeDir             = 040755
+	zipUnixModeFile            = 0100644
+	zipMsDosDirAttribute       = 0x10
+	zipLocalHeaderLength       = 30
+	zip64EndLength             = 56
+	zip64DataDescriptorLength  = 24
+	zipExtTimeExtraLength      = 9
+	zip64LocalExtraLength      = 20
+)
+
+// an entry in a zip. directory's name ends with "/".
+type ZipEntry struct {
+	Name string
+	//size of the content. 0 for directory.
+	Size     int64
+	Modified time.Time
+	//open the content. nil for directory.
+	Open func() (io.ReadCloser, error)
+}
+
+func (this *ZipEntry) isDir() bool {
+	return strings.HasSuffix(this.Name, "/")
+}
+
+func (this *ZipEntry) isZip64() bool {
+	return this.Size >= zipUint32Max
+}
+
+// written entry, used by the central directory.
+type zipRecord struct {
+	entry  *ZipEntry
+	crc32  uint32
+	offset int64
+}
+
+// zip with stored(no compression) method. the size is known before writing, so that Content-Length can be sent.
+// content's crc32 is unknown until read, so data descriptors are used.
+type StoredZipWriter struct {
+	writer  io.Writer
+	count   int64
+	records []*zipRecord
+}
+
+func NewStoredZipWriter(writer io.Writer) *StoredZipWriter {
+	return &StoredZipWriter{writer: writer}
+}
+
+// the exact size of the zip containing the entries.
+func StoredZipSize(entries []*ZipEntry) int64 {
+	size := NewStoredZipWriter(io.Discard)
+	for _, entry := range entries {
+		record := &zipRecord{entry: entry, offset: size.count}
+		size.count += int64(len(localHeader(record)))
+		if !entry.isDir() {
+			size.count += entry.Size + int64(len(dataDescriptor(record)))
+		}
+		size.records = append(size.records, record)
+	}
+	size.count += int64(len(size.centralDirectory()))
+	return size.count
+}
+
+func (this *StoredZipWriter) write(buf []byte) error {
+	n, err := this.writer.Write(buf)
+	this.count += int64(n)
+	return err
+}
+
+// write an entry. the content must have exactly entry.Size bytes.
+func (this *StoredZipWriter) WriteEntry(entry *ZipEntry) error {
+
+	if len(entry.Name) > zipUint16Max {
+		return fmt.Errorf("zip entry name too long: %s", entry.Name)
+	}
+
+	record := &zipRecord{entry: entry, offset: this.count}
+	err := this.write(localHeader(record))
+	if err != nil {
+		return err
+	}
+
+	if !entry.isDir() {
+		reader, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		hash := crc32.NewIEEE()
+		n, err := io.CopyN(io.MultiWriter(this.writer, hash), reader, entry.Size)
+		this.count += n
+		closeErr := reader.Close()
+		if err == io.EOF {
+			err = fmt.Errorf("zip entry %s is shorter than %d bytes", entry.Name, entry.Size)
+		}
+		if err != nil {
+			return err
+		}
+		if closeErr != nil {
+			return closeErr
+		}
+
+		record.crc32 = hash.Sum32()
+		err = this.write(dataDescriptor(record))
+		if err != nil {
+			return err
+		}
+	}
+
+	this.records = append(this.records, record)
+	return nil
+}
+
+// write the central directory. the zip is complete after closed.
+func (this *StoredZipWriter) Close() error {
+	return this.write(this.centralDirectory())
+}
+
+// write a zip of the entries.
+func WriteStoredZip(writer io.Writer, entries []*ZipEntry) error {
+	zipWriter := NewStoredZipWriter(writer)
+	for _, entry := range entries {
+		err := zipWriter.WriteEntry(entry)
+		if err != nil {
+			return err
+		}
+	}
+	return zipWriter.Close()
+}
+
+func localHeader(record *zipRecord) []byte {
+	entry := record.entry
+
+	extra := extTimeExtra(entry.Modified)
+	version := uint16(zipVersion20)
+	size := uint32(entry.Size)
+	if entry.isZip64() {
+		version = zipVersion45
+		size = zipUint32Max
+		extra = append(extra, zip64LocalExtra(entry.Size)...)
+	}
+
+	flags := uint16(zipFlagUTF8)
+	if !entry.isDir() {
+		flags |= zipFlagDataDescriptor
+	}
+	date, clock := msDosTime(entry.Modified)
+
+	buf := make([]byte, 0, zipLocalHeaderLength+len(entry.Name)+len(extra))
+	buf = binary.LittleEndian.AppendUint32(buf, zipLocalHeaderSignature)
+	buf = binary.LittleEndian.AppendUint16(buf, version)
+	buf = binary.LittleEndian.AppendUint16(buf, flags)
+	buf = binary.LittleEndian.AppendUint16(buf, 0) //stored
+	buf = binary.LittleEndian.AppendUint16(buf, clock)
+	buf = binary.LittleEndian.AppendUint16(buf, date)
+	//crc32 is in the data descriptor.
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, size)
+	buf = binary.LittleEndian.AppendUint32(buf, size)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(entry.Name)))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(extra)))
+	buf = append(buf, entry.Name...)
+	buf = append(buf, extra...)
+	return buf
+}
+
+func dataDescriptor(record *zipRecord) []byte {
+	buf := make([]byte, 0, zip64DataDescriptorLength)
+	buf = binary.LittleEndian.AppendUint32(buf, zipDataDescriptorSignature)
+	buf = binary.LittleEndian.AppendUint32(buf, record.crc32)
+	if record.entry.isZip64() {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(record.entry.Size))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(record.entry.Size))
+	} else {
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(record.entry.Size))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(record.entry.Size))
+	}
+	return buf
+}
+
+func (this *StoredZipWriter) centralDirectory() []byte {
+
+	var buf []byte
+	for _, record := range this.records {
+		entry := record.entry
+
+		extra := extTimeExtra(entry.Modified)
+		version := uint16(zipVersion20)
+		size := uint32(entry.Size)
+		offset := uint32(record.offset)
+		var zip64Extra []byte
+		if entry.isZip64() {
+			size = zipUint32Max
+			zip64Extra = binary.LittleEndian.AppendUint64(zip64Extra, uint64(entry.Size))
+			zip64Extra = binary.LittleEndian.AppendUint64(zip64Extra, uint64(entry.Size))
+		}
+		if record.offset >= zipUint32Max {
+			offset = zipUint32Max
+			zip64Extra = binary.LittleEndian.AppendUint64(zip64Extra, uint64(record.offset))
+		}
+		if zip64Extra != nil {
+			version = zipVersion45
+			extra = binary.LittleEndian.AppendUint16(extra, zip64ExtraID)
+			extra = binary.LittleEndian.AppendUint16(extra, uint16(len(zip64Extra)))
+			extra = append(extra, zip64Extra...)
+		}
+
+		flags := uint16(zipFlagUTF8)
+		externalAttrs := uint32(zipUnixModeFile) << 16
+		if entry.isDir() {
+			externalAttrs = uint32(zipUnixModeDir)<<16 | zipMsDosDirAttribute
+		} else {
+			flags |= zipFlagDataDescriptor
+		}
+		date, clock := msDosTime(entry.Modified)
+
+		buf = binary.LittleEndian.AppendUint32(buf, zipCentralHeaderSignature)
+		buf = binary.LittleEndian.AppendUint16(buf, zipCreatorUnix<<8|zipVersion20)
+		buf = binary.LittleEndian.AppendUint16(buf, version)
+		buf = binary.LittleEndian.AppendUint16(buf, flags)
+		buf = binary.LittleEndian.AppendUint16(buf, 0) //stored
+		buf = binary.LittleEndian.AppendUint16(buf, clock)
+		buf = binary.LittleEndian.AppendUint16(buf, date)
+		buf = binary.LittleEndian.AppendUint32(buf, record.crc32)
+		buf = binary.LittleEndian.AppendUint32(buf, size)
+		buf = binary.LittleEndian.AppendUint32(buf, size)
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(entry.Name)))
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(extra)))
+		buf = binary.LittleEndian.AppendUint16(buf, 0) //comment
+		buf = binary.LittleEndian.AppendUint16(buf, 0) //disk number
+		buf = binary.LittleEndian.AppendUint16(buf, 0) //internal attributes
+		buf = binary.LittleEndian.AppendUint32(buf, externalAttrs)
+		buf = binary.LittleEndian.AppendUint32(buf, offset)
+		buf = append(buf, entry.Name...)
+		buf = append(buf, extra...)
+	}
+
+	directoryOffset := this.count
+	directorySize := int64(len(buf))
+	records := len(this.records)
+
+	if records >= zipUint16Max || directorySize >= zipUint32Max || directoryOffset >= zipUint32Max {
+		zip64EndOffset := directoryOffset + directorySize
+		buf = binary.LittleEndian.AppendUint32(buf, zip64EndSignature)
+		buf = binary.LittleEndian.AppendUint64(buf, zip64EndLength-12)
+		buf = binary.LittleEndian.AppendUint16(buf, zipVersion45)
+		buf = binary.LittleEndian.AppendUint16(buf, zipVersion45)
+		buf = binary.LittleEndian.AppendUint32(buf, 0)
+		buf = binary.LittleEndian.AppendUint32(buf, 0)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(records))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(records))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(directorySize))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(directoryOffset))
+
+		buf = binary.LittleEndian.AppendUint32(buf, zip64LocatorSignature)
+		buf = binary.LittleEndian.AppendUint32(buf, 0)
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(zip64EndOffset))
+		buf = binary.LittleEndian.AppendUint32(buf, 1)
+
+		records = zipUint16Max
+		directorySize = min(directorySize, zipUint32Max)
+		directoryOffset = min(directoryOffset, zipUint32Max)
+	}
+
+	buf = binary.LittleEndian.AppendUint32(buf, zipEndSignature)
+	buf = binary.LittleEndian.AppendUint16(buf, 0)
+	buf = binary.LittleEndian.AppendUint16(buf, 0)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(records))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(records))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(directorySize))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(directoryOffset))
+	buf = binary.LittleEndian.AppendUint16(buf, 0) //comment
+	return buf
+}
+
+// "extended timestamp" used by Info-ZIP. only the modification time.
+func extTimeExtra(modified time.Time) []byte {
+	buf := make([]byte, 0, zipExtTimeExtraLength)
+	buf = binary.LittleEndian.AppendUint16(buf, zipExtTimeExtraID)
+	buf = binary.LittleEndian.AppendUint16(buf, 5)
+	buf = append(buf, 1)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(modified.Unix()))
+	return buf
+}
+
+// both sizes in the local header.
+func zip64LocalExtra(size int64) []byte {
+	buf := make([]byte, 0, zip64LocalExtraLength)
+	buf = binary.LittleEndian.AppendUint16(buf, zip64ExtraID)
+	buf = binary.LittleEndian.AppendUint16(buf, 16)
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(size))
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(size))
+	return buf
+}
+
+// MS-DOS date and time. the earliest is 1980-01-01.
+func msDosTime(t time.Time) (date uint16, clock uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	date = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+	return date, clock
+}
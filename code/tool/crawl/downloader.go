@@ -0,0 +1,248 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// the size of the remote file exceeds the max size.
+type SizeError struct {
+	Size    int64
+	MaxSize int64
+}
+
+func (this *SizeError) Error() string {
+	return fmt.Sprintf("size %d exceeds the limit %d", this.Size, this.MaxSize)
+}
+
+// the server responds an unexpected status.
+type StatusError struct {
+	Code int
+}
+
+func (this *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d", this.Code)
+}
+
+var contentRangePattern = regexp.MustCompile(`^bytes (\d+)-(\d+)/(\d+|\*)$`)
+
+// download a url into a file. the received bytes are kept after a failure,
+// and the next attempt continues with a Range request.
+type Downloader struct {
+	Client *http.Client
+	//< 0 means no limit. checked by Content-Length before receiving and by the received bytes.
+	MaxSize int64
+	//attempts after the first one fails.
+	Retries int
+	//wait before the first retry, doubled for each next one.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	//an attempt fails when no byte is received in this duration. 0 means no timeout.
+	IdleTimeout time.Duration
+	//nil means no bandwidth limit.
+	Limiter *Limiter
+	//invoked with the received bytes and the total size. total is -1 when unknown.
+	Progress func(done int64, total int64)
+	//invoked before each retry.
+	OnRetry func(attempt int, err error)
+}
+
+// download url to path. a partial file at path is resumed. return the size of the file.
+func (this *Downloader) Download(ctx context.Context, url string, path string) (int64, error) {
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	backoff := this.Backoff
+	for attempt := 0; ; attempt++ {
+
+		size, err := this.attempt(ctx, url, file)
+		if err == nil {
+			return size, nil
+		}
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+		if !Retryable(err) || attempt >= this.Retries {
+			return 0, err
+		}
+
+		if this.OnRetry != nil {
+			this.OnRetry(attempt+1, err)
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return 0, ctx.Err()
+		}
+		backoff = backoff * 2
+		if this.MaxBackoff > 0 && backoff > this.MaxBackoff {
+			backoff = this.MaxBackoff
+		}
+	}
+}
+
+// whether a failed attempt is worth retrying. the network errors and server errors are.
+func Retryable(err error) bool {
+	var sizeError *SizeError
+	if errors.As(err, &sizeError) {
+		return false
+	}
+	var policyError *PolicyError
+	if errors.As(err, &policyError) {
+		return false
+	}
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		return statusError.Code >= 500 || statusError.Code == http.StatusTooManyRequests || statusError.Code == http.StatusRequestTimeout
+	}
+	return true
+}
+
+// one request continuing from the end of the file.
+func (this *Downloader) attempt(ctx context.Context, url string, file *os.File) (int64, error) {
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	offset := info.Size()
+
+	attemptCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(attemptCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, &StatusError{Code: http.StatusBadRequest}
+	}
+	if offset > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	client := this.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	total := int64(-1)
+	switch response.StatusCode {
+	case http.StatusOK:
+		//the range is ignored, start over.
+		offset = 0
+		total = response.ContentLength
+	case http.StatusPartialContent:
+		match := contentRangePattern.FindStringSubmatch(response.Header.Get("Content-Range"))
+		start := int64(-1)
+		if match != nil {
+			start, _ = strconv.ParseInt(match[1], 10, 64)
+		}
+		if start != offset {
+			//an unusable range, start over without range next time.
+			if err := file.Truncate(0); err != nil {
+				return 0, err
+			}
+			return 0, fmt.Errorf("unexpected content range %s", response.Header.Get("Content-Range"))
+		}
+		if match[3] != "*" {
+			total, _ = strconv.ParseInt(match[3], 10, 64)
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		//the file has been completely received.
+		if offset > 0 && response.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+			return offset, this.checkSize(offset)
+		}
+		if err := file.Truncate(0); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("range %d not satisfiable", offset)
+	default:
+		return 0, &StatusError{Code: response.StatusCode}
+	}
+
+	if total >= 0 {
+		if err := this.checkSize(total); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := file.Truncate(offset); err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	var reader io.Reader = response.Body
+	if this.IdleTimeout > 0 {
+		timer := time.AfterFunc(this.IdleTimeout, cancel)
+		defer timer.Stop()
+		reader = &idleReader{reader: reader, timer: timer, timeout: this.IdleTimeout}
+	}
+	reader = this.Limiter.Reader(ctx, reader)
+
+	done := offset
+	buffer := make([]byte, LIMITER_CHUNK)
+	for {
+		n, readErr := reader.Read(buffer)
+		if n > 0 {
+			if this.MaxSize >= 0 && done+int64(n) > this.MaxSize {
+				return 0, &SizeError{Size: done + int64(n), MaxSize: this.MaxSize}
+			}
+			if _, err := file.Write(buffer[:n]); err != nil {
+				return 0, err
+			}
+			done += int64(n)
+			if this.Progress != nil {
+				this.Progress(done, total)
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return 0, readErr
+		}
+	}
+
+	if total >= 0 && done != total {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return done, nil
+}
+
+func (this *Downloader) checkSize(size int64) error {
+	if this.MaxSize >= 0 && size > this.MaxSize {
+		return &SizeError{Size: size, MaxSize: this.MaxSize}
+	}
+	return nil
+}
+
+// reset the timer on every read. the request is canceled when the timer fires.
+type idleReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (this *idleReader) Read(p []byte) (int, error) {
+	n, err := this.reader.Read(p)
+	this.timer.Reset(this.timeout)
+	return n, err
+}
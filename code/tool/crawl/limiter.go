@@ -0,0 +1,99 @@
+package crawl
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// bytes read at most at a time, so that a slow rate does not wait too long for a single read.
+const LIMITER_CHUNK = 32 * 1024
+
+// a token bucket shared by the downloads to cap their total bandwidth.
+type Limiter struct {
+	mutex sync.Mutex
+	//bytes per second. <= 0 means no limit.
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func NewLimiter(rate int64) *Limiter {
+	return &Limiter{rate: rate, last: time.Now()}
+}
+
+// change the rate. the running downloads follow the new rate at once.
+func (this *Limiter) SetRate(rate int64) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.rate != rate {
+		this.rate = rate
+		this.tokens = 0
+		this.last = time.Now()
+	}
+}
+
+// wait until n bytes are allowed.
+func (this *Limiter) Wait(ctx context.Context, n int) error {
+
+	this.mutex.Lock()
+	if this.rate <= 0 {
+		this.mutex.Unlock()
+		return nil
+	}
+	now := time.Now()
+	this.tokens += now.Sub(this.last).Seconds() * float64(this.rate)
+	//at most one second of burst.
+	if this.tokens > float64(this.rate) {
+		this.tokens = float64(this.rate)
+	}
+	this.last = now
+	//take the tokens in advance, others wait after them.
+	this.tokens -= float64(n)
+	var delay time.Duration
+	if this.tokens < 0 {
+		delay = time.Duration(-this.tokens / float64(this.rate) * float64(time.Second))
+	}
+	this.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// a reader limited by the limiter. nil limiter means no limit.
+func (this *Limiter) Reader(ctx context.Context, reader io.Reader) io.Reader {
+	if this == nil {
+		return reader
+	}
+	return &limitedReader{ctx: ctx, reader: reader, limiter: this}
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *Limiter
+}
+
+func (this *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > LIMITER_CHUNK {
+		p = p[:LIMITER_CHUNK]
+	}
+	n, err := this.reader.Read(p)
+	if n > 0 {
+		if waitErr := this.limiter.Wait(this.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,184 @@
+package crawl
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// the ranges not reachable by default, besides loopback, private, link-local, multicast and unspecified.
+var blockedNets = parseCidrs(
+	"0.0.0.0/8",          //this network
+	"100.64.0.0/10",      //carrier grade nat
+	"192.0.0.0/24",       //ietf protocol assignments
+	"198.18.0.0/15",      //benchmarking
+	"240.0.0.0/4",        //reserved
+	"255.255.255.255/32", //broadcast
+	"64:ff9b::/96",       //nat64
+)
+
+// the url or address is not allowed by the policy.
+type PolicyError struct {
+	Target string
+}
+
+func (this *PolicyError) Error() string {
+	return fmt.Sprintf("access to %s is not allowed", this.Target)
+}
+
+// outbound policy of the crawls. the internal addresses are blocked unless allowed.
+type Policy struct {
+	//host patterns. eg. "files.example.com", "*.example.com", "10.0.0.0/8", or "*" for all.
+	hosts []string
+	nets  []*net.IPNet
+}
+
+func NewPolicy(allowHosts []string) *Policy {
+	policy := &Policy{}
+	for _, pattern := range allowHosts {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, ipNet, err := net.ParseCIDR(pattern); err == nil {
+			policy.nets = append(policy.nets, ipNet)
+		} else {
+			policy.hosts = append(policy.hosts, pattern)
+		}
+	}
+	return policy
+}
+
+// check the scheme and the host of a url before connecting. the resolved addresses are checked when dialing.
+func (this *Policy) CheckUrl(rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return &PolicyError{Target: rawUrl}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &PolicyError{Target: rawUrl}
+	}
+	host := u.Hostname()
+	if host == "" {
+		return &PolicyError{Target: rawUrl}
+	}
+	if this.AllowHost(host) {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return this.CheckIP(ip)
+	}
+	return nil
+}
+
+// whether the host matches an allowed pattern.
+func (this *Policy) AllowHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range this.hosts {
+		if pattern == "*" || pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		for _, ipNet := range this.nets {
+			if ipNet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// check an address to connect.
+func (this *Policy) CheckIP(ip net.IP) error {
+	for _, ipNet := range this.nets {
+		if ipNet.Contains(ip) {
+			return nil
+		}
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return &PolicyError{Target: ip.String()}
+	}
+	for _, ipNet := range blockedNets {
+		if ipNet.Contains(ip) {
+			return &PolicyError{Target: ip.String()}
+		}
+	}
+	return nil
+}
+
+// dial with the resolved address checked, so that a host resolved to an internal address is blocked,
+// no matter it comes from the url or a redirect.
+func (this *Policy) DialContext(dialer *net.Dialer) func(ctx context.Context, network string, address string) (net.Conn, error) {
+	return func(ctx context.Context, network string, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if this.AllowHost(host) {
+			return dialer.DialContext(ctx, network, address)
+		}
+
+		checked := *dialer
+		checked.Control = func(network string, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil {
+				return &PolicyError{Target: address}
+			}
+			return this.CheckIP(ip)
+		}
+		return checked.DialContext(ctx, network, address)
+	}
+}
+
+// whether the pattern is an allowed host, "*.domain", ip, cidr or "*".
+func ValidPattern(pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "*" || net.ParseIP(pattern) != nil {
+		return true
+	}
+	if _, _, err := net.ParseCIDR(pattern); err == nil {
+		return true
+	}
+	pattern = strings.TrimPrefix(pattern, "*.")
+	if pattern == "" {
+		return false
+	}
+	for _, label := range strings.Split(pattern, ".") {
+		if label == "" || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func parseCidrs(cidrs ...string) []*net.IPNet {
+	var ipNets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets
+}
@@ -228,18 +228,29 @@ func DownloadFile(
 		PanicError(e)
 	}()
 
-	//content-disposition tell browser to download rather than preview.
-	if withContentDisposition {
-		fileName := url.QueryEscape(filename)
-		writer.Header().Set("content-disposition", "attachment; filename=\""+fileName+"\"")
-	}
-
 	fileInfo, err := diskFile.Stat()
 	if err != nil {
 		panic("cannot load fileInfo from disk." + filePath)
 	}
 
-	modifyTime := fileInfo.ModTime()
+	DownloadContent(writer, request, diskFile, fileInfo.Size(), fileInfo.ModTime(), filename, withContentDisposition)
+}
+
+//download a seekable content, which may come from disk or a remote storage. Support chunk download.
+func DownloadContent(
+	writer http.ResponseWriter,
+	request *http.Request,
+	content io.ReadSeeker,
+	size int64,
+	modifyTime time.Time,
+	filename string,
+	withContentDisposition bool) {
+
+	//content-disposition tell browser to download rather than preview.
+	if withContentDisposition {
+		fileName := url.QueryEscape(filename)
+		writer.Header().Set("content-disposition", "attachment; filename=\""+fileName+"\"")
+	}
 
 	if CheckLastModified(writer, request, modifyTime) {
 		return
@@ -265,9 +276,9 @@ func DownloadFile(
 		if ctype == "" {
 			// read a chunk to decide between utf-8 text and binary
 			var buf [sniffLen]byte
-			n, _ := io.ReadFull(diskFile, buf[:])
+			n, _ := io.ReadFull(content, buf[:])
 			ctype = http.DetectContentType(buf[:n])
-			_, err := diskFile.Seek(0, os.SEEK_SET) // rewind to output whole file
+			_, err := content.Seek(0, os.SEEK_SET) // rewind to output whole file
 			if err != nil {
 				panic("cannot seek file")
 			}
@@ -277,11 +288,9 @@ func DownloadFile(
 		ctype = ctypes[0]
 	}
 
-	size := fileInfo.Size()
-
 	// handle Content-Range header.
 	sendSize := size
-	var sendContent io.Reader = diskFile
+	var sendContent io.Reader = content
 	if size >= 0 {
 		ranges, err := ParseRange(rangeReq, size)
 		if err != nil {
@@ -308,14 +317,12 @@ func DownloadFile(
 			// A response to a request for a single range MUST NOT
 			// be sent using the multipart/byteranges media type."
 			ra := ranges[0]
-			if _, err := diskFile.Seek(ra.start, io.SeekStart); err != nil {
+			if _, err := content.Seek(ra.start, io.SeekStart); err != nil {
 				panic(result.CustomWebResult(result.RANGE_NOT_SATISFIABLE, "range header出错"))
 			}
 			sendSize = ra.length
 			code = http.StatusPartialContent
 			writer.Header().Set("Content-Range", ra.contentRange(size))
-			//  把文件放进去
-			io.CopyN(writer, diskFile, int64(ra.length))
 		case len(ranges) > 1:
 			sendSize = RangesMIMESize(ranges, ctype, size)
 			code = http.StatusPartialContent
@@ -332,11 +339,11 @@ func DownloadFile(
 						pw.CloseWithError(err)
 						return
 					}
-					if _, err := diskFile.Seek(ra.start, io.SeekStart); err != nil {
+					if _, err := content.Seek(ra.start, io.SeekStart); err != nil {
 						pw.CloseWithError(err)
 						return
 					}
-					if _, err := io.CopyN(part, diskFile, ra.length); err != nil {
+					if _, err := io.CopyN(part, content, ra.length); err != nil {
 						pw.CloseWithError(err)
 						return
 					}
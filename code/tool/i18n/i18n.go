@@ -61,14 +61,7 @@ func (this *Item) Message(request *http.Request) string {
 		return this.English
 	}
 
-	lang, _ := request.Cookie(LANG_KEY)
-	formLangStr := request.FormValue(LANG_KEY)
-	acceptLangStr := request.Header.Get("Accept-Language")
-	var cookieLangStr string
-	if lang != nil {
-		cookieLangStr = lang.Value
-	}
-	tag, _ := language.MatchStrings(matcher, cookieLangStr, formLangStr, acceptLangStr)
+	tag := match(request)
 
 	tagBase, _ := tag.Base()
 	chineseBase, _ := language.Chinese.Base()
@@ -80,3 +73,23 @@ func (this *Item) Message(request *http.Request) string {
 	}
 
 }
+
+// the language of the request, so that the messages of a background job are in the same language.
+func Lang(request *http.Request) string {
+	if request == nil {
+		return language.English.String()
+	}
+	return match(request).String()
+}
+
+func match(request *http.Request) language.Tag {
+	lang, _ := request.Cookie(LANG_KEY)
+	formLangStr := request.FormValue(LANG_KEY)
+	acceptLangStr := request.Header.Get("Accept-Language")
+	var cookieLangStr string
+	if lang != nil {
+		cookieLangStr = lang.Value
+	}
+	tag, _ := language.MatchStrings(matcher, cookieLangStr, formLangStr, acceptLangStr)
+	return tag
+}
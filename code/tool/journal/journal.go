@@ -0,0 +1,193 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	//move a file or directory from Src to Dest.
+	OP_RENAME = "RENAME"
+	//create the directory Dest.
+	OP_MKDIR = "MKDIR"
+)
+
+const (
+	TYPE_BEGIN  = "BEGIN"
+	TYPE_ACTION = "ACTION"
+	TYPE_END    = "END"
+)
+
+// a filesystem action which can be applied again or undone.
+type Action struct {
+	Op   string `json:"op"`
+	Src  string `json:"src,omitempty"`
+	Dest string `json:"dest"`
+}
+
+// a line of the journal file.
+type Entry struct {
+	Work   string  `json:"work"`
+	Type   string  `json:"type"`
+	Action *Action `json:"action,omitempty"`
+}
+
+// a write ahead log of the filesystem actions. every action is synced to disk before it is applied,
+// so that the unfinished works can be replayed or rolled back after a crash.
+type Journal struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	//works begun but not ended.
+	opening map[string]bool
+}
+
+func Open(path string) (*Journal, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{path: path, file: file, opening: make(map[string]bool)}, nil
+}
+
+func (this *Journal) Begin(work string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.opening[work] = true
+	return this.write(&Entry{Work: work, Type: TYPE_BEGIN})
+}
+
+// log the action before applying it.
+func (this *Journal) Log(work string, action *Action) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.write(&Entry{Work: work, Type: TYPE_ACTION, Action: action})
+}
+
+// the work is finished. the file is truncated when no work is opening.
+func (this *Journal) End(work string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	delete(this.opening, work)
+	if len(this.opening) == 0 {
+		return this.file.Truncate(0)
+	}
+	return this.write(&Entry{Work: work, Type: TYPE_END})
+}
+
+// the actions of the works not ended, in the order of the works begun.
+func (this *Journal) Pending() ([]string, map[string][]*Action, error) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	file, err := os.Open(this.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var works []string
+	actions := make(map[string][]*Action)
+	ended := make(map[string]bool)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry := &Entry{}
+		//a torn line at the tail is written by a crash, and its action has not been applied.
+		if json.Unmarshal(scanner.Bytes(), entry) != nil {
+			continue
+		}
+		switch entry.Type {
+		case TYPE_BEGIN:
+			works = append(works, entry.Work)
+		case TYPE_ACTION:
+			if entry.Action != nil {
+				actions[entry.Work] = append(actions[entry.Work], entry.Action)
+			}
+		case TYPE_END:
+			ended[entry.Work] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var pending []string
+	for _, work := range works {
+		if !ended[work] {
+			pending = append(pending, work)
+		}
+	}
+	return pending, actions, nil
+}
+
+// drop all the entries. only invoke when no work is opening.
+func (this *Journal) Reset() error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.opening = make(map[string]bool)
+	return this.file.Truncate(0)
+}
+
+func (this *Journal) Close() error {
+	return this.file.Close()
+}
+
+func (this *Journal) write(entry *Entry) error {
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = this.file.Write(append(bytes, '\n'))
+	if err != nil {
+		return err
+	}
+	return this.file.Sync()
+}
+
+// apply the action. an action already applied is skipped.
+func Apply(action *Action) error {
+	switch action.Op {
+	case OP_RENAME:
+		if !exists(action.Src) && exists(action.Dest) {
+			return nil
+		}
+		return os.Rename(action.Src, action.Dest)
+	case OP_MKDIR:
+		return os.MkdirAll(action.Dest, 0777)
+	}
+	return nil
+}
+
+// undo the action. an action not applied is skipped.
+func Undo(action *Action) error {
+	switch action.Op {
+	case OP_RENAME:
+		if exists(action.Src) || !exists(action.Dest) {
+			return nil
+		}
+		return os.Rename(action.Dest, action.Src)
+	case OP_MKDIR:
+		//only an empty directory is removed, the one with content is kept.
+		_ = os.Remove(action.Dest)
+		return nil
+	}
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
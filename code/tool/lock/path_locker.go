@@ -0,0 +1,256 @@
+package lock
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MODE_READ  = "READ"
+	MODE_WRITE = "WRITE"
+)
+
+var ErrTimeout = errors.New("timeout when waiting for the lock")
+var ErrExpired = errors.New("the lock has expired or been released")
+
+// a path to lock. paths in different scopes never conflict.
+type Request struct {
+	Scope string
+	Path  string
+	Mode  string
+}
+
+func Read(scope string, p string) Request {
+	return Request{Scope: scope, Path: CleanPath(p), Mode: MODE_READ}
+}
+
+func Write(scope string, p string) Request {
+	return Request{Scope: scope, Path: CleanPath(p), Mode: MODE_WRITE}
+}
+
+// a granted or waiting lock.
+type Lock struct {
+	Id          int64     `json:"id"`
+	Scope       string    `json:"scope"`
+	Path        string    `json:"path"`
+	Mode        string    `json:"mode"`
+	Owner       string    `json:"owner"`
+	Waiting     bool      `json:"waiting"`
+	AcquireTime time.Time `json:"acquireTime"`
+	ExpireTime  time.Time `json:"expireTime"`
+}
+
+// hierarchical read/write locks on paths. a lock on a path covers its subtree,
+// so two locks conflict when one path contains the other and either is a write lock.
+// a lock not released before its lease expires is dropped.
+type PathLocker struct {
+	mutex   sync.Mutex
+	nextId  int64
+	locks   map[int64]*Lock
+	waits   map[int64]*Lock
+	changed chan struct{}
+}
+
+func NewPathLocker() *PathLocker {
+	return &PathLocker{
+		locks:   make(map[int64]*Lock),
+		waits:   make(map[int64]*Lock),
+		changed: make(chan struct{}),
+	}
+}
+
+// "/a/b/" -> "/a/b", "/" -> "". "" is the root which contains all.
+func CleanPath(p string) string {
+	return strings.TrimSuffix(path.Clean("/"+p), "/")
+}
+
+// whether one path contains the other.
+func Overlap(a string, b string) bool {
+	return a == b || strings.HasPrefix(b, a+"/") || strings.HasPrefix(a, b+"/")
+}
+
+func (this *Lock) conflict(request Request) bool {
+	return this.Scope == request.Scope &&
+		(this.Mode == MODE_WRITE || request.Mode == MODE_WRITE) &&
+		Overlap(this.Path, request.Path)
+}
+
+// acquire all the requests at once, so that no deadlock happens between multi-path operations.
+// wait at most wait, and each granted lock expires after lease.
+func (this *PathLocker) Acquire(requests []Request, owner string, wait time.Duration, lease time.Duration) ([]*Lock, error) {
+
+	deadline := time.Now().Add(wait)
+
+	this.mutex.Lock()
+	waits := this.newLocks(requests, owner, true)
+	for _, lock := range waits {
+		this.waits[lock.Id] = lock
+	}
+	defer func() {
+		for _, lock := range waits {
+			delete(this.waits, lock.Id)
+		}
+		this.mutex.Unlock()
+	}()
+
+	for {
+		this.dropExpired()
+		conflict, expireTime := this.conflict(requests)
+		if !conflict {
+			break
+		}
+
+		remain := time.Until(deadline)
+		if remain <= 0 {
+			return nil, ErrTimeout
+		}
+		//the conflicting lock may expire earlier.
+		if untilExpire := time.Until(expireTime); untilExpire < remain {
+			remain = untilExpire
+		}
+
+		//wait until some lock changes or timeout.
+		changed := this.changed
+		this.mutex.Unlock()
+		timer := time.NewTimer(remain)
+		select {
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+		this.mutex.Lock()
+	}
+
+	locks := this.newLocks(requests, owner, false)
+	now := time.Now()
+	for _, lock := range locks {
+		lock.AcquireTime = now
+		lock.ExpireTime = now.Add(lease)
+		this.locks[lock.Id] = lock
+	}
+	return locks, nil
+}
+
+// release the locks. released or expired ones are ignored.
+func (this *PathLocker) Release(locks []*Lock) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, lock := range locks {
+		delete(this.locks, lock.Id)
+	}
+	this.notify()
+}
+
+// extend the leases of the locks from now. return ErrExpired if one of them is not held any more.
+func (this *PathLocker) Renew(locks []*Lock, lease time.Duration) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.dropExpired()
+
+	for _, lock := range locks {
+		if _, ok := this.locks[lock.Id]; !ok {
+			return ErrExpired
+		}
+	}
+	expireTime := time.Now().Add(lease)
+	for _, lock := range locks {
+		lock.ExpireTime = expireTime
+	}
+	return nil
+}
+
+// force release a lock by id. return false if not held.
+func (this *PathLocker) ReleaseById(id int64) bool {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if _, ok := this.locks[id]; !ok {
+		return false
+	}
+	delete(this.locks, id)
+	this.notify()
+	return true
+}
+
+// copies of the granted and waiting locks, ordered by id.
+func (this *PathLocker) List() []*Lock {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.dropExpired()
+
+	list := make([]*Lock, 0, len(this.locks)+len(this.waits))
+	for _, lock := range this.locks {
+		copied := *lock
+		list = append(list, &copied)
+	}
+	for _, lock := range this.waits {
+		copied := *lock
+		list = append(list, &copied)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Id < list[j].Id
+	})
+	return list
+}
+
+func (this *PathLocker) newLocks(requests []Request, owner string, waiting bool) []*Lock {
+	locks := make([]*Lock, 0, len(requests))
+	for _, request := range requests {
+		this.nextId++
+		locks = append(locks, &Lock{
+			Id:          this.nextId,
+			Scope:       request.Scope,
+			Path:        request.Path,
+			Mode:        request.Mode,
+			Owner:       owner,
+			Waiting:     waiting,
+			AcquireTime: time.Now(),
+		})
+	}
+	return locks
+}
+
+// whether the requests conflict with the granted locks. return the earliest expire time of the conflicting ones.
+func (this *PathLocker) conflict(requests []Request) (bool, time.Time) {
+	conflict := false
+	var expireTime time.Time
+	for _, lock := range this.locks {
+		for _, request := range requests {
+			if lock.conflict(request) {
+				if !conflict || lock.ExpireTime.Before(expireTime) {
+					expireTime = lock.ExpireTime
+				}
+				conflict = true
+				break
+			}
+		}
+	}
+	return conflict, expireTime
+}
+
+func (this *PathLocker) dropExpired() {
+	now := time.Now()
+	dropped := false
+	for id, lock := range this.locks {
+		if lock.ExpireTime.Before(now) {
+			delete(this.locks, id)
+			dropped = true
+		}
+	}
+	if dropped {
+		this.notify()
+	}
+}
+
+// wake up all the waiters.
+func (this *PathLocker) notify() {
+	close(this.changed)
+	this.changed = make(chan struct{})
+}
@@ -0,0 +1,138 @@
+package search
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	//only the head of a plain text file is indexed.
+	TEXT_MAX_SIZE = 1024 * 1024
+	//office files are read into memory, larger ones are not indexed.
+	OFFICE_MAX_SIZE = 16 * 1024 * 1024
+)
+
+var ErrNotExtractable = errors.New("text cannot be extracted")
+
+// get the lower case extension without ".". eg. "pdf"
+func Extension(filename string) string {
+	return strings.TrimPrefix(strings.ToLower(path.Ext(filename)), ".")
+}
+
+// whether the text of a file can be extracted.
+func Extractable(filename string, size int64) bool {
+	switch Extension(filename) {
+	case "txt", "md", "csv":
+		return true
+	case "docx", "xlsx":
+		return size <= OFFICE_MAX_SIZE
+	default:
+		return false
+	}
+}
+
+// extract the text of txt, md, csv, docx and xlsx. at most TEXT_MAX_SIZE bytes are returned.
+func ExtractText(filename string, reader io.Reader, size int64) (string, error) {
+
+	if !Extractable(filename, size) {
+		return "", ErrNotExtractable
+	}
+
+	switch Extension(filename) {
+	case "docx":
+		return extractOffice(reader, size, func(name string) bool {
+			return name == "word/document.xml"
+		})
+	case "xlsx":
+		return extractOffice(reader, size, func(name string) bool {
+			return name == "xl/sharedStrings.xml" || strings.HasPrefix(name, "xl/worksheets/sheet")
+		})
+	default:
+		content, err := ioutil.ReadAll(io.LimitReader(reader, TEXT_MAX_SIZE))
+		if err != nil {
+			return "", err
+		}
+		//the limit may cut a character.
+		return strings.ToValidUTF8(string(content), ""), nil
+	}
+}
+
+// docx and xlsx are zip of xml. texts are in <t> elements.
+func extractOffice(reader io.Reader, size int64, accept func(name string) bool) (string, error) {
+
+	content, err := ioutil.ReadAll(io.LimitReader(reader, size))
+	if err != nil {
+		return "", err
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", err
+	}
+
+	builder := &strings.Builder{}
+	for _, file := range zipReader.File {
+		if !accept(file.Name) {
+			continue
+		}
+		err = extractXmlText(file, builder)
+		if err != nil {
+			return "", err
+		}
+		if builder.Len() >= TEXT_MAX_SIZE {
+			break
+		}
+	}
+
+	text := builder.String()
+	if len(text) > TEXT_MAX_SIZE {
+		text = text[:TEXT_MAX_SIZE]
+		for !utf8.ValidString(text) {
+			text = text[:len(text)-1]
+		}
+	}
+	return text, nil
+}
+
+func extractXmlText(file *zip.File, builder *strings.Builder) error {
+
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	//a xml part never inflates without limit.
+	decoder := xml.NewDecoder(io.LimitReader(reader, OFFICE_MAX_SIZE))
+	inText := false
+	for builder.Len() < TEXT_MAX_SIZE {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			inText = element.Name.Local == "t"
+		case xml.EndElement:
+			inText = false
+			//paragraph of docx, shared string and cell of xlsx.
+			if element.Name.Local == "p" || element.Name.Local == "si" || element.Name.Local == "c" {
+				builder.WriteString(" ")
+			}
+		case xml.CharData:
+			if inText {
+				builder.Write(element)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	//longer words are truncated.
+	TERM_MAX_LENGTH = 64
+)
+
+// chinese, japanese and korean have no spaces between words.
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r)
+}
+
+// split a text into lower case terms. letters and digits make a word, CJK runs are split into bigrams
+// and the last character, so that both "报告" and "告" match "年度报告".
+func Tokenize(text string) []string {
+
+	var terms []string
+	var word []rune
+	var cjk []rune
+
+	flushWord := func() {
+		if len(word) > TERM_MAX_LENGTH {
+			word = word[:TERM_MAX_LENGTH]
+		}
+		if len(word) > 0 {
+			terms = append(terms, string(word))
+		}
+		word = word[:0]
+	}
+	flushCJK := func() {
+		for i := 0; i+1 < len(cjk); i++ {
+			terms = append(terms, string(cjk[i:i+2]))
+		}
+		if len(cjk) > 0 {
+			terms = append(terms, string(cjk[len(cjk)-1:]))
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		if isCJK(r) {
+			flushWord()
+			cjk = append(cjk, r)
+		} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			flushCJK()
+			word = append(word, r)
+		} else {
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+
+	return terms
+}
+
+// count the terms of a text. only the most frequent limit terms are kept. limit <= 0 means no limit.
+func CountTerms(text string, limit int) map[string]int {
+
+	counts := make(map[string]int)
+	for _, term := range Tokenize(text) {
+		counts[term]++
+	}
+	if limit <= 0 || len(counts) <= limit {
+		return counts
+	}
+
+	terms := make([]string, 0, len(counts))
+	for term := range counts {
+		terms = append(terms, term)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if counts[terms[i]] != counts[terms[j]] {
+			return counts[terms[i]] > counts[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+
+	kept := make(map[string]int, limit)
+	for _, term := range terms[:limit] {
+		kept[term] = counts[term]
+	}
+	return kept
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	//local file system
+	BACKEND_TYPE_LOCAL = "local"
+	//s3 compatible object storage. eg. aws s3, minio
+	BACKEND_TYPE_S3 = "s3"
+)
+
+// returned when the key not exist. same as os.ErrNotExist, so os.IsNotExist() works.
+var ErrNotExist = os.ErrNotExist
+
+// info of a file or a directory(common prefix) in the backend.
+type FileInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+// name of the file.
+func (this *FileInfo) Name() string {
+	key := strings.TrimSuffix(this.Key, "/")
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
+type ReadSeekCloser interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// where the file contents are stored. key is a relative path separated by "/". eg. blob-store/ab/cd/abcd...
+type StorageBackend interface {
+	//open a file to read.
+	Open(key string) (ReadSeekCloser, error)
+	//create or truncate a file to write. the content is saved when closed.
+	Create(key string) (io.WriteCloser, error)
+	//stat a file.
+	Stat(key string) (*FileInfo, error)
+	//rename a file.
+	Rename(srcKey string, destKey string) error
+	//remove a file.
+	Remove(key string) error
+	//list the files and directories directly under the prefix.
+	List(prefix string) ([]*FileInfo, error)
+}
+
+// backend configuration in tank.json
+type BackendConfig struct {
+	//local or s3
+	Type string
+	//********local configurations.********
+	//root directory. default is the matter path.
+	Root string
+	//********s3 configurations.********
+	//eg. http://127.0.0.1:9000 or https://s3.amazonaws.com
+	Endpoint string
+	//default is us-east-1
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	//key prefix in the bucket.
+	Prefix string
+	//use http://endpoint/bucket/key rather than http://bucket.endpoint/key. minio uses path style.
+	PathStyle bool
+}
+
+// create a backend by the config.
+func NewBackend(config *BackendConfig, defaultRoot string) (StorageBackend, error) {
+	switch config.Type {
+	case "", BACKEND_TYPE_LOCAL:
+		root := config.Root
+		if root == "" {
+			root = defaultRoot
+		}
+		return NewLocalBackend(root), nil
+	case BACKEND_TYPE_S3:
+		return NewS3Backend(config)
+	default:
+		return nil, fmt.Errorf("not supported backend type %s", config.Type)
+	}
+}
+
+// check the key is a clean relative path.
+func CheckKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid key %s", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == ".." || part == "." {
+			return fmt.Errorf("invalid key %s", key)
+		}
+	}
+	return nil
+}
+
+// put a local file to the backend. the local file is removed.
+func PutFile(backend StorageBackend, key string, filePath string) error {
+
+	//rename directly when possible.
+	if local, ok := backend.(*LocalBackend); ok {
+		return local.MoveIn(filePath, key)
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	//upload from the file directly rather than buffering it again.
+	if s3, ok := backend.(*S3Backend); ok {
+		fileInfo, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		err = s3.Upload(key, file, fileInfo.Size())
+		if err != nil {
+			return err
+		}
+	} else {
+		writer, err := backend.Create(key)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, file)
+		closeErr := writer.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	file.Close()
+	return os.Remove(filePath)
+}
+
+// whether the key exists.
+func Exists(backend StorageBackend, key string) (bool, error) {
+	_, err := backend.Stat(key)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// store files in a local directory.
+type LocalBackend struct {
+	Root string
+}
+
+func NewLocalBackend(root string) *LocalBackend {
+	return &LocalBackend{Root: root}
+}
+
+// absolute path of the key.
+func (this *LocalBackend) Path(key string) string {
+	return filepath.Join(this.Root, filepath.FromSlash(key))
+}
+
+func (this *LocalBackend) Open(key string) (ReadSeekCloser, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	return os.Open(this.Path(key))
+}
+
+func (this *LocalBackend) Create(key string) (io.WriteCloser, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	path := this.Path(key)
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+}
+
+func (this *LocalBackend) Stat(key string) (*FileInfo, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	fileInfo, err := os.Stat(this.Path(key))
+	if err != nil {
+		return nil, err
+	}
+	return &FileInfo{Key: key, Size: fileInfo.Size(), ModTime: fileInfo.ModTime(), IsDir: fileInfo.IsDir()}, nil
+}
+
+func (this *LocalBackend) Rename(srcKey string, destKey string) error {
+	if err := CheckKey(srcKey); err != nil {
+		return err
+	}
+	if err := CheckKey(destKey); err != nil {
+		return err
+	}
+	destPath := this.Path(destKey)
+	err := os.MkdirAll(filepath.Dir(destPath), 0777)
+	if err != nil {
+		return err
+	}
+	return os.Rename(this.Path(srcKey), destPath)
+}
+
+func (this *LocalBackend) Remove(key string) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	return os.Remove(this.Path(key))
+}
+
+func (this *LocalBackend) List(prefix string) ([]*FileInfo, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	dirPath := this.Root
+	if prefix != "" {
+		if err := CheckKey(prefix); err != nil {
+			return nil, err
+		}
+		dirPath = this.Path(prefix)
+		prefix = prefix + "/"
+	}
+
+	fileInfos, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*FileInfo
+	for _, fileInfo := range fileInfos {
+		list = append(list, &FileInfo{Key: prefix + fileInfo.Name(), Size: fileInfo.Size(), ModTime: fileInfo.ModTime(), IsDir: fileInfo.IsDir()})
+	}
+	return list, nil
+}
+
+// move a local file into the backend.
+func (this *LocalBackend) MoveIn(filePath string, key string) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	destPath := this.Path(key)
+	err := os.MkdirAll(filepath.Dir(destPath), 0777)
+	if err != nil {
+		return err
+	}
+	return os.Rename(filePath, destPath)
+}
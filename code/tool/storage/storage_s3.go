@@ -0,0 +1,694 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	S3_DEFAULT_REGION = "us-east-1"
+	//sha256 of empty payload.
+	S3_EMPTY_PAYLOAD_HASH = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	S3_UNSIGNED_PAYLOAD   = "UNSIGNED-PAYLOAD"
+	//objects larger than it are uploaded in parts. a single PUT is limited to 5GB, a part is at least 5MB.
+	S3_PART_SIZE = 16 * 1024 * 1024
+	//max parts of a multipart upload.
+	S3_MAX_PARTS = 10000
+)
+
+// store files in a s3 compatible object storage. requests are signed with AWS Signature Version 4.
+type S3Backend struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	prefix    string
+	pathStyle bool
+
+	Client *http.Client
+	//size of the parts in multipart upload. can be replaced in test.
+	PartSize int64
+	//current time. can be replaced in test.
+	Now func() time.Time
+}
+
+// no total timeout, a large object may take hours. but a dead connection fails soon.
+func newS3Client() *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   30 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			MaxIdleConnsPerHost:   16,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 60 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+	}
+}
+
+func NewS3Backend(config *BackendConfig) (*S3Backend, error) {
+	if config.Endpoint == "" {
+		return nil, errors.New("s3 endpoint is required")
+	}
+	if config.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(config.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("s3 endpoint %s must start with http:// or https://", config.Endpoint)
+	}
+
+	region := config.Region
+	if region == "" {
+		region = S3_DEFAULT_REGION
+	}
+
+	return &S3Backend{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    config.Bucket,
+		accessKey: config.AccessKey,
+		secretKey: config.SecretKey,
+		prefix:    strings.Trim(config.Prefix, "/"),
+		pathStyle: config.PathStyle,
+		Client:    newS3Client(),
+		PartSize:  S3_PART_SIZE,
+		Now:       time.Now,
+	}, nil
+}
+
+// key in the bucket.
+func (this *S3Backend) objectKey(key string) string {
+	if this.prefix == "" {
+		return key
+	}
+	if key == "" {
+		return this.prefix + "/"
+	}
+	return this.prefix + "/" + key
+}
+
+// url of an object. empty objectKey means the bucket.
+func (this *S3Backend) objectUrl(objectKey string, query url.Values) string {
+	host := this.endpoint.Host
+	path := strings.TrimSuffix(this.endpoint.Path, "/")
+	if this.pathStyle {
+		path = path + "/" + this.bucket + "/" + objectKey
+	} else {
+		host = this.bucket + "." + host
+		path = path + "/" + objectKey
+	}
+
+	rawUrl := this.endpoint.Scheme + "://" + host + S3UriEncode(path, false)
+	if len(query) > 0 {
+		rawUrl = rawUrl + "?" + s3CanonicalQuery(query)
+	}
+	return rawUrl
+}
+
+// uri encode by the rule of AWS Signature Version 4.
+func S3UriEncode(s string, encodeSlash bool) string {
+	var builder strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			builder.WriteByte(c)
+		} else {
+			builder.WriteString(fmt.Sprintf("%%%02X", c))
+		}
+	}
+	return builder.String()
+}
+
+func s3CanonicalQuery(query url.Values) string {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		values := query[key]
+		sort.Strings(values)
+		for _, value := range values {
+			pairs = append(pairs, S3UriEncode(key, true)+"="+S3UriEncode(value, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// sign the request with AWS Signature Version 4.
+func (this *S3Backend) Sign(request *http.Request, payloadHash string, now time.Time) {
+
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	request.Header.Set("x-amz-date", amzDate)
+	request.Header.Set("x-amz-content-sha256", payloadHash)
+
+	host := request.Host
+	if host == "" {
+		host = request.URL.Host
+	}
+
+	//headers to be signed.
+	headerMap := map[string]string{"host": host}
+	for name, values := range request.Header {
+		name = strings.ToLower(name)
+		if strings.HasPrefix(name, "x-amz-") || name == "range" || name == "content-type" || name == "content-md5" {
+			headerMap[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	var names []string
+	for name := range headerMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headerMap[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		s3CanonicalQuery(request.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := date + "/" + this.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	signingKey := hmacSha256([]byte("AWS4"+this.secretKey), date)
+	signingKey = hmacSha256(signingKey, this.region)
+	signingKey = hmacSha256(signingKey, "s3")
+	signingKey = hmacSha256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(signingKey, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", this.accessKey, scope, signedHeaders, signature))
+}
+
+// error response of s3.
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// send a signed request. non 2xx response is turned to error.
+func (this *S3Backend) do(method string, objectKey string, query url.Values, header http.Header, body io.Reader, contentLength int64) (*http.Response, error) {
+
+	request, err := http.NewRequest(method, this.objectUrl(objectKey, query), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+
+	payloadHash := S3_EMPTY_PAYLOAD_HASH
+	if body != nil {
+		request.ContentLength = contentLength
+		payloadHash = S3_UNSIGNED_PAYLOAD
+	}
+	this.Sign(request, payloadHash, this.Now())
+
+	response, err := this.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return response, nil
+	}
+
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNotFound {
+		return nil, &os.PathError{Op: method, Path: objectKey, Err: ErrNotExist}
+	}
+
+	content, _ := ioutil.ReadAll(io.LimitReader(response.Body, 64*1024))
+	s3Err := &s3Error{}
+	if xml.Unmarshal(content, s3Err) == nil && s3Err.Code != "" {
+		return nil, fmt.Errorf("s3 %s %s: %s %s", method, objectKey, s3Err.Code, s3Err.Message)
+	}
+	return nil, fmt.Errorf("s3 %s %s: status %d", method, objectKey, response.StatusCode)
+}
+
+func (this *S3Backend) Open(key string) (ReadSeekCloser, error) {
+	fileInfo, err := this.Stat(key)
+	if err != nil {
+		return nil, err
+	}
+	return &s3Reader{backend: this, objectKey: this.objectKey(key), size: fileInfo.Size}, nil
+}
+
+func (this *S3Backend) Create(key string) (io.WriteCloser, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	return &s3Writer{backend: this, objectKey: this.objectKey(key)}, nil
+}
+
+// upload size bytes from the reader. large objects are uploaded in parts.
+func (this *S3Backend) Upload(key string, reader io.Reader, size int64) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	objectKey := this.objectKey(key)
+
+	if size <= this.PartSize {
+		return this.putObject(objectKey, reader, size)
+	}
+
+	partSize := this.PartSize
+	if size > partSize*S3_MAX_PARTS {
+		partSize = (size + S3_MAX_PARTS - 1) / S3_MAX_PARTS
+	}
+
+	upload, err := this.createMultipartUpload(objectKey)
+	if err != nil {
+		return err
+	}
+	for offset := int64(0); offset < size; offset += partSize {
+		length := partSize
+		if size-offset < length {
+			length = size - offset
+		}
+		err = upload.uploadPart(io.LimitReader(reader, length), length)
+		if err != nil {
+			upload.abort()
+			return err
+		}
+	}
+	return upload.complete()
+}
+
+func (this *S3Backend) putObject(objectKey string, body io.Reader, size int64) error {
+	if size == 0 {
+		//zero length body should not be chunked.
+		body = http.NoBody
+	}
+	response, err := this.do(http.MethodPut, objectKey, nil, nil, body, size)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+type s3InitiateResult struct {
+	UploadId string
+}
+
+type s3CompletePart struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3CompleteRequest struct {
+	XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletePart `xml:"Part"`
+}
+
+// a multipart upload in progress.
+type s3MultipartUpload struct {
+	backend   *S3Backend
+	objectKey string
+	uploadId  string
+	parts     []s3CompletePart
+}
+
+func (this *S3Backend) createMultipartUpload(objectKey string) (*s3MultipartUpload, error) {
+	query := url.Values{}
+	query.Set("uploads", "")
+	response, err := this.do(http.MethodPost, objectKey, query, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	result := &s3InitiateResult{}
+	err = xml.NewDecoder(response.Body).Decode(result)
+	if err != nil {
+		return nil, err
+	}
+	if result.UploadId == "" {
+		return nil, fmt.Errorf("s3 create multipart upload %s: no UploadId", objectKey)
+	}
+	return &s3MultipartUpload{backend: this, objectKey: objectKey, uploadId: result.UploadId}, nil
+}
+
+func (this *s3MultipartUpload) uploadPart(body io.Reader, size int64) error {
+	partNumber := len(this.parts) + 1
+	query := url.Values{}
+	query.Set("partNumber", strconv.Itoa(partNumber))
+	query.Set("uploadId", this.uploadId)
+	response, err := this.backend.do(http.MethodPut, this.objectKey, query, nil, body, size)
+	if err != nil {
+		return err
+	}
+	response.Body.Close()
+
+	this.parts = append(this.parts, s3CompletePart{PartNumber: partNumber, ETag: response.Header.Get("ETag")})
+	return nil
+}
+
+func (this *s3MultipartUpload) complete() error {
+	content, err := xml.Marshal(&s3CompleteRequest{Parts: this.parts})
+	if err != nil {
+		this.abort()
+		return err
+	}
+	query := url.Values{}
+	query.Set("uploadId", this.uploadId)
+	response, err := this.backend.do(http.MethodPost, this.objectKey, query, nil, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		this.abort()
+		return err
+	}
+	defer response.Body.Close()
+
+	//complete may fail with 200 status.
+	content, err = ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	s3Err := &s3Error{}
+	if xml.Unmarshal(content, s3Err) == nil && s3Err.Code != "" {
+		this.abort()
+		return fmt.Errorf("s3 complete multipart upload %s: %s %s", this.objectKey, s3Err.Code, s3Err.Message)
+	}
+	return nil
+}
+
+// the uploaded parts are charged until aborted.
+func (this *s3MultipartUpload) abort() {
+	query := url.Values{}
+	query.Set("uploadId", this.uploadId)
+	response, err := this.backend.do(http.MethodDelete, this.objectKey, query, nil, nil, 0)
+	if err == nil {
+		response.Body.Close()
+	}
+}
+
+func (this *S3Backend) Stat(key string) (*FileInfo, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	response, err := this.do(http.MethodHead, this.objectKey(key), nil, nil, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+
+	size, err := strconv.ParseInt(response.Header.Get("Content-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("s3 HEAD %s: invalid Content-Length", key)
+	}
+	modTime, _ := http.ParseTime(response.Header.Get("Last-Modified"))
+
+	return &FileInfo{Key: key, Size: size, ModTime: modTime}, nil
+}
+
+// s3 has no rename. copy then delete.
+func (this *S3Backend) Rename(srcKey string, destKey string) error {
+	if err := CheckKey(srcKey); err != nil {
+		return err
+	}
+	if err := CheckKey(destKey); err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("x-amz-copy-source", S3UriEncode("/"+this.bucket+"/"+this.objectKey(srcKey), false))
+	response, err := this.do(http.MethodPut, this.objectKey(destKey), nil, header, nil, 0)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	//copy may fail with 200 status.
+	content, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	s3Err := &s3Error{}
+	if xml.Unmarshal(content, s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("s3 copy %s: %s %s", srcKey, s3Err.Code, s3Err.Message)
+	}
+
+	return this.Remove(srcKey)
+}
+
+func (this *S3Backend) Remove(key string) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	response, err := this.do(http.MethodDelete, this.objectKey(key), nil, nil, nil, 0)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key          string
+		Size         int64
+		LastModified time.Time
+	}
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (this *S3Backend) List(prefix string) ([]*FileInfo, error) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix != "" {
+		if err := CheckKey(prefix); err != nil {
+			return nil, err
+		}
+		prefix = prefix + "/"
+	}
+	objectPrefix := this.objectKey(prefix)
+	trimPrefix := this.objectKey("")
+
+	var list []*FileInfo
+	token := ""
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("delimiter", "/")
+		query.Set("prefix", objectPrefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		response, err := this.do(http.MethodGet, "", query, nil, nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		result := &s3ListResult{}
+		err = xml.NewDecoder(response.Body).Decode(result)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, content := range result.Contents {
+			list = append(list, &FileInfo{Key: strings.TrimPrefix(content.Key, trimPrefix), Size: content.Size, ModTime: content.LastModified})
+		}
+		for _, commonPrefix := range result.CommonPrefixes {
+			list = append(list, &FileInfo{Key: strings.TrimSuffix(strings.TrimPrefix(commonPrefix.Prefix, trimPrefix), "/"), IsDir: true})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	return list, nil
+}
+
+// read an object by range requests, so that it can seek.
+type s3Reader struct {
+	backend   *S3Backend
+	objectKey string
+	size      int64
+	offset    int64
+	body      io.ReadCloser
+}
+
+func (this *s3Reader) Read(p []byte) (int, error) {
+	if this.offset >= this.size {
+		return 0, io.EOF
+	}
+
+	if this.body == nil {
+		header := http.Header{}
+		header.Set("Range", fmt.Sprintf("bytes=%d-", this.offset))
+		response, err := this.backend.do(http.MethodGet, this.objectKey, nil, header, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		if response.StatusCode != http.StatusPartialContent && this.offset > 0 {
+			response.Body.Close()
+			return 0, fmt.Errorf("s3 GET %s: range not supported", this.objectKey)
+		}
+		this.body = response.Body
+	}
+
+	n, err := this.body.Read(p)
+	this.offset += int64(n)
+	if err == io.EOF {
+		this.body.Close()
+		this.body = nil
+		if this.offset < this.size {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+func (this *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	var target int64
+	switch whence {
+	case io.SeekStart:
+		target = offset
+	case io.SeekCurrent:
+		target = this.offset + offset
+	case io.SeekEnd:
+		target = this.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if target < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if target != this.offset && this.body != nil {
+		this.body.Close()
+		this.body = nil
+	}
+	this.offset = target
+	return target, nil
+}
+
+func (this *s3Reader) Close() error {
+	if this.body != nil {
+		err := this.body.Close()
+		this.body = nil
+		return err
+	}
+	return nil
+}
+
+// buffer a part in memory. the parts are uploaded when filled, so the size needn't be known in advance.
+// the object is limited to S3_MAX_PARTS parts.
+type s3Writer struct {
+	backend   *S3Backend
+	objectKey string
+	buffer    bytes.Buffer
+	upload    *s3MultipartUpload
+	err       error
+}
+
+func (this *s3Writer) Write(p []byte) (int, error) {
+	if this.err != nil {
+		return 0, this.err
+	}
+
+	written := 0
+	for len(p) > 0 {
+		//upload the full part only when more comes, so that a small object is put at once.
+		if int64(this.buffer.Len()) >= this.backend.PartSize {
+			if this.err = this.flush(); this.err != nil {
+				return written, this.err
+			}
+		}
+		n := int(this.backend.PartSize) - this.buffer.Len()
+		if n > len(p) {
+			n = len(p)
+		}
+		this.buffer.Write(p[:n])
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (this *s3Writer) flush() error {
+	if this.upload == nil {
+		upload, err := this.backend.createMultipartUpload(this.objectKey)
+		if err != nil {
+			return err
+		}
+		this.upload = upload
+	}
+	if len(this.upload.parts) >= S3_MAX_PARTS {
+		return fmt.Errorf("s3 upload %s: more than %d parts", this.objectKey, S3_MAX_PARTS)
+	}
+	size := int64(this.buffer.Len())
+	err := this.upload.uploadPart(bytes.NewReader(this.buffer.Bytes()), size)
+	this.buffer.Reset()
+	return err
+}
+
+func (this *s3Writer) Close() error {
+	if this.err != nil {
+		if this.upload != nil {
+			this.upload.abort()
+		}
+		return this.err
+	}
+
+	if this.upload == nil {
+		return this.backend.putObject(this.objectKey, bytes.NewReader(this.buffer.Bytes()), int64(this.buffer.Len()))
+	}
+
+	err := this.flush()
+	if err != nil {
+		this.upload.abort()
+		return err
+	}
+	return this.upload.complete()
+}
@@ -162,6 +162,24 @@ func DeleteEmptyDirRecursive(dirPath string) {
 	}
 }
 
+//delete the dir bottom up if it contains nothing but empty dirs. return whether it is deleted.
+func DeleteEmptyDirTree(dirPath string) bool {
+	dir, err := ioutil.ReadDir(dirPath)
+	if err != nil {
+		return false
+	}
+	empty := true
+	for _, info := range dir {
+		if !info.IsDir() || !DeleteEmptyDirTree(filepath.Join(dirPath, info.Name())) {
+			empty = false
+		}
+	}
+	if !empty {
+		return false
+	}
+	return os.Remove(dirPath) == nil
+}
+
 //get conf path.
 func GetConfPath() string {
 
@@ -262,3 +280,15 @@ func ReadDirNames(dirname string) ([]string, error) {
 
 	return names, nil
 }
+
+// whether the path is dir itself or under dir. both should be cleaned.
+func IsSubPath(path string, dir string) bool {
+	if path == dir {
+		return true
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -14,6 +14,11 @@ go run litmus_test_server.go
 and separately, from the downloaded litmus-xxx directory:
 
 make URL=http://localhost:9999/ check
+
+To run litmus against tank's DavService instead of the memory file system,
+put litmus on the PATH and run TestDavLitmus in code/test:
+
+LITMUS_TESTS="basic copymove props locks" go test -run TestDavLitmus ./code/test/
 */
 package main
 